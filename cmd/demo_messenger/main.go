@@ -1,12 +1,28 @@
 package main
 
 import (
-	"github.com/arkadyb/caply"
+	"context"
 	"github.com/arkadyb/demo_messenger/internal/messenger"
+	"github.com/arkadyb/demo_messenger/internal/pkg/audit"
+	"github.com/arkadyb/demo_messenger/internal/pkg/breaker"
 	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/idempotency"
+	"github.com/arkadyb/demo_messenger/internal/pkg/ipfilter"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/pacer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/quiethours"
+	"github.com/arkadyb/demo_messenger/internal/pkg/ratelimit"
+	"github.com/arkadyb/demo_messenger/internal/pkg/suppressions"
+	"github.com/arkadyb/demo_messenger/internal/pkg/templates"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/arkadyb/demo_messenger/internal/pkg/verifications"
 	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/arkadyb/demo_messenger/internal/verifier"
 	"github.com/gomodule/redigo/redis"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"net/http"
 	"os"
 	"os/signal"
@@ -26,13 +42,12 @@ var (
 func main() {
 	var (
 		cfg = server.InitConfig()
-		cp  *caply.Caply
 		err error
 	)
 
-	// Setup log format
-	if cfg.LogFormat == strings.ToLower("json") {
-		log.SetFormatter(&log.JSONFormatter{})
+	// Setup log format, every package logs with the same logger
+	if err := logging.Configure(cfg.LogFormat); err != nil {
+		log.Fatalln(err)
 	}
 
 	// Log version details
@@ -42,45 +57,205 @@ func main() {
 		"buildstamp": buildstamp,
 	}).Info("build information")
 
+	// trace requests through the buffer and provider calls
+	var tracer *tracing.Tracer
+	switch cfg.TracingExporter {
+	case "none":
+	case "stdout":
+		tracer = tracing.NewTracer(tracing.NewStdoutExporter(os.Stdout), tracing.Config{})
+	case "otlp":
+		tracer = tracing.NewTracer(tracing.NewOTLPExporter(cfg.TracingOTLPEndpoint, cfg.TracingServiceName, &http.Client{Timeout: 10 * time.Second}), tracing.Config{})
+	default:
+		log.Fatalf("unknown tracing exporter %s", cfg.TracingExporter)
+	}
+	tracing.SetTracer(tracer)
+
 	// workaround for demo purposes; docker starts postgres composer quite fast, but postgres itself is not ready to accept connections at the time
 	time.Sleep(5 * time.Second)
 	// init buffer store for queue of messages waiting to be delivered
-	buffer, err := buffer.NewPostgresBuffer(cfg.BufferDBConnectionString, cfg.BufferDBMaxConnections)
+	buffer, err := buffer.NewPostgresBuffer(cfg.BufferDBConnectionString, cfg.BufferDBMaxConnections, time.Duration(cfg.QueueStarvationTimeoutSeconds)*time.Second)
 	if err != nil {
 		log.Fatalln("failed to dial postgres:", err)
 	}
 
+	// report queue depth on metrics endpoint
+	prometheus.MustRegister(messenger.NewQueueCollector(buffer))
+
+	// init templates store, shares connections pool with buffer
+	templates := templates.NewPostgresStore(buffer.DB)
+
+	// load quiet hours rules, messages inside recipient's quiet hours are held in the buffer
+	quietHours, err := quiethours.Parse(cfg.QuietHours, strings.Split(cfg.QuietHoursBypassCategories, ","))
+	if err != nil {
+		log.Fatalln(errors.Wrap(err, "failed to parse quiet hours"))
+	}
+	defaultTimeZone, err := time.LoadLocation(cfg.QuietHoursDefaultTimeZone)
+	if err != nil {
+		log.Fatalln(errors.Wrap(err, "failed to load quiet hours default time zone"))
+	}
+
+	// pause sending while twilio keeps failing
+	twilioBreaker := messenger.NewProviderBreaker("twilio", breaker.Config{
+		FailureThreshold: cfg.ProviderBreakerFailureThreshold,
+		OpenTimeout:      time.Duration(cfg.ProviderBreakerOpenSeconds) * time.Second,
+	})
+
+	// pace outbound traffic by originator and twilio account
+	pacerLimits, err := pacer.ParseLimits(cfg.PacerLimits)
+	if err != nil {
+		log.Fatalln(errors.Wrap(err, "failed to parse pacer limits"))
+	}
+
 	// create twilio http client
-	httpclient := &http.Client{}
+	httpclient, err := utils.NewHTTPClient(utils.HTTPClientConfig{
+		Timeout:               time.Duration(cfg.HTTPClientTimeoutSeconds) * time.Second,
+		DialTimeout:           time.Duration(cfg.HTTPClientDialTimeoutSeconds) * time.Second,
+		TLSHandshakeTimeout:   time.Duration(cfg.HTTPClientTLSHandshakeTimeoutSeconds) * time.Second,
+		ResponseHeaderTimeout: time.Duration(cfg.HTTPClientResponseHeaderTimeoutSeconds) * time.Second,
+		IdleConnTimeout:       time.Duration(cfg.HTTPClientIdleConnTimeoutSeconds) * time.Second,
+		MaxIdleConns:          cfg.HTTPClientMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.HTTPClientMaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.HTTPClientMaxConnsPerHost,
+		ProxyURL:              cfg.HTTPClientProxyURL,
+	})
+	if err != nil {
+		log.Fatalln(errors.Wrap(err, "failed to setup http client"))
+	}
+
+	// recipients failed with permanent errors, or suppressed by admin, dont get messages
+	suppressionsStore := suppressions.NewPostgresStore(buffer.DB)
 
 	// init application
-	messenger := messenger.NewMessenger(messenger.SendSMSViaTwilio(cfg.TwilioSid, cfg.TwilioToken, httpclient), buffer)
-	messenger.Errors = make(chan error)
-	go func() {
-		for err := range messenger.Errors {
-			log.Error(err)
-		}
-	}()
+	messenger := messenger.NewMessenger(messenger.SendSMSViaTwilio(cfg.TwilioSid, cfg.TwilioToken, httpclient), buffer, templates, messenger.Config{
+		MaxSegments:     cfg.SMSMaxSegments,
+		AllowUCS2:       cfg.SMSAllowUCS2,
+		LocaleFallback:  strings.Split(cfg.TemplateLocaleFallback, ","),
+		QuietHours:      quietHours,
+		DefaultTimeZone: defaultTimeZone,
+		Breaker:         twilioBreaker,
+		MaxAttempts:     cfg.SendMaxAttempts,
+		RetryBackoff:    time.Duration(cfg.SendRetryBackoffSeconds) * time.Second,
+		Suppressions:    suppressionsStore,
+		Concurrency:     cfg.SendConcurrency,
+		SendTimeout:     time.Duration(cfg.SendTimeoutSeconds) * time.Second,
+		BatchTimeout:    time.Duration(cfg.SendBatchTimeoutSeconds) * time.Second,
+		Pacer:           pacer.New(pacerLimits),
+		PacerMaxWait:    time.Duration(cfg.PacerMaxWaitSeconds) * time.Second,
+		ProviderAccount: "twilio:" + cfg.TwilioSid,
+	})
+
+	// init one-time password verifier, sends codes through the messenger. Verification is disabled without the secret
+	var otp verifier.Application
+	if len(cfg.VerifySecret) > 0 {
+		otp = verifier.NewVerifier(messenger, verifications.NewPostgresStore(buffer.DB), verifier.Config{
+			CodeLength:    cfg.VerifyCodeLength,
+			CodeTTL:       time.Duration(cfg.VerifyCodeTTLSeconds) * time.Second,
+			MaxAttempts:   cfg.VerifyMaxAttempts,
+			LockoutPeriod: time.Duration(cfg.VerifyLockoutSeconds) * time.Second,
+			Secret:        cfg.VerifySecret,
+			Message:       cfg.VerifyMessage,
+		})
+	} else {
+		log.Warnln("verify secret is not set, one-time password verification is disabled")
+	}
 
-	// init redis db and rate-limiter
-	rateLimiterStore := caply.NewRedisStore(&redis.Pool{
+	// init redis db for rate-limiter
+	redisPool := &redis.Pool{
 		MaxIdle:     cfg.RedisMaxIdle,
 		MaxActive:   cfg.RedisMaxActive,
 		IdleTimeout: time.Duration(cfg.RedisIdleTimeoutSeconds) * time.Second,
 		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial("tcp", cfg.RedisHost, redis.DialPassword(cfg.RedisPwd))
-			if err != nil {
-				log.Fatalln("failed to dial redis:", err)
-			}
-			return c, err
+			// rate limiter falls back to failure policy while redis is unavailable, so dial failure is not fatal
+			return redis.Dial("tcp", cfg.RedisHost,
+				redis.DialPassword(cfg.RedisPwd),
+				redis.DialConnectTimeout(time.Duration(cfg.RedisTimeoutSeconds)*time.Second),
+				redis.DialReadTimeout(time.Duration(cfg.RedisTimeoutSeconds)*time.Second),
+			)
 		},
+	}
+
+	// init API keys and rate limit tiers of tenants
+	var tenantsStore tenants.Store
+	switch cfg.TenantsStore {
+	case "config":
+		if tenantsStore, err = tenants.NewStaticStore(cfg.APIKeys, cfg.RateLimitTiers); err != nil {
+			log.Fatalln(errors.Wrap(err, "failed to load tenants"))
+		}
+	case "postgres":
+		tenantsStore = tenants.NewCachedStore(tenants.NewPostgresStore(buffer.DB), time.Duration(cfg.TenantsCacheTTLSeconds)*time.Second)
+	default:
+		log.Fatalf("unknown tenants store %s", cfg.TenantsStore)
+	}
+
+	// rate limit with failure policy while redis is unavailable
+	failurePolicy, err := ratelimit.ParsePolicy(cfg.RateLimitFailurePolicy)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	rateLimitersStatus := server.NewRateLimiterStatus(time.Duration(cfg.RateLimitRetrySeconds) * time.Second)
+
+	// every tier gets own rate limiter, anonymous clients use default limits
+	rateLimiters := server.NewTierRateLimiters(tenantsStore, tenants.Tier{
+		MaxRequests:     cfg.RateLimitMaxRequests,
+		BulkMaxRequests: cfg.RateLimitBulkMaxRequests,
+	}, func(maxRequests int) (server.RateLimiter, error) {
+		period := time.Duration(cfg.RateLimitPerPeriodSeconds) * time.Second
+		rl, err := ratelimit.NewRedisLimiter(redisPool, maxRequests, period)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to setup rate limiter")
+		}
+		return ratelimit.NewFallbackLimiter(rl, maxRequests, period, failurePolicy, rateLimitersStatus)
 	})
-	cp, err = caply.NewCaply(cfg.RateLimitMaxRequests, time.Duration(cfg.RateLimitPerPeriodSeconds)*time.Second, rateLimiterStore)
+
+	// forwarding headers are only trusted when request comes from the proxy
+	trustedProxies, err := utils.ParseTrustedProxies(cfg.TrustedProxies, cfg.ForwardingHeader)
 	if err != nil {
-		log.Fatalln(errors.Wrap(err, "failed to setup rate limiter"))
+		log.Fatalln(err)
 	}
 
-	server := server.NewServer(cfg, messenger, cp)
+	// per-route allow and deny lists, reloaded on SIGHUP
+	ipFilter, err := ipfilter.NewReloadable(cfg.IPFilterRulesFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := ipFilter.Reload(); err != nil {
+				log.Error(errors.Wrap(err, "failed to reload ip filter rules, previous rules are kept"))
+				continue
+			}
+			log.Info("ip filter rules reloaded")
+		}
+	}()
+
+	// responses of send requests are kept for clients retrying them with the same Idempotency-Key
+	idempotencyKeys := idempotency.NewPostgresStore(buffer.DB, time.Duration(cfg.IdempotencyKeyTTLSeconds)*time.Second)
+	go func() {
+		for range time.Tick(time.Duration(cfg.IdempotencyCleanupSeconds) * time.Second) {
+			deleted, err := idempotencyKeys.DeleteExpired(context.Background())
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			log.Infof("%d expired idempotency keys deleted", deleted)
+		}
+	}()
+
+	// admin routes are served only when admin API keys are configured, every admin action changing state is audited
+	adminKeys, err := server.ParseAdminKeys(cfg.AdminAPIKeys)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	admin := &server.Admin{
+		Keys:         adminKeys,
+		Queue:        buffer,
+		Suppressions: suppressionsStore,
+		Audit:        audit.NewPostgresLog(buffer.DB),
+	}
+
+	server := server.NewServer(cfg, messenger, templates, otp, tenantsStore, rateLimiters, rateLimitersStatus, trustedProxies, ipFilter, idempotencyKeys, admin)
 	// start server
 	server.Start()
 
@@ -93,5 +268,12 @@ func main() {
 	messenger.Shutdown()
 	buffer.Close()
 	server.Stop()
+	if tracer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := tracer.Shutdown(ctx); err != nil {
+			log.Error(errors.Wrap(err, "failed to export remaining spans"))
+		}
+		cancel()
+	}
 	log.Fatalf("process killed with signal: %v", signal.String())
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+// pauseCommand pauses sending globally, of the originator or of the tenant
+func pauseCommand(ctx context.Context, api *apiClient, out *printer, args []string) error {
+	var reason string
+	fs := newFlagSet("pause", "[flags] global|originator|tenant [value]")
+	fs.StringVar(&reason, "reason", "", "Reason of the pause")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return errors.New("scope is required")
+	}
+
+	pause := &types.Pause{}
+	if err := api.do(ctx, "POST", "/v1/admin/pauses", nil, &types.PauseRequest{Scope: fs.Arg(0), Value: fs.Arg(1), Reason: reason}, pause); err != nil {
+		return err
+	}
+
+	return out.print(pause, func(w io.Writer) {
+		fmt.Fprintf(w, "sending paused for %s by %s at %s\n", pauseTarget(pause.Scope, pause.Value), pause.PausedBy, pause.CreatedAt.Format(time.RFC3339))
+	})
+}
+
+// resumeCommand resumes paused sending
+func resumeCommand(ctx context.Context, api *apiClient, out *printer, args []string) error {
+	fs := newFlagSet("resume", "global|originator|tenant [value]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return errors.New("scope is required")
+	}
+
+	if err := api.do(ctx, "POST", "/v1/admin/pauses/resume", nil, &types.ResumeRequest{Scope: fs.Arg(0), Value: fs.Arg(1)}, nil); err != nil {
+		return err
+	}
+
+	return out.print(nil, func(w io.Writer) {
+		fmt.Fprintf(w, "sending resumed for %s\n", pauseTarget(fs.Arg(0), fs.Arg(1)))
+	})
+}
+
+// pausesCommand lists pauses in effect
+func pausesCommand(ctx context.Context, api *apiClient, out *printer, args []string) error {
+	fs := newFlagSet("pauses", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	pauses := &types.Pauses{}
+	if err := api.do(ctx, "GET", "/v1/admin/pauses", nil, nil, pauses); err != nil {
+		return err
+	}
+
+	return out.print(pauses, func(w io.Writer) {
+		fmt.Fprintln(w, "SCOPE\tVALUE\tPAUSED BY\tCREATED\tREASON")
+		for _, pause := range pauses.Pauses {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pause.Scope, pause.Value, pause.PausedBy, pause.CreatedAt.Format(time.RFC3339), pause.Reason)
+		}
+	})
+}
+
+// cancelCommand removes message waiting in the queue
+func cancelCommand(ctx context.Context, api *apiClient, out *printer, args []string) error {
+	return messageActionCommand(ctx, api, out, "cancel", "cancelled", args)
+}
+
+// requeueCommand moves failed, dead-lettered, cancelled and still pending recipients of processed message back to the queue
+func requeueCommand(ctx context.Context, api *apiClient, out *printer, args []string) error {
+	return messageActionCommand(ctx, api, out, "requeue", "requeued", args)
+}
+
+func messageActionCommand(ctx context.Context, api *apiClient, out *printer, action, done string, args []string) error {
+	fs := newFlagSet(action, "message_id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("message ID is required")
+	}
+	messageID, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid message ID %s", fs.Arg(0))
+	}
+
+	result := &types.AdminActionResult{}
+	if err := api.do(ctx, "POST", fmt.Sprintf("/v1/admin/messages/%d/%s", messageID, action), nil, nil, result); err != nil {
+		return err
+	}
+
+	return out.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "%d recipients of message %d %s\n", result.Recipients, messageID, done)
+	})
+}
+
+// purgeCommand cancels every message of the originator waiting in the queue
+func purgeCommand(ctx context.Context, api *apiClient, out *printer, args []string) error {
+	fs := newFlagSet("purge", "originator")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("originator is required")
+	}
+
+	result := &types.AdminActionResult{}
+	if err := api.do(ctx, "POST", "/v1/admin/messages/purge", nil, &types.PurgeRequest{Originator: fs.Arg(0)}, result); err != nil {
+		return err
+	}
+
+	return out.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "%d recipients of %s cancelled\n", result.Recipients, fs.Arg(0))
+	})
+}
+
+// suppressCommand adds recipient to suppression list
+func suppressCommand(ctx context.Context, api *apiClient, out *printer, args []string) error {
+	fs := newFlagSet("suppress", "phone_number")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("phone number is required")
+	}
+
+	if err := api.do(ctx, "POST", "/v1/admin/suppressions", nil, &types.SuppressRequest{PhoneNumber: fs.Arg(0)}, nil); err != nil {
+		return err
+	}
+
+	return out.print(nil, func(w io.Writer) {
+		fmt.Fprintf(w, "%s suppressed\n", fs.Arg(0))
+	})
+}
+
+// pauseTarget names paused scope, i.e. "originator:acme"
+func pauseTarget(scope, value string) string {
+	if len(value) == 0 {
+		return scope
+	}
+	return scope + ":" + value
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/arkadyb/demo_messenger/pkg/client"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiClient calls messenger HTTP API with configured API key, messages are sent with Go client retrying failed requests
+type apiClient struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+	sender  *client.Client
+}
+
+// problemError is problem details of failed request
+type problemError struct {
+	*types.Problem
+}
+
+func (e *problemError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.Status, e.Title)
+	if len(e.Detail) > 0 {
+		msg += ": " + e.Detail
+	}
+	for _, fieldError := range e.Errors {
+		msg += fmt.Sprintf("; %s: %s", fieldError.Field, fieldError.Message)
+	}
+	return msg
+}
+
+// do sends body as json to the path and decodes json response into result, error response is returned as *problemError
+func (c *apiClient) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode request")
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := strings.TrimRight(c.baseURL, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(c.apiKey) > 0 {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to call %s %s", method, path)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		problem := &types.Problem{}
+		if err := json.NewDecoder(resp.Body).Decode(problem); err != nil || problem.Status == 0 {
+			return errors.Errorf("%s %s failed with status %d", method, path, resp.StatusCode)
+		}
+		return &problemError{Problem: problem}
+	}
+
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.Wrapf(err, "failed to decode response of %s %s", method, path)
+	}
+
+	return nil
+}
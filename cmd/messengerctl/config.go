@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/namsral/flag"
+)
+
+// Configuration holds all of the client's configuration keys
+type Configuration struct {
+	URL            string
+	APIKey         string
+	TimeoutSeconds int
+	Retries        int
+	Output         string
+}
+
+// InitConfig loads configuration from env variables
+func InitConfig() Configuration {
+	cfg := Configuration{}
+
+	flag.StringVar(&cfg.URL, "messenger_url", "http://localhost:8085", "Base URL of the messenger API")
+	flag.StringVar(&cfg.APIKey, "messenger_api_key", "", "API key sent with every request, admin commands need admin API key")
+	flag.IntVar(&cfg.TimeoutSeconds, "messenger_timeout", 30, "Period (seconds) single request can take")
+	flag.IntVar(&cfg.Retries, "messenger_retries", 3, "Number of times send request failed with network error, rate limit or server error is retried")
+	flag.StringVar(&cfg.Output, "messenger_output", "text", "Output format: can be 'text' or 'json'")
+
+	flag.Parse()
+
+	return cfg
+}
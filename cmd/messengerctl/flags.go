@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"sort"
+	"strings"
+)
+
+// newFlagSet creates flag set of the command. Command flags are read from command line only,
+// env variables configure global flags, so variables left from other commands cant change them
+func newFlagSet(name, arguments string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: messengerctl %s %s\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// variablesFlag collects repeated name=value template variables
+type variablesFlag map[string]string
+
+func (v variablesFlag) String() string {
+	pairs := make([]string, 0, len(v))
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v variablesFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i < 1 {
+		return errors.Errorf("variable %s must be name=value", value)
+	}
+	v[value[:i]] = value[i+1:]
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestVariablesFlag_Set(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    variablesFlag
+		wantErr bool
+	}{
+		{"Single variable", []string{"name=John"}, variablesFlag{"name": "John"}, false},
+		{"Repeated variables", []string{"name=John", "code=42"}, variablesFlag{"name": "John", "code": "42"}, false},
+		{"Value with equals sign", []string{"query=a=b"}, variablesFlag{"query": "a=b"}, false},
+		{"Empty value", []string{"name="}, variablesFlag{"name": ""}, false},
+		{"Last value wins", []string{"name=John", "name=Jane"}, variablesFlag{"name": "Jane"}, false},
+		{"No value", []string{"name"}, variablesFlag{}, true},
+		{"No name", []string{"=John"}, variablesFlag{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := variablesFlag{}
+			var err error
+			for _, value := range tt.values {
+				if err = got.Set(value); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("variablesFlag.Set() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewFlagSet_Env(t *testing.T) {
+	for name, value := range map[string]string{"MESSENGER_RECIPIENT": "+3712000000", "RECIPIENT": "+3712000000"} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	var recipient string
+	fs := newFlagSet("send", "[flags]")
+	fs.StringVar(&recipient, "recipient", "", "Phone number of the recipient")
+	if !assert.NoError(t, fs.Parse([]string{})) {
+		t.FailNow()
+	}
+	assert.Empty(t, recipient)
+}
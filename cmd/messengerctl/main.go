@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/pkg/client"
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// command of the client, run with arguments following its name
+type command struct {
+	name        string
+	description string
+	run         func(ctx context.Context, api *apiClient, out *printer, args []string) error
+}
+
+var commands = []*command{
+	{"send", "Enqueue sms given with flags, or messages of the file in bulk", sendCommand},
+	{"status", "List status of recipients of messages of the tenant, or of every tenant with -admin", statusCommand},
+	{"tail", "Print new messages as they are enqueued, without later status changes, until interrupted", tailCommand},
+	{"pause", "Pause sending globally, of the originator or of the tenant (admin)", pauseCommand},
+	{"resume", "Resume paused sending (admin)", resumeCommand},
+	{"pauses", "List pauses in effect (admin)", pausesCommand},
+	{"cancel", "Cancel message waiting in the queue (admin)", cancelCommand},
+	{"requeue", "Move failed recipients of processed message back to the queue (admin)", requeueCommand},
+	{"purge", "Cancel every message of the originator waiting in the queue (admin)", purgeCommand},
+	{"suppress", "Add recipient to suppression list (admin)", suppressCommand},
+}
+
+func main() {
+	flag.Usage = usage
+	cfg := InitConfig()
+
+	if cfg.Output != "text" && cfg.Output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format %s\n", cfg.Output)
+		os.Exit(2)
+	}
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	var cmd *command
+	for _, c := range commands {
+		if c.name == flag.Arg(0) {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %s\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	// interrupt cancels request in progress and stops tail
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	httpClient := &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second}
+	api := &apiClient{
+		baseURL: cfg.URL,
+		apiKey:  cfg.APIKey,
+		client:  httpClient,
+		sender:  client.NewClient(cfg.URL, client.Config{APIKey: cfg.APIKey, HTTPClient: httpClient, MaxRetries: cfg.Retries}),
+	}
+	out := &printer{w: os.Stdout, json: cfg.Output == "json"}
+
+	if err := cmd.run(ctx, api, out, flag.Args()[1:]); err != nil {
+		// problem details are written as json for scripts to read its code
+		if out.json {
+			switch cause := errors.Cause(err).(type) {
+			case *problemError:
+				json.NewEncoder(os.Stdout).Encode(cause.Problem)
+			case *client.Error:
+				if cause.Problem != nil {
+					json.NewEncoder(os.Stdout).Encode(cause.Problem)
+				}
+			}
+		}
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: messengerctl [flags] command [command flags] [arguments]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s%s\n", c.name, c.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nflags, also read from env variables named as flags in upper case:\n")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// maxPageSize is the largest page of messages admin API lists
+const maxPageSize = 1000
+
+// messageFilterFlags holds flags filtering listed messages
+type messageFilterFlags struct {
+	admin      bool
+	state      string
+	originator string
+	tenantID   string
+	recipient  string
+}
+
+func (f *messageFilterFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.admin, "admin", false, "List messages of every tenant with admin API key, only messages of the tenant of API key are listed otherwise")
+	fs.StringVar(&f.state, "state", "", "State of recipients: can be 'pending', 'scheduled', 'failed', 'dead_lettered' or 'cancelled'")
+	fs.StringVar(&f.originator, "originator", "", "Originator of messages")
+	fs.StringVar(&f.tenantID, "tenant_id", "", "Tenant messages were sent by, used with -admin")
+	fs.StringVar(&f.recipient, "recipient", "", "Phone number of the recipient")
+}
+
+// path returns route listing messages, tenant route lists messages of the tenant of API key
+func (f *messageFilterFlags) path() string {
+	if f.admin {
+		return "/v1/admin/messages"
+	}
+	return "/v1/messages"
+}
+
+func (f *messageFilterFlags) query() url.Values {
+	query := url.Values{}
+	for name, value := range map[string]string{"state": f.state, "originator": f.originator, "tenant_id": f.tenantID, "recipient": f.recipient} {
+		if len(value) > 0 {
+			query.Set(name, value)
+		}
+	}
+	return query
+}
+
+// statusCommand lists status of recipients of the messages matching filter
+func statusCommand(ctx context.Context, api *apiClient, out *printer, args []string) error {
+	var (
+		filter  messageFilterFlags
+		afterID int64
+		limit   int
+	)
+	fs := newFlagSet("status", "[flags]")
+	filter.register(fs)
+	fs.Int64Var(&afterID, "after_id", 0, "List messages after this ID, used to get the next page")
+	fs.IntVar(&limit, "limit", 100, "Number of messages listed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	query := filter.query()
+	query.Set("after_id", strconv.FormatInt(afterID, 10))
+	query.Set("limit", strconv.Itoa(limit))
+
+	page := &types.QueueMessages{}
+	if err := api.do(ctx, "GET", filter.path(), query, nil, page); err != nil {
+		return err
+	}
+
+	return out.print(page, func(w io.Writer) {
+		fmt.Fprintln(w, "MESSAGE\tRECIPIENT\tSTATUS\tATTEMPTS\tERROR\tORIGINATOR\tCREATED")
+		writeMessages(w, page.Messages)
+		if page.NextAfterID > 0 {
+			fmt.Fprintf(w, "next page: -after_id %d\n", page.NextAfterID)
+		}
+	})
+}
+
+// tailCommand polls API for messages enqueued after the last one seen and prints them until interrupted.
+// Message is printed once, with status of its recipients at the poll it was first seen, later status changes are not followed.
+func tailCommand(ctx context.Context, api *apiClient, out *printer, args []string) error {
+	var (
+		filter   messageFilterFlags
+		afterID  int64
+		interval time.Duration
+	)
+	fs := newFlagSet("tail", "[flags]")
+	filter.register(fs)
+	fs.Int64Var(&afterID, "after_id", -1, "Print messages after this ID, only messages enqueued from now on are printed when not set")
+	fs.DurationVar(&interval, "interval", 5*time.Second, "Period between polls")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// messages already in the queue are skipped to the last one
+	skip := afterID < 0
+	if skip {
+		afterID = 0
+	}
+
+	for {
+		query := filter.query()
+		query.Set("after_id", strconv.FormatInt(afterID, 10))
+		query.Set("limit", strconv.Itoa(maxPageSize))
+
+		page := &types.QueueMessages{}
+		if err := api.do(ctx, "GET", filter.path(), query, nil, page); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if !skip {
+			for _, message := range page.Messages {
+				if err := out.stream(message, func(w io.Writer) {
+					writeMessages(w, []*types.QueueMessage{message})
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		if len(page.Messages) > 0 {
+			afterID = page.Messages[len(page.Messages)-1].MessageID
+		}
+		if page.NextAfterID > 0 {
+			continue
+		}
+		skip = false
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// writeMessages writes line per recipient of the messages
+func writeMessages(w io.Writer, messages []*types.QueueMessage) {
+	for _, message := range messages {
+		for _, recipient := range message.Recipients {
+			errorCode := "-"
+			if recipient.ErrorCode != 0 {
+				errorCode = strconv.Itoa(recipient.ErrorCode)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n", message.MessageID, recipient.PhoneNumber, recipient.Status, recipient.Attempts, errorCode, message.Originator, message.CreatedAt.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTailCommand(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		wantPath     string
+		wantAfterIDs []string
+		wantPrinted  []int64
+	}{
+		{
+			"Messages after given ID",
+			[]string{"-after_id", "0", "-interval", "10ms", "-state", "failed"},
+			"/v1/messages",
+			[]string{"0", "2", "4", "5", "5", "6"},
+			[]int64{1, 2, 3, 4, 5, 6},
+		},
+		{
+			"Messages enqueued from now on",
+			[]string{"-interval", "10ms", "-state", "failed"},
+			"/v1/messages",
+			[]string{"0", "2", "4", "5", "5", "6"},
+			[]int64{6},
+		},
+		{
+			"Messages of every tenant",
+			[]string{"-admin", "-after_id", "4", "-interval", "10ms", "-state", "failed"},
+			"/v1/admin/messages",
+			[]string{"4", "5", "5", "6"},
+			[]int64{5, 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var (
+				mu       sync.Mutex
+				afterIDs []string
+				queue    = []int64{1, 2, 3, 4, 5}
+			)
+			// pages hold two messages, message 6 is enqueued after the first poll which found nothing new
+			api, srv := newTestAPI(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				assert.Equal(t, tt.wantPath, req.URL.Path)
+				assert.Equal(t, "failed", req.URL.Query().Get("state"))
+				afterID, _ := strconv.ParseInt(req.URL.Query().Get("after_id"), 10, 64)
+				afterIDs = append(afterIDs, req.URL.Query().Get("after_id"))
+
+				page := &types.QueueMessages{Messages: []*types.QueueMessage{}}
+				for _, messageID := range queue {
+					if messageID > afterID && len(page.Messages) < 2 {
+						page.Messages = append(page.Messages, &types.QueueMessage{MessageID: messageID, Recipients: []*types.QueueRecipient{{PhoneNumber: "1", Status: "failed"}}})
+					}
+				}
+				if len(page.Messages) == 2 {
+					page.NextAfterID = page.Messages[1].MessageID
+				}
+				switch {
+				case afterID == 5 && len(queue) == 5:
+					queue = append(queue, 6)
+				case afterID == 6:
+					cancel()
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(page)
+			}))
+			defer srv.Close()
+
+			out := &bytes.Buffer{}
+			done := make(chan error, 1)
+			go func() {
+				done <- tailCommand(ctx, api, &printer{w: out, json: true}, tt.args)
+			}()
+			select {
+			case err := <-done:
+				assert.NoError(t, err)
+			case <-time.After(3 * time.Second):
+				t.Fatal("tail did not stop")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.wantAfterIDs, afterIDs)
+
+			var printed []int64
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if len(line) == 0 {
+					continue
+				}
+				message := &types.QueueMessage{}
+				if !assert.NoError(t, json.Unmarshal([]byte(line), message)) {
+					t.FailNow()
+				}
+				printed = append(printed, message.MessageID)
+			}
+			assert.Equal(t, tt.wantPrinted, printed)
+		})
+	}
+}
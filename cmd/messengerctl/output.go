@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"text/tabwriter"
+)
+
+// printer writes results of commands as text tables, or as json for scripting
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes result as indented json, or as text written by table
+func (p *printer) print(result interface{}, table func(w io.Writer)) error {
+	return p.write(result, table, "  ")
+}
+
+// stream writes result as single line of json, or as text written by table, so streamed results are read line by line
+func (p *printer) stream(result interface{}, table func(w io.Writer)) error {
+	return p.write(result, table, "")
+}
+
+func (p *printer) write(result interface{}, table func(w io.Writer), indent string) error {
+	if p.json {
+		if result == nil {
+			return nil
+		}
+		encoder := json.NewEncoder(p.w)
+		encoder.SetIndent("", indent)
+		return errors.Wrap(encoder.Encode(result), "failed to write result")
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	table(tw)
+	return errors.Wrap(tw.Flush(), "failed to write result")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// sendCommand enqueues single sms given with flags, or messages of the file with bulk requests
+func sendCommand(ctx context.Context, api *apiClient, out *printer, args []string) error {
+	var (
+		sms       = &types.SMS{}
+		variables = variablesFlag{}
+		file      string
+		batchSize int
+		key       string
+	)
+	fs := newFlagSet("send", "[flags]")
+	fs.StringVar(&sms.Recipient, "recipient", "", "Phone number of the recipient")
+	fs.StringVar(&sms.Originator, "originator", "", "Originator of the message, also used for messages of the file without originator")
+	fs.StringVar(&sms.Message, "message", "", "Text of the message")
+	fs.StringVar(&sms.TemplateID, "template_id", "", "Template to render message text from")
+	fs.IntVar(&sms.TemplateVersion, "template_version", 0, "Version of the template, latest version is used when not set")
+	fs.Var(variables, "var", "Template variable as name=value, can be repeated")
+	fs.StringVar(&sms.Locale, "locale", "", "Locale of the template variant, inferred from recipient's country code when not set")
+	fs.StringVar(&sms.Priority, "priority", "", "Priority of delivery: can be 'low', 'normal' or 'high'")
+	fs.StringVar(&sms.Category, "category", "", "Category of the message quiet hours are applied for")
+	fs.StringVar(&sms.TimeZone, "timezone", "", "IANA time zone of the recipient")
+	fs.StringVar(&file, "file", "", "File with messages sent in bulk, either json array or one json message per line, '-' reads standard input")
+	fs.IntVar(&batchSize, "batch_size", 100, "Number of messages of the file sent with single bulk request")
+	fs.StringVar(&key, "idempotency_key", "", "Idempotency-Key making repeated command enqueue messages once, batches of the file get it suffixed with batch number")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(variables) > 0 {
+		sms.Variables = variables
+	}
+
+	if len(file) == 0 {
+		receipt, err := api.sender.SendSMS(ctx, sms, key)
+		if err != nil {
+			return err
+		}
+		return out.print(receipt, func(w io.Writer) {
+			fmt.Fprintf(w, "%s\t%s\n", sms.Recipient, receiptText(receipt))
+		})
+	}
+
+	if batchSize < 1 {
+		return errors.New("batch size must be positive")
+	}
+	messages, err := readMessages(file)
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		if len(message.Originator) == 0 {
+			message.Originator = sms.Originator
+		}
+	}
+
+	// results of sent batches are printed even when following batch fails
+	response := &types.BulkSMSResponse{Results: make([]*types.BulkSMSResult, 0, len(messages))}
+	for start := 0; start < len(messages) && err == nil; start += batchSize {
+		end := start + batchSize
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		batchKey := key
+		if len(key) > 0 {
+			batchKey = fmt.Sprintf("%s-%d", key, start/batchSize+1)
+		}
+		var batch *types.BulkSMSResponse
+		if batch, err = api.sender.SendBulkSMS(ctx, messages[start:end], batchKey); err != nil {
+			err = errors.Wrapf(err, "failed to send messages %d-%d of %s", start+1, end, file)
+			break
+		}
+		response.Results = append(response.Results, batch.Results...)
+	}
+
+	notEnqueued := 0
+	for _, result := range response.Results {
+		if result.Receipt == nil {
+			notEnqueued++
+		}
+	}
+	if printErr := out.print(response, func(w io.Writer) {
+		for i, result := range response.Results {
+			detail := result.Error
+			if result.Receipt != nil {
+				detail = receiptText(result.Receipt)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, messages[i].Recipient, result.Status, detail)
+		}
+	}); printErr != nil {
+		return printErr
+	}
+	if err != nil {
+		return err
+	}
+	if notEnqueued > 0 {
+		return errors.Errorf("%d of %d messages were not enqueued", notEnqueued, len(messages))
+	}
+
+	return nil
+}
+
+// readMessages reads messages of the file, either json array or one json message per line, "-" reads standard input
+func readMessages(path string) ([]*types.SMS, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open %s", path)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+	data = bytes.TrimSpace(data)
+
+	var messages []*types.SMS
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode messages of %s", path)
+		}
+		return messages, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		sms := &types.SMS{}
+		if err := decoder.Decode(sms); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode message %d of %s", len(messages)+1, path)
+		}
+		messages = append(messages, sms)
+	}
+
+	return messages, nil
+}
+
+// receiptText describes receipt of enqueued message
+func receiptText(receipt *types.SMSReceipt) string {
+	text := receipt.Status
+	if receipt.ScheduledAt != nil {
+		text += " until " + receipt.ScheduledAt.Format(time.RFC3339)
+	}
+	if len(receipt.TemplateID) > 0 {
+		text += fmt.Sprintf(" (template %s v%d %s)", receipt.TemplateID, receipt.TemplateVersion, receipt.TemplateLocale)
+	}
+	return text
+}
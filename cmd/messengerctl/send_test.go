@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/arkadyb/demo_messenger/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestAPI returns client of the API served by handler
+func newTestAPI(handler http.Handler) (*apiClient, *httptest.Server) {
+	srv := httptest.NewServer(handler)
+	return &apiClient{
+		baseURL: srv.URL,
+		client:  srv.Client(),
+		sender:  client.NewClient(srv.URL, client.Config{HTTPClient: srv.Client()}),
+	}, srv
+}
+
+// writeFile writes data into file of temporary directory and returns its path
+func writeFile(t *testing.T, data string) string {
+	dir, err := ioutil.TempDir("", "messengerctl")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	path := filepath.Join(dir, "messages.json")
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600)) {
+		t.FailNow()
+	}
+	return path
+}
+
+func TestReadMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		stdin   bool
+		want    []*types.SMS
+		wantErr bool
+	}{
+		{
+			"JSON array",
+			`[{"recipient": "1", "message": "Hi"}, {"recipient": "2", "originator": "Acme", "message": "Hello"}]`,
+			false,
+			[]*types.SMS{{Recipient: "1", Message: "Hi"}, {Recipient: "2", Originator: "Acme", Message: "Hello"}},
+			false,
+		},
+		{
+			"Message per line",
+			"{\"recipient\": \"1\", \"message\": \"Hi\"}\n\n{\"recipient\": \"2\", \"message\": \"Hello\"}\n",
+			false,
+			[]*types.SMS{{Recipient: "1", Message: "Hi"}, {Recipient: "2", Message: "Hello"}},
+			false,
+		},
+		{
+			"Standard input",
+			`  [{"recipient": "1", "message": "Hi"}]`,
+			true,
+			[]*types.SMS{{Recipient: "1", Message: "Hi"}},
+			false,
+		},
+		{
+			"Empty file",
+			"",
+			false,
+			nil,
+			false,
+		},
+		{
+			"Invalid array",
+			`[{"recipient": "1"`,
+			false,
+			nil,
+			true,
+		},
+		{
+			"Invalid line",
+			"{\"recipient\": \"1\"}\nrecipient=2\n",
+			false,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, tt.data)
+			defer os.RemoveAll(filepath.Dir(path))
+
+			if tt.stdin {
+				f, err := os.Open(path)
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				defer f.Close()
+
+				stdin := os.Stdin
+				os.Stdin = f
+				defer func() { os.Stdin = stdin }()
+				path = "-"
+			}
+
+			got, err := readMessages(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readMessages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := readMessages(filepath.Join(os.TempDir(), "messengerctl-missing.json"))
+		assert.Error(t, err)
+	})
+}
+
+func TestSendCommand_Bulk(t *testing.T) {
+	const file = `{"recipient": "1", "message": "Hi"}
+{"recipient": "2", "message": "Hi"}
+{"recipient": "bad", "message": "Hi"}
+{"recipient": "4", "originator": "Other", "message": "Hi"}
+{"recipient": "5", "message": "Hi"}`
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantKeys  []string
+		wantSizes []int
+		wantLines [][]string
+		wantErr   string
+	}{
+		{
+			"Batches",
+			[]string{"-originator", "Acme", "-batch_size", "2", "-idempotency_key", "import"},
+			[]string{"import-1", "import-2", "import-3"},
+			[]int{2, 2, 1},
+			[][]string{
+				{"1", "1", "accepted"},
+				{"2", "2", "accepted"},
+				{"3", "bad", "rejected"},
+				{"4", "4", "accepted"},
+				{"5", "5", "accepted"},
+			},
+			"1 of 5 messages were not enqueued",
+		},
+		{
+			"Single batch",
+			[]string{"-originator", "Acme"},
+			nil,
+			[]int{5},
+			[][]string{
+				{"1", "1", "accepted"},
+				{"2", "2", "accepted"},
+				{"3", "bad", "rejected"},
+				{"4", "4", "accepted"},
+				{"5", "5", "accepted"},
+			},
+			"1 of 5 messages were not enqueued",
+		},
+		{
+			"Invalid batch size",
+			[]string{"-batch_size", "0"},
+			nil,
+			nil,
+			nil,
+			"batch size must be positive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu    sync.Mutex
+				keys  []string
+				sizes []int
+			)
+			api, srv := newTestAPI(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				bulk := &types.BulkSMSRequest{}
+				if !assert.Equal(t, "/v1/send/sms/bulk", req.URL.Path) || !assert.NoError(t, json.NewDecoder(req.Body).Decode(bulk)) {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				mu.Lock()
+				keys = append(keys, req.Header.Get("Idempotency-Key"))
+				sizes = append(sizes, len(bulk.Messages))
+				mu.Unlock()
+
+				response := &types.BulkSMSResponse{}
+				for _, sms := range bulk.Messages {
+					if sms.Recipient == "bad" {
+						response.Results = append(response.Results, &types.BulkSMSResult{Status: "rejected", Error: "invalid recipient", Code: types.ErrorCodeValidationFailed})
+						continue
+					}
+					assert.NotEmpty(t, sms.Originator)
+					response.Results = append(response.Results, &types.BulkSMSResult{Status: "accepted", Receipt: &types.SMSReceipt{Status: "accepted"}})
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusMultiStatus)
+				json.NewEncoder(w).Encode(response)
+			}))
+			defer srv.Close()
+
+			path := writeFile(t, file)
+			defer os.RemoveAll(filepath.Dir(path))
+
+			out := &bytes.Buffer{}
+			err := sendCommand(context.Background(), api, &printer{w: out}, append(tt.args, "-file", path))
+			if !assert.Error(t, err) {
+				t.FailNow()
+			}
+			assert.Contains(t, err.Error(), tt.wantErr)
+
+			mu.Lock()
+			defer mu.Unlock()
+			// batches of the file without idempotency key get random keys
+			if tt.wantKeys != nil {
+				assert.Equal(t, tt.wantKeys, keys)
+			}
+			assert.Equal(t, tt.wantSizes, sizes)
+
+			var lines [][]string
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if fields := strings.Fields(line); len(fields) >= 3 {
+					lines = append(lines, fields[:3])
+				}
+			}
+			assert.Equal(t, tt.wantLines, lines)
+		})
+	}
+}
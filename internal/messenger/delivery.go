@@ -0,0 +1,286 @@
+package messenger
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// errNotDispatched marks recipients left out of the batch because provider became unavailable or pacer limit was reached,
+// and recipients which provider calls were cancelled by shutdown
+var errNotDispatched = errors.New("recipient was not dispatched")
+
+// deliver sends message to every recipient with bounded concurrency and records delivery outcome of each of them.
+// Failed recipient does not affect the rest of the batch, recipients left out because of open circuit,
+// batch timeout or shutdown are requeued. Outcomes are recorded with ctx, which is not bound to batch deadline.
+func (a *Messenger) deliver(ctx context.Context, sendNotification SendNotificationFunc, msg *buffer.Message, recipients []*buffer.Recipient) error {
+	batchSizeHistogram.Observe(float64(len(recipients)))
+	results, resumeAt := a.dispatch(ctx, msg, recipients, sendNotification)
+
+	var (
+		retries  = map[int][]*buffer.Recipient{}
+		skipped  []*buffer.Recipient
+		firstErr error
+		failures int
+	)
+	for i, recipient := range recipients {
+		sendErr := results[i]
+		if sendErr == errNotDispatched {
+			skipped = append(skipped, recipient)
+			continue
+		}
+
+		retry, err := a.recordResult(ctx, msg, recipient, sendErr)
+		if err != nil {
+			return errors.Wrapf(err, "failed to record delivery of message %d", msg.MessageID)
+		}
+		if retry {
+			if classify(sendErr).Class == Fatal {
+				// circuit is open already, recipient goes back to the queue as is
+				skipped = append(skipped, recipient)
+			} else {
+				retries[recipient.Attempts] = append(retries[recipient.Attempts], recipient)
+			}
+		}
+		if sendErr != nil {
+			if firstErr == nil {
+				firstErr = sendErr
+			}
+			failures++
+		}
+	}
+
+	// retried recipients are grouped by attempts made, so every group shares the backoff,
+	// retry falling inside quiet hours of the recipients is held till they end
+	for attempts, group := range retries {
+		retryAt := time.Now().Add(a.retryBackoff(attempts))
+		if releaseAt := a.releaseTime(ctx, msg, retryAt); releaseAt != nil {
+			retryAt = *releaseAt
+		}
+		if err := a.buffer.RequeueRecipients(ctx, msg, group, &retryAt); err != nil {
+			return errors.Wrapf(err, "failed to requeue recipients of message %d", msg.MessageID)
+		}
+	}
+	if len(skipped) > 0 {
+		resumeFrom := time.Now()
+		if resumeAt != nil {
+			resumeFrom = *resumeAt
+		}
+		if releaseAt := a.releaseTime(ctx, msg, resumeFrom); releaseAt != nil {
+			resumeAt = releaseAt
+		}
+		if err := a.buffer.RequeueRecipients(ctx, msg, skipped, resumeAt); err != nil {
+			return errors.Wrapf(err, "failed to requeue recipients of message %d", msg.MessageID)
+		}
+	}
+
+	if firstErr != nil {
+		return errors.Wrapf(firstErr, "failed to deliver message %d to %d of %d recipients", msg.MessageID, failures, len(recipients))
+	}
+
+	return nil
+}
+
+// dispatch calls provider for every recipient using up to Concurrency parallel calls and returns error of each call.
+// Dispatching stops once circuit breaker opens, batch times out or messenger shuts down. When pacer holds sending
+// longer than PacerMaxWait dispatching stops as well, and time sending can be resumed at is returned.
+// Calls are traced as children of the request recipient was enqueued with and linked to the batch span of ctx,
+// they are logged with logger of ctx. ctx is not used for cancellation.
+func (a *Messenger) dispatch(ctx context.Context, msg *buffer.Message, recipients []*buffer.Recipient, sendNotification SendNotificationFunc) ([]error, *time.Time) {
+	parentCtx := logging.WithLogger(a.ctx, logging.FromContext(ctx))
+	batchSpan, traced := tracing.SpanContextFromContext(ctx)
+	if traced {
+		parentCtx = tracing.ContextWithRemoteParent(parentCtx, batchSpan)
+	}
+
+	batchCtx, cancel := parentCtx, context.CancelFunc(func() {})
+	if a.cfg.BatchTimeout > 0 {
+		batchCtx, cancel = context.WithTimeout(parentCtx, a.cfg.BatchTimeout)
+	}
+	defer cancel()
+
+	concurrency := a.cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		results   = make([]error, len(recipients))
+		resumeAt  *time.Time
+		semaphore = make(chan struct{}, concurrency)
+		wg        sync.WaitGroup
+	)
+	for i, recipient := range recipients {
+		semaphore <- struct{}{}
+
+		stop := batchCtx.Err() != nil || (a.cfg.Breaker != nil && !a.cfg.Breaker.Allow())
+		if !stop {
+			var err error
+			resumeAt, err = a.pace(batchCtx, msg)
+			stop = err != nil || resumeAt != nil
+		}
+		if stop {
+			<-semaphore
+			for j := i; j < len(recipients); j++ {
+				results[j] = errNotDispatched
+			}
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, recipient *buffer.Recipient) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			sendCtx, cancel := batchCtx, context.CancelFunc(func() {})
+			if a.cfg.SendTimeout > 0 {
+				sendCtx, cancel = context.WithTimeout(batchCtx, a.cfg.SendTimeout)
+			}
+			defer cancel()
+
+			var links []tracing.SpanContext
+			if sc, ok := tracing.ParseTraceparent(recipient.TraceParent); ok {
+				sendCtx = tracing.ContextWithRemoteParent(sendCtx, sc)
+				if traced {
+					links = append(links, batchSpan)
+				}
+			}
+			sendCtx, span := tracing.StartSpan(sendCtx, "messenger.send", tracing.KindConsumer, links...)
+			span.SetAttribute("messaging.message_id", msg.MessageID)
+			span.SetAttribute("messaging.attempt", recipient.Attempts+1)
+
+			err := sendNotification(sendCtx, msg, recipient)
+			span.Finish(err)
+			if err != nil && a.ctx.Err() != nil {
+				// call was cancelled by shutdown, it counts neither as attempt of the recipient nor against the provider
+				results[i] = errNotDispatched
+				return
+			}
+			results[i] = err
+			a.recordBreaker(err)
+		}(i, recipient)
+	}
+	wg.Wait()
+
+	return results, resumeAt
+}
+
+// pace waits for pacer tokens of message originator and provider account.
+// Waiting longer than PacerMaxWait is not done, time sending can be resumed at is returned instead.
+func (a *Messenger) pace(ctx context.Context, msg *buffer.Message) (*time.Time, error) {
+	if a.cfg.Pacer == nil {
+		return nil, nil
+	}
+
+	keys := []string{"originator:" + msg.Originator}
+	if len(a.cfg.ProviderAccount) > 0 {
+		keys = append(keys, "account:"+a.cfg.ProviderAccount)
+	}
+
+	for {
+		wait := a.cfg.Pacer.Reserve(keys...)
+		if wait == 0 {
+			return nil, nil
+		}
+		if wait > a.cfg.PacerMaxWait {
+			pacerWaitsCounter.WithLabelValues("deferred").Inc()
+			resumeAt := time.Now().Add(wait)
+			return &resumeAt, nil
+		}
+
+		pacerWaitsCounter.WithLabelValues("waited").Inc()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// recordBreaker reports provider call outcome to the circuit breaker, only provider failures count against it
+func (a *Messenger) recordBreaker(sendErr error) {
+	if a.cfg.Breaker == nil {
+		return
+	}
+	if sendErr == nil {
+		a.cfg.Breaker.Success()
+		return
+	}
+
+	switch classify(sendErr).Class {
+	case Permanent, Rejected:
+		// provider is healthy, only the recipient or the message cant be sent
+		a.cfg.Breaker.Success()
+	case Fatal:
+		a.cfg.Breaker.Trip()
+	default:
+		a.cfg.Breaker.Failure()
+	}
+}
+
+// recordResult stores delivery outcome of the recipient and tells whether recipient should be retried
+func (a *Messenger) recordResult(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient, sendErr error) (bool, error) {
+	if sendErr == nil {
+		enqueueToSendHistogram.WithLabelValues(buffer.PriorityName(msg.Priority)).Observe(time.Since(msg.CreatedAt).Seconds())
+		recipient.Status = buffer.RecipientSent
+		recipient.ErrorCode = 0
+		recipient.Attempts++
+		return false, a.buffer.UpdateRecipientStatus(ctx, recipient)
+	}
+
+	perr := classify(sendErr)
+	switch perr.Class {
+	case Permanent, Rejected:
+		recipient.Status = buffer.RecipientFailed
+		recipient.ErrorCode = perr.Code
+		recipient.Attempts++
+		if err := a.buffer.UpdateRecipientStatus(ctx, recipient); err != nil {
+			return false, err
+		}
+		if perr.Class == Permanent && a.cfg.Suppressions != nil {
+			if err := a.cfg.Suppressions.Suppress(ctx, recipient.PhoneNumber, perr.Code); err != nil {
+				return false, errors.Wrapf(err, "failed to suppress recipient %s", recipient.PhoneNumber)
+			}
+		}
+		return false, nil
+	case Fatal:
+		// nothing can be sent until operator fixes the account, recipient is retried without counting the attempt
+		logging.FromContext(ctx).Errorf("fatal %s error, sending requires attention: %s", perr.Provider, perr.Message)
+		recipient.Status = buffer.RecipientPending
+		recipient.ErrorCode = perr.Code
+		return true, a.buffer.UpdateRecipientStatus(ctx, recipient)
+	}
+
+	recipient.ErrorCode = perr.Code
+	recipient.Attempts++
+	if a.cfg.MaxAttempts > 0 && recipient.Attempts >= a.cfg.MaxAttempts {
+		recipient.Status = buffer.RecipientDeadLettered
+		return false, a.buffer.UpdateRecipientStatus(ctx, recipient)
+	}
+
+	recipient.Status = buffer.RecipientPending
+	return true, a.buffer.UpdateRecipientStatus(ctx, recipient)
+}
+
+// classify returns provider error of the failed call, unclassified errors are treated as transient
+func classify(sendErr error) *ProviderError {
+	if perr, ok := errors.Cause(sendErr).(*ProviderError); ok {
+		return perr
+	}
+	return &ProviderError{Provider: "unknown", Class: Transient, Message: sendErr.Error()}
+}
+
+// retryBackoff returns delay before next delivery attempt, it doubles with every attempt made
+func (a *Messenger) retryBackoff(attempts int) time.Duration {
+	backoff := a.cfg.RetryBackoff
+	for i := 1; i < attempts && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+	return backoff
+}
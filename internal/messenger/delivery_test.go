@@ -0,0 +1,507 @@
+package messenger_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/messenger"
+	"github.com/arkadyb/demo_messenger/internal/pkg/breaker"
+	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/pacer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/quiethours"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errUnexpected = errors.New("unexpected error")
+
+func TestMessenger_Delivery(t *testing.T) {
+	message := &buffer.Message{
+		MessageID:  1,
+		Originator: "originator",
+		Text:       "text",
+		CreatedAt:  time.Now(),
+	}
+
+	recipientStatus := func(phoneNumber, status string, errorCode, attempts int) interface{} {
+		return mock.MatchedBy(func(r *buffer.Recipient) bool {
+			return r.PhoneNumber == phoneNumber && r.Status == status && r.ErrorCode == errorCode && r.Attempts == attempts
+		})
+	}
+	requeued := func(phoneNumbers ...string) interface{} {
+		return mock.MatchedBy(func(recipients []*buffer.Recipient) bool {
+			if len(recipients) != len(phoneNumbers) {
+				return false
+			}
+			for i := range recipients {
+				if recipients[i].PhoneNumber != phoneNumbers[i] {
+					return false
+				}
+			}
+			return true
+		})
+	}
+
+	tests := []struct {
+		name         string
+		errs         map[string]error
+		attempts     int
+		buffer       func(*MockedBuffer)
+		suppressions func(*MockedSuppressions)
+		wantErr      error
+		wantState    breaker.State
+	}{
+		{
+			"Permanent error",
+			map[string]error{"2": &messenger.ProviderError{Provider: "twilio", PhoneNumber: "2", Class: messenger.Permanent, StatusCode: 400, Code: 21211}},
+			0,
+			func(buff *MockedBuffer) {
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("1", buffer.RecipientSent, 0, 1)).Return(nil).Once()
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("2", buffer.RecipientFailed, 21211, 1)).Return(nil).Once()
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("3", buffer.RecipientSent, 0, 1)).Return(nil).Once()
+			},
+			func(store *MockedSuppressions) {
+				store.On("Suppress", mock.Anything, "2", 21211).Return(nil).Once()
+			},
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "2", Class: messenger.Permanent, StatusCode: 400, Code: 21211},
+			breaker.Closed,
+		},
+		{
+			"Rejected error does not suppress",
+			map[string]error{"2": &messenger.ProviderError{Provider: "twilio", PhoneNumber: "2", Class: messenger.Rejected, StatusCode: 400, Code: 21617}},
+			0,
+			func(buff *MockedBuffer) {
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("1", buffer.RecipientSent, 0, 1)).Return(nil).Once()
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("2", buffer.RecipientFailed, 21617, 1)).Return(nil).Once()
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("3", buffer.RecipientSent, 0, 1)).Return(nil).Once()
+			},
+			func(store *MockedSuppressions) {},
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "2", Class: messenger.Rejected, StatusCode: 400, Code: 21617},
+			breaker.Closed,
+		},
+		{
+			"Transient error",
+			map[string]error{"2": &messenger.ProviderError{Provider: "twilio", PhoneNumber: "2", Class: messenger.Transient, StatusCode: 429, Code: 20429}},
+			0,
+			func(buff *MockedBuffer) {
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("1", buffer.RecipientSent, 0, 1)).Return(nil).Once()
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("2", buffer.RecipientPending, 20429, 1)).Return(nil).Once()
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("3", buffer.RecipientSent, 0, 1)).Return(nil).Once()
+				buff.On("RequeueRecipients", mock.Anything, message, requeued("2"), mock.MatchedBy(func(sendAfter *time.Time) bool {
+					return sendAfter != nil && sendAfter.After(time.Now())
+				})).Return(nil).Once()
+			},
+			func(store *MockedSuppressions) {},
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "2", Class: messenger.Transient, StatusCode: 429, Code: 20429},
+			breaker.Closed,
+		},
+		{
+			"Transient error out of attempts",
+			map[string]error{"2": &messenger.ProviderError{Provider: "twilio", PhoneNumber: "2", Class: messenger.Transient, StatusCode: 503}},
+			2,
+			func(buff *MockedBuffer) {
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("1", buffer.RecipientSent, 0, 3)).Return(nil).Once()
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("2", buffer.RecipientDeadLettered, 0, 3)).Return(nil).Once()
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("3", buffer.RecipientSent, 0, 3)).Return(nil).Once()
+			},
+			func(store *MockedSuppressions) {},
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "2", Class: messenger.Transient, StatusCode: 503},
+			breaker.Closed,
+		},
+		{
+			"Unclassified error",
+			map[string]error{"1": errUnexpected},
+			0,
+			func(buff *MockedBuffer) {
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("1", buffer.RecipientPending, 0, 1)).Return(nil).Once()
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("2", buffer.RecipientSent, 0, 1)).Return(nil).Once()
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("3", buffer.RecipientSent, 0, 1)).Return(nil).Once()
+				buff.On("RequeueRecipients", mock.Anything, message, requeued("1"), mock.Anything).Return(nil).Once()
+			},
+			func(store *MockedSuppressions) {},
+			errUnexpected,
+			breaker.Closed,
+		},
+		{
+			"Fatal error stops the batch",
+			map[string]error{"1": &messenger.ProviderError{Provider: "twilio", PhoneNumber: "1", Class: messenger.Fatal, StatusCode: 401, Code: 20003}},
+			0,
+			func(buff *MockedBuffer) {
+				buff.On("UpdateRecipientStatus", mock.Anything, recipientStatus("1", buffer.RecipientPending, 20003, 0)).Return(nil).Once()
+				buff.On("RequeueRecipients", mock.Anything, message, requeued("1", "2", "3"), (*time.Time)(nil)).Return(nil).Once()
+			},
+			func(store *MockedSuppressions) {},
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "1", Class: messenger.Fatal, StatusCode: 401, Code: 20003},
+			breaker.Open,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buff := &MockedBuffer{}
+			buff.On("PopNextMessage", mock.Anything).Return(message, nil).Once()
+			buff.On("PopNextMessage", mock.Anything).Return(nil, sql.ErrNoRows)
+			buff.On("GetRecipientsForMessageID", mock.Anything, int64(1)).Return([]*buffer.Recipient{
+				{MessageID: 1, PhoneNumber: "1", Attempts: tt.attempts},
+				{MessageID: 1, PhoneNumber: "2", Attempts: tt.attempts},
+				{MessageID: 1, PhoneNumber: "3", Attempts: tt.attempts},
+			}, nil).Once()
+			tt.buffer(buff)
+
+			store := &MockedSuppressions{}
+			tt.suppressions(store)
+
+			cb := breaker.New("test", breaker.Config{FailureThreshold: 5, OpenTimeout: time.Hour}, nil)
+			f := func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) error {
+				return tt.errs[recipient.PhoneNumber]
+			}
+			a := messenger.NewMessenger(f, buff, nil, messenger.Config{
+				Breaker:      cb,
+				MaxAttempts:  3,
+				RetryBackoff: time.Minute,
+				Suppressions: store,
+			})
+			a.Errors = make(chan error, 10)
+
+			select {
+			case err := <-a.Errors:
+				assert.Equal(t, tt.wantErr, errors.Cause(err))
+			case <-time.After(3 * time.Second):
+				t.Error("delivery error was not reported")
+			}
+			a.Shutdown()
+
+			buff.AssertExpectations(t)
+			store.AssertExpectations(t)
+			assert.Equal(t, tt.wantState, cb.State())
+		})
+	}
+}
+
+func TestMessenger_Delivery_Concurrency(t *testing.T) {
+	const concurrency = 3
+
+	var recipients []*buffer.Recipient
+	for i := 0; i < 2*concurrency; i++ {
+		recipients = append(recipients, &buffer.Recipient{MessageID: 1, PhoneNumber: fmt.Sprintf("%d", i)})
+	}
+
+	buff := &MockedBuffer{}
+	buff.On("PopNextMessage", mock.Anything).Return(&buffer.Message{MessageID: 1, CreatedAt: time.Now()}, nil).Once()
+	buff.On("PopNextMessage", mock.Anything).Return(nil, sql.ErrNoRows)
+	buff.On("GetRecipientsForMessageID", mock.Anything, int64(1)).Return(recipients, nil).Once()
+	buff.On("UpdateRecipientStatus", mock.Anything, mock.Anything).Return(nil)
+
+	var (
+		mu        sync.Mutex
+		active    int
+		maxActive int
+		sent      int
+		done      = make(chan struct{})
+	)
+	f := func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) error {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+
+		time.Sleep(100 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		active--
+		if sent++; sent == len(recipients) {
+			close(done)
+		}
+		return nil
+	}
+
+	a := messenger.NewMessenger(f, buff, nil, messenger.Config{Concurrency: concurrency})
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Error("batch was not delivered")
+	}
+	a.Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, concurrency, maxActive)
+}
+
+func TestMessenger_Delivery_TraceContext(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	buff := &MockedBuffer{}
+	buff.On("PopNextMessage", mock.Anything).Return(&buffer.Message{MessageID: 1, CreatedAt: time.Now()}, nil).Once()
+	buff.On("PopNextMessage", mock.Anything).Return(nil, sql.ErrNoRows)
+	buff.On("GetRecipientsForMessageID", mock.Anything, int64(1)).Return([]*buffer.Recipient{
+		{MessageID: 1, PhoneNumber: "1", TraceParent: traceparent},
+		{MessageID: 1, PhoneNumber: "2"},
+	}, nil).Once()
+	buff.On("UpdateRecipientStatus", mock.Anything, mock.Anything).Return(nil)
+
+	var (
+		mu       sync.Mutex
+		contexts = map[string]tracing.SpanContext{}
+		done     = make(chan struct{})
+	)
+	f := func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) error {
+		mu.Lock()
+		defer mu.Unlock()
+		contexts[recipient.PhoneNumber], _ = tracing.SpanContextFromContext(ctx)
+		if len(contexts) == 2 {
+			close(done)
+		}
+		return nil
+	}
+
+	a := messenger.NewMessenger(f, buff, nil, messenger.Config{Concurrency: 2})
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Error("batch was not delivered")
+	}
+	a.Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// send continues the trace of the request recipient was enqueued with, otherwise the trace of the batch
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", contexts["1"].TraceID.String())
+	assert.NotEqual(t, "00f067aa0ba902b7", contexts["1"].SpanID.String())
+	assert.True(t, contexts["2"].IsValid())
+	assert.NotEqual(t, contexts["1"].TraceID, contexts["2"].TraceID)
+}
+
+func TestMessenger_Delivery_SendTimeout(t *testing.T) {
+	buff := &MockedBuffer{}
+	buff.On("PopNextMessage", mock.Anything).Return(&buffer.Message{MessageID: 1, CreatedAt: time.Now()}, nil).Once()
+	buff.On("PopNextMessage", mock.Anything).Return(nil, sql.ErrNoRows)
+	buff.On("GetRecipientsForMessageID", mock.Anything, int64(1)).Return([]*buffer.Recipient{
+		{MessageID: 1, PhoneNumber: "1"},
+	}, nil).Once()
+	buff.On("UpdateRecipientStatus", mock.Anything, mock.MatchedBy(func(r *buffer.Recipient) bool {
+		return r.Status == buffer.RecipientPending && r.Attempts == 1
+	})).Return(nil).Once()
+	buff.On("RequeueRecipients", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+
+	f := func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	a := messenger.NewMessenger(f, buff, nil, messenger.Config{SendTimeout: 100 * time.Millisecond, BatchTimeout: time.Minute})
+	a.Errors = make(chan error, 10)
+
+	select {
+	case err := <-a.Errors:
+		assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	case <-time.After(3 * time.Second):
+		t.Error("send timeout was not reported")
+	}
+	a.Shutdown()
+
+	buff.AssertExpectations(t)
+}
+
+func TestMessenger_Delivery_Shutdown(t *testing.T) {
+	buff := &MockedBuffer{}
+	buff.On("PopNextMessage", mock.Anything).Return(&buffer.Message{MessageID: 1, CreatedAt: time.Now()}, nil).Once()
+	buff.On("PopNextMessage", mock.Anything).Return(nil, sql.ErrNoRows)
+	buff.On("GetRecipientsForMessageID", mock.Anything, int64(1)).Return([]*buffer.Recipient{
+		{MessageID: 1, PhoneNumber: "1"},
+	}, nil).Once()
+	buff.On("RequeueRecipients", mock.Anything, mock.Anything, mock.MatchedBy(func(recipients []*buffer.Recipient) bool {
+		return len(recipients) == 1 && recipients[0].Attempts == 0
+	}), (*time.Time)(nil)).Return(nil).Once()
+
+	started := make(chan struct{})
+	f := func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	cb := breaker.New("test", breaker.Config{FailureThreshold: 1, OpenTimeout: time.Hour}, nil)
+	a := messenger.NewMessenger(f, buff, nil, messenger.Config{Breaker: cb, BatchTimeout: time.Minute})
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("batch was not delivered")
+	}
+	a.Shutdown()
+
+	// recipient goes back to the queue without counting the attempt against it or the provider
+	buff.AssertExpectations(t)
+	assert.Equal(t, breaker.Closed, cb.State())
+}
+
+func TestMessenger_Delivery_Pacing(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   map[string]pacer.Limit
+		maxWait  time.Duration
+		wantSent int
+	}{
+		{
+			"Waits within the batch",
+			map[string]pacer.Limit{"originator": {Rate: 20, Burst: 1}},
+			time.Second,
+			3,
+		},
+		{
+			"Defers to the queue",
+			map[string]pacer.Limit{"originator": {Rate: 10, Burst: 10}, "account": {Rate: 0.5, Burst: 1}},
+			100 * time.Millisecond,
+			1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buff := &MockedBuffer{}
+			buff.On("PopNextMessage", mock.Anything).Return(&buffer.Message{MessageID: 1, Originator: "originator", CreatedAt: time.Now()}, nil).Once()
+			buff.On("PopNextMessage", mock.Anything).Return(nil, sql.ErrNoRows)
+			buff.On("GetRecipientsForMessageID", mock.Anything, int64(1)).Return([]*buffer.Recipient{
+				{MessageID: 1, PhoneNumber: "1"},
+				{MessageID: 1, PhoneNumber: "2"},
+				{MessageID: 1, PhoneNumber: "3"},
+			}, nil).Once()
+			buff.On("UpdateRecipientStatus", mock.Anything, mock.Anything).Return(nil).Times(tt.wantSent)
+			if tt.wantSent < 3 {
+				buff.On("RequeueRecipients", mock.Anything, mock.Anything, mock.MatchedBy(func(recipients []*buffer.Recipient) bool {
+					return len(recipients) == 3-tt.wantSent
+				}), mock.MatchedBy(func(sendAfter *time.Time) bool {
+					return sendAfter != nil && sendAfter.After(time.Now().Add(tt.maxWait))
+				})).Return(nil).Once()
+			}
+
+			var (
+				mu   sync.Mutex
+				sent int
+			)
+			f := func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) error {
+				mu.Lock()
+				defer mu.Unlock()
+				sent++
+				return nil
+			}
+
+			a := messenger.NewMessenger(f, buff, nil, messenger.Config{
+				Pacer:           pacer.New(tt.limits),
+				PacerMaxWait:    tt.maxWait,
+				ProviderAccount: "twilio:sid",
+			})
+			time.Sleep(1500 * time.Millisecond)
+			a.Shutdown()
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.wantSent, sent)
+			buff.AssertExpectations(t)
+		})
+	}
+}
+
+func TestMessenger_Delivery_QuietHours(t *testing.T) {
+	now := time.Now().UTC()
+	rules, err := quiethours.Parse(fmt.Sprintf("marketing=%s-%s,reminder=%s-%s",
+		now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04"),
+		now.Add(30*time.Minute).Format("15:04"), now.Add(3*time.Hour).Format("15:04"),
+	), []string{"transactional"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		message   *buffer.Message
+		errs      map[string]error
+		wantSent  int
+		wantHeld  bool
+		wantAfter time.Time
+	}{
+		{
+			"Held when quiet hours started while message was waiting",
+			&buffer.Message{MessageID: 1, Originator: "originator", CreatedAt: now, Category: "marketing", TimeZone: "UTC"},
+			nil,
+			0,
+			true,
+			now.Add(59 * time.Minute),
+		},
+		{
+			"Bypass category is sent",
+			&buffer.Message{MessageID: 1, Originator: "originator", CreatedAt: now, Category: "transactional", TimeZone: "UTC"},
+			nil,
+			2,
+			false,
+			time.Time{},
+		},
+		{
+			"Message enqueued without quiet hours is sent",
+			&buffer.Message{MessageID: 1, Originator: "originator", CreatedAt: now, Category: "marketing"},
+			nil,
+			2,
+			false,
+			time.Time{},
+		},
+		{
+			"Retry is held till end of quiet hours",
+			&buffer.Message{MessageID: 1, Originator: "originator", CreatedAt: now, Category: "reminder", TimeZone: "UTC"},
+			map[string]error{"2": &messenger.ProviderError{Provider: "twilio", PhoneNumber: "2", Class: messenger.Transient, StatusCode: 429, Code: 20429}},
+			2,
+			true,
+			now.Add(179 * time.Minute),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buff := &MockedBuffer{}
+			buff.On("PopNextMessage", mock.Anything).Return(tt.message, nil).Once()
+			buff.On("PopNextMessage", mock.Anything).Return(nil, sql.ErrNoRows)
+			buff.On("GetRecipientsForMessageID", mock.Anything, int64(1)).Return([]*buffer.Recipient{
+				{MessageID: 1, PhoneNumber: "1"},
+				{MessageID: 1, PhoneNumber: "2"},
+			}, nil).Once()
+			buff.On("UpdateRecipientStatus", mock.Anything, mock.Anything).Return(nil).Times(tt.wantSent)
+			if tt.wantHeld {
+				buff.On("RequeueRecipients", mock.Anything, tt.message, mock.Anything, mock.MatchedBy(func(sendAfter *time.Time) bool {
+					return sendAfter != nil && sendAfter.After(tt.wantAfter)
+				})).Return(nil).Once()
+			}
+
+			var (
+				mu   sync.Mutex
+				sent int
+			)
+			f := func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) error {
+				mu.Lock()
+				defer mu.Unlock()
+				sent++
+				return tt.errs[recipient.PhoneNumber]
+			}
+
+			a := messenger.NewMessenger(f, buff, nil, messenger.Config{
+				QuietHours:   rules,
+				MaxAttempts:  3,
+				RetryBackoff: time.Hour,
+			})
+			a.Errors = make(chan error, 10)
+			time.Sleep(1500 * time.Millisecond)
+			a.Shutdown()
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.wantSent, sent)
+			buff.AssertExpectations(t)
+			if !tt.wantHeld {
+				buff.AssertNotCalled(t, "RequeueRecipients", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
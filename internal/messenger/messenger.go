@@ -3,10 +3,21 @@ package messenger
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/breaker"
 	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/countries"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/pacer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/quiethours"
+	"github.com/arkadyb/demo_messenger/internal/pkg/segments"
+	"github.com/arkadyb/demo_messenger/internal/pkg/suppressions"
+	"github.com/arkadyb/demo_messenger/internal/pkg/templates"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
 	"github.com/arkadyb/demo_messenger/internal/types"
 	"github.com/pkg/errors"
-	"github.com/prometheus/common/log"
+	log "github.com/sirupsen/logrus"
 	"time"
 )
 
@@ -15,16 +26,64 @@ const BATCH_TIMEOUT = 1 * time.Second
 // Application interface describes behaviour of the application
 type Application interface {
 	// EnqueueSMS used to enqueue sms notifications, places them into waiting queue
-	EnqueueSMS(context.Context, *types.SMS) error
+	EnqueueSMS(context.Context, *types.SMS) (*types.SMSReceipt, error)
 }
 
-// SendNotificationFunc defines function used to deliver Message to Recipients
-type SendNotificationFunc func(msg *buffer.Message, recipients []*buffer.Recipient) error
+// SendNotificationFunc defines function used to deliver Message to Recipient, it is called concurrently for recipients of the batch
+type SendNotificationFunc func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) error
+
+// Config holds messenger settings
+type Config struct {
+	// MaxSegments limits number of segments rendered message can take, 0 means no limit
+	MaxSegments int
+	// AllowUCS2 allows rendered messages with characters outside of GSM-7 alphabet
+	AllowUCS2 bool
+	// LocaleFallback lists locales to look template variant for when requested locale has none
+	LocaleFallback []string
+	// QuietHours holds messages inside recipient's quiet hours until the next allowed window, nil disables quiet hours
+	QuietHours *quiethours.Rules
+	// DefaultTimeZone is used for recipients whose time zone cant be inferred from the phone number, defaults to UTC
+	DefaultTimeZone *time.Location
+	// Breaker guards provider calls, dequeuing is paused while its circuit is open, nil disables circuit breaking
+	Breaker *breaker.Breaker
+	// MaxAttempts limits number of delivery attempts to recipient failing with transient errors
+	MaxAttempts int
+	// RetryBackoff is delay before the first retry of transient failure, it doubles with every next attempt
+	RetryBackoff time.Duration
+	// Suppressions stores recipients failed with permanent errors, nil disables suppression
+	Suppressions suppressions.Store
+	// Concurrency limits number of parallel provider calls within the batch, defaults to 1
+	Concurrency int
+	// SendTimeout limits every provider call, 0 means no limit
+	SendTimeout time.Duration
+	// BatchTimeout limits delivery of the whole batch, recipients not dispatched in time are requeued, 0 means no limit
+	BatchTimeout time.Duration
+	// Pacer limits throughput by "originator" and "account" keys, nil disables pacing
+	Pacer *pacer.Pacer
+	// PacerMaxWait is the longest pacer wait within the batch, recipients waiting longer are requeued till pacer lets them through
+	PacerMaxWait time.Duration
+	// ProviderAccount identifies provider account for pacing, i.e. "twilio:<sid>"
+	ProviderAccount string
+}
+
+// InvalidSMSError returned when sms cant be enqueued because of its content
+type InvalidSMSError struct {
+	Reason string
+}
+
+func (e *InvalidSMSError) Error() string {
+	return e.Reason
+}
 
 // NewMessenger creates new Messenger instance
-func NewMessenger(sendNotification SendNotificationFunc, buf buffer.Buffer) *Messenger {
+func NewMessenger(sendNotification SendNotificationFunc, buf buffer.Buffer, tmpl templates.Store, cfg Config) *Messenger {
+	ctx, cancel := context.WithCancel(context.Background())
 	a := &Messenger{
+		ctx:               ctx,
+		cancel:            cancel,
 		buffer:            buf,
+		templates:         tmpl,
+		cfg:               cfg,
 		timer:             time.NewTimer(BATCH_TIMEOUT),
 		stopSignalChannel: make(chan bool),
 	}
@@ -37,40 +96,12 @@ func NewMessenger(sendNotification SendNotificationFunc, buf buffer.Buffer) *Mes
 				close(a.stopSignalChannel)
 				return
 			case <-a.timer.C:
-				var (
-					ctx = context.Background()
-				)
 				a.timer.Stop()
 
-				nextMessage, err := a.buffer.PopNextMessage(ctx)
-				if err == sql.ErrNoRows {
-					// no rows were found, skip
-					a.timer.Reset(BATCH_TIMEOUT)
-					break
-				}
-				if err != nil {
-					if a.Errors != nil {
-						a.Errors <- errors.Wrap(err, "failed to pop next message")
-					}
-					a.timer.Reset(BATCH_TIMEOUT)
-					break
-				}
-
-				if nextMessage != nil {
-					recipients, err := a.buffer.GetRecipientsForMessageID(ctx, nextMessage.MessageID)
-					if err != nil {
-						a.Errors <- errors.Wrapf(err, "failed to get recipients for message %d", nextMessage.MessageID)
-						a.timer.Reset(BATCH_TIMEOUT)
-						break
-					}
-					if len(recipients) > 0 {
-						if err := sendNotification(nextMessage, recipients); err != nil {
-							if a.Errors != nil {
-								a.Errors <- errors.Wrap(err, "failed to send notification")
-								a.timer.Reset(BATCH_TIMEOUT)
-								break
-							}
-						}
+				// provider is unavailable, keep messages in the queue until circuit lets calls through
+				if a.cfg.Breaker == nil || a.cfg.Breaker.Allow() {
+					if err := a.processNextMessage(sendNotification); err != nil && a.Errors != nil {
+						a.Errors <- err
 					}
 				}
 				a.timer.Reset(BATCH_TIMEOUT)
@@ -81,35 +112,280 @@ func NewMessenger(sendNotification SendNotificationFunc, buf buffer.Buffer) *Mes
 	return a
 }
 
+// processNextMessage pops next due message and delivers it to its recipients. Batch span is linked to traces
+// of requests recipients were enqueued with, polls finding nothing to send are not traced.
+// Every log line of the batch holds batch and message IDs, failures are logged as well as returned.
+func (a *Messenger) processNextMessage(sendNotification SendNotificationFunc) (err error) {
+	ctx, span := tracing.StartSpan(context.Background(), "messenger.batch", tracing.KindInternal)
+	ctx = logging.WithFields(ctx, log.Fields{"batchID": logging.NewID(), "traceID": span.SpanContext().TraceID.String()})
+	defer func() {
+		if err == sql.ErrNoRows {
+			span.Discard()
+			err = nil
+			return
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error(err)
+		}
+		span.Finish(err)
+	}()
+
+	nextMessage, err := a.buffer.PopNextMessage(ctx)
+	if err == sql.ErrNoRows {
+		return err
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to pop next message")
+	}
+	if nextMessage == nil {
+		return nil
+	}
+	ctx = logging.WithFields(ctx, log.Fields{"messageID": nextMessage.MessageID})
+
+	queuedAt := nextMessage.CreatedAt
+	if nextMessage.SendAfter != nil {
+		queuedAt = *nextMessage.SendAfter
+	}
+	queueWaitHistogram.WithLabelValues(buffer.PriorityName(nextMessage.Priority)).Observe(time.Since(queuedAt).Seconds())
+
+	recipients, err := a.buffer.GetRecipientsForMessageID(ctx, nextMessage.MessageID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get recipients for message %d", nextMessage.MessageID)
+	}
+	span.SetAttribute("messaging.message_id", nextMessage.MessageID)
+	span.SetAttribute("messaging.batch.message_count", len(recipients))
+	for _, recipient := range recipients {
+		if sc, ok := tracing.ParseTraceparent(recipient.TraceParent); ok {
+			span.AddLink(sc)
+		}
+	}
+
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	// message could wait in the queue past start of quiet hours, i.e. behind backlog, pause or open circuit
+	if releaseAt := a.releaseTime(ctx, nextMessage, time.Now()); releaseAt != nil {
+		logging.FromContext(ctx).Debugf("holding batch of %d recipients till end of quiet hours at %s", len(recipients), releaseAt)
+		if err := a.buffer.RequeueRecipients(ctx, nextMessage, recipients, releaseAt); err != nil {
+			return errors.Wrapf(err, "failed to requeue recipients of message %d", nextMessage.MessageID)
+		}
+		return nil
+	}
+
+	logging.FromContext(ctx).Debugf("delivering batch of %d recipients", len(recipients))
+	if err := a.deliver(ctx, sendNotification, nextMessage, recipients); err != nil {
+		return errors.Wrap(err, "failed to send notification")
+	}
+
+	return nil
+}
+
 // Messenger implements Application interface
 type Messenger struct {
-	buffer buffer.Buffer
+	buffer    buffer.Buffer
+	templates templates.Store
+	cfg       Config
+
+	// ctx is cancelled on shutdown to abort provider calls in flight
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	timer             *time.Timer
 	stopSignalChannel chan bool
 
-	// errors channel delivers information of notifications notifications failed to be sent
+	// errors channel delivers information of notifications notifications failed to be sent, errors are logged regardless
 	Errors chan error
 }
 
 // EnqueueSMS places sms into buffered queue
-func (a *Messenger) EnqueueSMS(ctx context.Context, sms *types.SMS) error {
+func (a *Messenger) EnqueueSMS(ctx context.Context, sms *types.SMS) (*types.SMSReceipt, error) {
 	if sms == nil {
-		return errors.New("sms cant be nil")
+		return nil, errors.New("sms cant be nil")
 	}
 
-	if err := a.buffer.SaveMessageForRecipient(ctx, sms.Recipient, sms.Originator, sms.Message); err != nil && err != sql.ErrNoRows {
-		return errors.Wrap(err, "failed to send sms")
+	priority, ok := buffer.ParsePriority(sms.Priority)
+	if !ok {
+		return nil, &InvalidSMSError{Reason: fmt.Sprintf("unknown priority %s", sms.Priority)}
+	}
+
+	var (
+		receipt = &types.SMSReceipt{Status: "accepted"}
+		text    = sms.Message
+	)
+	if len(sms.TemplateID) > 0 {
+		tmpl, err := a.findTemplate(ctx, sms)
+		if err != nil {
+			return nil, err
+		}
+		if text, err = a.renderTemplate(tmpl, sms.Variables); err != nil {
+			return nil, err
+		}
+
+		receipt.TemplateID = tmpl.TemplateID
+		receipt.TemplateVersion = tmpl.Version
+		receipt.TemplateLocale = tmpl.Locale
+	}
+
+	if a.cfg.Suppressions != nil {
+		suppressed, err := a.cfg.Suppressions.IsSuppressed(ctx, sms.Recipient)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to check recipient suppression")
+		}
+		if suppressed {
+			return nil, &InvalidSMSError{Reason: fmt.Sprintf("recipient %s is suppressed", sms.Recipient)}
+		}
+	}
+
+	message := &buffer.Message{
+		Originator: sms.Originator,
+		Text:       text,
+		Priority:   priority,
+	}
+	// tenant is kept with the message, so its sending can be paused
+	if tenant, ok := tenants.FromContext(ctx); ok {
+		message.TenantID = tenant.TenantID
+	}
+
+	if err := a.scheduleSMS(ctx, sms, message); err != nil {
+		return nil, err
+	}
+	if message.SendAfter != nil {
+		receipt.Status = "scheduled"
+		receipt.ScheduledAt = message.SendAfter
+	}
+	if err := a.buffer.SaveMessageForRecipient(ctx, sms.Recipient, message); err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "failed to send sms")
+	}
+
+	return receipt, nil
+}
+
+// findTemplate looks for the first existing template variant going through the locale fallback chain.
+// Versions are numbered per locale variant, so pinned version falls back only past locales without the template,
+// locale having the template but not its pinned version is reported as mismatch.
+func (a *Messenger) findTemplate(ctx context.Context, sms *types.SMS) (*templates.Template, error) {
+	if a.templates == nil {
+		return nil, errors.New("templates store is not configured")
+	}
+
+	locale := sms.Locale
+	if len(locale) == 0 {
+		if country, ok := countries.FromPhoneNumber(sms.Recipient); ok {
+			locale = country.Locale
+		}
+	}
+
+	for _, l := range templates.LocaleChain(locale, a.cfg.LocaleFallback) {
+		tmpl, err := a.templates.GetTemplate(ctx, sms.TemplateID, l, sms.TemplateVersion)
+		if err == templates.ErrTemplateNotFound && sms.TemplateVersion > 0 {
+			_, err = a.templates.GetTemplate(ctx, sms.TemplateID, l, 0)
+			if err == nil {
+				return nil, &InvalidSMSError{Reason: fmt.Sprintf("template %s has no version %d for locale %s", sms.TemplateID, sms.TemplateVersion, l)}
+			}
+		}
+		if err == templates.ErrTemplateNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get template %s for locale %s", sms.TemplateID, l)
+		}
+
+		return tmpl, nil
+	}
+
+	return nil, &InvalidSMSError{Reason: fmt.Sprintf("template %s not found", sms.TemplateID)}
+}
+
+// scheduleSMS resolves category and time zone of the recipient and returns time sms should be held until
+// when it falls inside recipient's quiet hours of the tenant or the category. Category and time zone are kept
+// with the message, so quiet hours are checked again when it is sent. Nothing is resolved without quiet hours.
+func (a *Messenger) scheduleSMS(ctx context.Context, sms *types.SMS, message *buffer.Message) error {
+	if a.cfg.QuietHours == nil {
+		return nil
+	}
+
+	category := sms.Category
+	if len(category) == 0 {
+		category = quiethours.DefaultCategory
+	}
+
+	loc := a.cfg.DefaultTimeZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	if len(sms.TimeZone) > 0 {
+		var err error
+		if loc, err = time.LoadLocation(sms.TimeZone); err != nil {
+			return &InvalidSMSError{Reason: fmt.Sprintf("unknown time zone %s", sms.TimeZone)}
+		}
+	} else if country, ok := countries.FromPhoneNumber(sms.Recipient); ok {
+		countryLoc, err := time.LoadLocation(country.TimeZone)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load time zone of country %s", country.Code)
+		}
+		loc = countryLoc
+	}
+
+	message.Category = category
+	message.TimeZone = loc.String()
+	if release, held := a.cfg.QuietHours.ReleaseTime(message.TenantID, category, time.Now(), loc); held {
+		release = release.UTC()
+		message.SendAfter = &release
 	}
 
 	return nil
 }
 
+// releaseTime returns time message should be held until when given time falls inside quiet hours of its recipients,
+// nil is returned when message can be sent then. Messages enqueued without quiet hours are never held.
+func (a *Messenger) releaseTime(ctx context.Context, msg *buffer.Message, at time.Time) *time.Time {
+	if a.cfg.QuietHours == nil || len(msg.TimeZone) == 0 {
+		return nil
+	}
+
+	loc, err := time.LoadLocation(msg.TimeZone)
+	if err != nil {
+		logging.FromContext(ctx).Error(errors.Wrapf(err, "failed to load time zone %s of message %d", msg.TimeZone, msg.MessageID))
+		return nil
+	}
+
+	release, held := a.cfg.QuietHours.ReleaseTime(msg.TenantID, msg.Category, at, loc)
+	if !held {
+		return nil
+	}
+	release = release.UTC()
+
+	return &release
+}
+
+// renderTemplate renders sms text from the template and checks it fits into allowed number of segments
+func (a *Messenger) renderTemplate(tmpl *templates.Template, variables map[string]string) (string, error) {
+	text, err := templates.Render(tmpl.Body, variables)
+	if err != nil {
+		return "", &InvalidSMSError{Reason: err.Error()}
+	}
+	if len(text) == 0 {
+		return "", &InvalidSMSError{Reason: "rendered message is empty"}
+	}
+
+	info := segments.Analyze(text)
+	if info.Encoding == segments.UCS2 && !a.cfg.AllowUCS2 {
+		return "", &InvalidSMSError{Reason: "rendered message contains characters outside of GSM-7 alphabet"}
+	}
+	if a.cfg.MaxSegments > 0 && info.Segments > a.cfg.MaxSegments {
+		return "", &InvalidSMSError{Reason: fmt.Sprintf("rendered message takes %d %s segments, maximum is %d", info.Segments, info.Encoding, a.cfg.MaxSegments)}
+	}
+
+	return text, nil
+}
+
 // Shutdown gracefully stops application
 func (a *Messenger) Shutdown() {
 	shutdownTimer := time.NewTimer(5 * time.Second)
+	a.cancel()
 	a.stopSignalChannel <- true
-	log.Infoln("gracefully shutting down application...")
+	log.Info("gracefully shutting down application...")
 	for {
 		select {
 		case _, open := <-a.stopSignalChannel:
@@ -2,13 +2,19 @@ package messenger_test
 
 import (
 	"context"
+	"fmt"
 	"github.com/arkadyb/demo_messenger/internal/messenger"
+	"github.com/arkadyb/demo_messenger/internal/pkg/breaker"
 	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/quiethours"
+	"github.com/arkadyb/demo_messenger/internal/pkg/templates"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
 	"github.com/arkadyb/demo_messenger/internal/types"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -46,8 +52,8 @@ func (mb *MockedBuffer) GetRecipientsForMessageID(ctx context.Context, id int64)
 	return
 }
 
-func (mb *MockedBuffer) SaveMessageForRecipient(ctx context.Context, phoneNumber, originator, text string) (err error) {
-	args := mb.Called(ctx, phoneNumber, originator, text)
+func (mb *MockedBuffer) SaveMessageForRecipient(ctx context.Context, phoneNumber string, message *buffer.Message) (err error) {
+	args := mb.Called(ctx, phoneNumber, message)
 
 	if args.Get(0) != nil {
 		err = args.Error(0)
@@ -56,10 +62,115 @@ func (mb *MockedBuffer) SaveMessageForRecipient(ctx context.Context, phoneNumber
 	return
 }
 
+func (mb *MockedBuffer) CountPendingMessages(ctx context.Context) (counts map[int]int, err error) {
+	args := mb.Called(ctx)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	if args.Get(0) != nil {
+		counts = args.Get(0).(map[int]int)
+	}
+
+	return
+}
+
+func (mb *MockedBuffer) CountQueuedRecipients(ctx context.Context) (counts map[string]int, err error) {
+	args := mb.Called(ctx)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	if args.Get(0) != nil {
+		counts = args.Get(0).(map[string]int)
+	}
+
+	return
+}
+
+func (mb *MockedBuffer) UpdateRecipientStatus(ctx context.Context, recipient *buffer.Recipient) (err error) {
+	args := mb.Called(ctx, recipient)
+
+	if args.Get(0) != nil {
+		err = args.Error(0)
+	}
+
+	return
+}
+
+func (mb *MockedBuffer) RequeueRecipients(ctx context.Context, message *buffer.Message, recipients []*buffer.Recipient, sendAfter *time.Time) (err error) {
+	args := mb.Called(ctx, message, recipients, sendAfter)
+
+	if args.Get(0) != nil {
+		err = args.Error(0)
+	}
+
+	return
+}
+
+type MockedSuppressions struct {
+	mock.Mock
+}
+
+func (ms *MockedSuppressions) Suppress(ctx context.Context, phoneNumber string, errorCode int) (err error) {
+	args := ms.Called(ctx, phoneNumber, errorCode)
+
+	if args.Get(0) != nil {
+		err = args.Error(0)
+	}
+
+	return
+}
+
+func (ms *MockedSuppressions) IsSuppressed(ctx context.Context, phoneNumber string) (suppressed bool, err error) {
+	args := ms.Called(ctx, phoneNumber)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	return args.Bool(0), err
+}
+
+type MockedTemplates struct {
+	mock.Mock
+}
+
+func (mt *MockedTemplates) GetTemplate(ctx context.Context, templateID, locale string, version int) (tmpl *templates.Template, err error) {
+	args := mt.Called(ctx, templateID, locale, version)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	if args.Get(0) != nil {
+		tmpl = args.Get(0).(*templates.Template)
+	}
+
+	return
+}
+
+func (mt *MockedTemplates) SaveTemplate(ctx context.Context, templateID, locale, body string) (tmpl *templates.Template, err error) {
+	args := mt.Called(ctx, templateID, locale, body)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	if args.Get(0) != nil {
+		tmpl = args.Get(0).(*templates.Template)
+	}
+
+	return
+}
+
 func TestMessenger_EnqueueSMS(t *testing.T) {
 	type fields struct {
-		errors chan error
-		buffer func() buffer.Buffer
+		errors    chan error
+		buffer    func() buffer.Buffer
+		templates func() templates.Store
 	}
 	type args struct {
 		ctx context.Context
@@ -77,9 +188,12 @@ func TestMessenger_EnqueueSMS(t *testing.T) {
 				nil,
 				func() buffer.Buffer {
 					mock := &MockedBuffer{}
-					mock.On("SaveMessageForRecipient", context.Background(), "12345", "originator", "some text").Return(nil)
+					mock.On("SaveMessageForRecipient", context.Background(), "12345", &buffer.Message{Originator: "originator", Text: "some text", Priority: buffer.PriorityNormal}).Return(nil)
 					return mock
 				},
+				func() templates.Store {
+					return nil
+				},
 			},
 			args{
 				context.Background(),
@@ -91,6 +205,29 @@ func TestMessenger_EnqueueSMS(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"Tenant is kept with the message",
+			fields{
+				nil,
+				func() buffer.Buffer {
+					mock := &MockedBuffer{}
+					mock.On("SaveMessageForRecipient", tenants.NewContext(context.Background(), &tenants.Tenant{TenantID: "acme"}), "12345", &buffer.Message{Originator: "originator", Text: "some text", Priority: buffer.PriorityNormal, TenantID: "acme"}).Return(nil)
+					return mock
+				},
+				func() templates.Store {
+					return nil
+				},
+			},
+			args{
+				tenants.NewContext(context.Background(), &tenants.Tenant{TenantID: "acme"}),
+				&types.SMS{
+					Recipient:  "12345",
+					Originator: "originator",
+					Message:    "some text",
+				},
+			},
+			false,
+		},
 		{
 			"Bad args",
 			fields{
@@ -98,6 +235,9 @@ func TestMessenger_EnqueueSMS(t *testing.T) {
 				func() buffer.Buffer {
 					return nil
 				},
+				func() templates.Store {
+					return nil
+				},
 			},
 			args{
 				context.Background(),
@@ -111,9 +251,12 @@ func TestMessenger_EnqueueSMS(t *testing.T) {
 				nil,
 				func() buffer.Buffer {
 					mock := &MockedBuffer{}
-					mock.On("SaveMessageForRecipient", context.Background(), "12345", "originator", "some text").Return(errors.New("error"))
+					mock.On("SaveMessageForRecipient", context.Background(), "12345", &buffer.Message{Originator: "originator", Text: "some text", Priority: buffer.PriorityNormal}).Return(errors.New("error"))
 					return mock
 				},
+				func() templates.Store {
+					return nil
+				},
 			},
 			args{
 				context.Background(),
@@ -125,11 +268,155 @@ func TestMessenger_EnqueueSMS(t *testing.T) {
 			},
 			true,
 		},
+		{
+			"Rendered template",
+			fields{
+				nil,
+				func() buffer.Buffer {
+					mock := &MockedBuffer{}
+					mock.On("SaveMessageForRecipient", context.Background(), "12345", &buffer.Message{Originator: "originator", Text: "Hi John", Priority: buffer.PriorityNormal}).Return(nil)
+					return mock
+				},
+				func() templates.Store {
+					store := &MockedTemplates{}
+					store.On("GetTemplate", context.Background(), "welcome", mock.Anything, 0).Return(&templates.Template{TemplateID: "welcome", Version: 1, Body: "Hi {{name}}"}, nil)
+					return store
+				},
+			},
+			args{
+				context.Background(),
+				&types.SMS{
+					Recipient:  "12345",
+					Originator: "originator",
+					TemplateID: "welcome",
+					Variables:  map[string]string{"name": "John"},
+				},
+			},
+			false,
+		},
+		{
+			"Template not found",
+			fields{
+				nil,
+				func() buffer.Buffer {
+					return nil
+				},
+				func() templates.Store {
+					store := &MockedTemplates{}
+					store.On("GetTemplate", context.Background(), "welcome", mock.Anything, 2).Return(nil, templates.ErrTemplateNotFound)
+					store.On("GetTemplate", context.Background(), "welcome", mock.Anything, 0).Return(nil, templates.ErrTemplateNotFound)
+					return store
+				},
+			},
+			args{
+				context.Background(),
+				&types.SMS{
+					Recipient:       "12345",
+					Originator:      "originator",
+					TemplateID:      "welcome",
+					TemplateVersion: 2,
+				},
+			},
+			true,
+		},
+		{
+			"Missing template variable",
+			fields{
+				nil,
+				func() buffer.Buffer {
+					return nil
+				},
+				func() templates.Store {
+					store := &MockedTemplates{}
+					store.On("GetTemplate", context.Background(), "welcome", mock.Anything, 0).Return(&templates.Template{TemplateID: "welcome", Version: 1, Body: "Hi {{name}}"}, nil)
+					return store
+				},
+			},
+			args{
+				context.Background(),
+				&types.SMS{
+					Recipient:  "12345",
+					Originator: "originator",
+					TemplateID: "welcome",
+				},
+			},
+			true,
+		},
+		{
+			"Rendered template too long",
+			fields{
+				nil,
+				func() buffer.Buffer {
+					return nil
+				},
+				func() templates.Store {
+					store := &MockedTemplates{}
+					store.On("GetTemplate", context.Background(), "welcome", mock.Anything, 0).Return(&templates.Template{TemplateID: "welcome", Version: 1, Body: "Hi {{name}}, {{text}}"}, nil)
+					return store
+				},
+			},
+			args{
+				context.Background(),
+				&types.SMS{
+					Recipient:  "12345",
+					Originator: "originator",
+					TemplateID: "welcome",
+					Variables:  map[string]string{"name": "John", "text": strings.Repeat("a", 160)},
+				},
+			},
+			true,
+		},
+		{
+			"High priority",
+			fields{
+				nil,
+				func() buffer.Buffer {
+					mock := &MockedBuffer{}
+					mock.On("SaveMessageForRecipient", context.Background(), "12345", &buffer.Message{Originator: "originator", Text: "some text", Priority: buffer.PriorityHigh}).Return(nil)
+					return mock
+				},
+				func() templates.Store {
+					return nil
+				},
+			},
+			args{
+				context.Background(),
+				&types.SMS{
+					Recipient:  "12345",
+					Originator: "originator",
+					Message:    "some text",
+					Priority:   "high",
+				},
+			},
+			false,
+		},
+		{
+			"Unknown priority",
+			fields{
+				nil,
+				func() buffer.Buffer {
+					return nil
+				},
+				func() templates.Store {
+					return nil
+				},
+			},
+			args{
+				context.Background(),
+				&types.SMS{
+					Recipient:  "12345",
+					Originator: "originator",
+					Message:    "some text",
+					Priority:   "urgent",
+				},
+			},
+			true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			a := messenger.NewMessenger(nil, tt.fields.buffer())
-			if err := a.EnqueueSMS(tt.args.ctx, tt.args.sms); (err != nil) != tt.wantErr {
+			a := messenger.NewMessenger(nil, tt.fields.buffer(), tt.fields.templates(), messenger.Config{MaxSegments: 1, LocaleFallback: []string{"en"}})
+			if _, err := a.EnqueueSMS(tt.args.ctx, tt.args.sms); (err != nil) != tt.wantErr {
 				t.Errorf("Messenger.EnqueueSMS() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			a.Shutdown()
@@ -137,6 +424,227 @@ func TestMessenger_EnqueueSMS(t *testing.T) {
 	}
 }
 
+func TestMessenger_EnqueueSMS_TemplateLocale(t *testing.T) {
+	tests := []struct {
+		name      string
+		sms       *types.SMS
+		templates func() templates.Store
+		want      *types.SMSReceipt
+	}{
+		{
+			"Requested locale",
+			&types.SMS{Recipient: "+491701234567", Originator: "originator", TemplateID: "welcome", Locale: "de_at"},
+			func() templates.Store {
+				store := &MockedTemplates{}
+				store.On("GetTemplate", context.Background(), "welcome", "de-AT", 0).Return(&templates.Template{TemplateID: "welcome", Locale: "de-AT", Version: 3, Body: "Servus"}, nil)
+				return store
+			},
+			&types.SMSReceipt{Status: "accepted", TemplateID: "welcome", TemplateVersion: 3, TemplateLocale: "de-AT"},
+		},
+		{
+			"Locale inferred from recipient's country code",
+			&types.SMS{Recipient: "+491701234567", Originator: "originator", TemplateID: "welcome"},
+			func() templates.Store {
+				store := &MockedTemplates{}
+				store.On("GetTemplate", context.Background(), "welcome", "de-DE", 0).Return(nil, templates.ErrTemplateNotFound)
+				store.On("GetTemplate", context.Background(), "welcome", "de", 0).Return(&templates.Template{TemplateID: "welcome", Locale: "de", Version: 1, Body: "Hallo"}, nil)
+				return store
+			},
+			&types.SMSReceipt{Status: "accepted", TemplateID: "welcome", TemplateVersion: 1, TemplateLocale: "de"},
+		},
+		{
+			"Fallback locale",
+			&types.SMS{Recipient: "+33612345678", Originator: "originator", TemplateID: "welcome"},
+			func() templates.Store {
+				store := &MockedTemplates{}
+				store.On("GetTemplate", context.Background(), "welcome", "fr-FR", 0).Return(nil, templates.ErrTemplateNotFound)
+				store.On("GetTemplate", context.Background(), "welcome", "fr", 0).Return(nil, templates.ErrTemplateNotFound)
+				store.On("GetTemplate", context.Background(), "welcome", "en", 0).Return(&templates.Template{TemplateID: "welcome", Locale: "en", Version: 2, Body: "Hello"}, nil)
+				return store
+			},
+			&types.SMSReceipt{Status: "accepted", TemplateID: "welcome", TemplateVersion: 2, TemplateLocale: "en"},
+		},
+		{
+			"Pinned version of requested locale",
+			&types.SMS{Recipient: "+491701234567", Originator: "originator", TemplateID: "welcome", TemplateVersion: 2, Locale: "de_at"},
+			func() templates.Store {
+				store := &MockedTemplates{}
+				store.On("GetTemplate", context.Background(), "welcome", "de-AT", 2).Return(&templates.Template{TemplateID: "welcome", Locale: "de-AT", Version: 2, Body: "Servus"}, nil)
+				return store
+			},
+			&types.SMSReceipt{Status: "accepted", TemplateID: "welcome", TemplateVersion: 2, TemplateLocale: "de-AT"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buff := &MockedBuffer{}
+			buff.On("SaveMessageForRecipient", context.Background(), tt.sms.Recipient, mock.Anything).Return(nil)
+
+			a := messenger.NewMessenger(nil, buff, tt.templates(), messenger.Config{LocaleFallback: []string{"en"}})
+			got, err := a.EnqueueSMS(context.Background(), tt.sms)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+			a.Shutdown()
+		})
+	}
+}
+
+func TestMessenger_EnqueueSMS_PinnedTemplateVersion(t *testing.T) {
+	tests := []struct {
+		name      string
+		sms       *types.SMS
+		templates func() *MockedTemplates
+		want      *types.SMSReceipt
+		wantErr   string
+	}{
+		{
+			"Fallback past locales without the template",
+			&types.SMS{Recipient: "+491701234567", Originator: "originator", TemplateID: "welcome", TemplateVersion: 2},
+			func() *MockedTemplates {
+				store := &MockedTemplates{}
+				store.On("GetTemplate", context.Background(), "welcome", "de-DE", 2).Return(nil, templates.ErrTemplateNotFound)
+				store.On("GetTemplate", context.Background(), "welcome", "de-DE", 0).Return(nil, templates.ErrTemplateNotFound)
+				store.On("GetTemplate", context.Background(), "welcome", "de", 2).Return(nil, templates.ErrTemplateNotFound)
+				store.On("GetTemplate", context.Background(), "welcome", "de", 0).Return(nil, templates.ErrTemplateNotFound)
+				store.On("GetTemplate", context.Background(), "welcome", "en", 2).Return(&templates.Template{TemplateID: "welcome", Locale: "en", Version: 2, Body: "Hello"}, nil)
+				return store
+			},
+			&types.SMSReceipt{Status: "accepted", TemplateID: "welcome", TemplateVersion: 2, TemplateLocale: "en"},
+			"",
+		},
+		{
+			"Unknown country",
+			&types.SMS{Recipient: "+999123456", Originator: "originator", TemplateID: "welcome", TemplateVersion: 2},
+			func() *MockedTemplates {
+				store := &MockedTemplates{}
+				store.On("GetTemplate", context.Background(), "welcome", "en", 2).Return(&templates.Template{TemplateID: "welcome", Locale: "en", Version: 2, Body: "Hello"}, nil)
+				return store
+			},
+			&types.SMSReceipt{Status: "accepted", TemplateID: "welcome", TemplateVersion: 2, TemplateLocale: "en"},
+			"",
+		},
+		{
+			"Locale without pinned version",
+			&types.SMS{Recipient: "+491701234567", Originator: "originator", TemplateID: "welcome", TemplateVersion: 2, Locale: "de_at"},
+			func() *MockedTemplates {
+				store := &MockedTemplates{}
+				store.On("GetTemplate", context.Background(), "welcome", "de-AT", 2).Return(nil, templates.ErrTemplateNotFound)
+				store.On("GetTemplate", context.Background(), "welcome", "de-AT", 0).Return(&templates.Template{TemplateID: "welcome", Locale: "de-AT", Version: 1, Body: "Servus"}, nil)
+				return store
+			},
+			nil,
+			"template welcome has no version 2 for locale de-AT",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.templates()
+			buff := &MockedBuffer{}
+			buff.On("SaveMessageForRecipient", context.Background(), tt.sms.Recipient, mock.Anything).Return(nil)
+
+			a := messenger.NewMessenger(nil, buff, store, messenger.Config{LocaleFallback: []string{"en"}})
+			got, err := a.EnqueueSMS(context.Background(), tt.sms)
+			if len(tt.wantErr) > 0 {
+				assert.IsType(t, &messenger.InvalidSMSError{}, err)
+				assert.EqualError(t, err, tt.wantErr)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+			store.AssertExpectations(t)
+			a.Shutdown()
+		})
+	}
+}
+
+func TestMessenger_EnqueueSMS_QuietHours(t *testing.T) {
+	now := time.Now().UTC()
+	window := fmt.Sprintf("%s-%s", now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04"))
+	rules, err := quiethours.Parse("marketing="+window+",tenant:acme="+window, []string{"transactional"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		sms           *types.SMS
+		wantStatus    string
+		wantScheduled bool
+		wantErr       bool
+	}{
+		{
+			"Held inside quiet hours",
+			context.Background(),
+			&types.SMS{Recipient: "+491701234567", Originator: "originator", Message: "Sale", Category: "marketing", TimeZone: "UTC"},
+			"scheduled",
+			true,
+			false,
+		},
+		{
+			"Transactional bypasses quiet hours",
+			context.Background(),
+			&types.SMS{Recipient: "+491701234567", Originator: "originator", Message: "Code", Category: "transactional", TimeZone: "UTC"},
+			"accepted",
+			false,
+			false,
+		},
+		{
+			"Category without quiet hours",
+			context.Background(),
+			&types.SMS{Recipient: "+491701234567", Originator: "originator", Message: "Reminder", Category: "reminder", TimeZone: "UTC"},
+			"accepted",
+			false,
+			false,
+		},
+		{
+			"Held inside quiet hours of the tenant",
+			tenants.NewContext(context.Background(), &tenants.Tenant{TenantID: "acme"}),
+			&types.SMS{Recipient: "+491701234567", Originator: "originator", Message: "Reminder", Category: "reminder", TimeZone: "UTC"},
+			"scheduled",
+			true,
+			false,
+		},
+		{
+			"Transactional of the tenant bypasses quiet hours",
+			tenants.NewContext(context.Background(), &tenants.Tenant{TenantID: "acme"}),
+			&types.SMS{Recipient: "+491701234567", Originator: "originator", Message: "Code", Category: "transactional", TimeZone: "UTC"},
+			"accepted",
+			false,
+			false,
+		},
+		{
+			"Unknown time zone",
+			context.Background(),
+			&types.SMS{Recipient: "+491701234567", Originator: "originator", Message: "Sale", Category: "marketing", TimeZone: "Mars/Olympus"},
+			"",
+			false,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buff := &MockedBuffer{}
+			buff.On("SaveMessageForRecipient", tt.ctx, tt.sms.Recipient, mock.MatchedBy(func(msg *buffer.Message) bool {
+				// category and time zone are kept, so quiet hours are checked again when message is sent
+				return (msg.SendAfter != nil) == tt.wantScheduled && (msg.SendAfter == nil || msg.SendAfter.After(now)) &&
+					msg.Category == tt.sms.Category && msg.TimeZone == tt.sms.TimeZone
+			})).Return(nil)
+
+			a := messenger.NewMessenger(nil, buff, nil, messenger.Config{QuietHours: rules})
+			got, err := a.EnqueueSMS(tt.ctx, tt.sms)
+			if tt.wantErr {
+				assert.IsType(t, &messenger.InvalidSMSError{}, err)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantStatus, got.Status)
+				assert.Equal(t, tt.wantScheduled, got.ScheduledAt != nil)
+				buff.AssertExpectations(t)
+			}
+			a.Shutdown()
+		})
+	}
+}
+
 func TestMessenger_Processing(t *testing.T) {
 	type params struct {
 		expectedCount int
@@ -151,20 +659,22 @@ func TestMessenger_Processing(t *testing.T) {
 	}{
 		{
 			"Success",
-			func(msg *buffer.Message, recipients []*buffer.Recipient) error {
-				logrus.Infof("%v %v\n", msg, recipients)
+			func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) error {
+				logrus.Infof("%v %v\n", msg, recipient)
 				return nil
 			},
 			func() buffer.Buffer {
 				buff := &MockedBuffer{}
-				buff.On("PopNextMessage", context.Background()).Return(&buffer.Message{
-					1,
-					"originator",
-					"text",
-					true,
+				buff.On("PopNextMessage", mock.Anything).Return(&buffer.Message{
+					MessageID:  1,
+					Originator: "originator",
+					Text:       "text",
+					Processed:  true,
+					Priority:   buffer.PriorityNormal,
+					CreatedAt:  time.Now(),
 				}, nil)
 
-				buff.On("GetRecipientsForMessageID", context.Background(), int64(1)).Return([]*buffer.Recipient{
+				buff.On("GetRecipientsForMessageID", mock.Anything, int64(1)).Return([]*buffer.Recipient{
 					{
 						MessageID:   int64(1),
 						PhoneNumber: "12345",
@@ -174,11 +684,12 @@ func TestMessenger_Processing(t *testing.T) {
 						PhoneNumber: "67899",
 					},
 				}, nil)
+				buff.On("UpdateRecipientStatus", mock.Anything, mock.Anything).Return(nil)
 
 				return buff
 			},
 			params{
-				5,
+				6,
 				6 * time.Second,
 			},
 		},
@@ -188,14 +699,14 @@ func TestMessenger_Processing(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			stopChan := make(chan bool)
 			counter := 0
-			f := func(msg *buffer.Message, recipients []*buffer.Recipient) error {
+			f := func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) error {
 				counter++
 				if counter == tt.params.expectedCount {
 					close(stopChan)
 				}
 				return nil
 			}
-			a := messenger.NewMessenger(f, tt.buff())
+			a := messenger.NewMessenger(f, tt.buff(), nil, messenger.Config{})
 
 			wg := sync.WaitGroup{}
 			wg.Add(1)
@@ -218,3 +729,45 @@ func TestMessenger_Processing(t *testing.T) {
 		})
 	}
 }
+
+func TestMessenger_Processing_CircuitOpen(t *testing.T) {
+	buff := &MockedBuffer{}
+	buff.On("PopNextMessage", mock.Anything).Return(&buffer.Message{
+		MessageID:  1,
+		Originator: "originator",
+		Text:       "text",
+		CreatedAt:  time.Now(),
+	}, nil)
+	buff.On("GetRecipientsForMessageID", mock.Anything, int64(1)).Return([]*buffer.Recipient{
+		{
+			MessageID:   int64(1),
+			PhoneNumber: "12345",
+		},
+	}, nil)
+	buff.On("UpdateRecipientStatus", mock.Anything, mock.Anything).Return(nil)
+	buff.On("RequeueRecipients", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	var (
+		mu      sync.Mutex
+		counter int
+	)
+	f := func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) error {
+		mu.Lock()
+		defer mu.Unlock()
+		counter++
+		return errors.New("provider is down")
+	}
+
+	cb := messenger.NewProviderBreaker("test", breaker.Config{FailureThreshold: 1, OpenTimeout: time.Hour})
+	a := messenger.NewMessenger(f, buff, nil, messenger.Config{Breaker: cb})
+	a.Errors = make(chan error, 10)
+
+	time.Sleep(3500 * time.Millisecond)
+	a.Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, counter)
+	assert.Equal(t, breaker.Open, cb.State())
+	buff.AssertNumberOfCalls(t, "PopNextMessage", 1)
+}
@@ -0,0 +1,146 @@
+package messenger
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/breaker"
+	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+var (
+	queueWaitHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "messenger_queue_wait_seconds",
+		Help:    "Time messages wait in the queue before delivery by priority",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"priority"})
+
+	providerCircuitStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "messenger_provider_circuit_state",
+		Help: "State of provider circuit breaker: 0 closed, 1 half-open, 2 open",
+	}, []string{"provider"})
+
+	providerCircuitTransitionsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "messenger_provider_circuit_transitions_total",
+		Help: "Number of provider circuit breaker transitions by state entered",
+	}, []string{"provider", "state"})
+
+	pacerWaitsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "messenger_pacer_waits_total",
+		Help: "Number of times provider calls were held by pacer, either waited for or deferred back to the queue",
+	}, []string{"outcome"})
+
+	enqueueToSendHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "messenger_enqueue_to_send_seconds",
+		Help:    "Time from enqueuing message to its successful delivery to the recipient by priority",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 14),
+	}, []string{"priority"})
+
+	batchSizeHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "messenger_batch_size",
+		Help:    "Number of recipients of delivered batches",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 11),
+	})
+
+	providerRequestHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "messenger_provider_request_duration_seconds",
+		Help:    "Latency of provider calls by outcome",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"provider", "outcome"})
+
+	sendsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "messenger_sends_total",
+		Help: "Number of provider calls by outcome: sent or error class",
+	}, []string{"provider", "outcome"})
+
+	queueDepthDesc = prometheus.NewDesc(
+		"messenger_queue_depth",
+		"Number of messages waiting in the queue by priority",
+		[]string{"priority"}, nil,
+	)
+
+	queueRecipientsDesc = prometheus.NewDesc(
+		"messenger_queue_recipients",
+		"Number of recipients waiting in the queue by state: due, scheduled or retrying",
+		[]string{"state"}, nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(queueWaitHistogram)
+	prometheus.MustRegister(providerCircuitStateGauge)
+	prometheus.MustRegister(providerCircuitTransitionsCounter)
+	prometheus.MustRegister(pacerWaitsCounter)
+	prometheus.MustRegister(enqueueToSendHistogram)
+	prometheus.MustRegister(batchSizeHistogram)
+	prometheus.MustRegister(providerRequestHistogram)
+	prometheus.MustRegister(sendsCounter)
+}
+
+// NewQueueCollector creates prometheus collector reporting queue depth by priority and by recipients state on every scrape
+func NewQueueCollector(buf buffer.Buffer) prometheus.Collector {
+	return &queueCollector{
+		buffer: buf,
+	}
+}
+
+type queueCollector struct {
+	buffer buffer.Buffer
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- queueRecipientsDesc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	counts, err := c.buffer.CountPendingMessages(ctx)
+	if err != nil {
+		log.Error(errors.Wrap(err, "failed to collect queue depth"))
+	} else {
+		for _, priority := range []int{buffer.PriorityLow, buffer.PriorityNormal, buffer.PriorityHigh} {
+			ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(counts[priority]), buffer.PriorityName(priority))
+		}
+	}
+
+	states, err := c.buffer.CountQueuedRecipients(ctx)
+	if err != nil {
+		log.Error(errors.Wrap(err, "failed to collect queued recipients"))
+		return
+	}
+	for _, state := range []string{buffer.QueueDue, buffer.QueueScheduled, buffer.QueueRetrying} {
+		ch <- prometheus.MustNewConstMetric(queueRecipientsDesc, prometheus.GaugeValue, float64(states[state]), state)
+	}
+}
+
+// observeProviderCall reports latency and outcome of the provider call
+func observeProviderCall(provider string, startedAt time.Time, sendErr error) {
+	outcome := "sent"
+	if sendErr != nil {
+		outcome = classify(sendErr).Class.String()
+	}
+
+	providerRequestHistogram.WithLabelValues(provider, outcome).Observe(time.Since(startedAt).Seconds())
+	sendsCounter.WithLabelValues(provider, outcome).Inc()
+}
+
+// NewProviderBreaker creates circuit breaker for provider calls reporting its state changes to logs and metrics
+func NewProviderBreaker(provider string, cfg breaker.Config) *breaker.Breaker {
+	providerCircuitStateGauge.WithLabelValues(provider).Set(float64(breaker.Closed))
+
+	return breaker.New(provider, cfg, func(name string, from, to breaker.State) {
+		providerCircuitStateGauge.WithLabelValues(name).Set(float64(to))
+		providerCircuitTransitionsCounter.WithLabelValues(name, to.String()).Inc()
+
+		if to == breaker.Open {
+			log.Warnf("%s circuit breaker changed state from %s to %s, sending is paused for %s", name, from, to, cfg.OpenTimeout)
+		} else {
+			log.Infof("%s circuit breaker changed state from %s to %s", name, from, to)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package messenger
+
+import (
+	"fmt"
+)
+
+// ErrorClass describes how delivery failure reported by the provider should be handled
+type ErrorClass int
+
+const (
+	// Transient errors are retried with backoff, i.e. rate limiting or provider outage
+	Transient ErrorClass = iota
+	// Permanent errors are not retried and recipient gets suppressed, i.e. invalid or blocked number
+	Permanent
+	// Fatal errors affect every message and need operator's attention, i.e. authentication failure
+	Fatal
+	// Rejected errors are not retried and recipient is not suppressed, i.e. message body is too long
+	Rejected
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case Transient:
+		return "transient"
+	case Permanent:
+		return "permanent"
+	case Fatal:
+		return "fatal"
+	case Rejected:
+		return "rejected"
+	}
+	return "unknown"
+}
+
+// ProviderError returned when provider failed to deliver message to the recipient
+type ProviderError struct {
+	Provider    string
+	PhoneNumber string
+	Class       ErrorClass
+	// StatusCode is HTTP status code of provider response, 0 when request failed before response was received
+	StatusCode int
+	// Code is provider specific error code
+	Code    int
+	Message string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s failed to send sms to %s with %s error: %s (status %d, code %d)", e.Provider, e.PhoneNumber, e.Class, e.Message, e.StatusCode, e.Code)
+}
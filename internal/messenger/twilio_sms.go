@@ -1,59 +1,137 @@
 package messenger
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
-// SendSMSViaMessageBird sends sms notifications with Message Bird API
+const twilioProvider = "twilio"
+
+// Twilio error codes of failures affecting every message sent with the account
+// https://www.twilio.com/docs/api/errors
+var twilioFatalCodes = map[int]bool{
+	20003: true, // authentication failed
+	20005: true, // account not active
+	21212: true, // invalid From number
+	21606: true, // From number is not SMS capable
+	21659: true, // From number is not a Twilio number
+}
+
+// Twilio error codes of recipients that cant be reached, only they get suppressed
+var twilioPermanentCodes = map[int]bool{
+	21211: true, // invalid To number
+	21214: true, // To number cannot be reached
+	21217: true, // To number does not appear to be valid
+	21610: true, // recipient unsubscribed with STOP
+	21614: true, // To number is not a mobile number
+}
+
+// twilioError is error body returned by Twilio API
+type twilioError struct {
+	Code     int    `json:"code"`
+	Message  string `json:"message"`
+	MoreInfo string `json:"more_info"`
+	Status   int    `json:"status"`
+}
+
+// SendSMSViaTwilio sends sms notifications with Twilio API
 func SendSMSViaTwilio(sid, token string, httpclient *http.Client) SendNotificationFunc {
-	return func(msg *buffer.Message, recipients []*buffer.Recipient) error {
-		var (
-			urlStr = fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", sid)
-		)
-
-		for _, recipient := range recipients {
-			req, err := http.NewRequest("POST", urlStr, newSms(msg.Originator, recipient.PhoneNumber, msg.Text))
-			if err != nil {
-				return errors.Wrapf(err, "failed to send sms to %s", recipient.PhoneNumber)
-			}
+	var (
+		urlStr = fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", sid)
+	)
 
-			req.SetBasicAuth(sid, token)
+	return func(ctx context.Context, msg *buffer.Message, recipient *buffer.Recipient) (err error) {
+		ctx, span := tracing.StartSpan(ctx, "twilio.send", tracing.KindClient)
+		span.SetAttribute("http.method", "POST")
+		span.SetAttribute("peer.service", twilioProvider)
+		defer func(startedAt time.Time) {
+			observeProviderCall(twilioProvider, startedAt, err)
+			span.Finish(err)
+		}(time.Now())
 
-			req.Header.Add("Accept", "application/json")
-			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req, err := http.NewRequest("POST", urlStr, newSms(msg.Originator, recipient.PhoneNumber, msg.Text))
+		if err != nil {
+			return errors.Wrapf(err, "failed to send sms to %s", recipient.PhoneNumber)
+		}
 
-			resp, err := httpclient.Do(req)
-			if err != nil || (resp.StatusCode < 200 || resp.StatusCode >= 300) {
-				strResp, _ := ioutil.ReadAll(resp.Body)
-				err = fmt.Errorf("response %s", strResp)
+		req = req.WithContext(ctx)
+		req.SetBasicAuth(sid, token)
 
-				if err != nil {
-					err = errors.Wrapf(err, "failed to send sms to %s", recipient.PhoneNumber)
-				}
+		req.Header.Add("Accept", "application/json")
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-				return err
+		resp, err := httpclient.Do(req)
+		if err != nil {
+			return &ProviderError{
+				Provider:    twilioProvider,
+				PhoneNumber: recipient.PhoneNumber,
+				Class:       Transient,
+				Message:     err.Error(),
 			}
+		}
+		defer resp.Body.Close()
+		span.SetAttribute("http.status_code", resp.StatusCode)
 
-			var data map[string]interface{}
-			decoder := json.NewDecoder(resp.Body)
-			err = decoder.Decode(&data)
-			if err == nil {
-				log.Infof("message sent to %s with sid", recipient.PhoneNumber)
-			}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return newTwilioError(recipient.PhoneNumber, resp)
+		}
+
+		var data struct {
+			Sid string `json:"sid"`
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&data); err == nil {
+			logging.FromContext(ctx).Infof("message %d sent to %s with sid %s", msg.MessageID, recipient.PhoneNumber, data.Sid)
 		}
 
 		return nil
 	}
 }
 
+// newTwilioError parses Twilio error response and classifies it
+func newTwilioError(phoneNumber string, resp *http.Response) *ProviderError {
+	perr := &ProviderError{
+		Provider:    twilioProvider,
+		PhoneNumber: phoneNumber,
+		StatusCode:  resp.StatusCode,
+		Message:     http.StatusText(resp.StatusCode),
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	var twerr twilioError
+	if err := json.Unmarshal(body, &twerr); err == nil {
+		perr.Code = twerr.Code
+		if len(twerr.Message) > 0 {
+			perr.Message = twerr.Message
+		}
+	} else if len(body) > 0 {
+		perr.Message = string(body)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden || twilioFatalCodes[perr.Code]:
+		perr.Class = Fatal
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		perr.Class = Transient
+	case twilioPermanentCodes[perr.Code]:
+		perr.Class = Permanent
+	default:
+		// message was rejected for other reason than its recipient, i.e. too long body
+		perr.Class = Rejected
+	}
+
+	return perr
+}
+
 func newSms(from, to, body string) *strings.Reader {
 	msgData := url.Values{}
 	msgData.Set("To", to)
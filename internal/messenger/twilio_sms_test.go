@@ -0,0 +1,155 @@
+package messenger_test
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/messenger"
+	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// redirectTransport sends all requests to the test server
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = rt.target.Scheme
+	req.URL.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSendSMSViaTwilio(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    *messenger.ProviderError
+		wantErr bool
+	}{
+		{
+			"Success",
+			http.StatusCreated,
+			`{"sid": "SM123"}`,
+			nil,
+			false,
+		},
+		{
+			"Invalid number",
+			http.StatusBadRequest,
+			`{"code": 21211, "message": "The 'To' number is not a valid phone number.", "more_info": "https://www.twilio.com/docs/errors/21211", "status": 400}`,
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "+491701234567", Class: messenger.Permanent, StatusCode: 400, Code: 21211, Message: "The 'To' number is not a valid phone number."},
+			true,
+		},
+		{
+			"Blocked recipient",
+			http.StatusBadRequest,
+			`{"code": 21610, "message": "Attempt to send to unsubscribed recipient", "status": 400}`,
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "+491701234567", Class: messenger.Permanent, StatusCode: 400, Code: 21610, Message: "Attempt to send to unsubscribed recipient"},
+			true,
+		},
+		{
+			"Bad request without recipient code",
+			http.StatusBadRequest,
+			`{"code": 21617, "message": "The concatenated message body exceeds the 1600 character limit", "status": 400}`,
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "+491701234567", Class: messenger.Rejected, StatusCode: 400, Code: 21617, Message: "The concatenated message body exceeds the 1600 character limit"},
+			true,
+		},
+		{
+			"Not found without body",
+			http.StatusNotFound,
+			``,
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "+491701234567", Class: messenger.Rejected, StatusCode: 404, Message: "Not Found"},
+			true,
+		},
+		{
+			"Too many requests",
+			http.StatusTooManyRequests,
+			`{"code": 20429, "message": "Too Many Requests", "status": 429}`,
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "+491701234567", Class: messenger.Transient, StatusCode: 429, Code: 20429, Message: "Too Many Requests"},
+			true,
+		},
+		{
+			"Server error without body",
+			http.StatusBadGateway,
+			``,
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "+491701234567", Class: messenger.Transient, StatusCode: 502, Message: "Bad Gateway"},
+			true,
+		},
+		{
+			"Authentication failure",
+			http.StatusUnauthorized,
+			`{"code": 20003, "message": "Authenticate", "status": 401}`,
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "+491701234567", Class: messenger.Fatal, StatusCode: 401, Code: 20003, Message: "Authenticate"},
+			true,
+		},
+		{
+			"Invalid originator",
+			http.StatusBadRequest,
+			`{"code": 21212, "message": "Invalid From Number", "status": 400}`,
+			&messenger.ProviderError{Provider: "twilio", PhoneNumber: "+491701234567", Class: messenger.Fatal, StatusCode: 400, Code: 21212, Message: "Invalid From Number"},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/2010-04-01/Accounts/sid/Messages.json", r.URL.Path)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			target, _ := url.Parse(ts.URL)
+			send := messenger.SendSMSViaTwilio("sid", "token", &http.Client{Transport: &redirectTransport{target}})
+
+			err := send(context.Background(), &buffer.Message{Originator: "originator", Text: "text"}, &buffer.Recipient{MessageID: 1, PhoneNumber: "+491701234567"})
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tt.want, errors.Cause(err))
+		})
+	}
+}
+
+func TestSendSMSViaTwilio_ConnectionError(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	target, _ := url.Parse(ts.URL)
+	ts.Close()
+
+	send := messenger.SendSMSViaTwilio("sid", "token", &http.Client{Transport: &redirectTransport{target}})
+
+	err := send(context.Background(), &buffer.Message{Originator: "originator", Text: "text"}, &buffer.Recipient{MessageID: 1, PhoneNumber: "+491701234567"})
+	if perr, ok := errors.Cause(err).(*messenger.ProviderError); assert.True(t, ok) {
+		assert.Equal(t, messenger.Transient, perr.Class)
+		assert.Equal(t, 0, perr.StatusCode)
+	}
+}
+
+func TestSendSMSViaTwilio_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	target, _ := url.Parse(ts.URL)
+	send := messenger.SendSMSViaTwilio("sid", "token", &http.Client{Transport: &redirectTransport{target}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err := send(ctx, &buffer.Message{Originator: "originator", Text: "text"}, &buffer.Recipient{MessageID: 1, PhoneNumber: "+491701234567"})
+	assert.True(t, time.Since(started) < time.Second)
+	if perr, ok := errors.Cause(err).(*messenger.ProviderError); assert.True(t, ok) {
+		assert.Equal(t, messenger.Transient, perr.Class)
+	}
+}
@@ -0,0 +1,35 @@
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+// Outcomes of audited actions
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeRejected  = "rejected"
+	OutcomeFailed    = "failed"
+)
+
+// Entry is record of action taken by operator
+type Entry struct {
+	// Actor is name of the operator taking the action
+	Actor string `db:"actor"`
+	// Action is name of the action, i.e. messages.cancel
+	Action string `db:"action"`
+	// Target is what the action was taken on, i.e. message ID or originator
+	Target string `db:"target"`
+	// Details is JSON with parameters and result of the action
+	Details   string    `db:"details"`
+	Outcome   string    `db:"outcome"`
+	RequestID string    `db:"request_id"`
+	ClientIP  string    `db:"client_ip"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Log describes append-only log of operator actions
+type Log interface {
+	// Record appends entry to the log
+	Record(ctx context.Context, entry *Entry) error
+}
@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// PostgresLog implements Log interface for Postgres
+type PostgresLog struct {
+	*sqlx.DB
+}
+
+// NewPostgresLog creates new instance of PostgresLog
+func NewPostgresLog(db *sqlx.DB) *PostgresLog {
+	return &PostgresLog{
+		DB: db,
+	}
+}
+
+// Record appends entry to audit_log table, creation time is set by the database
+func (pl *PostgresLog) Record(ctx context.Context, entry *Entry) error {
+	if entry == nil || len(entry.Actor) == 0 || len(entry.Action) == 0 {
+		return errors.New("actor and action cant be empty")
+	}
+
+	_, err := pl.NamedExecContext(ctx, "INSERT INTO audit_log (actor, action, target, details, outcome, request_id, client_ip) VALUES(:actor, :action, :target, CAST(NULLIF(:details, '') AS jsonb), :outcome, NULLIF(:request_id, ''), NULLIF(:client_ip, ''))", entry)
+	if err != nil {
+		return errors.Wrapf(err, "failed to record %s by %s", entry.Action, entry.Actor)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package audit_test
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+
+	"github.com/arkadyb/demo_messenger/internal/pkg/audit"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestPostgresLog_Record(t *testing.T) {
+	type fields struct {
+		DB func() (*sqlx.DB, sqlmock.Sqlmock)
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		entry   *audit.Entry
+		wantErr bool
+	}{
+		{
+			"Success",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectExec(`^INSERT INTO audit_log \(actor, action, target, details, outcome, request_id, client_ip\) VALUES\(\?, \?, \?, CAST\(NULLIF\(\?, ''\) AS jsonb\), \?, NULLIF\(\?, ''\), NULLIF\(\?, ''\)\)$`).
+						WithArgs("ops", "messages.cancel", "42", `{"cancelled":2}`, audit.OutcomeSucceeded, "MockedRequestID", "10.0.0.1").
+						WillReturnResult(sqlmock.NewResult(0, 1))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			&audit.Entry{Actor: "ops", Action: "messages.cancel", Target: "42", Details: `{"cancelled":2}`, Outcome: audit.OutcomeSucceeded, RequestID: "MockedRequestID", ClientIP: "10.0.0.1"},
+			false,
+		},
+		{
+			"Missing actor",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			&audit.Entry{Action: "messages.cancel"},
+			true,
+		},
+		{
+			"DB Error",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectExec(`^INSERT INTO audit_log`).WillReturnError(errors.New("error"))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			&audit.Entry{Actor: "ops", Action: "messages.purge"},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.fields.DB()
+			pl := audit.NewPostgresLog(db)
+			defer pl.Close()
+
+			err := pl.Record(context.Background(), tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PostgresLog.Record() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
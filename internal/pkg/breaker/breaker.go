@@ -0,0 +1,138 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State of the circuit breaker
+type State int
+
+// Circuit breaker states
+const (
+	// Closed lets all calls through
+	Closed State = iota
+	// HalfOpen lets calls through to probe whether the dependency is back, first result closes or opens the circuit
+	HalfOpen
+	// Open rejects all calls until open timeout passes
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+// Config holds circuit breaker thresholds
+type Config struct {
+	// FailureThreshold is number of consecutive failures opening the circuit
+	FailureThreshold int
+	// OpenTimeout is period circuit stays open before calls are let through again
+	OpenTimeout time.Duration
+}
+
+// StateChangeFunc is called on every state transition of the circuit breaker
+type StateChangeFunc func(name string, from, to State)
+
+// Breaker implements circuit breaker opening after number of consecutive failures
+type Breaker struct {
+	name          string
+	cfg           Config
+	onStateChange StateChangeFunc
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+}
+
+// New creates new circuit breaker in closed state, onStateChange can be nil
+func New(name string, cfg Config, onStateChange StateChangeFunc) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 1
+	}
+
+	return &Breaker{
+		name:          name,
+		cfg:           cfg,
+		onStateChange: onStateChange,
+	}
+}
+
+// Name returns name of the circuit breaker
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns current state of the circuit breaker
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Allow reports whether call can be made, open circuit turns half-open once open timeout passes
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open {
+		if time.Since(b.openedAt) < b.cfg.OpenTimeout {
+			return false
+		}
+		b.setState(HalfOpen)
+	}
+
+	return true
+}
+
+// Success records successful call and closes the circuit
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.setState(Closed)
+}
+
+// Failure records failed call, circuit opens when failures threshold is reached or probing call fails
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.openedAt = time.Now()
+		b.setState(Open)
+	}
+}
+
+// Trip opens the circuit regardless of failures threshold
+func (b *Breaker) Trip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.openedAt = time.Now()
+	b.setState(Open)
+}
+
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+
+	from := b.state
+	b.state = state
+	if b.onStateChange != nil {
+		b.onStateChange(b.name, from, state)
+	}
+}
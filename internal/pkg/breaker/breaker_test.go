@@ -0,0 +1,58 @@
+package breaker_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/breaker"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	var transitions []string
+	b := breaker.New("twilio", breaker.Config{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond}, func(name string, from, to breaker.State) {
+		transitions = append(transitions, name+":"+from.String()+"->"+to.String())
+	})
+
+	assert.True(t, b.Allow())
+	b.Failure()
+	assert.Equal(t, breaker.Closed, b.State())
+
+	// success resets consecutive failures
+	b.Success()
+	b.Failure()
+	assert.Equal(t, breaker.Closed, b.State())
+
+	b.Failure()
+	assert.Equal(t, breaker.Open, b.State())
+	assert.False(t, b.Allow())
+
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, b.Allow())
+	assert.Equal(t, breaker.HalfOpen, b.State())
+
+	// failed probe opens circuit again
+	b.Failure()
+	assert.Equal(t, breaker.Open, b.State())
+	assert.False(t, b.Allow())
+
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, b.Allow())
+	b.Success()
+	assert.Equal(t, breaker.Closed, b.State())
+
+	assert.Equal(t, []string{
+		"twilio:closed->open",
+		"twilio:open->half-open",
+		"twilio:half-open->open",
+		"twilio:open->half-open",
+		"twilio:half-open->closed",
+	}, transitions)
+}
+
+func TestBreaker_Trip(t *testing.T) {
+	b := breaker.New("twilio", breaker.Config{FailureThreshold: 5, OpenTimeout: time.Hour}, nil)
+
+	b.Trip()
+	assert.Equal(t, breaker.Open, b.State())
+	assert.False(t, b.Allow())
+}
@@ -0,0 +1,97 @@
+package buffer
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"time"
+)
+
+var (
+	// ErrMessageNotFound returned when message does not exist or is in the state action cant be applied to
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrPauseNotFound returned when sending is not paused for given scope
+	ErrPauseNotFound = errors.New("pause not found")
+)
+
+// States of recipients messages are listed by
+const (
+	// StatePending - recipient waits in the queue and can be sent right away
+	StatePending = "pending"
+	// StateScheduled - recipient waits in the queue until message send_after
+	StateScheduled = "scheduled"
+	// StateFailed - recipient cant be reached
+	StateFailed = RecipientFailed
+	// StateDeadLettered - attempts to deliver to the recipient ran out
+	StateDeadLettered = RecipientDeadLettered
+	// StateCancelled - recipient was removed from the queue by operator
+	StateCancelled = RecipientCancelled
+)
+
+// States lists every state messages can be listed by
+var States = []string{StatePending, StateScheduled, StateFailed, StateDeadLettered, StateCancelled}
+
+// Admin describes management of the queue by operators
+type Admin interface {
+	// ListMessages returns messages having recipients matching the filter, ordered by message ID.
+	// Only recipients matching the filter are listed with the message.
+	ListMessages(ctx context.Context, filter *MessageFilter) ([]*MessageDetails, error)
+	// CancelMessage removes message waiting in the queue and returns number of recipients cancelled
+	CancelMessage(ctx context.Context, messageID int64) (int, error)
+	// RequeueMessage moves failed, dead-lettered, cancelled and still pending recipients of processed message back to the queue
+	// and returns number of recipients requeued. Attempts of requeued recipients start over.
+	RequeueMessage(ctx context.Context, messageID int64) (int, error)
+	// PurgeOriginator removes every message of the originator waiting in the queue and returns number of recipients cancelled
+	PurgeOriginator(ctx context.Context, originator string) (int, error)
+
+	// PauseSending stops taking messages of the pause scope from the queue, messages are still accepted into the queue.
+	// Pausing scope already paused updates its reason and operator, pause keeps the time it was made.
+	PauseSending(ctx context.Context, pause *Pause) error
+	// ResumeSending lifts the pause of given scope and value
+	ResumeSending(ctx context.Context, scope, value string) error
+	// ListPauses returns pauses in effect, ordered by the time they were made
+	ListPauses(ctx context.Context) ([]*Pause, error)
+}
+
+// Scopes of pauses
+const (
+	// PauseGlobal pauses every message
+	PauseGlobal = "global"
+	// PauseOriginator pauses messages of the originator
+	PauseOriginator = "originator"
+	// PauseTenant pauses messages enqueued by the tenant
+	PauseTenant = "tenant"
+)
+
+// PauseScopes lists every scope sending can be paused for
+var PauseScopes = []string{PauseGlobal, PauseOriginator, PauseTenant}
+
+// Pause holds messages of the scope in the queue until it is resumed
+type Pause struct {
+	Scope string `db:"scope"`
+	// Value is originator or tenant ID paused, empty for global pause
+	Value    string `db:"value"`
+	Reason   string `db:"reason"`
+	PausedBy string `db:"paused_by"`
+	// CreatedAt is set by the store when pause is made
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// MessageFilter selects messages listed to operators, empty fields do not filter.
+// Filter is audited along with the listing, so it is named the way admin API names its query parameters.
+type MessageFilter struct {
+	// State of recipients, one of States
+	State       string `json:"state,omitempty"`
+	Originator  string `json:"originator,omitempty"`
+	TenantID    string `json:"tenant_id,omitempty"`
+	PhoneNumber string `json:"recipient,omitempty"`
+	// AfterID lists messages with greater ID only, ID of the last message listed is passed to get the next page
+	AfterID int64 `json:"after_id,omitempty"`
+	// Limit is maximum number of messages listed
+	Limit int `json:"limit,omitempty"`
+}
+
+// MessageDetails is message along with its recipients
+type MessageDetails struct {
+	Message
+	Recipients []*Recipient
+}
@@ -2,6 +2,7 @@ package buffer
 
 import (
 	"context"
+	"time"
 )
 
 // Buffer describes behaviour of buffered store
@@ -11,5 +12,13 @@ type Buffer interface {
 	// GetRecipientsForMessageID returns list of recipients for given message ID
 	GetRecipientsForMessageID(context.Context, int64) ([]*Recipient, error)
 	// SaveMessageForRecipient stores next message into waiting queue
-	SaveMessageForRecipient(ctx context.Context, phoneNumber, originator, text string) error
+	SaveMessageForRecipient(ctx context.Context, phoneNumber string, message *Message) error
+	// UpdateRecipientStatus stores delivery status, error code and attempts of the recipient
+	UpdateRecipientStatus(context.Context, *Recipient) error
+	// RequeueRecipients moves recipients of processed message into new message waiting in the queue till sendAfter, nil sendAfter means right away
+	RequeueRecipients(ctx context.Context, message *Message, recipients []*Recipient, sendAfter *time.Time) error
+	// CountPendingMessages returns number of messages waiting in the queue by priority
+	CountPendingMessages(context.Context) (map[int]int, error)
+	// CountQueuedRecipients returns number of recipients waiting in the queue by queue state
+	CountQueuedRecipients(context.Context) (map[string]int, error)
 }
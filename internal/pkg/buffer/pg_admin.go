@@ -0,0 +1,259 @@
+package buffer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// ListMessages returns messages having recipients matching the filter, ordered by message ID
+func (pb *PostgresBuffer) ListMessages(ctx context.Context, filter *MessageFilter) (messages []*MessageDetails, err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.ListMessages", tracing.KindClient)
+	defer func() { span.Finish(err) }()
+
+	if filter == nil {
+		filter = &MessageFilter{}
+	}
+	conditions, args, err := filterConditions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT DISTINCT m.message_id, m.originator, m.text, m.processed, m.priority, m.created_at, m.send_after, COALESCE(m.tenant_id, '') AS tenant_id FROM messages m JOIN recipients r ON r.message_id = m.message_id WHERE " + strings.Join(conditions, " AND ") + " ORDER BY m.message_id"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	if err = pb.SelectContext(ctx, &messages, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to list messages")
+	}
+	if len(messages) == 0 {
+		return messages, nil
+	}
+
+	// recipients of the listed page only, matching same filter
+	conditions = append(conditions, fmt.Sprintf("r.message_id BETWEEN $%d AND $%d", len(args)+1, len(args)+2))
+	args = append(args, messages[0].MessageID, messages[len(messages)-1].MessageID)
+
+	var recipients []*Recipient
+	err = pb.SelectContext(ctx, &recipients, "SELECT r.message_id, r.phone_number, r.status, COALESCE(r.error_code, 0) AS error_code, r.attempts, COALESCE(r.trace_parent, '') AS trace_parent FROM recipients r JOIN messages m ON m.message_id = r.message_id WHERE "+strings.Join(conditions, " AND ")+" ORDER BY r.message_id, r.phone_number", args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list recipients")
+	}
+
+	byID := make(map[int64]*MessageDetails, len(messages))
+	for _, message := range messages {
+		byID[message.MessageID] = message
+	}
+	for _, recipient := range recipients {
+		if message, ok := byID[recipient.MessageID]; ok {
+			message.Recipients = append(message.Recipients, recipient)
+		}
+	}
+
+	return messages, nil
+}
+
+// filterConditions converts filter into query conditions on messages m joined with recipients r
+func filterConditions(filter *MessageFilter) ([]string, []interface{}, error) {
+	var (
+		conditions = []string{"TRUE"}
+		args       []interface{}
+	)
+	arg := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	switch filter.State {
+	case "":
+	case StatePending:
+		conditions = append(conditions, "m.processed=FALSE", "r.status='pending'", "(m.send_after IS NULL OR m.send_after <= now())")
+	case StateScheduled:
+		conditions = append(conditions, "m.processed=FALSE", "r.status='pending'", "m.send_after > now()")
+	case StateFailed, StateDeadLettered, StateCancelled:
+		arg("r.status=$%d", filter.State)
+	default:
+		return nil, nil, errors.Errorf("unknown state %s", filter.State)
+	}
+	if len(filter.Originator) > 0 {
+		arg("m.originator=$%d", filter.Originator)
+	}
+	if len(filter.TenantID) > 0 {
+		arg("m.tenant_id=$%d", filter.TenantID)
+	}
+	if len(filter.PhoneNumber) > 0 {
+		arg("r.phone_number=$%d", filter.PhoneNumber)
+	}
+	if filter.AfterID > 0 {
+		arg("m.message_id > $%d", filter.AfterID)
+	}
+
+	return conditions, args, nil
+}
+
+// CancelMessage removes message waiting in the queue and returns number of recipients cancelled.
+// Message already taken from the queue by messenger cant be cancelled.
+func (pb *PostgresBuffer) CancelMessage(ctx context.Context, messageID int64) (cancelled int, err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.CancelMessage", tracing.KindClient)
+	defer func() { span.Finish(err) }()
+
+	tx, err := pb.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create new transaction")
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.GetContext(ctx, &id, "SELECT message_id FROM messages WHERE message_id=$1 AND processed=FALSE FOR UPDATE", messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrMessageNotFound
+		}
+		return 0, errors.Wrapf(err, "failed to get message %d", messageID)
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE messages SET processed=TRUE WHERE message_id=$1", messageID); err != nil {
+		return 0, errors.Wrapf(err, "failed to remove message %d from the queue", messageID)
+	}
+
+	result, err := tx.ExecContext(ctx, "UPDATE recipients SET status='cancelled' WHERE message_id=$1 AND status='pending'", messageID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to cancel recipients of message %d", messageID)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get number of cancelled recipients")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return int(affected), nil
+}
+
+// RequeueMessage moves failed, dead-lettered, cancelled and still pending recipients of processed message into new message waiting in the queue
+func (pb *PostgresBuffer) RequeueMessage(ctx context.Context, messageID int64) (requeued int, err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.RequeueMessage", tracing.KindClient)
+	defer func() { span.Finish(err) }()
+
+	tx, err := pb.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create new transaction")
+	}
+	defer tx.Rollback()
+
+	message := &Message{}
+	err = tx.GetContext(ctx, message, "SELECT message_id, originator, text, priority, COALESCE(tenant_id, '') AS tenant_id, COALESCE(category, '') AS category, COALESCE(time_zone, '') AS time_zone FROM messages WHERE message_id=$1 AND processed=TRUE FOR UPDATE", messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrMessageNotFound
+		}
+		return 0, errors.Wrapf(err, "failed to get message %d", messageID)
+	}
+
+	var msgID int64
+	err = tx.QueryRowContext(ctx, "INSERT INTO messages (originator, text, priority, tenant_id, category, time_zone) VALUES($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, '')) RETURNING message_id", message.Originator, message.Text, message.Priority, message.TenantID, message.Category, message.TimeZone).Scan(&msgID)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to save message")
+	}
+
+	result, err := tx.ExecContext(ctx, "UPDATE recipients SET message_id=$1, status='pending', error_code=NULL, attempts=0 WHERE message_id=$2 AND status IN ('failed', 'dead_lettered', 'cancelled', 'pending')", msgID, messageID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to requeue recipients of message %d", messageID)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get number of requeued recipients")
+	}
+	if affected == 0 {
+		// nothing to requeue, new message is rolled back
+		return 0, nil
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return int(affected), nil
+}
+
+// PurgeOriginator removes every message of the originator waiting in the queue and returns number of recipients cancelled
+func (pb *PostgresBuffer) PurgeOriginator(ctx context.Context, originator string) (cancelled int, err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.PurgeOriginator", tracing.KindClient)
+	defer func() { span.Finish(err) }()
+
+	if len(originator) == 0 {
+		return 0, errors.New("originator cant be empty")
+	}
+
+	result, err := pb.ExecContext(ctx, `WITH purged AS (UPDATE messages SET processed=TRUE WHERE originator=$1 AND processed=FALSE RETURNING message_id)
+		UPDATE recipients SET status='cancelled' WHERE status='pending' AND message_id IN (SELECT message_id FROM purged)`, originator)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to purge messages of originator %s", originator)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get number of cancelled recipients")
+	}
+
+	return int(affected), nil
+}
+
+// PauseSending stores the pause and sets its creation time, messenger skips messages of paused scopes when taking next message from the queue
+func (pb *PostgresBuffer) PauseSending(ctx context.Context, pause *Pause) (err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.PauseSending", tracing.KindClient)
+	defer func() { span.Finish(err) }()
+
+	if pause == nil || len(pause.Scope) == 0 || len(pause.PausedBy) == 0 {
+		return errors.New("scope and operator of the pause cant be empty")
+	}
+
+	stmt, err := pb.PrepareNamedContext(ctx, "INSERT INTO pauses (scope, value, reason, paused_by) VALUES(:scope, :value, NULLIF(:reason, ''), :paused_by) ON CONFLICT (scope, value) DO UPDATE SET reason=EXCLUDED.reason, paused_by=EXCLUDED.paused_by RETURNING created_at")
+	if err != nil {
+		return errors.Wrap(err, "failed to prepare insert statement")
+	}
+	defer stmt.Close()
+
+	if err = stmt.GetContext(ctx, &pause.CreatedAt, pause); err != nil {
+		return errors.Wrapf(err, "failed to pause %s %s", pause.Scope, pause.Value)
+	}
+
+	return nil
+}
+
+// ResumeSending removes the pause of given scope and value
+func (pb *PostgresBuffer) ResumeSending(ctx context.Context, scope, value string) (err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.ResumeSending", tracing.KindClient)
+	defer func() { span.Finish(err) }()
+
+	result, err := pb.ExecContext(ctx, "DELETE FROM pauses WHERE scope=$1 AND value=$2", scope, value)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resume %s %s", scope, value)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get number of resumed pauses")
+	}
+	if affected == 0 {
+		return ErrPauseNotFound
+	}
+
+	return nil
+}
+
+// ListPauses returns pauses in effect, ordered by the time they were made
+func (pb *PostgresBuffer) ListPauses(ctx context.Context) (pauses []*Pause, err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.ListPauses", tracing.KindClient)
+	defer func() { span.Finish(err) }()
+
+	err = pb.SelectContext(ctx, &pauses, "SELECT scope, value, COALESCE(reason, '') AS reason, paused_by, created_at FROM pauses ORDER BY created_at, scope, value")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pauses")
+	}
+
+	return pauses, nil
+}
@@ -0,0 +1,422 @@
+package buffer_test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestPostgresBuffer_ListMessages(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	messageColumns := []string{"message_id", "originator", "text", "processed", "priority", "created_at", "send_after", "tenant_id"}
+	recipientColumns := []string{"message_id", "phone_number", "status", "error_code", "attempts", "trace_parent"}
+
+	tests := []struct {
+		name    string
+		DB      func() (*sqlx.DB, sqlmock.Sqlmock)
+		filter  *buffer.MessageFilter
+		want    []*buffer.MessageDetails
+		wantErr bool
+	}{
+		{
+			"Dead-lettered messages of originator",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				mock.MatchExpectationsInOrder(true)
+
+				mock.ExpectQuery(`^SELECT DISTINCT m.message_id, m.originator, m.text, m.processed, m.priority, m.created_at, m.send_after, COALESCE\(m.tenant_id, ''\) AS tenant_id FROM messages m JOIN recipients r ON r.message_id = m.message_id WHERE TRUE AND r.status=\$1 AND m.originator=\$2 AND m.message_id > \$3 ORDER BY m.message_id LIMIT 2$`).WithArgs(buffer.StateDeadLettered, "MockedOriginator", 10).WillReturnRows(
+					sqlmock.NewRows(messageColumns).
+						AddRow(11, "MockedOriginator", "MockedText", true, buffer.PriorityNormal, createdAt, nil, "acme").
+						AddRow(12, "MockedOriginator", "MockedText2", true, buffer.PriorityHigh, createdAt, nil, ""))
+				mock.ExpectQuery(`^SELECT r.message_id, r.phone_number, r.status, COALESCE\(r.error_code, 0\) AS error_code, r.attempts, COALESCE\(r.trace_parent, ''\) AS trace_parent FROM recipients r JOIN messages m ON m.message_id = r.message_id WHERE TRUE AND r.status=\$1 AND m.originator=\$2 AND m.message_id > \$3 AND r.message_id BETWEEN \$4 AND \$5 ORDER BY r.message_id, r.phone_number$`).WithArgs(buffer.StateDeadLettered, "MockedOriginator", 10, 11, 12).WillReturnRows(
+					sqlmock.NewRows(recipientColumns).
+						AddRow(11, "1", buffer.RecipientDeadLettered, 0, 3, "").
+						AddRow(11, "2", buffer.RecipientDeadLettered, 20429, 3, "").
+						AddRow(12, "3", buffer.RecipientDeadLettered, 0, 3, ""))
+
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			&buffer.MessageFilter{State: buffer.StateDeadLettered, Originator: "MockedOriginator", AfterID: 10, Limit: 2},
+			[]*buffer.MessageDetails{
+				{
+					Message: buffer.Message{MessageID: 11, Originator: "MockedOriginator", Text: "MockedText", Processed: true, Priority: buffer.PriorityNormal, CreatedAt: createdAt, TenantID: "acme"},
+					Recipients: []*buffer.Recipient{
+						{MessageID: 11, PhoneNumber: "1", Status: buffer.RecipientDeadLettered, Attempts: 3},
+						{MessageID: 11, PhoneNumber: "2", Status: buffer.RecipientDeadLettered, ErrorCode: 20429, Attempts: 3},
+					},
+				},
+				{
+					Message: buffer.Message{MessageID: 12, Originator: "MockedOriginator", Text: "MockedText2", Processed: true, Priority: buffer.PriorityHigh, CreatedAt: createdAt},
+					Recipients: []*buffer.Recipient{
+						{MessageID: 12, PhoneNumber: "3", Status: buffer.RecipientDeadLettered, Attempts: 3},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Scheduled messages to recipient",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				mock.MatchExpectationsInOrder(true)
+
+				mock.ExpectQuery(`WHERE TRUE AND m.processed=FALSE AND r.status='pending' AND m.send_after > now\(\) AND r.phone_number=\$1 ORDER BY m.message_id$`).WithArgs("1").WillReturnRows(
+					sqlmock.NewRows(messageColumns))
+
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			&buffer.MessageFilter{State: buffer.StateScheduled, PhoneNumber: "1"},
+			nil,
+			false,
+		},
+		{
+			"Unknown state",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			&buffer.MessageFilter{State: "sent"},
+			nil,
+			true,
+		},
+		{
+			"Failed to list messages",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				mock.ExpectQuery(`^SELECT DISTINCT`).WillReturnError(errors.New("error"))
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			nil,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.DB()
+			pb := &buffer.PostgresBuffer{DB: db}
+			defer pb.Close()
+
+			got, err := pb.ListMessages(context.Background(), tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PostgresBuffer.ListMessages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PostgresBuffer.ListMessages() = %v, want %v", got, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
+
+func TestPostgresBuffer_CancelMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		DB      func() (*sqlx.DB, sqlmock.Sqlmock)
+		want    int
+		wantErr error
+	}{
+		{
+			"Success",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				mock.MatchExpectationsInOrder(true)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(`^SELECT message_id FROM messages WHERE message_id=\$1 AND processed=FALSE FOR UPDATE$`).WithArgs(1).WillReturnRows(
+					sqlmock.NewRows([]string{"message_id"}).AddRow(1))
+				mock.ExpectExec(`^UPDATE messages SET processed=TRUE WHERE message_id=\$1$`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`^UPDATE recipients SET status='cancelled' WHERE message_id=\$1 AND status='pending'$`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			2,
+			nil,
+		},
+		{
+			"Message is not in the queue",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				mock.MatchExpectationsInOrder(true)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(`^SELECT message_id FROM messages`).WithArgs(1).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			0,
+			buffer.ErrMessageNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.DB()
+			pb := &buffer.PostgresBuffer{DB: db}
+			defer pb.Close()
+
+			got, err := pb.CancelMessage(context.Background(), 1)
+			if err != tt.wantErr {
+				t.Errorf("PostgresBuffer.CancelMessage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("PostgresBuffer.CancelMessage() = %v, want %v", got, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
+
+func TestPostgresBuffer_RequeueMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		DB      func() (*sqlx.DB, sqlmock.Sqlmock)
+		want    int
+		wantErr error
+	}{
+		{
+			"Success",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				mock.MatchExpectationsInOrder(true)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(`^SELECT message_id, originator, text, priority, COALESCE\(tenant_id, ''\) AS tenant_id, COALESCE\(category, ''\) AS category, COALESCE\(time_zone, ''\) AS time_zone FROM messages WHERE message_id=\$1 AND processed=TRUE FOR UPDATE$`).WithArgs(1).WillReturnRows(
+					sqlmock.NewRows([]string{"message_id", "originator", "text", "priority", "tenant_id", "category", "time_zone"}).AddRow(1, "MockedOriginator", "MockedText", buffer.PriorityHigh, "acme", "marketing", "Europe/Berlin"))
+				mock.ExpectQuery(`^INSERT INTO messages \(originator, text, priority, tenant_id, category, time_zone\) VALUES\(\$1, \$2, \$3, NULLIF\(\$4, ''\), NULLIF\(\$5, ''\), NULLIF\(\$6, ''\)\) RETURNING message_id$`).WithArgs("MockedOriginator", "MockedText", buffer.PriorityHigh, "acme", "marketing", "Europe/Berlin").WillReturnRows(
+					sqlmock.NewRows([]string{"message_id"}).AddRow(2))
+				mock.ExpectExec(`^UPDATE recipients SET message_id=\$1, status='pending', error_code=NULL, attempts=0 WHERE message_id=\$2 AND status IN \('failed', 'dead_lettered', 'cancelled', 'pending'\)$`).WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectCommit()
+
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			3,
+			nil,
+		},
+		{
+			"Pending recipients of processed message",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				mock.MatchExpectationsInOrder(true)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(`^SELECT message_id, originator, text, priority, COALESCE`).WithArgs(1).WillReturnRows(
+					sqlmock.NewRows([]string{"message_id", "originator", "text", "priority"}).AddRow(1, "MockedOriginator", "MockedText", buffer.PriorityNormal))
+				mock.ExpectQuery(`^INSERT INTO messages`).WillReturnRows(sqlmock.NewRows([]string{"message_id"}).AddRow(2))
+				mock.ExpectExec(`^UPDATE recipients SET .* WHERE message_id=\$2 AND status IN \(.*'pending'\)$`).WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			2,
+			nil,
+		},
+		{
+			"Nothing to requeue",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				mock.MatchExpectationsInOrder(true)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(`^SELECT message_id, originator, text, priority, COALESCE`).WithArgs(1).WillReturnRows(
+					sqlmock.NewRows([]string{"message_id", "originator", "text", "priority"}).AddRow(1, "MockedOriginator", "MockedText", buffer.PriorityHigh))
+				mock.ExpectQuery(`^INSERT INTO messages`).WillReturnRows(sqlmock.NewRows([]string{"message_id"}).AddRow(2))
+				mock.ExpectExec(`^UPDATE recipients`).WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			0,
+			nil,
+		},
+		{
+			"Message is still in the queue",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				mock.MatchExpectationsInOrder(true)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(`^SELECT message_id, originator, text, priority, COALESCE`).WithArgs(1).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			0,
+			buffer.ErrMessageNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.DB()
+			pb := &buffer.PostgresBuffer{DB: db}
+			defer pb.Close()
+
+			got, err := pb.RequeueMessage(context.Background(), 1)
+			if err != tt.wantErr {
+				t.Errorf("PostgresBuffer.RequeueMessage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("PostgresBuffer.RequeueMessage() = %v, want %v", got, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
+
+func TestPostgresBuffer_PurgeOriginator(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec(`^WITH purged AS \(UPDATE messages SET processed=TRUE WHERE originator=\$1 AND processed=FALSE RETURNING message_id\)\s+UPDATE recipients SET status='cancelled' WHERE status='pending' AND message_id IN \(SELECT message_id FROM purged\)$`).WithArgs("MockedOriginator").WillReturnResult(sqlmock.NewResult(0, 5))
+
+	pb := &buffer.PostgresBuffer{DB: sqlx.NewDb(db, "sqlmock")}
+	defer pb.Close()
+
+	got, err := pb.PurgeOriginator(context.Background(), "MockedOriginator")
+	if err != nil {
+		t.Errorf("PostgresBuffer.PurgeOriginator() error = %v", err)
+		return
+	}
+	if got != 5 {
+		t.Errorf("PostgresBuffer.PurgeOriginator() = %v, want %v", got, 5)
+	}
+	if mock.ExpectationsWereMet() != nil {
+		t.Error("Not all expectations were met")
+	}
+}
+
+func TestPostgresBuffer_PauseSending(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		DB      func() (*sqlx.DB, sqlmock.Sqlmock)
+		pause   *buffer.Pause
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			"Success",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				mock.ExpectPrepare(`^INSERT INTO pauses \(scope, value, reason, paused_by\) VALUES\(\?, \?, NULLIF\(\?, ''\), \?\) ON CONFLICT \(scope, value\) DO UPDATE SET reason=EXCLUDED.reason, paused_by=EXCLUDED.paused_by RETURNING created_at$`).ExpectQuery().
+					WithArgs(buffer.PauseOriginator, "MockedOriginator", "wrong template", "ops").WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(createdAt))
+
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			&buffer.Pause{Scope: buffer.PauseOriginator, Value: "MockedOriginator", Reason: "wrong template", PausedBy: "ops"},
+			createdAt,
+			false,
+		},
+		{
+			"Missing operator",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			&buffer.Pause{Scope: buffer.PauseGlobal},
+			time.Time{},
+			true,
+		},
+		{
+			"DB Error",
+			func() (*sqlx.DB, sqlmock.Sqlmock) {
+				db, mock, _ := sqlmock.New()
+				mock.ExpectPrepare(`^INSERT INTO pauses`).ExpectQuery().WillReturnError(errors.New("error"))
+				return sqlx.NewDb(db, "sqlmock"), mock
+			},
+			&buffer.Pause{Scope: buffer.PauseGlobal, PausedBy: "ops"},
+			time.Time{},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.DB()
+			pb := &buffer.PostgresBuffer{DB: db}
+			defer pb.Close()
+
+			if err := pb.PauseSending(context.Background(), tt.pause); (err != nil) != tt.wantErr {
+				t.Errorf("PostgresBuffer.PauseSending() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.pause.CreatedAt.Equal(tt.want) {
+				t.Errorf("PostgresBuffer.PauseSending() created at = %v, want %v", tt.pause.CreatedAt, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
+
+func TestPostgresBuffer_ResumeSending(t *testing.T) {
+	tests := []struct {
+		name     string
+		affected int64
+		wantErr  error
+	}{
+		{"Success", 1, nil},
+		{"Not paused", 0, buffer.ErrPauseNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			mock.ExpectExec(`^DELETE FROM pauses WHERE scope=\$1 AND value=\$2$`).WithArgs(buffer.PauseTenant, "acme").WillReturnResult(sqlmock.NewResult(0, tt.affected))
+
+			pb := &buffer.PostgresBuffer{DB: sqlx.NewDb(db, "sqlmock")}
+			defer pb.Close()
+
+			if err := pb.ResumeSending(context.Background(), buffer.PauseTenant, "acme"); err != tt.wantErr {
+				t.Errorf("PostgresBuffer.ResumeSending() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
+
+func TestPostgresBuffer_ListPauses(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	db, mock, _ := sqlmock.New()
+	mock.ExpectQuery(`^SELECT scope, value, COALESCE\(reason, ''\) AS reason, paused_by, created_at FROM pauses ORDER BY created_at, scope, value$`).WillReturnRows(
+		sqlmock.NewRows([]string{"scope", "value", "reason", "paused_by", "created_at"}).
+			AddRow(buffer.PauseGlobal, "", "incident", "ops", createdAt).
+			AddRow(buffer.PauseTenant, "acme", "", "ops", createdAt))
+
+	pb := &buffer.PostgresBuffer{DB: sqlx.NewDb(db, "sqlmock")}
+	defer pb.Close()
+
+	got, err := pb.ListPauses(context.Background())
+	if err != nil {
+		t.Errorf("PostgresBuffer.ListPauses() error = %v", err)
+		return
+	}
+	want := []*buffer.Pause{
+		{Scope: buffer.PauseGlobal, Reason: "incident", PausedBy: "ops", CreatedAt: createdAt},
+		{Scope: buffer.PauseTenant, Value: "acme", PausedBy: "ops", CreatedAt: createdAt},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PostgresBuffer.ListPauses() = %v, want %v", got, want)
+	}
+	if mock.ExpectationsWereMet() != nil {
+		t.Error("Not all expectations were met")
+	}
+}
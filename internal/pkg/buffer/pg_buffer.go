@@ -3,8 +3,10 @@ package buffer
 import (
 	"context"
 	"database/sql"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
+	"time"
 	// Postgres driver
 	_ "github.com/lib/pq"
 )
@@ -12,10 +14,13 @@ import (
 // PostgresBuffer implements Buffer interface for Postgres
 type PostgresBuffer struct {
 	*sqlx.DB
+
+	// StarvationTimeout is maximum time message waits before it is served regardless of its priority
+	StarvationTimeout time.Duration
 }
 
 // NewPostgresBuffer creates new instance of PostgresBuffer
-func NewPostgresBuffer(connString string, maxConnections int) (*PostgresBuffer, error) {
+func NewPostgresBuffer(connString string, maxConnections int, starvationTimeout time.Duration) (*PostgresBuffer, error) {
 	if len(connString) == 0 {
 		return nil, errors.New("connection string cant be empty")
 	}
@@ -30,22 +35,34 @@ func NewPostgresBuffer(connString string, maxConnections int) (*PostgresBuffer,
 	db.SetMaxOpenConns(maxConnections)
 
 	return &PostgresBuffer{
-		DB: db,
+		DB:                db,
+		StarvationTimeout: starvationTimeout,
 	}, nil
 }
 
-// PopNextMessage takes next available message waiting for processing from messages queue and marks it as processed
-func (pb *PostgresBuffer) PopNextMessage(ctx context.Context) (*Message, error) {
-	var (
-		message = &Message{}
-	)
+// PopNextMessage takes next available message waiting for processing from messages queue and marks it as processed.
+// Messages with higher priority are served first, unless lower priority message waits longer than starvation timeout.
+// Messages scheduled for later are skipped until their send time, waiting time of such messages starts at send time.
+// Messages of paused originators and tenants, or every message while sending is paused globally, stay in the queue.
+func (pb *PostgresBuffer) PopNextMessage(ctx context.Context) (message *Message, err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.PopNextMessage", tracing.KindClient)
+	defer func() {
+		if err == sql.ErrNoRows {
+			// queue is polled every second, empty polls are not traced
+			span.Discard()
+			return
+		}
+		span.Finish(err)
+	}()
+
+	message = &Message{}
 	tx, err := pb.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create new transaction")
 	}
 	defer tx.Rollback()
 
-	err = tx.GetContext(ctx, message, "SELECT message_id, originator, text  FROM messages WHERE message_id = (SELECT MIN(message_id) FROM messages WHERE processed=FALSE) FOR UPDATE")
+	err = tx.GetContext(ctx, message, "SELECT message_id, originator, text, priority, created_at, send_after, COALESCE(tenant_id, '') AS tenant_id, COALESCE(category, '') AS category, COALESCE(time_zone, '') AS time_zone FROM messages WHERE processed=FALSE AND (send_after IS NULL OR send_after <= now()) AND NOT EXISTS (SELECT 1 FROM pauses p WHERE p.scope='global' OR (p.scope='originator' AND p.value=messages.originator) OR (p.scope='tenant' AND p.value=messages.tenant_id)) ORDER BY COALESCE(send_after, created_at) < now() - $1 * interval '1 second' DESC, priority DESC, message_id LIMIT 1 FOR UPDATE", pb.StarvationTimeout.Seconds())
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, err
@@ -67,9 +84,15 @@ func (pb *PostgresBuffer) PopNextMessage(ctx context.Context) (*Message, error)
 	return message, nil
 }
 
-// SaveMessageForRecipient saves message into the queue
-func (pb *PostgresBuffer) SaveMessageForRecipient(ctx context.Context, phoneNumber, originator, text string) error {
-	if len(phoneNumber) == 0 || len(originator) == 0 || len(text) == 0 {
+// SaveMessageForRecipient saves message into the queue, recipient joins unprocessed message with same originator, text, priority, send time,
+// tenant, category and time zone
+func (pb *PostgresBuffer) SaveMessageForRecipient(ctx context.Context, phoneNumber string, message *Message) (err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.SaveMessageForRecipient", tracing.KindProducer)
+	defer func() { span.Finish(err) }()
+	// recipient keeps trace of the request it was enqueued with, sending is a child of the producer span
+	traceParent := tracing.Traceparent(ctx)
+
+	if len(phoneNumber) == 0 || message == nil || len(message.Originator) == 0 || len(message.Text) == 0 {
 		return errors.New("input arguments cant be empty")
 	}
 
@@ -80,7 +103,7 @@ func (pb *PostgresBuffer) SaveMessageForRecipient(ctx context.Context, phoneNumb
 	defer tx.Rollback()
 
 	var unprocessedMesages []*Message
-	if err = tx.SelectContext(ctx, &unprocessedMesages, "SELECT message_id, originator, text, processed FROM messages WHERE originator=$1 AND text=$2 AND processed = FALSE FOR UPDATE", originator, text); err != nil {
+	if err = tx.SelectContext(ctx, &unprocessedMesages, "SELECT message_id, originator, text, processed, priority, send_after FROM messages WHERE originator=$1 AND text=$2 AND priority=$3 AND send_after IS NOT DISTINCT FROM $4 AND tenant_id IS NOT DISTINCT FROM NULLIF($5, '') AND category IS NOT DISTINCT FROM NULLIF($6, '') AND time_zone IS NOT DISTINCT FROM NULLIF($7, '') AND processed = FALSE FOR UPDATE", message.Originator, message.Text, message.Priority, message.SendAfter, message.TenantID, message.Category, message.TimeZone); err != nil {
 		return errors.Wrap(err, "failed to select unprocessed messages")
 	}
 
@@ -88,20 +111,20 @@ func (pb *PostgresBuffer) SaveMessageForRecipient(ctx context.Context, phoneNumb
 	if len(unprocessedMesages) > 0 {
 		msgID = unprocessedMesages[0].MessageID
 	} else {
-		stmt, err := tx.PrepareContext(ctx, "INSERT INTO messages (originator, text) VALUES($1, $2) RETURNING message_id")
+		stmt, err := tx.PrepareContext(ctx, "INSERT INTO messages (originator, text, priority, send_after, tenant_id, category, time_zone) VALUES($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, '')) RETURNING message_id")
 		if err != nil {
 			return errors.Wrap(err, "failed to prepare insert statement")
 		}
 		defer stmt.Close()
 
-		err = stmt.QueryRowContext(ctx, originator, text).Scan(&msgID)
+		err = stmt.QueryRowContext(ctx, message.Originator, message.Text, message.Priority, message.SendAfter, message.TenantID, message.Category, message.TimeZone).Scan(&msgID)
 		if err != nil {
 			return errors.Wrap(err, "failed to save message")
 		}
 
 	}
 
-	_, err = tx.NamedExecContext(ctx, "INSERT INTO recipients (message_id, phone_number) VALUES(:message_id, :phone_number) ON CONFLICT DO NOTHING", &Recipient{MessageID: msgID, PhoneNumber: phoneNumber})
+	_, err = tx.NamedExecContext(ctx, "INSERT INTO recipients (message_id, phone_number, trace_parent) VALUES(:message_id, :phone_number, NULLIF(:trace_parent, '')) ON CONFLICT DO NOTHING", &Recipient{MessageID: msgID, PhoneNumber: phoneNumber, TraceParent: traceParent})
 	if err != nil {
 		return errors.Wrap(err, "failed to save recipient")
 	}
@@ -115,13 +138,115 @@ func (pb *PostgresBuffer) SaveMessageForRecipient(ctx context.Context, phoneNumb
 }
 
 // GetRecipientsForMessageID returns list of recipients for message ID
-func (pb *PostgresBuffer) GetRecipientsForMessageID(ctx context.Context, messageID int64) ([]*Recipient, error) {
-	var recipients []*Recipient
+func (pb *PostgresBuffer) GetRecipientsForMessageID(ctx context.Context, messageID int64) (recipients []*Recipient, err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.GetRecipientsForMessageID", tracing.KindClient)
+	defer func() { span.Finish(err) }()
 
-	err := pb.SelectContext(ctx, &recipients, "SELECT message_id, phone_number FROM recipients WHERE message_id = $1", messageID)
+	err = pb.SelectContext(ctx, &recipients, "SELECT message_id, phone_number, status, COALESCE(error_code, 0) AS error_code, attempts, COALESCE(trace_parent, '') AS trace_parent FROM recipients WHERE message_id = $1", messageID)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get maximum sequence number from projection")
 	}
 
 	return recipients, nil
 }
+
+// UpdateRecipientStatus stores delivery status, error code and attempts of the recipient
+func (pb *PostgresBuffer) UpdateRecipientStatus(ctx context.Context, recipient *Recipient) (err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.UpdateRecipientStatus", tracing.KindClient)
+	defer func() { span.Finish(err) }()
+
+	if recipient == nil {
+		return errors.New("recipient cant be nil")
+	}
+
+	_, err = pb.NamedExecContext(ctx, "UPDATE recipients SET status=:status, error_code=NULLIF(:error_code, 0), attempts=:attempts WHERE message_id=:message_id AND phone_number=:phone_number", recipient)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update status of recipient %s", recipient.PhoneNumber)
+	}
+
+	return nil
+}
+
+// RequeueRecipients moves recipients of processed message into new message waiting in the queue
+func (pb *PostgresBuffer) RequeueRecipients(ctx context.Context, message *Message, recipients []*Recipient, sendAfter *time.Time) (err error) {
+	ctx, span := pb.startSpan(ctx, "buffer.RequeueRecipients", tracing.KindClient)
+	defer func() { span.Finish(err) }()
+
+	if message == nil || len(recipients) == 0 {
+		return errors.New("input arguments cant be empty")
+	}
+
+	tx, err := pb.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create new transaction")
+	}
+	defer tx.Rollback()
+
+	var msgID int64
+	err = tx.QueryRowContext(ctx, "INSERT INTO messages (originator, text, priority, send_after, tenant_id, category, time_zone) VALUES($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, '')) RETURNING message_id", message.Originator, message.Text, message.Priority, sendAfter, message.TenantID, message.Category, message.TimeZone).Scan(&msgID)
+	if err != nil {
+		return errors.Wrap(err, "failed to save message")
+	}
+
+	for _, recipient := range recipients {
+		_, err = tx.ExecContext(ctx, "UPDATE recipients SET message_id=$1, status='pending' WHERE message_id=$2 AND phone_number=$3", msgID, recipient.MessageID, recipient.PhoneNumber)
+		if err != nil {
+			return errors.Wrapf(err, "failed to requeue recipient %s", recipient.PhoneNumber)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+// CountPendingMessages returns number of unprocessed messages by priority
+func (pb *PostgresBuffer) CountPendingMessages(ctx context.Context) (map[int]int, error) {
+	var rows []struct {
+		Priority int `db:"priority"`
+		Count    int `db:"count"`
+	}
+
+	err := pb.SelectContext(ctx, &rows, "SELECT priority, COUNT(*) AS count FROM messages WHERE processed=FALSE GROUP BY priority")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count pending messages")
+	}
+
+	counts := make(map[int]int, len(rows))
+	for _, row := range rows {
+		counts[row.Priority] = row.Count
+	}
+
+	return counts, nil
+}
+
+// CountQueuedRecipients returns number of recipients of unprocessed messages by queue state
+func (pb *PostgresBuffer) CountQueuedRecipients(ctx context.Context) (map[string]int, error) {
+	var rows []struct {
+		State string `db:"state"`
+		Count int    `db:"count"`
+	}
+
+	err := pb.SelectContext(ctx, &rows, `SELECT CASE WHEN r.attempts > 0 THEN 'retrying' WHEN m.send_after > now() THEN 'scheduled' ELSE 'due' END AS state, COUNT(*) AS count
+		FROM recipients r JOIN messages m ON m.message_id = r.message_id WHERE m.processed=FALSE GROUP BY 1`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count queued recipients")
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.State] = row.Count
+	}
+
+	return counts, nil
+}
+
+// startSpan starts span of buffer query
+func (pb *PostgresBuffer) startSpan(ctx context.Context, name string, kind tracing.Kind) (context.Context, *tracing.Span) {
+	ctx, span := tracing.StartSpan(ctx, name, kind)
+	span.SetAttribute("db.system", "postgresql")
+	return ctx, span
+}
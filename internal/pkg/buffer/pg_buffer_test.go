@@ -3,17 +3,23 @@ package buffer_test
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"github.com/DATA-DOG/go-sqlmock"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
 func TestPostgresBuffer_PopNextMessage(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
 	type fields struct {
 		DB func() (*sqlx.DB, sqlmock.Sqlmock)
 	}
@@ -35,8 +41,8 @@ func TestPostgresBuffer_PopNextMessage(t *testing.T) {
 					mock.MatchExpectationsInOrder(true)
 
 					mock.ExpectBegin()
-					mock.ExpectQuery(`SELECT message_id, originator, text  FROM messages WHERE message_id = \(SELECT MIN\(message_id\) FROM messages WHERE processed=FALSE\)`).WillReturnRows(
-						sqlmock.NewRows([]string{"message_id", "originator", "text"}).AddRow(1, "MockedOriginator", "MockedText"))
+					mock.ExpectQuery(`^SELECT message_id, originator, text, priority, created_at, send_after, COALESCE\(tenant_id, ''\) AS tenant_id, COALESCE\(category, ''\) AS category, COALESCE\(time_zone, ''\) AS time_zone FROM messages WHERE processed=FALSE AND \(send_after IS NULL OR send_after <= now\(\)\) AND NOT EXISTS \(SELECT 1 FROM pauses p WHERE p.scope='global' OR \(p.scope='originator' AND p.value=messages.originator\) OR \(p.scope='tenant' AND p.value=messages.tenant_id\)\) ORDER BY COALESCE\(send_after, created_at\) < now\(\) - \$1 \* interval '1 second' DESC, priority DESC, message_id LIMIT 1 FOR UPDATE$`).WithArgs(float64(60)).WillReturnRows(
+						sqlmock.NewRows([]string{"message_id", "originator", "text", "priority", "created_at", "send_after", "tenant_id", "category", "time_zone"}).AddRow(1, "MockedOriginator", "MockedText", buffer.PriorityHigh, createdAt, nil, "acme", "marketing", "Europe/Berlin"))
 					mock.ExpectExec("UPDATE messages SET processed=true WHERE message_id=\\$1$").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
 					mock.ExpectCommit()
 
@@ -51,6 +57,11 @@ func TestPostgresBuffer_PopNextMessage(t *testing.T) {
 				Originator: "MockedOriginator",
 				Text:       "MockedText",
 				Processed:  false,
+				Priority:   buffer.PriorityHigh,
+				CreatedAt:  createdAt,
+				TenantID:   "acme",
+				Category:   "marketing",
+				TimeZone:   "Europe/Berlin",
 			},
 			false,
 		},
@@ -79,7 +90,7 @@ func TestPostgresBuffer_PopNextMessage(t *testing.T) {
 					mock.MatchExpectationsInOrder(true)
 
 					mock.ExpectBegin()
-					mock.ExpectQuery(`SELECT message_id, originator, text  FROM messages WHERE message_id = \(SELECT MIN\(message_id\) FROM messages WHERE processed=FALSE\)`).WillReturnError(sql.ErrNoRows)
+					mock.ExpectQuery(`^SELECT message_id, originator, text, priority, created_at, send_after, COALESCE\(tenant_id, ''\) AS tenant_id, COALESCE\(category, ''\) AS category, COALESCE\(time_zone, ''\) AS time_zone FROM messages WHERE processed=FALSE AND \(send_after IS NULL OR send_after <= now\(\)\) AND NOT EXISTS \(SELECT 1 FROM pauses p WHERE p.scope='global' OR \(p.scope='originator' AND p.value=messages.originator\) OR \(p.scope='tenant' AND p.value=messages.tenant_id\)\) ORDER BY COALESCE\(send_after, created_at\) < now\(\) - \$1 \* interval '1 second' DESC, priority DESC, message_id LIMIT 1 FOR UPDATE$`).WithArgs(float64(60)).WillReturnError(sql.ErrNoRows)
 
 					return sqlx.NewDb(db, "sqlmock"), mock
 				},
@@ -95,7 +106,8 @@ func TestPostgresBuffer_PopNextMessage(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			db, mock := tt.fields.DB()
 			pb := &buffer.PostgresBuffer{
-				DB: db,
+				DB:                db,
+				StarvationTimeout: time.Minute,
 			}
 			defer pb.Close()
 
@@ -114,15 +126,26 @@ func TestPostgresBuffer_PopNextMessage(t *testing.T) {
 	}
 }
 
+// childTraceparent matches traceparent of the span started within the trace of the parent
+type childTraceparent string
+
+func (parent childTraceparent) Match(v driver.Value) bool {
+	value, ok := v.(string)
+	return ok && strings.HasPrefix(value, string(parent)[:36]) && value != string(parent)
+}
+
 func TestPostgresBuffer_SaveMessageForRecipient(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sendAfter := time.Date(2019, 3, 2, 8, 0, 0, 0, time.UTC)
+	parent, _ := tracing.ParseTraceparent(traceparent)
+
 	type fields struct {
 		DB func() (*sqlx.DB, sqlmock.Sqlmock)
 	}
 	type args struct {
 		ctx         context.Context
 		phoneNumber string
-		originator  string
-		text        string
+		message     *buffer.Message
 	}
 	tests := []struct {
 		name    string
@@ -138,12 +161,12 @@ func TestPostgresBuffer_SaveMessageForRecipient(t *testing.T) {
 					mock.MatchExpectationsInOrder(true)
 
 					mock.ExpectBegin()
-					mock.ExpectQuery(`^SELECT message_id, originator, text, processed FROM messages.*`).
+					mock.ExpectQuery(`^SELECT message_id, originator, text, processed, priority, send_after FROM messages.*`).WithArgs("MockedOriginator", "MockedText", buffer.PriorityNormal, nil, "", "", "").
 						WillReturnRows(
 							sqlmock.NewRows([]string{"message_id", "originator", "text"}))
-					mock.ExpectPrepare(`^INSERT INTO messages \(originator, text\).*`).ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"message_id"}).AddRow(1))
+					mock.ExpectPrepare(`^INSERT INTO messages \(originator, text, priority, send_after, tenant_id, category, time_zone\).*`).ExpectQuery().WithArgs("MockedOriginator", "MockedText", buffer.PriorityNormal, nil, "", "", "").WillReturnRows(sqlmock.NewRows([]string{"message_id"}).AddRow(1))
 
-					mock.ExpectExec(`^INSERT INTO recipients \(message_id, phone_number\).*`).WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectExec(`^INSERT INTO recipients \(message_id, phone_number, trace_parent\).*`).WillReturnResult(sqlmock.NewResult(0, 1))
 					mock.ExpectCommit()
 
 					return sqlx.NewDb(db, "sqlmock"), mock
@@ -152,8 +175,45 @@ func TestPostgresBuffer_SaveMessageForRecipient(t *testing.T) {
 			args{
 				context.Background(),
 				"1234567",
-				"MockedOriginator",
-				"MockedText",
+				&buffer.Message{
+					Originator: "MockedOriginator",
+					Text:       "MockedText",
+					Priority:   buffer.PriorityNormal,
+				},
+			},
+			false,
+		},
+		{
+			"Add new scheduled batch",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.MatchExpectationsInOrder(true)
+
+					mock.ExpectBegin()
+					mock.ExpectQuery(`^SELECT message_id, originator, text, processed, priority, send_after FROM messages.*`).WithArgs("MockedOriginator", "MockedText", buffer.PriorityLow, sendAfter, "acme", "marketing", "Europe/Berlin").
+						WillReturnRows(
+							sqlmock.NewRows([]string{"message_id", "originator", "text"}))
+					mock.ExpectPrepare(`^INSERT INTO messages \(originator, text, priority, send_after, tenant_id, category, time_zone\).*`).ExpectQuery().WithArgs("MockedOriginator", "MockedText", buffer.PriorityLow, sendAfter, "acme", "marketing", "Europe/Berlin").WillReturnRows(sqlmock.NewRows([]string{"message_id"}).AddRow(1))
+
+					mock.ExpectExec(`^INSERT INTO recipients \(message_id, phone_number, trace_parent\).*`).WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectCommit()
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			args{
+				context.Background(),
+				"1234567",
+				&buffer.Message{
+					Originator: "MockedOriginator",
+					Text:       "MockedText",
+					Priority:   buffer.PriorityLow,
+					SendAfter:  &sendAfter,
+					TenantID:   "acme",
+					Category:   "marketing",
+					TimeZone:   "Europe/Berlin",
+				},
 			},
 			false,
 		},
@@ -165,11 +225,11 @@ func TestPostgresBuffer_SaveMessageForRecipient(t *testing.T) {
 					mock.MatchExpectationsInOrder(true)
 
 					mock.ExpectBegin()
-					mock.ExpectQuery(`^SELECT message_id, originator, text, processed FROM messages.*`).
+					mock.ExpectQuery(`^SELECT message_id, originator, text, processed, priority, send_after FROM messages.*`).WithArgs("MockedOriginator", "MockedText", buffer.PriorityNormal, nil, "", "", "").
 						WillReturnRows(
 							sqlmock.NewRows([]string{"message_id", "originator", "text"}).AddRow(1, "MockedOriginator", "MockedText"))
 
-					mock.ExpectExec(`^INSERT INTO recipients \(message_id, phone_number\).*`).WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectExec(`^INSERT INTO recipients \(message_id, phone_number, trace_parent\).*`).WillReturnResult(sqlmock.NewResult(0, 1))
 					mock.ExpectCommit()
 
 					return sqlx.NewDb(db, "sqlmock"), mock
@@ -178,8 +238,39 @@ func TestPostgresBuffer_SaveMessageForRecipient(t *testing.T) {
 			args{
 				context.Background(),
 				"1234567",
-				"MockedOriginator",
-				"MockedText",
+				&buffer.Message{
+					Originator: "MockedOriginator",
+					Text:       "MockedText",
+					Priority:   buffer.PriorityNormal,
+				},
+			},
+			false,
+		},
+		{
+			"Trace of the request",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.MatchExpectationsInOrder(true)
+
+					mock.ExpectBegin()
+					mock.ExpectQuery(`^SELECT message_id, originator, text, processed, priority, send_after FROM messages.*`).
+						WillReturnRows(sqlmock.NewRows([]string{"message_id", "originator", "text"}).AddRow(1, "MockedOriginator", "MockedText"))
+					mock.ExpectExec(`^INSERT INTO recipients \(message_id, phone_number, trace_parent\).*`).WithArgs(1, "1234567", childTraceparent(traceparent)).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectCommit()
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			args{
+				tracing.ContextWithRemoteParent(context.Background(), parent),
+				"1234567",
+				&buffer.Message{
+					Originator: "MockedOriginator",
+					Text:       "MockedText",
+					Priority:   buffer.PriorityNormal,
+				},
 			},
 			false,
 		},
@@ -198,8 +289,11 @@ func TestPostgresBuffer_SaveMessageForRecipient(t *testing.T) {
 			args{
 				context.Background(),
 				"1234567",
-				"MockedOriginator",
-				"MockedText",
+				&buffer.Message{
+					Originator: "MockedOriginator",
+					Text:       "MockedText",
+					Priority:   buffer.PriorityNormal,
+				},
 			},
 			true,
 		},
@@ -212,7 +306,7 @@ func TestPostgresBuffer_SaveMessageForRecipient(t *testing.T) {
 			}
 			defer pb.Close()
 
-			if err := pb.SaveMessageForRecipient(tt.args.ctx, tt.args.phoneNumber, tt.args.originator, tt.args.text); (err != nil) != tt.wantErr {
+			if err := pb.SaveMessageForRecipient(tt.args.ctx, tt.args.phoneNumber, tt.args.message); (err != nil) != tt.wantErr {
 				t.Errorf("PostgresBuffer.SaveMessageForRecipient() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			if mock.ExpectationsWereMet() != nil {
@@ -244,9 +338,9 @@ func TestPostgresBuffer_GetRecipientsForMessageID(t *testing.T) {
 					db, mock, _ := sqlmock.New()
 					mock.MatchExpectationsInOrder(true)
 
-					mock.ExpectQuery(`^SELECT message_id, phone_number FROM recipients.*`).
+					mock.ExpectQuery(`^SELECT message_id, phone_number, status, COALESCE\(error_code, 0\) AS error_code, attempts, COALESCE\(trace_parent, ''\) AS trace_parent FROM recipients.*`).
 						WillReturnRows(
-							sqlmock.NewRows([]string{"message_id", "phone_number"}).AddRow(1, "12345678").AddRow(2, "0987654"))
+							sqlmock.NewRows([]string{"message_id", "phone_number", "status", "error_code", "attempts", "trace_parent"}).AddRow(1, "12345678", "pending", 0, 0, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01").AddRow(2, "0987654", "pending", 30003, 1, ""))
 
 					return sqlx.NewDb(db, "sqlmock"), mock
 				},
@@ -257,12 +351,17 @@ func TestPostgresBuffer_GetRecipientsForMessageID(t *testing.T) {
 			},
 			[]*buffer.Recipient{
 				{
-					1,
-					"12345678",
+					MessageID:   1,
+					PhoneNumber: "12345678",
+					Status:      buffer.RecipientPending,
+					TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
 				},
 				{
-					2,
-					"0987654",
+					MessageID:   2,
+					PhoneNumber: "0987654",
+					Status:      buffer.RecipientPending,
+					ErrorCode:   30003,
+					Attempts:    1,
 				},
 			},
 			false,
@@ -274,7 +373,7 @@ func TestPostgresBuffer_GetRecipientsForMessageID(t *testing.T) {
 					db, mock, _ := sqlmock.New()
 					mock.MatchExpectationsInOrder(true)
 
-					mock.ExpectQuery(`^SELECT message_id, phone_number FROM recipients.*`).WillReturnError(sql.ErrNoRows)
+					mock.ExpectQuery(`^SELECT message_id, phone_number, status, COALESCE\(error_code, 0\) AS error_code, attempts, COALESCE\(trace_parent, ''\) AS trace_parent FROM recipients.*`).WillReturnError(sql.ErrNoRows)
 
 					return sqlx.NewDb(db, "sqlmock"), mock
 				},
@@ -293,7 +392,7 @@ func TestPostgresBuffer_GetRecipientsForMessageID(t *testing.T) {
 					db, mock, _ := sqlmock.New()
 					mock.MatchExpectationsInOrder(true)
 
-					mock.ExpectQuery(`^SELECT message_id, phone_number FROM recipients.*`).WillReturnError(errors.New("error"))
+					mock.ExpectQuery(`^SELECT message_id, phone_number, status, COALESCE\(error_code, 0\) AS error_code, attempts, COALESCE\(trace_parent, ''\) AS trace_parent FROM recipients.*`).WillReturnError(errors.New("error"))
 
 					return sqlx.NewDb(db, "sqlmock"), mock
 				},
@@ -327,3 +426,184 @@ func TestPostgresBuffer_GetRecipientsForMessageID(t *testing.T) {
 		})
 	}
 }
+
+func TestPostgresBuffer_CountPendingMessages(t *testing.T) {
+	type fields struct {
+		DB func() (*sqlx.DB, sqlmock.Sqlmock)
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    map[int]int
+		wantErr bool
+	}{
+		{
+			"Success",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^SELECT priority, COUNT\(\*\) AS count FROM messages WHERE processed=FALSE GROUP BY priority$`).
+						WillReturnRows(sqlmock.NewRows([]string{"priority", "count"}).AddRow(buffer.PriorityLow, 50000).AddRow(buffer.PriorityHigh, 3))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			map[int]int{
+				buffer.PriorityLow:  50000,
+				buffer.PriorityHigh: 3,
+			},
+			false,
+		},
+		{
+			"DB Error",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^SELECT priority, COUNT\(\*\).*`).WillReturnError(errors.New("error"))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.fields.DB()
+			pb := &buffer.PostgresBuffer{
+				DB: db,
+			}
+			defer pb.Close()
+
+			got, err := pb.CountPendingMessages(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PostgresBuffer.CountPendingMessages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PostgresBuffer.CountPendingMessages() = %v, want %v", got, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
+
+func TestPostgresBuffer_RequeueRecipients(t *testing.T) {
+	sendAfter := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	message := &buffer.Message{
+		MessageID:  1,
+		Originator: "MockedOriginator",
+		Text:       "MockedText",
+		Priority:   buffer.PriorityNormal,
+		TenantID:   "acme",
+		Category:   "marketing",
+		TimeZone:   "Europe/Berlin",
+	}
+	recipients := []*buffer.Recipient{
+		{MessageID: 1, PhoneNumber: "12345678"},
+		{MessageID: 1, PhoneNumber: "0987654"},
+	}
+
+	tests := []struct {
+		name    string
+		mock    func(sqlmock.Sqlmock)
+		wantErr bool
+	}{
+		{
+			"Success",
+			func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`^INSERT INTO messages \(originator, text, priority, send_after, tenant_id, category, time_zone\).*`).WithArgs("MockedOriginator", "MockedText", buffer.PriorityNormal, sendAfter, "acme", "marketing", "Europe/Berlin").
+					WillReturnRows(sqlmock.NewRows([]string{"message_id"}).AddRow(2))
+				mock.ExpectExec(`^UPDATE recipients SET message_id=\$1, status='pending' WHERE message_id=\$2 AND phone_number=\$3$`).WithArgs(2, 1, "12345678").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`^UPDATE recipients SET message_id=\$1.*`).WithArgs(2, 1, "0987654").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			false,
+		},
+		{
+			"DB Error",
+			func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`^INSERT INTO messages.*`).WillReturnRows(sqlmock.NewRows([]string{"message_id"}).AddRow(2))
+				mock.ExpectExec(`^UPDATE recipients SET message_id=\$1.*`).WillReturnError(errors.New("error"))
+				mock.ExpectRollback()
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			mock.MatchExpectationsInOrder(true)
+			tt.mock(mock)
+
+			pb := &buffer.PostgresBuffer{
+				DB: sqlx.NewDb(db, "sqlmock"),
+			}
+			defer pb.Close()
+
+			if err := pb.RequeueRecipients(context.Background(), message, recipients, &sendAfter); (err != nil) != tt.wantErr {
+				t.Errorf("PostgresBuffer.RequeueRecipients() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
+
+func TestPostgresBuffer_CountQueuedRecipients(t *testing.T) {
+	tests := []struct {
+		name    string
+		mock    func(sqlmock.Sqlmock)
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			"Success",
+			func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`^SELECT CASE WHEN r.attempts > 0 THEN 'retrying' WHEN m.send_after > now\(\) THEN 'scheduled' ELSE 'due' END AS state, COUNT\(\*\) AS count.*WHERE m.processed=FALSE GROUP BY 1$`).
+					WillReturnRows(sqlmock.NewRows([]string{"state", "count"}).AddRow(buffer.QueueDue, 120).AddRow(buffer.QueueRetrying, 4))
+			},
+			map[string]int{
+				buffer.QueueDue:      120,
+				buffer.QueueRetrying: 4,
+			},
+			false,
+		},
+		{
+			"DB Error",
+			func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`^SELECT CASE.*`).WillReturnError(errors.New("error"))
+			},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			tt.mock(mock)
+			pb := &buffer.PostgresBuffer{
+				DB: sqlx.NewDb(db, "sqlmock"),
+			}
+			defer pb.Close()
+
+			got, err := pb.CountQueuedRecipients(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PostgresBuffer.CountQueuedRecipients() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PostgresBuffer.CountQueuedRecipients() = %v, want %v", got, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
@@ -1,13 +1,83 @@
 package buffer
 
+import "time"
+
+// Message priorities, messages with higher priority are delivered first
+const (
+	PriorityLow = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+var priorityNames = []string{"low", "normal", "high"}
+
+// ParsePriority converts priority name into its value, empty name stands for normal priority
+func ParsePriority(name string) (int, bool) {
+	if len(name) == 0 {
+		return PriorityNormal, true
+	}
+	for priority, priorityName := range priorityNames {
+		if name == priorityName {
+			return priority, true
+		}
+	}
+	return 0, false
+}
+
+// PriorityName returns name of the priority value
+func PriorityName(priority int) string {
+	if priority < 0 || priority >= len(priorityNames) {
+		return "unknown"
+	}
+	return priorityNames[priority]
+}
+
 type Message struct {
-	MessageID  int64  `db:"message_id"`
-	Originator string `db:"originator"`
-	Text       string `db:"text"`
-	Processed  bool   `db:"processed"`
+	MessageID  int64     `db:"message_id"`
+	Originator string    `db:"originator"`
+	Text       string    `db:"text"`
+	Processed  bool      `db:"processed"`
+	Priority   int       `db:"priority"`
+	CreatedAt  time.Time `db:"created_at"`
+	// SendAfter holds message in the queue until given time, nil means message can be sent right away
+	SendAfter *time.Time `db:"send_after"`
+	// TenantID is tenant message was enqueued by, empty for anonymous clients
+	TenantID string `db:"tenant_id"`
+	// Category and TimeZone of the recipients, quiet hours are checked again with them when message is sent.
+	// Both are empty for messages enqueued before they were stored
+	Category string `db:"category"`
+	TimeZone string `db:"time_zone"`
 }
 
+// Recipient delivery statuses
+const (
+	RecipientPending = "pending"
+	RecipientSent    = "sent"
+	// RecipientFailed - recipient cant be reached, i.e. provider rejected the number
+	RecipientFailed = "failed"
+	// RecipientDeadLettered - delivery kept failing until attempts ran out, recipient waits for operator to requeue it
+	RecipientDeadLettered = "dead_lettered"
+	// RecipientCancelled - operator removed recipient from the queue before it was sent
+	RecipientCancelled = "cancelled"
+)
+
+// Queue states of pending recipients
+const (
+	// QueueDue - recipient can be sent right away
+	QueueDue = "due"
+	// QueueScheduled - recipient is held until message send_after, i.e. by quiet hours or pacer
+	QueueScheduled = "scheduled"
+	// QueueRetrying - recipient waits for another attempt after transient failure
+	QueueRetrying = "retrying"
+)
+
 type Recipient struct {
 	MessageID   int64  `db:"message_id"`
 	PhoneNumber string `db:"phone_number"`
+	Status      string `db:"status"`
+	// ErrorCode is provider error code of the last failed delivery attempt, 0 when there is none
+	ErrorCode int `db:"error_code"`
+	Attempts  int `db:"attempts"`
+	// TraceParent is W3C traceparent of the request recipient was enqueued with, sending is traced as its child
+	TraceParent string `db:"trace_parent"`
 }
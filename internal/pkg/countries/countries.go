@@ -0,0 +1,120 @@
+package countries
+
+import "strings"
+
+// Country holds dialing and localisation details of the country
+type Country struct {
+	// Code is ISO 3166-1 alpha-2 country code
+	Code string
+	// CallingCode is E.164 country calling code without leading plus sign
+	CallingCode string
+	// Locale is default BCP 47 locale used in the country
+	Locale string
+	// TimeZone is IANA name of the most populated time zone of the country
+	TimeZone string
+}
+
+// list of supported countries, countries sharing calling code are listed in order of preference
+var countries = []Country{
+	{"US", "1", "en-US", "America/New_York"},
+	{"CA", "1", "en-CA", "America/Toronto"},
+	{"RU", "7", "ru-RU", "Europe/Moscow"},
+	{"KZ", "7", "ru-KZ", "Asia/Almaty"},
+	{"EG", "20", "ar-EG", "Africa/Cairo"},
+	{"ZA", "27", "en-ZA", "Africa/Johannesburg"},
+	{"GR", "30", "el-GR", "Europe/Athens"},
+	{"NL", "31", "nl-NL", "Europe/Amsterdam"},
+	{"BE", "32", "nl-BE", "Europe/Brussels"},
+	{"FR", "33", "fr-FR", "Europe/Paris"},
+	{"ES", "34", "es-ES", "Europe/Madrid"},
+	{"HU", "36", "hu-HU", "Europe/Budapest"},
+	{"IT", "39", "it-IT", "Europe/Rome"},
+	{"RO", "40", "ro-RO", "Europe/Bucharest"},
+	{"CH", "41", "de-CH", "Europe/Zurich"},
+	{"AT", "43", "de-AT", "Europe/Vienna"},
+	{"GB", "44", "en-GB", "Europe/London"},
+	{"DK", "45", "da-DK", "Europe/Copenhagen"},
+	{"SE", "46", "sv-SE", "Europe/Stockholm"},
+	{"NO", "47", "nb-NO", "Europe/Oslo"},
+	{"PL", "48", "pl-PL", "Europe/Warsaw"},
+	{"DE", "49", "de-DE", "Europe/Berlin"},
+	{"MX", "52", "es-MX", "America/Mexico_City"},
+	{"AR", "54", "es-AR", "America/Argentina/Buenos_Aires"},
+	{"BR", "55", "pt-BR", "America/Sao_Paulo"},
+	{"CL", "56", "es-CL", "America/Santiago"},
+	{"CO", "57", "es-CO", "America/Bogota"},
+	{"MY", "60", "ms-MY", "Asia/Kuala_Lumpur"},
+	{"AU", "61", "en-AU", "Australia/Sydney"},
+	{"ID", "62", "id-ID", "Asia/Jakarta"},
+	{"PH", "63", "en-PH", "Asia/Manila"},
+	{"NZ", "64", "en-NZ", "Pacific/Auckland"},
+	{"SG", "65", "en-SG", "Asia/Singapore"},
+	{"TH", "66", "th-TH", "Asia/Bangkok"},
+	{"JP", "81", "ja-JP", "Asia/Tokyo"},
+	{"KR", "82", "ko-KR", "Asia/Seoul"},
+	{"VN", "84", "vi-VN", "Asia/Ho_Chi_Minh"},
+	{"CN", "86", "zh-CN", "Asia/Shanghai"},
+	{"TR", "90", "tr-TR", "Europe/Istanbul"},
+	{"IN", "91", "hi-IN", "Asia/Kolkata"},
+	{"PK", "92", "ur-PK", "Asia/Karachi"},
+	{"IR", "98", "fa-IR", "Asia/Tehran"},
+	{"MA", "212", "ar-MA", "Africa/Casablanca"},
+	{"NG", "234", "en-NG", "Africa/Lagos"},
+	{"KE", "254", "sw-KE", "Africa/Nairobi"},
+	{"PT", "351", "pt-PT", "Europe/Lisbon"},
+	{"LU", "352", "fr-LU", "Europe/Luxembourg"},
+	{"IE", "353", "en-IE", "Europe/Dublin"},
+	{"FI", "358", "fi-FI", "Europe/Helsinki"},
+	{"BG", "359", "bg-BG", "Europe/Sofia"},
+	{"LT", "370", "lt-LT", "Europe/Vilnius"},
+	{"LV", "371", "lv-LV", "Europe/Riga"},
+	{"EE", "372", "et-EE", "Europe/Tallinn"},
+	{"UA", "380", "uk-UA", "Europe/Kiev"},
+	{"RS", "381", "sr-RS", "Europe/Belgrade"},
+	{"HR", "385", "hr-HR", "Europe/Zagreb"},
+	{"SI", "386", "sl-SI", "Europe/Ljubljana"},
+	{"CZ", "420", "cs-CZ", "Europe/Prague"},
+	{"SK", "421", "sk-SK", "Europe/Bratislava"},
+	{"HK", "852", "zh-HK", "Asia/Hong_Kong"},
+	{"TW", "886", "zh-TW", "Asia/Taipei"},
+	{"AE", "971", "ar-AE", "Asia/Dubai"},
+	{"IL", "972", "he-IL", "Asia/Jerusalem"},
+	{"SA", "966", "ar-SA", "Asia/Riyadh"},
+}
+
+var (
+	byCallingCode = map[string]Country{}
+	byCode        = map[string]Country{}
+)
+
+func init() {
+	for _, country := range countries {
+		if _, ok := byCallingCode[country.CallingCode]; !ok {
+			byCallingCode[country.CallingCode] = country
+		}
+		byCode[country.Code] = country
+	}
+}
+
+// FromPhoneNumber detects country of the phone number in E.164 format by its calling code
+func FromPhoneNumber(phoneNumber string) (Country, bool) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(phoneNumber, "+"), "00")
+
+	// calling codes are prefix free and take up to 3 digits, so longest match is the right one
+	for length := 3; length > 0; length-- {
+		if len(digits) <= length {
+			continue
+		}
+		if country, ok := byCallingCode[digits[:length]]; ok {
+			return country, true
+		}
+	}
+
+	return Country{}, false
+}
+
+// FromCode returns country by its ISO 3166-1 alpha-2 code
+func FromCode(code string) (Country, bool) {
+	country, ok := byCode[strings.ToUpper(code)]
+	return country, ok
+}
@@ -0,0 +1,66 @@
+package countries_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/countries"
+	"testing"
+)
+
+func TestFromPhoneNumber(t *testing.T) {
+	tests := []struct {
+		name        string
+		phoneNumber string
+		want        string
+		wantOK      bool
+	}{
+		{
+			"Single digit calling code",
+			"+15551234567",
+			"US",
+			true,
+		},
+		{
+			"Two digits calling code",
+			"+491701234567",
+			"DE",
+			true,
+		},
+		{
+			"Three digits calling code",
+			"+3725123456",
+			"EE",
+			true,
+		},
+		{
+			"No plus sign",
+			"447700900123",
+			"GB",
+			true,
+		},
+		{
+			"International prefix",
+			"00447700900123",
+			"GB",
+			true,
+		},
+		{
+			"Unknown calling code",
+			"+999123456",
+			"",
+			false,
+		},
+		{
+			"Empty",
+			"",
+			"",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := countries.FromPhoneNumber(tt.phoneNumber)
+			if ok != tt.wantOK || got.Code != tt.want {
+				t.Errorf("FromPhoneNumber() = %v, %v, want %v, %v", got.Code, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
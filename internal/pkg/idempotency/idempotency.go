@@ -0,0 +1,31 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrRequestInProgress is returned when request reserved the key is not completed yet
+	ErrRequestInProgress = errors.New("request with the idempotency key is in progress")
+	// ErrKeyReused is returned when the key was used with different request
+	ErrKeyReused = errors.New("idempotency key was used with different request")
+)
+
+// Response is stored response of completed request, replayed for repeated requests with the same key
+type Response struct {
+	StatusCode  int    `db:"status_code"`
+	ContentType string `db:"content_type"`
+	Body        []byte `db:"body"`
+}
+
+// Store describes behaviour of idempotency keys store, keys are unique within the scope of the client
+type Store interface {
+	// Begin reserves the key for request with given fingerprint. Response of completed request with the key is returned when there is one,
+	// ErrRequestInProgress or ErrKeyReused is returned when request cant proceed
+	Begin(ctx context.Context, scope, key, fingerprint string) (*Response, error)
+	// Complete stores response of the request reserved the key
+	Complete(ctx context.Context, scope, key string, response *Response) error
+	// Release removes the key of failed request, so the request is executed again when retried
+	Release(ctx context.Context, scope, key string) error
+}
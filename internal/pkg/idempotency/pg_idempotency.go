@@ -0,0 +1,96 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// PostgresStore implements Store interface for Postgres
+type PostgresStore struct {
+	*sqlx.DB
+	ttl time.Duration
+}
+
+// NewPostgresStore creates new instance of PostgresStore, keys older than ttl are taken over by new requests
+func NewPostgresStore(db *sqlx.DB, ttl time.Duration) *PostgresStore {
+	return &PostgresStore{
+		DB:  db,
+		ttl: ttl,
+	}
+}
+
+// storedKey is the key with fingerprint of request reserved it
+type storedKey struct {
+	Fingerprint string `db:"fingerprint"`
+	Response
+}
+
+// Begin inserts the key, or takes over expired one. Key reserved by another request is returned as it is stored.
+func (ps *PostgresStore) Begin(ctx context.Context, scope, key, fingerprint string) (*Response, error) {
+	var reserved bool
+	err := ps.GetContext(ctx, &reserved, `INSERT INTO idempotency_keys (scope, idempotency_key, fingerprint) VALUES($1, $2, $3)
+		ON CONFLICT (scope, idempotency_key) DO UPDATE SET fingerprint=EXCLUDED.fingerprint, status_code=NULL, content_type=NULL, body=NULL, created_at=now()
+		WHERE idempotency_keys.created_at < now() - make_interval(secs => $4) RETURNING TRUE`, scope, key, fingerprint, ps.ttl.Seconds())
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, errors.Wrapf(err, "failed to reserve idempotency key %s", key)
+	}
+
+	stored := &storedKey{}
+	err = ps.GetContext(ctx, stored, "SELECT fingerprint, COALESCE(status_code, 0) AS status_code, COALESCE(content_type, '') AS content_type, body FROM idempotency_keys WHERE scope=$1 AND idempotency_key=$2", scope, key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// key is released by failed request in the meantime
+			return nil, ErrRequestInProgress
+		}
+		return nil, errors.Wrapf(err, "failed to get idempotency key %s", key)
+	}
+
+	switch {
+	case stored.Fingerprint != fingerprint:
+		return nil, ErrKeyReused
+	case stored.StatusCode == 0:
+		return nil, ErrRequestInProgress
+	}
+
+	return &stored.Response, nil
+}
+
+// Complete stores response of the request with the key
+func (ps *PostgresStore) Complete(ctx context.Context, scope, key string, response *Response) error {
+	if response == nil {
+		return errors.New("response cant be nil")
+	}
+
+	_, err := ps.ExecContext(ctx, "UPDATE idempotency_keys SET status_code=$3, content_type=NULLIF($4, ''), body=$5 WHERE scope=$1 AND idempotency_key=$2", scope, key, response.StatusCode, response.ContentType, response.Body)
+	if err != nil {
+		return errors.Wrapf(err, "failed to complete idempotency key %s", key)
+	}
+
+	return nil
+}
+
+// Release removes the key of request not completed
+func (ps *PostgresStore) Release(ctx context.Context, scope, key string) error {
+	_, err := ps.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE scope=$1 AND idempotency_key=$2 AND status_code IS NULL", scope, key)
+	if err != nil {
+		return errors.Wrapf(err, "failed to release idempotency key %s", key)
+	}
+
+	return nil
+}
+
+// DeleteExpired removes keys older than ttl and returns number of keys removed
+func (ps *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := ps.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE created_at < now() - make_interval(secs => $1)", ps.ttl.Seconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to delete expired idempotency keys")
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,177 @@
+package idempotency_test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arkadyb/demo_messenger/internal/pkg/idempotency"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestPostgresStore_Begin(t *testing.T) {
+	type fields struct {
+		DB func() (*sqlx.DB, sqlmock.Sqlmock)
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *idempotency.Response
+		wantErr error
+	}{
+		{
+			"New key",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^INSERT INTO idempotency_keys \(scope, idempotency_key, fingerprint\) VALUES\(\$1, \$2, \$3\)\s+ON CONFLICT \(scope, idempotency_key\) DO UPDATE SET .+ WHERE idempotency_keys.created_at < now\(\) - make_interval\(secs => \$4\) RETURNING TRUE$`).
+						WithArgs("tenant:acme", "key", "fingerprint", float64(86400)).
+						WillReturnRows(sqlmock.NewRows([]string{"bool"}).AddRow(true))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			nil,
+			nil,
+		},
+		{
+			"Completed request",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^INSERT INTO idempotency_keys`).WillReturnError(sql.ErrNoRows)
+					mock.ExpectQuery(`^SELECT fingerprint, COALESCE\(status_code, 0\) AS status_code, COALESCE\(content_type, ''\) AS content_type, body FROM idempotency_keys WHERE scope=\$1 AND idempotency_key=\$2$`).
+						WithArgs("tenant:acme", "key").
+						WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status_code", "content_type", "body"}).AddRow("fingerprint", 202, "application/json", []byte(`{"status":"accepted"}`)))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			&idempotency.Response{StatusCode: 202, ContentType: "application/json", Body: []byte(`{"status":"accepted"}`)},
+			nil,
+		},
+		{
+			"Request in progress",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^INSERT INTO idempotency_keys`).WillReturnError(sql.ErrNoRows)
+					mock.ExpectQuery(`^SELECT fingerprint`).
+						WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status_code", "content_type", "body"}).AddRow("fingerprint", 0, "", nil))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			nil,
+			idempotency.ErrRequestInProgress,
+		},
+		{
+			"Key used with different request",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^INSERT INTO idempotency_keys`).WillReturnError(sql.ErrNoRows)
+					mock.ExpectQuery(`^SELECT fingerprint`).
+						WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status_code", "content_type", "body"}).AddRow("other", 202, "application/json", []byte(`{}`)))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			nil,
+			idempotency.ErrKeyReused,
+		},
+		{
+			"DB Error",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^INSERT INTO idempotency_keys`).WillReturnError(errors.New("error"))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			nil,
+			errors.New("error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.fields.DB()
+			ps := idempotency.NewPostgresStore(db, 24*time.Hour)
+			defer ps.Close()
+
+			got, err := ps.Begin(context.Background(), "tenant:acme", "key", "fingerprint")
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("PostgresStore.Begin() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr != nil && errors.Cause(err).Error() != tt.wantErr.Error() {
+				t.Errorf("PostgresStore.Begin() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PostgresStore.Begin() = %v, want %v", got, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
+
+func TestPostgresStore_Complete(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec(`^UPDATE idempotency_keys SET status_code=\$3, content_type=NULLIF\(\$4, ''\), body=\$5 WHERE scope=\$1 AND idempotency_key=\$2$`).
+		WithArgs("tenant:acme", "key", 202, "application/json", []byte(`{"status":"accepted"}`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	ps := idempotency.NewPostgresStore(sqlx.NewDb(db, "sqlmock"), time.Hour)
+	defer ps.Close()
+
+	err := ps.Complete(context.Background(), "tenant:acme", "key", &idempotency.Response{StatusCode: 202, ContentType: "application/json", Body: []byte(`{"status":"accepted"}`)})
+	if err != nil {
+		t.Errorf("PostgresStore.Complete() error = %v", err)
+	}
+	if mock.ExpectationsWereMet() != nil {
+		t.Error("Not all expectations were met")
+	}
+}
+
+func TestPostgresStore_Release(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec(`^DELETE FROM idempotency_keys WHERE scope=\$1 AND idempotency_key=\$2 AND status_code IS NULL$`).
+		WithArgs("tenant:acme", "key").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	ps := idempotency.NewPostgresStore(sqlx.NewDb(db, "sqlmock"), time.Hour)
+	defer ps.Close()
+
+	if err := ps.Release(context.Background(), "tenant:acme", "key"); err != nil {
+		t.Errorf("PostgresStore.Release() error = %v", err)
+	}
+	if mock.ExpectationsWereMet() != nil {
+		t.Error("Not all expectations were met")
+	}
+}
+
+func TestPostgresStore_DeleteExpired(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectExec(`^DELETE FROM idempotency_keys WHERE created_at < now\(\) - make_interval\(secs => \$1\)$`).
+		WithArgs(float64(3600)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	ps := idempotency.NewPostgresStore(sqlx.NewDb(db, "sqlmock"), time.Hour)
+	defer ps.Close()
+
+	deleted, err := ps.DeleteExpired(context.Background())
+	if err != nil {
+		t.Errorf("PostgresStore.DeleteExpired() error = %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("PostgresStore.DeleteExpired() = %v, want 3", deleted)
+	}
+	if mock.ExpectationsWereMet() != nil {
+		t.Error("Not all expectations were met")
+	}
+}
@@ -0,0 +1,180 @@
+package ipfilter
+
+import (
+	"encoding/json"
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Reasons of filter decisions
+const (
+	// ReasonNotListed - no rule of the route lists the address
+	ReasonNotListed = "not_listed"
+	// ReasonAllowlisted - address is in allow list of every rule of the route having one
+	ReasonAllowlisted = "allowlisted"
+	// ReasonDenylisted - address is in deny list of the route rule
+	ReasonDenylisted = "denylisted"
+	// ReasonNotAllowlisted - route rule has allow list, but address is not in it
+	ReasonNotAllowlisted = "not_allowlisted"
+	// ReasonUnknownIP - address of the client cant be parsed, so it cant pass allow list
+	ReasonUnknownIP = "unknown_ip"
+)
+
+// Rule lists networks allowed and denied for routes starting with Path, CIDRs or single IPs can be listed
+type Rule struct {
+	Path  string   `json:"path"`
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Decision is the outcome of the filter for the request
+type Decision struct {
+	Allowed bool
+	Reason  string
+	// Rule is path of the rule decision was made by, empty when no rule lists the address
+	Rule string
+}
+
+type rule struct {
+	path  string
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// Filter evaluates rules of the request path, request is allowed when it passes every rule matching its path
+type Filter struct {
+	rules []*rule
+}
+
+// New creates filter of given rules
+func New(rules []Rule) (*Filter, error) {
+	filter := &Filter{}
+	for _, r := range rules {
+		if !strings.HasPrefix(r.Path, "/") {
+			return nil, errors.Errorf("path of the rule must start with /, got %s", r.Path)
+		}
+
+		allow, err := utils.ParseCIDRs(strings.Join(r.Allow, ","))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid allow list of %s", r.Path)
+		}
+		deny, err := utils.ParseCIDRs(strings.Join(r.Deny, ","))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid deny list of %s", r.Path)
+		}
+
+		filter.rules = append(filter.rules, &rule{path: r.Path, allow: allow, deny: deny})
+	}
+
+	return filter, nil
+}
+
+// Load creates filter of rules from json file holding list of rules, empty file name creates filter allowing everything
+func Load(fileName string) (*Filter, error) {
+	if len(fileName) == 0 {
+		return &Filter{}, nil
+	}
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read ip filter rules from %s", fileName)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse ip filter rules from %s", fileName)
+	}
+
+	return New(rules)
+}
+
+// Check evaluates rules matching the path for the client address
+func (f *Filter) Check(path string, ip string) Decision {
+	var (
+		clientIP = net.ParseIP(ip)
+		decision = Decision{Allowed: true, Reason: ReasonNotListed}
+	)
+	for _, r := range f.rules {
+		if !matchPath(r.path, path) {
+			continue
+		}
+
+		if clientIP != nil && contains(r.deny, clientIP) {
+			return Decision{Allowed: false, Reason: ReasonDenylisted, Rule: r.path}
+		}
+		if len(r.allow) == 0 {
+			continue
+		}
+		if clientIP == nil {
+			return Decision{Allowed: false, Reason: ReasonUnknownIP, Rule: r.path}
+		}
+		if !contains(r.allow, clientIP) {
+			return Decision{Allowed: false, Reason: ReasonNotAllowlisted, Rule: r.path}
+		}
+		decision = Decision{Allowed: true, Reason: ReasonAllowlisted, Rule: r.path}
+	}
+
+	return decision
+}
+
+// matchPath tells whether path is the rule path or is nested under it, so /v1/send does not match /v1/sending
+func matchPath(rulePath, path string) bool {
+	if rulePath == "/" || rulePath == path {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(rulePath, "/")+"/")
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reloadable holds filter loaded from the file, which can be reloaded at runtime
+type Reloadable struct {
+	fileName string
+
+	mu     sync.RWMutex
+	filter *Filter
+}
+
+// NewReloadable creates Reloadable filter loaded from the file
+func NewReloadable(fileName string) (*Reloadable, error) {
+	filter, err := Load(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reloadable{fileName: fileName, filter: filter}, nil
+}
+
+// Reload loads rules from the file again, filter is kept as is when rules cant be loaded
+func (r *Reloadable) Reload() error {
+	filter, err := Load(r.fileName)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.filter = filter
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Check evaluates rules matching the path for the client address
+func (r *Reloadable) Check(path string, ip string) Decision {
+	r.mu.RLock()
+	filter := r.filter
+	r.mu.RUnlock()
+
+	return filter.Check(path, ip)
+}
@@ -0,0 +1,90 @@
+package ipfilter_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/ipfilter"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []ipfilter.Rule
+		wantErr bool
+	}{
+		{"Valid", []ipfilter.Rule{{Path: "/v1", Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.1"}}}, false},
+		{"Relative path", []ipfilter.Rule{{Path: "v1"}}, true},
+		{"Invalid allow list", []ipfilter.Rule{{Path: "/v1", Allow: []string{"10.0.0.0/40"}}}, true},
+		{"Invalid deny list", []ipfilter.Rule{{Path: "/v1", Deny: []string{"vpc"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ipfilter.New(tt.rules)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestFilter_Check(t *testing.T) {
+	filter, err := ipfilter.New([]ipfilter.Rule{
+		{Path: "/", Deny: []string{"203.0.113.0/24"}},
+		{Path: "/v1/templates", Allow: []string{"10.0.0.0/8", "2001:db8::/32"}, Deny: []string{"10.6.6.6"}},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		ip       string
+		expected ipfilter.Decision
+	}{
+		{"Not listed", "/v1/send/sms", "198.51.100.1", ipfilter.Decision{Allowed: true, Reason: ipfilter.ReasonNotListed}},
+		{"Denied everywhere", "/v1/send/sms", "203.0.113.7", ipfilter.Decision{Allowed: false, Reason: ipfilter.ReasonDenylisted, Rule: "/"}},
+		{"Allowlisted", "/v1/templates/welcome", "10.1.2.3", ipfilter.Decision{Allowed: true, Reason: ipfilter.ReasonAllowlisted, Rule: "/v1/templates"}},
+		{"Allowlisted IPv6", "/v1/templates", "2001:db8::1", ipfilter.Decision{Allowed: true, Reason: ipfilter.ReasonAllowlisted, Rule: "/v1/templates"}},
+		{"Not allowlisted", "/v1/templates/welcome", "198.51.100.1", ipfilter.Decision{Allowed: false, Reason: ipfilter.ReasonNotAllowlisted, Rule: "/v1/templates"}},
+		{"Denied inside allow list", "/v1/templates/welcome", "10.6.6.6", ipfilter.Decision{Allowed: false, Reason: ipfilter.ReasonDenylisted, Rule: "/v1/templates"}},
+		{"Path prefix is not segment", "/v1/templatesx", "198.51.100.1", ipfilter.Decision{Allowed: true, Reason: ipfilter.ReasonNotListed}},
+		{"Unknown IP", "/v1/templates/welcome", "localhost", ipfilter.Decision{Allowed: false, Reason: ipfilter.ReasonUnknownIP, Rule: "/v1/templates"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, filter.Check(tt.path, tt.ip))
+		})
+	}
+}
+
+func TestReloadable(t *testing.T) {
+	file, err := ioutil.TempFile("", "ipfilter")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer os.Remove(file.Name())
+
+	writeRules := func(rules string) {
+		if !assert.NoError(t, ioutil.WriteFile(file.Name(), []byte(rules), 0600)) {
+			t.FailNow()
+		}
+	}
+
+	writeRules(`[{"path": "/v1", "deny": ["203.0.113.7"]}]`)
+	filter, err := ipfilter.NewReloadable(file.Name())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.False(t, filter.Check("/v1/send/sms", "203.0.113.7").Allowed)
+
+	writeRules(`[{"path": "/v1", "deny": ["203.0.113.8"]}]`)
+	assert.NoError(t, filter.Reload())
+	assert.True(t, filter.Check("/v1/send/sms", "203.0.113.7").Allowed)
+	assert.False(t, filter.Check("/v1/send/sms", "203.0.113.8").Allowed)
+
+	// invalid rules keep previous ones
+	writeRules(`[{"path": "/v1", "deny": ["invalid"]}]`)
+	assert.Error(t, filter.Reload())
+	assert.False(t, filter.Check("/v1/send/sms", "203.0.113.8").Allowed)
+}
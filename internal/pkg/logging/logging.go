@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+type loggerKey struct{}
+
+// Configure sets format of the process logger, format can be "text" or "json".
+// Every package logs with logrus standard logger, so the format applies to all of them.
+func Configure(format string) error {
+	switch strings.ToLower(format) {
+	case "", "text":
+		log.SetFormatter(&log.TextFormatter{})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return errors.Errorf("unknown log format %s", format)
+	}
+	return nil
+}
+
+// FromContext returns logger of the context, standard logger is returned when context has none
+func FromContext(ctx context.Context) *log.Entry {
+	if entry, ok := ctx.Value(loggerKey{}).(*log.Entry); ok {
+		return entry
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// WithLogger returns copy of the context holding given logger
+func WithLogger(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, entry)
+}
+
+// WithFields returns copy of the context holding logger with fields added to fields of the context logger
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	return WithLogger(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// NewID returns random identifier of request or batch, i.e. "4bf92f3577b34da6a3ce929d0e0e4736"
+func NewID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
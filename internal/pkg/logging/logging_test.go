@@ -0,0 +1,42 @@
+package logging_test
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWithFields(t *testing.T) {
+	ctx := logging.WithFields(context.Background(), log.Fields{"batchID": "b1"})
+	ctx = logging.WithFields(ctx, log.Fields{"messageID": int64(7)})
+
+	assert.Equal(t, log.Fields{"batchID": "b1", "messageID": int64(7)}, logging.FromContext(ctx).Data)
+	assert.Empty(t, logging.FromContext(context.Background()).Data)
+}
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		format  string
+		wantErr bool
+	}{
+		{"text", false},
+		{"JSON", false},
+		{"", false},
+		{"xml", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			err := logging.Configure(tt.format)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+	logging.Configure("text")
+}
+
+func TestNewID(t *testing.T) {
+	id := logging.NewID()
+	assert.Len(t, id, 32)
+	assert.NotEqual(t, id, logging.NewID())
+}
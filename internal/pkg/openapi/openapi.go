@@ -0,0 +1,219 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Document is OpenAPI 3 document, only parts used to match and validate requests and responses are decoded
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	// raw is the document as it was loaded
+	raw []byte
+}
+
+// PathItem holds operations of the path by lowercase HTTP method
+type PathItem map[string]*Operation
+
+// Operation of the path
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter of the operation passed in path or query
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody of the operation by media type
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response of the operation by media type
+type Response struct {
+	Content map[string]*MediaType `json:"content"`
+}
+
+// MediaType holds schema of the body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds schemas referred to with "#/components/schemas/<name>"
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// schemaRefPrefix is prefix of references to component schemas
+const schemaRefPrefix = "#/components/schemas/"
+
+// Load decodes OpenAPI document and checks every schema reference of it can be resolved
+func Load(data []byte) (*Document, error) {
+	doc := &Document{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, errors.Wrap(err, "failed to decode openapi document")
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, errors.Errorf("unsupported openapi version %s", doc.OpenAPI)
+	}
+	doc.raw = data
+
+	for path, item := range doc.Paths {
+		for method, op := range *item {
+			for _, schema := range op.schemas() {
+				if err := doc.checkRefs(schema); err != nil {
+					return nil, errors.Wrapf(err, "invalid schema of %s %s", strings.ToUpper(method), path)
+				}
+			}
+		}
+	}
+	for name, schema := range doc.Components.Schemas {
+		if err := doc.checkRefs(schema); err != nil {
+			return nil, errors.Wrapf(err, "invalid schema %s", name)
+		}
+	}
+
+	return doc, nil
+}
+
+// Bytes returns the document as it was loaded
+func (d *Document) Bytes() []byte {
+	return d.raw
+}
+
+// Operations returns "METHOD /path" of every operation of the document, sorted
+func (d *Document) Operations() []string {
+	var operations []string
+	for path, item := range d.Paths {
+		for method := range *item {
+			operations = append(operations, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(operations)
+
+	return operations
+}
+
+// FindOperation returns operation of the document matching request method and path, along with values of path parameters.
+// Path matching the most literal segments wins, i.e. "/users/me" is preferred over "/users/{id}".
+func (d *Document) FindOperation(method, path string) (*Operation, map[string]string, bool) {
+	var (
+		segments = strings.Split(path, "/")
+		found    *Operation
+		params   map[string]string
+	)
+	for template, item := range d.Paths {
+		op, ok := (*item)[strings.ToLower(method)]
+		if !ok {
+			continue
+		}
+		if p, ok := matchPath(strings.Split(template, "/"), segments); ok && (found == nil || len(p) < len(params)) {
+			found, params = op, p
+		}
+	}
+
+	return found, params, found != nil
+}
+
+// matchPath matches path segments against segments of path template, "{name}" segment matches any non-empty value
+func matchPath(template, segments []string) (map[string]string, bool) {
+	if len(template) != len(segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, segment := range template {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if len(segments[i]) == 0 {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = segments[i]
+			continue
+		}
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// response returns response of the operation documented for status code, falling back to
+// range of the status code, i.e. "4XX", and then to "default" response
+func (op *Operation) response(statusCode int) (*Response, bool) {
+	for _, code := range []string{strconv.Itoa(statusCode), fmt.Sprintf("%dXX", statusCode/100), "default"} {
+		if response, ok := op.Responses[code]; ok {
+			return response, true
+		}
+	}
+	return nil, false
+}
+
+// schemas returns top level schemas of the operation
+func (op *Operation) schemas() []*Schema {
+	var schemas []*Schema
+	for _, param := range op.Parameters {
+		schemas = append(schemas, param.Schema)
+	}
+	if op.RequestBody != nil {
+		for _, mediaType := range op.RequestBody.Content {
+			schemas = append(schemas, mediaType.Schema)
+		}
+	}
+	for _, response := range op.Responses {
+		for _, mediaType := range response.Content {
+			schemas = append(schemas, mediaType.Schema)
+		}
+	}
+
+	return schemas
+}
+
+// resolve returns schema the reference points to, or the schema itself when it is not a reference
+func (d *Document) resolve(schema *Schema) *Schema {
+	for schema != nil && len(schema.Ref) > 0 {
+		schema = d.Components.Schemas[strings.TrimPrefix(schema.Ref, schemaRefPrefix)]
+	}
+	return schema
+}
+
+func (d *Document) checkRefs(schema *Schema) error {
+	if schema == nil {
+		return nil
+	}
+	if len(schema.Ref) > 0 {
+		if _, ok := d.Components.Schemas[strings.TrimPrefix(schema.Ref, schemaRefPrefix)]; !ok || !strings.HasPrefix(schema.Ref, schemaRefPrefix) {
+			return errors.Errorf("unresolved reference %s", schema.Ref)
+		}
+		return nil
+	}
+
+	for _, property := range schema.Properties {
+		if err := d.checkRefs(property); err != nil {
+			return err
+		}
+	}
+	if err := d.checkRefs(schema.Items); err != nil {
+		return err
+	}
+	if schema.AdditionalProperties != nil {
+		return d.checkRefs(schema.AdditionalProperties.Schema)
+	}
+
+	return nil
+}
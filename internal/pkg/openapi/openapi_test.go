@@ -0,0 +1,220 @@
+package openapi_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/openapi"
+	"github.com/arkadyb/demo_messenger/internal/pkg/validation"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const document = `{
+	"openapi": "3.0.3",
+	"paths": {
+		"/users/{id}": {
+			"get": {
+				"parameters": [
+					{"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "minimum": 1}},
+					{"name": "fields", "in": "query", "required": true, "schema": {"type": "string"}}
+				],
+				"responses": {
+					"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+					"4XX": {"content": {"application/problem+json": {"schema": {"type": "object", "required": ["code"]}}}}
+				}
+			}
+		},
+		"/users/me": {
+			"get": {
+				"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}}}
+			}
+		},
+		"/users": {
+			"post": {
+				"requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+				"responses": {"201": {}}
+			}
+		}
+	},
+	"components": {
+		"schemas": {
+			"User": {
+				"type": "object",
+				"required": ["name"],
+				"additionalProperties": false,
+				"properties": {
+					"name": {"type": "string", "minLength": 1, "maxLength": 5},
+					"role": {"type": "string", "enum": ["admin", "user"]},
+					"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+					"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+					"created_at": {"type": "string", "format": "date-time"}
+				}
+			}
+		}
+	}
+}`
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		expectedErr bool
+	}{
+		{"Valid", document, false},
+		{"Not json", `{"openapi": `, true},
+		{"Unsupported version", `{"swagger": "2.0"}`, true},
+		{"Unresolved reference", `{"openapi": "3.0.3", "paths": {"/": {"get": {"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}}}}}}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := openapi.Load([]byte(tt.data))
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			assert.Equal(t, []string{"GET /users/me", "GET /users/{id}", "POST /users"}, doc.Operations())
+			assert.Equal(t, tt.data, string(doc.Bytes()))
+		})
+	}
+}
+
+func TestDocument_FindOperation(t *testing.T) {
+	doc, err := openapi.Load([]byte(document))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	_, params, ok := doc.FindOperation("GET", "/users/42")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"id": "42"}, params)
+
+	_, params, ok = doc.FindOperation("GET", "/users/me")
+	assert.True(t, ok)
+	assert.Empty(t, params)
+
+	_, _, ok = doc.FindOperation("DELETE", "/users/42")
+	assert.False(t, ok)
+
+	_, _, ok = doc.FindOperation("GET", "/users/42/roles")
+	assert.False(t, ok)
+}
+
+func TestDocument_ValidateRequest(t *testing.T) {
+	doc, err := openapi.Load([]byte(document))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	tests := []struct {
+		name               string
+		method             string
+		url                string
+		contentType        string
+		body               string
+		expectedViolations []*validation.Violation
+		expectedErr        error
+	}{
+		{"Valid parameters", "GET", "/users/42?fields=name", "", "", nil, nil},
+		{
+			"Invalid parameters",
+			"GET", "/users/zero", "", "",
+			[]*validation.Violation{
+				{Field: "id", Code: validation.CodeInvalid, Message: "id must be integer"},
+				{Field: "fields", Code: validation.CodeRequired, Message: "fields is required"},
+			},
+			nil,
+		},
+		{"Valid body", "POST", "/users", "application/json", `{"name": "bob", "tags": ["a"], "labels": {"team": "core"}, "created_at": "2019-03-01T10:00:00Z"}`, nil, nil},
+		{
+			"Invalid body",
+			"POST", "/users", "", `{"role": "owner", "tags": ["a", "b", "c"], "nmae": "bob", "labels": {"team": 1}}`,
+			[]*validation.Violation{
+				{Field: "name", Code: validation.CodeRequired, Message: "name is required"},
+				{Field: "labels.team", Code: validation.CodeInvalid, Message: "labels.team must be string"},
+				{Field: "nmae", Code: validation.CodeUnknown, Message: "nmae is not a known field"},
+				{Field: "role", Code: validation.CodeInvalid, Message: "role must be one of admin, user"},
+				{Field: "tags", Code: validation.CodeTooMany, Message: "tags must have at most 2 elements"},
+			},
+			nil,
+		},
+		{
+			"Too long",
+			"POST", "/users", "", `{"name": "robert"}`,
+			[]*validation.Violation{{Field: "name", Code: validation.CodeTooLong, Message: "name must be at most 5 characters long"}},
+			nil,
+		},
+		{
+			"Missing body",
+			"POST", "/users", "", "",
+			[]*validation.Violation{{Field: "", Code: validation.CodeRequired, Message: "body is required"}},
+			nil,
+		},
+		{
+			"Body of wrong type",
+			"POST", "/users", "", `["bob"]`,
+			[]*validation.Violation{{Field: "", Code: validation.CodeInvalid, Message: "body must be object"}},
+			nil,
+		},
+		{"Malformed body", "POST", "/users", "", `{"name": `, nil, openapi.ErrMalformedBody},
+		{"Undocumented media type", "POST", "/users", "text/plain", `bob`, nil, openapi.ErrUnsupportedMediaType},
+		{"Undocumented operation", "DELETE", "/users/42", "", "", nil, openapi.ErrOperationNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://fake-url"+tt.url, strings.NewReader(tt.body))
+			if len(tt.contentType) > 0 {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			violations, err := doc.ValidateRequest(req, []byte(tt.body))
+			assert.Equal(t, tt.expectedErr, errors.Cause(err))
+			assert.Equal(t, tt.expectedViolations, violations)
+		})
+	}
+}
+
+func TestDocument_ValidateResponse(t *testing.T) {
+	doc, err := openapi.Load([]byte(document))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	tests := []struct {
+		name               string
+		statusCode         int
+		contentType        string
+		body               string
+		expectedViolations []*validation.Violation
+		expectedErr        bool
+	}{
+		{"Valid", http.StatusOK, "application/json", `{"name": "bob"}`, nil, false},
+		{
+			"Invalid body",
+			http.StatusOK, "application/json", `{"name": "bob", "created_at": "yesterday"}`,
+			[]*validation.Violation{{Field: "created_at", Code: validation.CodeInvalid, Message: "created_at must be RFC 3339 date-time"}},
+			false,
+		},
+		{"Status range", http.StatusNotFound, "application/problem+json", `{"code": "not_found"}`, nil, false},
+		{"Undocumented status", http.StatusInternalServerError, "application/problem+json", `{"code": "internal_error"}`, nil, true},
+		{"Undocumented content type", http.StatusOK, "text/plain", `bob`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Content-Type", tt.contentType)
+
+			violations, err := doc.ValidateResponse("GET", "/users/42", tt.statusCode, header, []byte(tt.body))
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedViolations, violations)
+		})
+	}
+}
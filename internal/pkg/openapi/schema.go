@@ -0,0 +1,221 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/validation"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is the subset of OpenAPI schema object values are validated with
+type Schema struct {
+	Ref      string        `json:"$ref,omitempty"`
+	Type     string        `json:"type,omitempty"`
+	Format   string        `json:"format,omitempty"`
+	Nullable bool          `json:"nullable,omitempty"`
+	Enum     []interface{} `json:"enum,omitempty"`
+
+	Required             []string              `json:"required,omitempty"`
+	Properties           map[string]*Schema    `json:"properties,omitempty"`
+	AdditionalProperties *AdditionalProperties `json:"additionalProperties,omitempty"`
+
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+}
+
+// AdditionalProperties tells whether object can have properties other than listed ones, and schema of their values
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+// UnmarshalJSON decodes additionalProperties given either as boolean or as schema
+func (ap *AdditionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &ap.Allowed); err == nil {
+		return nil
+	}
+
+	ap.Allowed = true
+	return json.Unmarshal(data, &ap.Schema)
+}
+
+// validate checks decoded json value against the schema and returns every violation found, path names the value
+func (d *Document) validate(schema *Schema, value interface{}, path string) []*validation.Violation {
+	schema = d.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	if value == nil {
+		if schema.Nullable || len(schema.Type) == 0 {
+			return nil
+		}
+		return []*validation.Violation{invalid(path, "%s must not be null", name(path))}
+	}
+
+	if len(schema.Type) > 0 && !isType(schema.Type, value) {
+		return []*validation.Violation{invalid(path, "%s must be %s", name(path), schema.Type)}
+	}
+
+	if len(schema.Enum) > 0 && !oneOf(schema.Enum, value) {
+		allowed := make([]string, len(schema.Enum))
+		for i, e := range schema.Enum {
+			allowed[i] = fmt.Sprint(e)
+		}
+		return []*validation.Violation{invalid(path, "%s must be one of %s", name(path), strings.Join(allowed, ", "))}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return d.validateString(schema, v, path)
+	case float64:
+		if schema.Minimum != nil && v < *schema.Minimum {
+			return []*validation.Violation{invalid(path, "%s must be at least %v", name(path), *schema.Minimum)}
+		}
+		if schema.Maximum != nil && v > *schema.Maximum {
+			return []*validation.Violation{invalid(path, "%s must be at most %v", name(path), *schema.Maximum)}
+		}
+	case []interface{}:
+		return d.validateArray(schema, v, path)
+	case map[string]interface{}:
+		return d.validateObject(schema, v, path)
+	}
+
+	return nil
+}
+
+func (d *Document) validateString(schema *Schema, value string, path string) []*validation.Violation {
+	length := utf8.RuneCountInString(value)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		if length == 0 {
+			return []*validation.Violation{{Field: path, Code: validation.CodeRequired, Message: fmt.Sprintf("%s is required", name(path))}}
+		}
+		return []*validation.Violation{invalid(path, "%s must be at least %d characters long", name(path), *schema.MinLength)}
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		return []*validation.Violation{{Field: path, Code: validation.CodeTooLong, Message: fmt.Sprintf("%s must be at most %d characters long", name(path), *schema.MaxLength)}}
+	}
+	if schema.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+			return []*validation.Violation{invalid(path, "%s must be RFC 3339 date-time", name(path))}
+		}
+	}
+
+	return nil
+}
+
+func (d *Document) validateArray(schema *Schema, value []interface{}, path string) []*validation.Violation {
+	if schema.MinItems != nil && len(value) < *schema.MinItems {
+		if len(value) == 0 {
+			return []*validation.Violation{{Field: path, Code: validation.CodeRequired, Message: fmt.Sprintf("%s is required", name(path))}}
+		}
+		return []*validation.Violation{invalid(path, "%s must have at least %d elements", name(path), *schema.MinItems)}
+	}
+	if schema.MaxItems != nil && len(value) > *schema.MaxItems {
+		return []*validation.Violation{{Field: path, Code: validation.CodeTooMany, Message: fmt.Sprintf("%s must have at most %d elements", name(path), *schema.MaxItems)}}
+	}
+
+	var violations []*validation.Violation
+	for i, item := range value {
+		violations = append(violations, d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+	}
+
+	return violations
+}
+
+func (d *Document) validateObject(schema *Schema, value map[string]interface{}, path string) []*validation.Violation {
+	var violations []*validation.Violation
+	for _, property := range schema.Required {
+		if _, ok := value[property]; !ok {
+			field := join(path, property)
+			violations = append(violations, &validation.Violation{Field: field, Code: validation.CodeRequired, Message: fmt.Sprintf("%s is required", field)})
+		}
+	}
+
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := join(path, key)
+		if property, ok := schema.Properties[key]; ok {
+			violations = append(violations, d.validate(property, value[key], field)...)
+			continue
+		}
+
+		switch {
+		case schema.AdditionalProperties == nil:
+		case !schema.AdditionalProperties.Allowed:
+			violations = append(violations, &validation.Violation{Field: field, Code: validation.CodeUnknown, Message: fmt.Sprintf("%s is not a known field", field)})
+		default:
+			violations = append(violations, d.validate(schema.AdditionalProperties.Schema, value[key], field)...)
+		}
+	}
+
+	return violations
+}
+
+func isType(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	}
+	return false
+}
+
+func oneOf(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(e, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func invalid(path, format string, args ...interface{}) *validation.Violation {
+	return &validation.Violation{Field: path, Code: validation.CodeInvalid, Message: fmt.Sprintf(format, args...)}
+}
+
+// name returns name of the value at path for violation messages, value at empty path is the body itself
+func name(path string) string {
+	if len(path) == 0 {
+		return "body"
+	}
+	return path
+}
+
+func join(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
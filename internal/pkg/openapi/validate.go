@@ -0,0 +1,142 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/validation"
+	"github.com/pkg/errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrOperationNotFound is returned for requests the document has no operation for
+	ErrOperationNotFound = errors.New("operation is not documented")
+	// ErrUnsupportedMediaType is returned for body of media type operation does not document
+	ErrUnsupportedMediaType = errors.New("media type is not documented")
+	// ErrMalformedBody is returned for json body which cant be decoded
+	ErrMalformedBody = errors.New("body is not valid json")
+)
+
+// ValidateRequest checks parameters and body of the request against its operation and returns every violation found.
+// Body of the request is passed separately, as it can be read only once.
+func (d *Document) ValidateRequest(req *http.Request, body []byte) ([]*validation.Violation, error) {
+	op, pathParams, ok := d.FindOperation(req.Method, req.URL.Path)
+	if !ok {
+		return nil, ErrOperationNotFound
+	}
+
+	var (
+		query      = req.URL.Query()
+		violations []*validation.Violation
+	)
+	for _, param := range op.Parameters {
+		var (
+			value   string
+			present bool
+		)
+		switch param.In {
+		case "path":
+			value, present = pathParams[param.Name]
+		case "query":
+			value, present = query.Get(param.Name), len(query[param.Name]) > 0
+		case "header":
+			value, present = req.Header.Get(param.Name), len(req.Header.Get(param.Name)) > 0
+		default:
+			continue
+		}
+
+		if !present {
+			if param.Required {
+				violations = append(violations, &validation.Violation{Field: param.Name, Code: validation.CodeRequired, Message: fmt.Sprintf("%s is required", param.Name)})
+			}
+			continue
+		}
+		violations = append(violations, d.validate(param.Schema, parameterValue(d.resolve(param.Schema), value), param.Name)...)
+	}
+
+	if op.RequestBody == nil {
+		return violations, nil
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			violations = append(violations, &validation.Violation{Field: "", Code: validation.CodeRequired, Message: "body is required"})
+		}
+		return violations, nil
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	if len(contentType) == 0 {
+		contentType = "application/json"
+	}
+	bodyViolations, err := d.validateBody(op.RequestBody.Content, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(violations, bodyViolations...), nil
+}
+
+// ValidateResponse checks status code, content type and body of the response against operation of the request
+// and returns every violation found. Undocumented status codes and media types are returned as errors.
+func (d *Document) ValidateResponse(method, path string, statusCode int, header http.Header, body []byte) ([]*validation.Violation, error) {
+	op, _, ok := d.FindOperation(method, path)
+	if !ok {
+		return nil, ErrOperationNotFound
+	}
+
+	response, ok := op.response(statusCode)
+	if !ok {
+		return nil, errors.Errorf("status %d of %s %s is not documented", statusCode, method, path)
+	}
+	if len(response.Content) == 0 {
+		return nil, nil
+	}
+
+	return d.validateBody(response.Content, header.Get("Content-Type"), body)
+}
+
+// validateBody checks body of the content type against schema documented for it, only json bodies are validated
+func (d *Document) validateBody(content map[string]*MediaType, contentType string, body []byte) ([]*validation.Violation, error) {
+	mediaTypeName, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errors.Wrapf(ErrUnsupportedMediaType, "invalid content type %s", contentType)
+	}
+	mediaType, ok := content[mediaTypeName]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnsupportedMediaType, "content type %s", mediaTypeName)
+	}
+	if mediaType.Schema == nil || !strings.HasSuffix(mediaTypeName, "json") {
+		return nil, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, errors.Wrap(ErrMalformedBody, err.Error())
+	}
+
+	return d.validate(mediaType.Schema, value, ""), nil
+}
+
+// parameterValue converts string value of path or query parameter to json type of its schema,
+// value which cant be converted is kept as string and fails validation
+func parameterValue(schema *Schema, value string) interface{} {
+	if schema == nil {
+		return value
+	}
+
+	switch schema.Type {
+	case "integer", "number":
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
@@ -0,0 +1,139 @@
+package pacer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is token bucket refilled with Rate tokens per second up to Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Pacer limits throughput by keys in "kind:value" format, i.e. "originator:+15551234567".
+// Key uses limit configured for the key itself or for its kind, keys without limit are not paced.
+type Pacer struct {
+	limits map[string]Limit
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+// New creates new Pacer with limits by key or kind
+func New(limits map[string]Limit) *Pacer {
+	return &Pacer{
+		limits:  limits,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Reserve takes token for every key when all of them have one available and returns 0,
+// otherwise nothing is taken and time to wait till every key has a token is returned
+func (p *Pacer) Reserve(keys ...string) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var (
+		now     = time.Now()
+		wait    time.Duration
+		buckets = make([]*bucket, 0, len(keys))
+	)
+	for _, key := range keys {
+		b := p.bucket(key, now)
+		if b == nil {
+			continue
+		}
+
+		if b.tokens < 1 {
+			if delay := time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second)); delay > wait {
+				wait = delay
+			}
+		}
+		buckets = append(buckets, b)
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return 0
+}
+
+// bucket returns refilled bucket of the key or nil when key is not paced
+func (p *Pacer) bucket(key string, now time.Time) *bucket {
+	b, ok := p.buckets[key]
+	if !ok {
+		limit, ok := p.limits[key]
+		if !ok {
+			if limit, ok = p.limits[strings.SplitN(key, ":", 2)[0]]; !ok {
+				return nil
+			}
+		}
+		if limit.Rate <= 0 {
+			return nil
+		}
+		if limit.Burst < 1 {
+			limit.Burst = 1
+		}
+
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		p.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+
+	return b
+}
+
+// ParseLimits reads comma separated list of key=rate[:burst] limits, i.e. "originator=1,account=10:20,originator:MyBrand=30".
+// Burst defaults to rate rounded up.
+func ParseLimits(spec string) (map[string]Limit, error) {
+	limits := map[string]Limit{}
+
+	for _, rule := range strings.Split(spec, ",") {
+		if rule = strings.TrimSpace(rule); len(rule) == 0 {
+			continue
+		}
+
+		idx := strings.LastIndex(rule, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid pacer limit %s", rule)
+		}
+
+		values := strings.SplitN(rule[idx+1:], ":", 2)
+		rate, err := strconv.ParseFloat(strings.TrimSpace(values[0]), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate of pacer limit %s", rule)
+		}
+
+		limit := Limit{Rate: rate, Burst: int(rate)}
+		if float64(limit.Burst) < rate {
+			limit.Burst++
+		}
+		if len(values) == 2 {
+			if limit.Burst, err = strconv.Atoi(strings.TrimSpace(values[1])); err != nil || limit.Burst < 1 {
+				return nil, fmt.Errorf("invalid burst of pacer limit %s", rule)
+			}
+		}
+
+		limits[strings.TrimSpace(rule[:idx])] = limit
+	}
+
+	return limits, nil
+}
@@ -0,0 +1,71 @@
+package pacer_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/pacer"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]pacer.Limit
+		wantErr bool
+	}{
+		{
+			"Kinds and keys",
+			"originator=1, account=10:20, originator:+15551234567=0.5",
+			map[string]pacer.Limit{
+				"originator":              {Rate: 1, Burst: 1},
+				"account":                 {Rate: 10, Burst: 20},
+				"originator:+15551234567": {Rate: 0.5, Burst: 1},
+			},
+			false,
+		},
+		{"Empty", "", map[string]pacer.Limit{}, false},
+		{"No rate", "originator", nil, true},
+		{"Invalid rate", "originator=fast", nil, true},
+		{"Invalid burst", "originator=1:0", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pacer.ParseLimits(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseLimits() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPacer_Reserve(t *testing.T) {
+	p := pacer.New(map[string]pacer.Limit{
+		"originator":      {Rate: 10, Burst: 2},
+		"originator:fast": {Rate: 1000, Burst: 1000},
+		"account":         {Rate: 1, Burst: 3},
+	})
+
+	// burst is available right away
+	assert.Equal(t, time.Duration(0), p.Reserve("originator:slow", "account:twilio"))
+	assert.Equal(t, time.Duration(0), p.Reserve("originator:slow", "account:twilio"))
+
+	// originator is out of tokens, account token is not taken
+	wait := p.Reserve("originator:slow", "account:twilio")
+	assert.True(t, wait > 0 && wait <= 100*time.Millisecond, "unexpected wait %v", wait)
+
+	// key limit overrides kind limit, account is shared
+	assert.Equal(t, time.Duration(0), p.Reserve("originator:fast", "account:twilio"))
+	wait = p.Reserve("originator:fast", "account:twilio")
+	assert.True(t, wait > 900*time.Millisecond && wait <= time.Second, "unexpected wait %v", wait)
+
+	// keys without limit are not paced
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, time.Duration(0), p.Reserve("sender:any"))
+	}
+
+	time.Sleep(110 * time.Millisecond)
+	assert.Equal(t, time.Duration(0), p.Reserve("originator:slow"))
+}
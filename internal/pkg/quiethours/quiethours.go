@@ -0,0 +1,132 @@
+package quiethours
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// DefaultCategory is used for messages sent without category and for categories with no quiet hours configured
+const DefaultCategory = "default"
+
+// tenantPrefix marks rule of the tenant, i.e. "tenant:acme"
+const tenantPrefix = "tenant:"
+
+// Window is daily period of local time when messages are not delivered, it can wrap around midnight
+type Window struct {
+	// Start and End are minutes since midnight
+	Start int
+	End   int
+}
+
+// Rules holds quiet hours windows by tenant and by message category
+type Rules struct {
+	windows map[string]Window
+	tenants map[string]Window
+	bypass  map[string]bool
+}
+
+// Parse reads quiet hours rules from comma separated list of category=HH:MM-HH:MM and tenant:ID=HH:MM-HH:MM windows,
+// i.e. "marketing=21:00-08:00,default=22:00-07:00,tenant:acme=20:00-09:00". Window of the tenant applies to every
+// category of its messages in place of category windows. Messages of bypass categories are never held.
+func Parse(spec string, bypass []string) (*Rules, error) {
+	rules := &Rules{
+		windows: map[string]Window{},
+		tenants: map[string]Window{},
+		bypass:  map[string]bool{},
+	}
+
+	for _, category := range bypass {
+		if category = strings.TrimSpace(category); len(category) > 0 {
+			rules.bypass[category] = true
+		}
+	}
+
+	for _, rule := range strings.Split(spec, ",") {
+		if rule = strings.TrimSpace(rule); len(rule) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(rule, "=", 2)
+		name := ""
+		if len(parts) == 2 {
+			name = strings.TrimSpace(parts[0])
+		}
+		if len(name) == 0 || name == tenantPrefix {
+			return nil, fmt.Errorf("invalid quiet hours rule %s", rule)
+		}
+
+		window, err := parseWindow(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid quiet hours rule %s", rule)
+		}
+		if strings.HasPrefix(name, tenantPrefix) {
+			rules.tenants[strings.TrimPrefix(name, tenantPrefix)] = window
+			continue
+		}
+		rules.windows[name] = window
+	}
+
+	return rules, nil
+}
+
+// ReleaseTime returns time message of the tenant with given category can be delivered at, when it is inside quiet hours of the location.
+// Window of the tenant takes precedence over window of the category, tenantID is empty for messages sent without API key.
+func (r *Rules) ReleaseTime(tenantID, category string, at time.Time, loc *time.Location) (time.Time, bool) {
+	if r == nil || r.bypass[category] {
+		return time.Time{}, false
+	}
+
+	window, ok := r.tenants[tenantID]
+	if !ok {
+		if window, ok = r.windows[category]; !ok {
+			if window, ok = r.windows[DefaultCategory]; !ok {
+				return time.Time{}, false
+			}
+		}
+	}
+
+	var (
+		local   = at.In(loc)
+		minutes = local.Hour()*60 + local.Minute()
+		release = time.Date(local.Year(), local.Month(), local.Day(), window.End/60, window.End%60, 0, 0, loc)
+	)
+
+	switch {
+	case window.Start < window.End:
+		if minutes >= window.Start && minutes < window.End {
+			return release, true
+		}
+	case window.Start > window.End:
+		if minutes < window.End {
+			return release, true
+		}
+		if minutes >= window.Start {
+			return release.AddDate(0, 0, 1), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func parseWindow(window string) (Window, error) {
+	bounds := strings.Split(strings.TrimSpace(window), "-")
+	if len(bounds) != 2 {
+		return Window{}, errors.New("window must be in HH:MM-HH:MM format")
+	}
+
+	start, err := time.Parse("15:04", strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return Window{}, errors.Wrap(err, "failed to parse window start")
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(bounds[1]))
+	if err != nil {
+		return Window{}, errors.Wrap(err, "failed to parse window end")
+	}
+
+	return Window{
+		Start: start.Hour()*60 + start.Minute(),
+		End:   end.Hour()*60 + end.Minute(),
+	}, nil
+}
@@ -0,0 +1,148 @@
+package quiethours_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/quiethours"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{"Empty", "", false},
+		{"Multiple categories", "marketing=21:00-08:00, default=22:30-07:00", false},
+		{"Tenant", "tenant:acme=20:00-09:00,marketing=21:00-08:00", false},
+		{"No category", "=21:00-08:00", true},
+		{"No tenant", "tenant:=21:00-08:00", true},
+		{"No window", "marketing", true},
+		{"Invalid time", "marketing=25:00-08:00", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := quiethours.Parse(tt.spec, nil); (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRules_ReleaseTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database is not available")
+	}
+
+	rules, err := quiethours.Parse("marketing=21:00-08:00,reminder=12:00-13:00,default=22:00-07:00,tenant:acme=20:00-09:00", []string{"transactional"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		tenantID string
+		category string
+		at       time.Time
+		want     time.Time
+		wantHeld bool
+	}{
+		{
+			"Before midnight",
+			"",
+			"marketing",
+			time.Date(2019, 3, 1, 22, 30, 0, 0, berlin),
+			time.Date(2019, 3, 2, 8, 0, 0, 0, berlin),
+			true,
+		},
+		{
+			"After midnight",
+			"",
+			"marketing",
+			time.Date(2019, 3, 2, 3, 0, 0, 0, berlin),
+			time.Date(2019, 3, 2, 8, 0, 0, 0, berlin),
+			true,
+		},
+		{
+			"Converted into recipient's time zone",
+			"",
+			"marketing",
+			time.Date(2019, 3, 1, 2, 0, 0, 0, time.UTC),
+			time.Date(2019, 3, 1, 8, 0, 0, 0, berlin),
+			true,
+		},
+		{
+			"Outside of quiet hours",
+			"",
+			"marketing",
+			time.Date(2019, 3, 1, 12, 0, 0, 0, berlin),
+			time.Time{},
+			false,
+		},
+		{
+			"Window within a day",
+			"",
+			"reminder",
+			time.Date(2019, 3, 1, 12, 15, 0, 0, berlin),
+			time.Date(2019, 3, 1, 13, 0, 0, 0, berlin),
+			true,
+		},
+		{
+			"Default window",
+			"",
+			"newsletter",
+			time.Date(2019, 3, 1, 23, 0, 0, 0, berlin),
+			time.Date(2019, 3, 2, 7, 0, 0, 0, berlin),
+			true,
+		},
+		{
+			"Window of the tenant",
+			"acme",
+			"reminder",
+			time.Date(2019, 3, 1, 20, 30, 0, 0, berlin),
+			time.Date(2019, 3, 2, 9, 0, 0, 0, berlin),
+			true,
+		},
+		{
+			"Tenant takes precedence over category",
+			"acme",
+			"marketing",
+			time.Date(2019, 3, 2, 8, 30, 0, 0, berlin),
+			time.Date(2019, 3, 2, 9, 0, 0, 0, berlin),
+			true,
+		},
+		{
+			"Other tenant gets category window",
+			"other",
+			"marketing",
+			time.Date(2019, 3, 2, 8, 30, 0, 0, berlin),
+			time.Time{},
+			false,
+		},
+		{
+			"Tenant bypass category",
+			"acme",
+			"transactional",
+			time.Date(2019, 3, 1, 23, 0, 0, 0, berlin),
+			time.Time{},
+			false,
+		},
+		{
+			"Bypass category",
+			"",
+			"transactional",
+			time.Date(2019, 3, 1, 23, 0, 0, 0, berlin),
+			time.Time{},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, held := rules.ReleaseTime(tt.tenantID, tt.category, tt.at, berlin)
+			if held != tt.wantHeld || !got.Equal(tt.want) {
+				t.Errorf("ReleaseTime() = %v, %v, want %v, %v", got, held, tt.want, tt.wantHeld)
+			}
+		})
+	}
+}
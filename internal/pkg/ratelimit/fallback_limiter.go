@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// Policy defines how requests are limited while primary limiter is unavailable
+type Policy string
+
+const (
+	// PolicyLocal limits requests with in-memory limiter of the instance
+	PolicyLocal Policy = "local"
+	// PolicyOpen allows all requests
+	PolicyOpen Policy = "open"
+	// PolicyClosed rejects all requests
+	PolicyClosed Policy = "closed"
+)
+
+// ErrUnavailable returned by fail-closed limiter while primary limiter is unavailable
+var ErrUnavailable = errors.New("rate limiter is unavailable")
+
+// ParsePolicy returns policy by its name
+func ParsePolicy(name string) (Policy, error) {
+	switch policy := Policy(name); policy {
+	case PolicyLocal, PolicyOpen, PolicyClosed:
+		return policy, nil
+	}
+
+	return "", fmt.Errorf("unknown rate limiter failure policy %s", name)
+}
+
+// Status tracks availability of primary limiters, it is shared by all fallback limiters of the instance.
+// Once primary limiter fails it is not called for retry interval, so every request does not wait for unavailable store.
+type Status struct {
+	retryInterval time.Duration
+	onChange      func(degraded bool, err error)
+
+	mu       sync.Mutex
+	degraded bool
+	retryAt  time.Time
+}
+
+// NewStatus creates new Status, onChange is called with error of primary limiter whenever limiters enter or leave degraded mode
+func NewStatus(retryInterval time.Duration, onChange func(degraded bool, err error)) *Status {
+	return &Status{
+		retryInterval: retryInterval,
+		onChange:      onChange,
+	}
+}
+
+// Degraded tells whether primary limiters are unavailable
+func (s *Status) Degraded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.degraded
+}
+
+// available tells whether primary limiter should be called
+func (s *Status) available() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.degraded || !time.Now().Before(s.retryAt)
+}
+
+// report records outcome of primary limiter call
+func (s *Status) report(err error) {
+	failed := err != nil
+
+	s.mu.Lock()
+	changed := s.degraded != failed
+	s.degraded = failed
+	if failed {
+		s.retryAt = time.Now().Add(s.retryInterval)
+	}
+	s.mu.Unlock()
+
+	if changed && s.onChange != nil {
+		s.onChange(failed, err)
+	}
+}
+
+// FallbackLimiter limits requests with primary limiter and falls back to policy while primary limiter fails
+type FallbackLimiter struct {
+	primary Limiter
+	local   *MemoryLimiter
+	policy  Policy
+	status  *Status
+	limit   int
+	period  time.Duration
+}
+
+// NewFallbackLimiter creates new instance of FallbackLimiter allowing limit requests per period
+func NewFallbackLimiter(primary Limiter, limit int, period time.Duration, policy Policy, status *Status) (*FallbackLimiter, error) {
+	fl := &FallbackLimiter{
+		primary: primary,
+		policy:  policy,
+		status:  status,
+		limit:   limit,
+		period:  period,
+	}
+
+	if policy == PolicyLocal {
+		var err error
+		if fl.local, err = NewMemoryLimiter(limit, period); err != nil {
+			return nil, err
+		}
+	}
+
+	return fl, nil
+}
+
+// Limit returns number of requests allowed per period
+func (fl *FallbackLimiter) Limit() int {
+	return fl.limit
+}
+
+// Take counts count requests of the key and returns its quota
+func (fl *FallbackLimiter) Take(key string, count int) (*Quota, error) {
+	if fl.status.available() {
+		quota, err := fl.primary.Take(key, count)
+		fl.status.report(err)
+		if err == nil {
+			return quota, nil
+		}
+	}
+
+	var (
+		quota *Quota
+		err   error
+	)
+	switch fl.policy {
+	case PolicyLocal:
+		quota, err = fl.local.Take(key, count)
+	case PolicyOpen:
+		quota = &Quota{Limit: fl.limit, Remaining: fl.limit, Reset: time.Now().Add(fl.period)}
+	default:
+		return nil, ErrUnavailable
+	}
+	if quota != nil {
+		quota.Degraded = true
+	}
+
+	return quota, err
+}
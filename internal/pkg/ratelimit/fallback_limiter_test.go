@@ -0,0 +1,114 @@
+package ratelimit_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/ratelimit"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+type MockedLimiter struct {
+	mock.Mock
+}
+
+func (m *MockedLimiter) Take(key string, count int) (quota *ratelimit.Quota, err error) {
+	args := m.Called(key, count)
+	if args.Get(0) != nil {
+		quota = args.Get(0).(*ratelimit.Quota)
+	}
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	return
+}
+
+func (m *MockedLimiter) Limit() int {
+	return m.Called().Int(0)
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, name := range []string{"local", "open", "closed"} {
+		policy, err := ratelimit.ParsePolicy(name)
+		assert.NoError(t, err)
+		assert.Equal(t, ratelimit.Policy(name), policy)
+	}
+
+	_, err := ratelimit.ParsePolicy("ajar")
+	assert.Error(t, err)
+}
+
+func TestFallbackLimiter_Take(t *testing.T) {
+	tests := []struct {
+		name             string
+		policy           ratelimit.Policy
+		expectedExceeded []bool
+		expectedErr      error
+	}{
+		{"Local", ratelimit.PolicyLocal, []bool{false, true}, nil},
+		{"Open", ratelimit.PolicyOpen, []bool{false, false}, nil},
+		{"Closed", ratelimit.PolicyClosed, nil, ratelimit.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &MockedLimiter{}
+			primary.On("Take", "key", 1).Return(nil, errors.New("connection refused")).Once()
+
+			var changes []bool
+			status := ratelimit.NewStatus(time.Hour, func(degraded bool, err error) {
+				changes = append(changes, degraded)
+			})
+			fl, err := ratelimit.NewFallbackLimiter(primary, 1, time.Minute, tt.policy, status)
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+
+			for i := 0; i < 2; i++ {
+				quota, err := fl.Take("key", 1)
+				if tt.expectedErr != nil {
+					assert.Equal(t, tt.expectedErr, err)
+					continue
+				}
+
+				assert.NoError(t, err)
+				assert.True(t, quota.Degraded)
+				assert.Equal(t, tt.expectedExceeded[i], quota.Exceeded)
+			}
+
+			// primary is called once within retry interval
+			primary.AssertNumberOfCalls(t, "Take", 1)
+			assert.True(t, status.Degraded())
+			assert.Equal(t, []bool{true}, changes)
+		})
+	}
+}
+
+func TestFallbackLimiter_Recovery(t *testing.T) {
+	primary := &MockedLimiter{}
+	primary.On("Take", "key", 1).Return(nil, errors.New("connection refused")).Once()
+	primary.On("Take", "key", 1).Return(&ratelimit.Quota{Limit: 1, Remaining: 0}, nil).Once()
+
+	var changes []bool
+	status := ratelimit.NewStatus(0, func(degraded bool, err error) {
+		changes = append(changes, degraded)
+	})
+	fl, err := ratelimit.NewFallbackLimiter(primary, 1, time.Minute, ratelimit.PolicyLocal, status)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	quota, err := fl.Take("key", 1)
+	assert.NoError(t, err)
+	assert.True(t, quota.Degraded)
+
+	quota, err = fl.Take("key", 1)
+	assert.NoError(t, err)
+	assert.False(t, quota.Degraded)
+
+	assert.False(t, status.Degraded())
+	assert.Equal(t, []bool{true, false}, changes)
+	primary.AssertExpectations(t)
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"github.com/pkg/errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter limits requests with token buckets kept in memory of the instance,
+// bucket of the key holds up to limit tokens and is refilled at limit tokens per period
+type MemoryLimiter struct {
+	limit  int
+	period time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewMemoryLimiter creates new instance of MemoryLimiter allowing limit requests per period
+func NewMemoryLimiter(limit int, period time.Duration) (*MemoryLimiter, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	if period <= 0 {
+		return nil, errors.New("period must be positive")
+	}
+
+	return &MemoryLimiter{
+		limit:     limit,
+		period:    period,
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}, nil
+}
+
+// Limit returns number of requests allowed per period
+func (ml *MemoryLimiter) Limit() int {
+	return ml.limit
+}
+
+// Take counts count requests of the key and returns its quota, requests are either taken all at once or not at all
+func (ml *MemoryLimiter) Take(key string, count int) (*Quota, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	now := time.Now()
+	ml.sweep(now)
+
+	b, ok := ml.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(ml.limit), last: now}
+		ml.buckets[key] = b
+	}
+	b.tokens = ml.refill(b, now)
+	b.last = now
+
+	quota := &Quota{Limit: ml.limit}
+	if b.tokens < float64(count) {
+		quota.Exceeded = true
+		quota.Remaining = int(math.Floor(b.tokens))
+		quota.Reset = now.Add(ml.refillTime(math.Min(float64(count), float64(ml.limit)) - b.tokens))
+		return quota, nil
+	}
+
+	b.tokens -= float64(count)
+	quota.Remaining = int(math.Floor(b.tokens))
+	quota.Reset = now.Add(ml.refillTime(float64(ml.limit) - b.tokens))
+
+	return quota, nil
+}
+
+// refill returns tokens of the bucket at given time
+func (ml *MemoryLimiter) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.last).Seconds()*float64(ml.limit)/ml.period.Seconds()
+	return math.Min(tokens, float64(ml.limit))
+}
+
+// refillTime returns time it takes to refill given number of tokens
+func (ml *MemoryLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens * float64(ml.period) / float64(ml.limit)))
+}
+
+// sweep drops full buckets once per period, so keys of gone clients are not kept forever
+func (ml *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(ml.lastSweep) < ml.period {
+		return
+	}
+	ml.lastSweep = now
+
+	for key, b := range ml.buckets {
+		if ml.refill(b, now) >= float64(ml.limit) {
+			delete(ml.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package ratelimit_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewMemoryLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		period  time.Duration
+		wantErr bool
+	}{
+		{"Valid", 10, time.Second, false},
+		{"Zero limit", 0, time.Second, true},
+		{"Zero period", 10, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ratelimit.NewMemoryLimiter(tt.limit, tt.period)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestMemoryLimiter_Take(t *testing.T) {
+	ml, err := ratelimit.NewMemoryLimiter(2, 200*time.Millisecond)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	quota, err := ml.Take("key", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, quota.Limit)
+	assert.Equal(t, 1, quota.Remaining)
+	assert.False(t, quota.Exceeded)
+
+	quota, err = ml.Take("key", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, quota.Remaining)
+	assert.False(t, quota.Exceeded)
+
+	quota, err = ml.Take("key", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, quota.Remaining)
+	assert.True(t, quota.Exceeded)
+	assert.True(t, time.Until(quota.Reset) <= 100*time.Millisecond)
+
+	// other keys have own buckets
+	quota, err = ml.Take("other", 1)
+	assert.NoError(t, err)
+	assert.False(t, quota.Exceeded)
+
+	// one token is refilled every 100ms
+	time.Sleep(110 * time.Millisecond)
+	quota, err = ml.Take("key", 1)
+	assert.NoError(t, err)
+	assert.False(t, quota.Exceeded)
+}
+
+func TestMemoryLimiter_Take_Count(t *testing.T) {
+	ml, err := ratelimit.NewMemoryLimiter(5, time.Second)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	quota, err := ml.Take("key", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, quota.Remaining)
+	assert.False(t, quota.Exceeded)
+
+	// requests are not taken partially
+	quota, err = ml.Take("key", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, quota.Remaining)
+	assert.True(t, quota.Exceeded)
+
+	quota, err = ml.Take("key", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, quota.Remaining)
+	assert.False(t, quota.Exceeded)
+}
@@ -0,0 +1,39 @@
+package ratelimit
+
+import "time"
+
+// Limiter counts requests of the key and returns its quota, bulk requests are counted once per message
+type Limiter interface {
+	Take(key string, count int) (*Quota, error)
+	// Limit returns number of requests allowed per rate limiting period
+	Limit() int
+}
+
+// Quota is the state of rate limit of the key after the request was counted
+type Quota struct {
+	// Limit is number of requests allowed per rate limiting period
+	Limit int
+	// Remaining is number of requests left in the current period
+	Remaining int
+	// Reset is time the current period ends at
+	Reset time.Time
+	// Exceeded tells whether the requests are over the limit, such requests are not counted
+	Exceeded bool
+	// Degraded tells whether quota was counted by fallback while primary limiter is unavailable
+	Degraded bool
+}
+
+// newQuota returns quota of the key counted count requests within the period ending in resetIn
+func newQuota(limit int, count int64, exceeded bool, resetIn time.Duration) *Quota {
+	remaining := int64(limit) - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &Quota{
+		Limit:     limit,
+		Remaining: int(remaining),
+		Reset:     time.Now().Add(resetIn),
+		Exceeded:  exceeded,
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// counts requests of the key unless they exceed the limit and sets expiration of the new window,
+// returns number of counted requests, window ttl in milliseconds and 1 when requests were rejected
+var takeScript = redis.NewScript(1, `
+local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+local n = tonumber(ARGV[2])
+if count + n > tonumber(ARGV[3]) then
+	return {count, redis.call('PTTL', KEYS[1]), 1}
+end
+count = redis.call('INCRBY', KEYS[1], n)
+if count == n then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {count, redis.call('PTTL', KEYS[1]), 0}
+`)
+
+// RedisLimiter counts requests in fixed windows stored in redis, so limits are shared by all instances of the service
+type RedisLimiter struct {
+	pool   *redis.Pool
+	limit  int
+	period time.Duration
+}
+
+// NewRedisLimiter creates new instance of RedisLimiter allowing limit requests per period
+func NewRedisLimiter(pool *redis.Pool, limit int, period time.Duration) (*RedisLimiter, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	if period < time.Millisecond {
+		return nil, errors.New("period must be at least one millisecond")
+	}
+
+	return &RedisLimiter{
+		pool:   pool,
+		limit:  limit,
+		period: period,
+	}, nil
+}
+
+// Limit returns number of requests allowed per period
+func (rl *RedisLimiter) Limit() int {
+	return rl.limit
+}
+
+// Take counts count requests of the key and returns its quota, requests over the limit are not counted
+func (rl *RedisLimiter) Take(key string, count int) (*Quota, error) {
+	conn := rl.pool.Get()
+	defer conn.Close()
+
+	reply, err := redis.Int64s(takeScript.Do(conn, "ratelimit:"+key, int64(rl.period/time.Millisecond), count, rl.limit))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to count request of %s", key)
+	}
+	if len(reply) != 3 {
+		return nil, errors.Errorf("unexpected reply counting request of %s", key)
+	}
+
+	resetIn := time.Duration(reply[1]) * time.Millisecond
+	if resetIn < 0 {
+		// key has no expiration, window is considered to be just started
+		resetIn = rl.period
+	}
+
+	return newQuota(rl.limit, reply[0], reply[2] == 1, resetIn), nil
+}
@@ -0,0 +1,88 @@
+package segments
+
+import "strings"
+
+// Encoding describes character set used to deliver sms
+type Encoding string
+
+const (
+	// GSM7 is default 7-bit GSM 03.38 alphabet
+	GSM7 Encoding = "GSM-7"
+	// UCS2 is 16-bit encoding used when text contains characters outside of GSM alphabet
+	UCS2 Encoding = "UCS-2"
+)
+
+const (
+	gsm7SingleSegment = 160
+	gsm7MultiSegment  = 153
+	ucs2SingleSegment = 70
+	ucs2MultiSegment  = 67
+)
+
+// GSM 03.38 basic character set
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// GSM 03.38 extension table, every character takes two septets
+const gsm7Extended = "\f^{}\\[~]|€"
+
+// Info holds encoding details of sms text
+type Info struct {
+	Encoding Encoding
+	// Length is number of encoding units (septets for GSM-7, code units for UCS-2)
+	Length   int
+	Segments int
+}
+
+// Analyze detects encoding of the text and calculates number of segments required to deliver it
+func Analyze(text string) Info {
+	var (
+		length = 0
+		isGSM7 = true
+	)
+
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			length++
+		case strings.ContainsRune(gsm7Extended, r):
+			length += 2
+		default:
+			isGSM7 = false
+		}
+	}
+
+	if isGSM7 {
+		return Info{
+			Encoding: GSM7,
+			Length:   length,
+			Segments: count(length, gsm7SingleSegment, gsm7MultiSegment),
+		}
+	}
+
+	// UCS-2 counts characters outside of basic multilingual plane as surrogate pairs
+	length = 0
+	for _, r := range text {
+		if r > 0xFFFF {
+			length += 2
+		} else {
+			length++
+		}
+	}
+
+	return Info{
+		Encoding: UCS2,
+		Length:   length,
+		Segments: count(length, ucs2SingleSegment, ucs2MultiSegment),
+	}
+}
+
+func count(length, single, multi int) int {
+	if length == 0 {
+		return 0
+	}
+	if length <= single {
+		return 1
+	}
+	return (length + multi - 1) / multi
+}
@@ -0,0 +1,63 @@
+package segments_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/segments"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want segments.Info
+	}{
+		{
+			"Empty",
+			"",
+			segments.Info{segments.GSM7, 0, 0},
+		},
+		{
+			"GSM-7 single segment",
+			"Hello world",
+			segments.Info{segments.GSM7, 11, 1},
+		},
+		{
+			"GSM-7 full segment",
+			strings.Repeat("a", 160),
+			segments.Info{segments.GSM7, 160, 1},
+		},
+		{
+			"GSM-7 two segments",
+			strings.Repeat("a", 161),
+			segments.Info{segments.GSM7, 161, 2},
+		},
+		{
+			"GSM-7 extended characters take two septets",
+			"Price: 10€",
+			segments.Info{segments.GSM7, 11, 1},
+		},
+		{
+			"UCS-2 single segment",
+			"Привет",
+			segments.Info{segments.UCS2, 6, 1},
+		},
+		{
+			"UCS-2 two segments",
+			strings.Repeat("я", 71),
+			segments.Info{segments.UCS2, 71, 2},
+		},
+		{
+			"UCS-2 surrogate pairs",
+			"Hi 😀",
+			segments.Info{segments.UCS2, 5, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := segments.Analyze(tt.text); got != tt.want {
+				t.Errorf("Analyze() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
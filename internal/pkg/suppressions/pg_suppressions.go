@@ -0,0 +1,45 @@
+package suppressions
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// PostgresStore implements Store interface for Postgres
+type PostgresStore struct {
+	*sqlx.DB
+}
+
+// NewPostgresStore creates new instance of PostgresStore
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{
+		DB: db,
+	}
+}
+
+// Suppress adds phone number to suppression list, already suppressed number keeps its original error code
+func (ps *PostgresStore) Suppress(ctx context.Context, phoneNumber string, errorCode int) error {
+	if len(phoneNumber) == 0 {
+		return errors.New("phone number cant be empty")
+	}
+
+	_, err := ps.ExecContext(ctx, "INSERT INTO suppressions (phone_number, error_code) VALUES($1, NULLIF($2, 0)) ON CONFLICT DO NOTHING", phoneNumber, errorCode)
+	if err != nil {
+		return errors.Wrapf(err, "failed to suppress %s", phoneNumber)
+	}
+
+	return nil
+}
+
+// IsSuppressed checks if phone number is in suppression list
+func (ps *PostgresStore) IsSuppressed(ctx context.Context, phoneNumber string) (bool, error) {
+	var suppressed bool
+
+	err := ps.GetContext(ctx, &suppressed, "SELECT EXISTS(SELECT 1 FROM suppressions WHERE phone_number=$1)", phoneNumber)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to check suppression of %s", phoneNumber)
+	}
+
+	return suppressed, nil
+}
@@ -0,0 +1,70 @@
+package suppressions_test
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+
+	"github.com/arkadyb/demo_messenger/internal/pkg/suppressions"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestPostgresStore_IsSuppressed(t *testing.T) {
+	type fields struct {
+		DB func() (*sqlx.DB, sqlmock.Sqlmock)
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    bool
+		wantErr bool
+	}{
+		{
+			"Suppressed",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^SELECT EXISTS\(SELECT 1 FROM suppressions WHERE phone_number=\$1\)$`).WithArgs("+491701234567").
+						WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			true,
+			false,
+		},
+		{
+			"DB Error",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^SELECT EXISTS.*`).WillReturnError(errors.New("error"))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			false,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.fields.DB()
+			ps := suppressions.NewPostgresStore(db)
+			defer ps.Close()
+
+			got, err := ps.IsSuppressed(context.Background(), "+491701234567")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PostgresStore.IsSuppressed() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("PostgresStore.IsSuppressed() = %v, want %v", got, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
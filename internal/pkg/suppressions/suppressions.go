@@ -0,0 +1,13 @@
+package suppressions
+
+import (
+	"context"
+)
+
+// Store describes behaviour of suppressed phone numbers store, messages to suppressed numbers are not accepted
+type Store interface {
+	// Suppress adds phone number to suppression list with provider error code it was suppressed for
+	Suppress(ctx context.Context, phoneNumber string, errorCode int) error
+	// IsSuppressed checks if phone number is in suppression list
+	IsSuppressed(ctx context.Context, phoneNumber string) (bool, error)
+}
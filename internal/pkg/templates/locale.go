@@ -0,0 +1,46 @@
+package templates
+
+import "strings"
+
+// NormalizeLocale converts locale into canonical BCP 47 form, i.e. "de_at" becomes "de-AT"
+func NormalizeLocale(locale string) string {
+	parts := strings.Split(strings.Replace(strings.TrimSpace(locale), "_", "-", -1), "-")
+	if len(parts[0]) == 0 {
+		return ""
+	}
+
+	parts[0] = strings.ToLower(parts[0])
+	if len(parts) > 1 {
+		parts[1] = strings.ToUpper(parts[1])
+	}
+
+	return strings.Join(parts, "-")
+}
+
+// LocaleChain returns ordered list of locales to look template variant for:
+// requested locale, its base language and then configured fallback locales
+func LocaleChain(locale string, fallback []string) []string {
+	var (
+		chain []string
+		seen  = map[string]bool{}
+	)
+
+	add := func(l string) {
+		if l = NormalizeLocale(l); len(l) > 0 && !seen[l] {
+			seen[l] = true
+			chain = append(chain, l)
+		}
+	}
+
+	if locale = NormalizeLocale(locale); len(locale) > 0 {
+		add(locale)
+		if i := strings.Index(locale, "-"); i > 0 {
+			add(locale[:i])
+		}
+	}
+	for _, l := range fallback {
+		add(l)
+	}
+
+	return chain
+}
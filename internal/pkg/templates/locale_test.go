@@ -0,0 +1,61 @@
+package templates_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/templates"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"", ""},
+		{"EN", "en"},
+		{"de_at", "de-AT"},
+		{" pt-br ", "pt-BR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			if got := templates.NormalizeLocale(tt.locale); got != tt.want {
+				t.Errorf("NormalizeLocale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocaleChain(t *testing.T) {
+	tests := []struct {
+		name     string
+		locale   string
+		fallback []string
+		want     []string
+	}{
+		{
+			"Regional locale",
+			"de-AT",
+			[]string{"en"},
+			[]string{"de-AT", "de", "en"},
+		},
+		{
+			"No locale",
+			"",
+			[]string{"en-GB", "en"},
+			[]string{"en-GB", "en"},
+		},
+		{
+			"Duplicates removed",
+			"en_gb",
+			[]string{"en"},
+			[]string{"en-GB", "en"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := templates.LocaleChain(tt.locale, tt.fallback); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LocaleChain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package templates
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// PostgresStore implements Store interface for Postgres
+type PostgresStore struct {
+	*sqlx.DB
+}
+
+// NewPostgresStore creates new instance of PostgresStore
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{
+		DB: db,
+	}
+}
+
+// GetTemplate returns locale variant of the template by its ID and version, latest version is returned when version is 0
+func (ps *PostgresStore) GetTemplate(ctx context.Context, templateID, locale string, version int) (*Template, error) {
+	var (
+		template = &Template{}
+		err      error
+	)
+
+	if version == 0 {
+		err = ps.GetContext(ctx, template, "SELECT template_id, locale, version, body, created_at FROM templates WHERE template_id=$1 AND locale=$2 ORDER BY version DESC LIMIT 1", templateID, locale)
+	} else {
+		err = ps.GetContext(ctx, template, "SELECT template_id, locale, version, body, created_at FROM templates WHERE template_id=$1 AND locale=$2 AND version=$3", templateID, locale, version)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTemplateNotFound
+		}
+
+		return nil, errors.Wrapf(err, "failed to get template %s", templateID)
+	}
+
+	return template, nil
+}
+
+// SaveTemplate stores template body as the next version of the template locale variant.
+// Concurrent saves of the same variant are serialized with transaction-level advisory lock, so each of them gets its own version.
+func (ps *PostgresStore) SaveTemplate(ctx context.Context, templateID, locale, body string) (*Template, error) {
+	if len(templateID) == 0 || len(locale) == 0 || len(body) == 0 {
+		return nil, errors.New("input arguments cant be empty")
+	}
+
+	tx, err := ps.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create new transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", templateID+"/"+locale); err != nil {
+		return nil, errors.Wrapf(err, "failed to lock template %s", templateID)
+	}
+
+	var (
+		template = &Template{}
+	)
+	err = tx.GetContext(ctx, template, "INSERT INTO templates (template_id, locale, version, body) VALUES($1, $2, COALESCE((SELECT MAX(version) FROM templates WHERE template_id=$1 AND locale=$2), 0) + 1, $3) RETURNING template_id, locale, version, body, created_at", templateID, locale, body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to save template %s", templateID)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return template, nil
+}
@@ -0,0 +1,235 @@
+package templates_test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arkadyb/demo_messenger/internal/pkg/templates"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestPostgresStore_GetTemplate(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	type fields struct {
+		DB func() (*sqlx.DB, sqlmock.Sqlmock)
+	}
+	type args struct {
+		ctx        context.Context
+		templateID string
+		locale     string
+		version    int
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    *templates.Template
+		wantErr error
+	}{
+		{
+			"Latest version",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^SELECT template_id, locale, version, body, created_at FROM templates WHERE template_id=\$1 AND locale=\$2 ORDER BY version DESC LIMIT 1$`).WithArgs("welcome", "en").
+						WillReturnRows(sqlmock.NewRows([]string{"template_id", "locale", "version", "body", "created_at"}).AddRow("welcome", "en", 2, "Hi {{name}}", createdAt))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			args{
+				context.Background(),
+				"welcome",
+				"en",
+				0,
+			},
+			&templates.Template{
+				TemplateID: "welcome",
+				Locale:     "en",
+				Version:    2,
+				Body:       "Hi {{name}}",
+				CreatedAt:  createdAt,
+			},
+			nil,
+		},
+		{
+			"Specific version",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^SELECT template_id, locale, version, body, created_at FROM templates WHERE template_id=\$1 AND locale=\$2 AND version=\$3$`).WithArgs("welcome", "en", 1).
+						WillReturnRows(sqlmock.NewRows([]string{"template_id", "locale", "version", "body", "created_at"}).AddRow("welcome", "en", 1, "Hello {{name}}", createdAt))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			args{
+				context.Background(),
+				"welcome",
+				"en",
+				1,
+			},
+			&templates.Template{
+				TemplateID: "welcome",
+				Locale:     "en",
+				Version:    1,
+				Body:       "Hello {{name}}",
+				CreatedAt:  createdAt,
+			},
+			nil,
+		},
+		{
+			"Not found",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^SELECT template_id, locale, version, body, created_at FROM templates.*`).WillReturnError(sql.ErrNoRows)
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			args{
+				context.Background(),
+				"welcome",
+				"en",
+				0,
+			},
+			nil,
+			templates.ErrTemplateNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.fields.DB()
+			ps := templates.NewPostgresStore(db)
+			defer ps.Close()
+
+			got, err := ps.GetTemplate(tt.args.ctx, tt.args.templateID, tt.args.locale, tt.args.version)
+			if err != tt.wantErr {
+				t.Errorf("PostgresStore.GetTemplate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PostgresStore.GetTemplate() = %v, want %v", got, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
+
+func TestPostgresStore_SaveTemplate(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	type fields struct {
+		DB func() (*sqlx.DB, sqlmock.Sqlmock)
+	}
+	type args struct {
+		ctx        context.Context
+		templateID string
+		locale     string
+		body       string
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    *templates.Template
+		wantErr bool
+	}{
+		{
+			"Next version",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectBegin()
+					mock.ExpectExec(`^SELECT pg_advisory_xact_lock\(hashtext\(\$1\)\)$`).WithArgs("welcome/en").WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectQuery(`^INSERT INTO templates \(template_id, locale, version, body\).*`).WithArgs("welcome", "en", "Hi {{name}}").
+						WillReturnRows(sqlmock.NewRows([]string{"template_id", "locale", "version", "body", "created_at"}).AddRow("welcome", "en", 3, "Hi {{name}}", createdAt))
+					mock.ExpectCommit()
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			args{
+				context.Background(),
+				"welcome",
+				"en",
+				"Hi {{name}}",
+			},
+			&templates.Template{
+				TemplateID: "welcome",
+				Locale:     "en",
+				Version:    3,
+				Body:       "Hi {{name}}",
+				CreatedAt:  createdAt,
+			},
+			false,
+		},
+		{
+			"Empty body",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			args{
+				context.Background(),
+				"welcome",
+				"en",
+				"",
+			},
+			nil,
+			true,
+		},
+		{
+			"DB Error",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectBegin()
+					mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectQuery(`^INSERT INTO templates \(template_id, locale, version, body\).*`).WillReturnError(errors.New("error"))
+					mock.ExpectRollback()
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			args{
+				context.Background(),
+				"welcome",
+				"en",
+				"Hi {{name}}",
+			},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.fields.DB()
+			ps := templates.NewPostgresStore(db)
+			defer ps.Close()
+
+			got, err := ps.SaveTemplate(tt.args.ctx, tt.args.templateID, tt.args.locale, tt.args.body)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PostgresStore.SaveTemplate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PostgresStore.SaveTemplate() = %v, want %v", got, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
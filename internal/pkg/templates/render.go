@@ -0,0 +1,42 @@
+package templates
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholders are named variables wrapped into double curly braces, i.e. {{name}}
+var placeholderRegexp = regexp.MustCompile(`{{\s*([A-Za-z0-9_]+)\s*}}`)
+
+// MissingVariablesError returned when template contains placeholders with no value provided
+type MissingVariablesError struct {
+	Variables []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return fmt.Sprintf("missing template variables: %s", strings.Join(e.Variables, ", "))
+}
+
+// Render substitutes template placeholders with variables values
+func Render(body string, variables map[string]string) (string, error) {
+	var missing []string
+
+	text := placeholderRegexp.ReplaceAllStringFunc(body, func(placeholder string) string {
+		name := placeholderRegexp.FindStringSubmatch(placeholder)[1]
+		value, ok := variables[name]
+		if !ok {
+			missing = append(missing, name)
+			return placeholder
+		}
+		return value
+	})
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", &MissingVariablesError{Variables: missing}
+	}
+
+	return text, nil
+}
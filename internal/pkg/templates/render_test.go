@@ -0,0 +1,51 @@
+package templates_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/templates"
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		variables map[string]string
+		want      string
+		wantErr   error
+	}{
+		{
+			"No placeholders",
+			"Hello world",
+			nil,
+			"Hello world",
+			nil,
+		},
+		{
+			"Substitute variables",
+			"Hi {{name}}, your code is {{ code }}. Bye {{name}}",
+			map[string]string{"name": "John", "code": "1234", "unused": "value"},
+			"Hi John, your code is 1234. Bye John",
+			nil,
+		},
+		{
+			"Missing variables",
+			"Hi {{name}}, your code is {{code}}",
+			map[string]string{},
+			"",
+			&templates.MissingVariablesError{Variables: []string{"code", "name"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := templates.Render(tt.body, tt.variables)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package templates
+
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+// ErrTemplateNotFound returned when requested template, its locale variant or version does not exist
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Store describes behaviour of templates store
+type Store interface {
+	// GetTemplate returns locale variant of the template by its ID and version, latest version is returned when version is 0
+	GetTemplate(ctx context.Context, templateID, locale string, version int) (*Template, error)
+	// SaveTemplate stores new version of the template locale variant
+	SaveTemplate(ctx context.Context, templateID, locale, body string) (*Template, error)
+}
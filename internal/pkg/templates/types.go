@@ -0,0 +1,11 @@
+package templates
+
+import "time"
+
+type Template struct {
+	TemplateID string    `db:"template_id" json:"template_id"`
+	Locale     string    `db:"locale" json:"locale"`
+	Version    int       `db:"version" json:"version"`
+	Body       string    `db:"body" json:"body"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
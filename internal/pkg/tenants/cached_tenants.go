@@ -0,0 +1,83 @@
+package tenants
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CachedStore caches tenants and tiers of underlying store, so they are not queried on every request
+type CachedStore struct {
+	store Store
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	tenants map[string]cachedTenant
+	tiers   map[string]cachedTier
+}
+
+type cachedTenant struct {
+	tenant    *Tenant
+	expiresAt time.Time
+}
+
+type cachedTier struct {
+	tier      *Tier
+	err       error
+	expiresAt time.Time
+}
+
+// NewCachedStore creates new instance of CachedStore, entries are kept for ttl.
+// Unknown API keys are not cached, so they cant be used to fill up the cache.
+func NewCachedStore(store Store, ttl time.Duration) *CachedStore {
+	return &CachedStore{
+		store:   store,
+		ttl:     ttl,
+		tenants: map[string]cachedTenant{},
+		tiers:   map[string]cachedTier{},
+	}
+}
+
+// GetTenantByAPIKey returns tenant authenticated by API key
+func (cs *CachedStore) GetTenantByAPIKey(ctx context.Context, apiKey string) (*Tenant, error) {
+	key := HashAPIKey(apiKey)
+
+	cs.mu.Lock()
+	cached, ok := cs.tenants[key]
+	cs.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.tenant, nil
+	}
+
+	tenant, err := cs.store.GetTenantByAPIKey(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	cs.tenants[key] = cachedTenant{tenant: tenant, expiresAt: time.Now().Add(cs.ttl)}
+	cs.mu.Unlock()
+
+	return tenant, nil
+}
+
+// GetTier returns rate limit tier by its name
+func (cs *CachedStore) GetTier(ctx context.Context, name string) (*Tier, error) {
+	cs.mu.Lock()
+	cached, ok := cs.tiers[name]
+	cs.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.tier, cached.err
+	}
+
+	tier, err := cs.store.GetTier(ctx, name)
+	if err != nil && err != ErrTierNotFound {
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	cs.tiers[name] = cachedTier{tier: tier, err: err, expiresAt: time.Now().Add(cs.ttl)}
+	cs.mu.Unlock()
+
+	return tier, err
+}
@@ -0,0 +1,56 @@
+package tenants
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// PostgresStore implements Store interface for Postgres
+type PostgresStore struct {
+	*sqlx.DB
+}
+
+// NewPostgresStore creates new instance of PostgresStore
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{
+		DB: db,
+	}
+}
+
+// GetTenantByAPIKey returns tenant authenticated by API key
+func (ps *PostgresStore) GetTenantByAPIKey(ctx context.Context, apiKey string) (*Tenant, error) {
+	var (
+		tenant = &Tenant{}
+	)
+
+	err := ps.GetContext(ctx, tenant, "SELECT tenant_id, tier FROM api_keys WHERE api_key_hash=$1 AND revoked=FALSE", HashAPIKey(apiKey))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTenantNotFound
+		}
+
+		return nil, errors.Wrap(err, "failed to get tenant by api key")
+	}
+
+	return tenant, nil
+}
+
+// GetTier returns rate limit tier by its name
+func (ps *PostgresStore) GetTier(ctx context.Context, name string) (*Tier, error) {
+	var (
+		tier = &Tier{}
+	)
+
+	err := ps.GetContext(ctx, tier, "SELECT name, max_requests, bulk_max_requests FROM rate_limit_tiers WHERE name=$1", name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTierNotFound
+		}
+
+		return nil, errors.Wrapf(err, "failed to get tier %s", name)
+	}
+
+	return tier, nil
+}
@@ -0,0 +1,71 @@
+package tenants_test
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestPostgresStore_GetTenantByAPIKey(t *testing.T) {
+	type fields struct {
+		DB func() (*sqlx.DB, sqlmock.Sqlmock)
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *tenants.Tenant
+		wantErr error
+	}{
+		{
+			"Success",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^SELECT tenant_id, tier FROM api_keys WHERE api_key_hash=\$1 AND revoked=FALSE$`).WithArgs(tenants.HashAPIKey("secret")).
+						WillReturnRows(sqlmock.NewRows([]string{"tenant_id", "tier"}).AddRow("acme", "gold"))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			&tenants.Tenant{TenantID: "acme", Tier: "gold"},
+			nil,
+		},
+		{
+			"Unknown key",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^SELECT tenant_id, tier FROM api_keys.*`).
+						WillReturnRows(sqlmock.NewRows([]string{"tenant_id", "tier"}))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			nil,
+			tenants.ErrTenantNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.fields.DB()
+			ps := tenants.NewPostgresStore(db)
+			defer ps.Close()
+
+			got, err := ps.GetTenantByAPIKey(context.Background(), "secret")
+			if errors.Cause(err) != tt.wantErr {
+				t.Errorf("PostgresStore.GetTenantByAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.want != nil && *got != *tt.want {
+				t.Errorf("PostgresStore.GetTenantByAPIKey() = %v, want %v", got, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package tenants
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StaticStore implements Store interface for tenants and tiers defined in configuration
+type StaticStore struct {
+	tenants map[string]*Tenant
+	tiers   map[string]*Tier
+}
+
+// NewStaticStore creates StaticStore from comma separated lists of api_key=tenant_id:tier API keys
+// and name=max_requests:bulk_max_requests tiers, i.e. "secret=acme:gold" and "free=10:1,gold=1000:100"
+func NewStaticStore(apiKeys, tiers string) (*StaticStore, error) {
+	store := &StaticStore{
+		tenants: map[string]*Tenant{},
+		tiers:   map[string]*Tier{},
+	}
+
+	for _, rule := range splitRules(tiers) {
+		name, values, ok := splitRule(rule)
+		if !ok || len(values) != 2 {
+			return nil, fmt.Errorf("invalid tier %s", rule)
+		}
+
+		maxRequests, err := strconv.Atoi(values[0])
+		if err != nil || maxRequests <= 0 {
+			return nil, fmt.Errorf("invalid max requests of tier %s", rule)
+		}
+		bulkMaxRequests, err := strconv.Atoi(values[1])
+		if err != nil || bulkMaxRequests <= 0 {
+			return nil, fmt.Errorf("invalid bulk max requests of tier %s", rule)
+		}
+
+		store.tiers[name] = &Tier{Name: name, MaxRequests: maxRequests, BulkMaxRequests: bulkMaxRequests}
+	}
+
+	for i, rule := range splitRules(apiKeys) {
+		// rule holds the key itself, so it is never included into errors
+		apiKey, values, ok := splitRule(rule)
+		if !ok || len(values) != 2 || len(values[0]) == 0 {
+			return nil, fmt.Errorf("invalid api key #%d", i+1)
+		}
+		if _, ok := store.tiers[values[1]]; !ok {
+			return nil, fmt.Errorf("unknown tier %s of tenant %s", values[1], values[0])
+		}
+
+		store.tenants[HashAPIKey(apiKey)] = &Tenant{TenantID: values[0], Tier: values[1]}
+	}
+
+	return store, nil
+}
+
+// GetTenantByAPIKey returns tenant authenticated by API key
+func (ss *StaticStore) GetTenantByAPIKey(ctx context.Context, apiKey string) (*Tenant, error) {
+	tenant, ok := ss.tenants[HashAPIKey(apiKey)]
+	if !ok {
+		return nil, ErrTenantNotFound
+	}
+	return tenant, nil
+}
+
+// GetTier returns rate limit tier by its name
+func (ss *StaticStore) GetTier(ctx context.Context, name string) (*Tier, error) {
+	tier, ok := ss.tiers[name]
+	if !ok {
+		return nil, ErrTierNotFound
+	}
+	return tier, nil
+}
+
+func splitRules(spec string) []string {
+	var rules []string
+	for _, rule := range strings.Split(spec, ",") {
+		if rule = strings.TrimSpace(rule); len(rule) > 0 {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// splitRule splits key=value1:value2 rule
+func splitRule(rule string) (string, []string, bool) {
+	parts := strings.SplitN(rule, "=", 2)
+	if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+		return "", nil, false
+	}
+
+	values := strings.Split(parts[1], ":")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return strings.TrimSpace(parts[0]), values, true
+}
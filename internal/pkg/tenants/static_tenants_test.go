@@ -0,0 +1,54 @@
+package tenants_test
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewStaticStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiKeys string
+		tiers   string
+		wantErr bool
+	}{
+		{"Valid", "secret=acme:gold, other=globex:free", "free=10:1,gold=1000:100", false},
+		{"Empty", "", "", false},
+		{"Unknown tier", "secret=acme:platinum", "free=10:1", true},
+		{"No tenant", "secret=:free", "free=10:1", true},
+		{"Invalid tier limits", "", "free=10", true},
+		{"Zero tier limits", "", "free=0:1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tenants.NewStaticStore(tt.apiKeys, tt.tiers); (err != nil) != tt.wantErr {
+				t.Errorf("NewStaticStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStaticStore(t *testing.T) {
+	store, err := tenants.NewStaticStore("secret=acme:gold", "free=10:1,gold=1000:100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenant, err := store.GetTenantByAPIKey(context.Background(), "secret")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &tenants.Tenant{TenantID: "acme", Tier: "gold"}, tenant)
+	}
+
+	_, err = store.GetTenantByAPIKey(context.Background(), "guess")
+	assert.Equal(t, tenants.ErrTenantNotFound, err)
+
+	tier, err := store.GetTier(context.Background(), "free")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &tenants.Tier{Name: "free", MaxRequests: 10, BulkMaxRequests: 1}, tier)
+	}
+
+	_, err = store.GetTier(context.Background(), "platinum")
+	assert.Equal(t, tenants.ErrTierNotFound, err)
+}
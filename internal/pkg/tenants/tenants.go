@@ -0,0 +1,42 @@
+package tenants
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrTenantNotFound returned when API key does not belong to any tenant
+	ErrTenantNotFound = errors.New("tenant not found")
+	// ErrTierNotFound returned when rate limit tier with given name does not exist
+	ErrTierNotFound = errors.New("tier not found")
+)
+
+// Store describes behaviour of tenants store
+type Store interface {
+	// GetTenantByAPIKey returns tenant authenticated by API key
+	GetTenantByAPIKey(ctx context.Context, apiKey string) (*Tenant, error)
+	// GetTier returns rate limit tier by its name
+	GetTier(ctx context.Context, name string) (*Tier, error)
+}
+
+type contextKey struct{}
+
+// NewContext returns context carrying tenant authenticated for the request
+func NewContext(ctx context.Context, tenant *Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext returns tenant carried by the context
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	tenant, ok := ctx.Value(contextKey{}).(*Tenant)
+	return tenant, ok
+}
+
+// HashAPIKey returns hex encoded SHA-256 of API key, API keys are stored hashed
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
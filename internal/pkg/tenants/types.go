@@ -0,0 +1,15 @@
+package tenants
+
+// Tenant is the client authenticated with API key
+type Tenant struct {
+	TenantID string `db:"tenant_id"`
+	// Tier is name of the rate limit tier tenant belongs to
+	Tier string `db:"tier"`
+}
+
+// Tier holds rate limits, number of requests allowed per rate limiting period
+type Tier struct {
+	Name            string `db:"name"`
+	MaxRequests     int    `db:"max_requests"`
+	BulkMaxRequests int    `db:"bulk_max_requests"`
+}
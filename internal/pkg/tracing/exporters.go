@@ -0,0 +1,229 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// StdoutExporter writes spans as json lines, it is meant for local use
+type StdoutExporter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewStdoutExporter creates new instance of StdoutExporter writing to w
+func NewStdoutExporter(w io.Writer) *StdoutExporter {
+	return &StdoutExporter{encoder: json.NewEncoder(w)}
+}
+
+type stdoutSpan struct {
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         Kind                   `json:"kind"`
+	StartTime    string                 `json:"start_time"`
+	DurationMs   float64                `json:"duration_ms"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Links        []string               `json:"links,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// Export writes spans to the writer
+func (e *StdoutExporter) Export(ctx context.Context, spans []*SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, span := range spans {
+		out := &stdoutSpan{
+			TraceID:    span.SpanContext.TraceID.String(),
+			SpanID:     span.SpanContext.SpanID.String(),
+			Name:       span.Name,
+			Kind:       span.Kind,
+			StartTime:  span.StartTime.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+			DurationMs: float64(span.EndTime.Sub(span.StartTime).Nanoseconds()) / 1e6,
+			Attributes: span.Attributes,
+			Error:      span.Error,
+		}
+		if span.ParentSpanID != (SpanID{}) {
+			out.ParentSpanID = span.ParentSpanID.String()
+		}
+		for _, link := range span.Links {
+			out.Links = append(out.Links, link.Traceparent())
+		}
+
+		if err := e.encoder.Encode(out); err != nil {
+			return errors.Wrap(err, "failed to write span")
+		}
+	}
+
+	return nil
+}
+
+// OTLPExporter sends spans to OpenTelemetry collector with OTLP over HTTP using json encoding
+// https://opentelemetry.io/docs/specs/otlp/#otlphttp
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	httpclient  *http.Client
+}
+
+// NewOTLPExporter creates new instance of OTLPExporter posting spans to endpoint, i.e. "http://localhost:4318/v1/traces"
+func NewOTLPExporter(endpoint, serviceName string, httpclient *http.Client) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		httpclient:  httpclient,
+	}
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Links             []otlpLink      `json:"links,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	// 64 bit integers are encoded as strings in OTLP json
+	IntValue *string `json:"intValue,omitempty"`
+}
+
+// OTLP status codes
+const (
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+// Export posts spans to the collector
+func (e *OTLPExporter) Export(ctx context.Context, spans []*SpanData) error {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: e.serviceName}}
+	for _, span := range spans {
+		out := otlpSpan{
+			TraceID:           span.SpanContext.TraceID.String(),
+			SpanID:            span.SpanContext.SpanID.String(),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		if span.ParentSpanID != (SpanID{}) {
+			out.ParentSpanID = span.ParentSpanID.String()
+		}
+		for key, value := range span.Attributes {
+			out.Attributes = append(out.Attributes, newOTLPAttribute(key, value))
+		}
+		for _, link := range span.Links {
+			out.Links = append(out.Links, otlpLink{TraceID: link.TraceID.String(), SpanID: link.SpanID.String()})
+		}
+		if len(span.Error) > 0 {
+			out.Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+
+		scope.Spans = append(scope.Spans, out)
+	}
+
+	body, err := json.Marshal(&otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource:   otlpResource{Attributes: []otlpAttribute{newOTLPAttribute("service.name", e.serviceName)}},
+			ScopeSpans: []otlpScopeSpans{scope},
+		}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode spans")
+	}
+
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create export request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.httpclient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to post spans")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("collector responded with %d: %s", resp.StatusCode, respBody)
+	}
+
+	return nil
+}
+
+func newOTLPAttribute(key string, value interface{}) otlpAttribute {
+	attribute := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case string:
+		attribute.Value.StringValue = &v
+	case bool:
+		attribute.Value.BoolValue = &v
+	case int:
+		s := strconv.Itoa(v)
+		attribute.Value.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		attribute.Value.IntValue = &s
+	default:
+		s := fmt.Sprint(v)
+		attribute.Value.StringValue = &s
+	}
+	return attribute
+}
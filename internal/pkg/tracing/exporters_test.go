@@ -0,0 +1,104 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestSpan(t *testing.T) *tracing.SpanData {
+	sc, ok := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+	link, ok := tracing.ParseTraceparent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+
+	startTime := time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC)
+	return &tracing.SpanData{
+		Name:         "twilio.send",
+		SpanContext:  sc,
+		ParentSpanID: link.SpanID,
+		Kind:         tracing.KindClient,
+		StartTime:    startTime,
+		EndTime:      startTime.Add(1500 * time.Microsecond),
+		Attributes:   map[string]interface{}{"http.status_code": 400},
+		Links:        []tracing.SpanContext{link},
+		Error:        "invalid phone number",
+	}
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var out bytes.Buffer
+	exporter := tracing.NewStdoutExporter(&out)
+	if !assert.NoError(t, exporter.Export(context.Background(), []*tracing.SpanData{newTestSpan(t)})) {
+		t.FailNow()
+	}
+
+	var line map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(out.Bytes(), &line)) {
+		t.FailNow()
+	}
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", line["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", line["span_id"])
+	assert.Equal(t, "b7ad6b7169203331", line["parent_span_id"])
+	assert.Equal(t, "twilio.send", line["name"])
+	assert.Equal(t, 1.5, line["duration_ms"])
+	assert.Equal(t, []interface{}{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}, line["links"])
+	assert.Equal(t, "invalid phone number", line["error"])
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		data, _ := ioutil.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(data, &body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	exporter := tracing.NewOTLPExporter(srv.URL+"/v1/traces", "demo_messenger", srv.Client())
+	if !assert.NoError(t, exporter.Export(context.Background(), []*tracing.SpanData{newTestSpan(t)})) {
+		t.FailNow()
+	}
+
+	resourceSpans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	resourceAttributes := resourceSpans["resource"].(map[string]interface{})["attributes"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "demo_messenger"}}, resourceAttributes[0])
+
+	span := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", span["spanId"])
+	assert.Equal(t, "b7ad6b7169203331", span["parentSpanId"])
+	assert.Equal(t, float64(tracing.KindClient), span["kind"])
+	assert.Equal(t, "1546336800000000000", span["startTimeUnixNano"])
+	assert.Equal(t, "1546336800001500000", span["endTimeUnixNano"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"key": "http.status_code", "value": map[string]interface{}{"intValue": "400"}}}, span["attributes"])
+	assert.Equal(t, map[string]interface{}{"code": float64(2), "message": "invalid phone number"}, span["status"])
+}
+
+func TestOTLPExporterCollectorError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	exporter := tracing.NewOTLPExporter(srv.URL, "demo_messenger", srv.Client())
+	err := exporter.Export(context.Background(), []*tracing.SpanData{newTestSpan(t)})
+	if !assert.Error(t, err) {
+		t.FailNow()
+	}
+	assert.Contains(t, err.Error(), "503")
+}
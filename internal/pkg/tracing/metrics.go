@@ -0,0 +1,12 @@
+package tracing
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var droppedSpansCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "tracing_dropped_spans_total",
+	Help: "Number of spans dropped because export queue was full or export failed",
+})
+
+func init() {
+	prometheus.MustRegister(droppedSpansCounter)
+}
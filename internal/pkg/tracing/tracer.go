@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// Exporter sends ended spans to tracing backend
+type Exporter interface {
+	Export(ctx context.Context, spans []*SpanData) error
+}
+
+// Config holds tracer settings
+type Config struct {
+	// QueueSize limits number of ended spans waiting for export, spans ended while queue is full are dropped
+	QueueSize int
+	// BatchSize is the maximum number of spans exported at once
+	BatchSize int
+	// Interval is the longest period ended span waits for export
+	Interval time.Duration
+	// ExportTimeout limits single export call
+	ExportTimeout time.Duration
+}
+
+// Tracer records ended spans and exports them in batches in background
+type Tracer struct {
+	exporter Exporter
+	cfg      Config
+
+	queue chan *SpanData
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewTracer creates new Tracer exporting spans with exporter, set it with SetTracer to start recording spans
+func NewTracer(exporter Exporter, cfg Config) *Tracer {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 2048
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.ExportTimeout <= 0 {
+		cfg.ExportTimeout = 10 * time.Second
+	}
+
+	t := &Tracer{
+		exporter: exporter,
+		cfg:      cfg,
+		queue:    make(chan *SpanData, cfg.QueueSize),
+		stop:     make(chan struct{}),
+	}
+
+	t.wg.Add(1)
+	go t.run()
+
+	return t
+}
+
+// record queues ended span for export
+func (t *Tracer) record(span *SpanData) {
+	select {
+	case t.queue <- span:
+	default:
+		droppedSpansCounter.Inc()
+	}
+}
+
+func (t *Tracer) run() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, t.cfg.BatchSize)
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= t.cfg.BatchSize {
+				batch = t.export(batch)
+			}
+		case <-ticker.C:
+			batch = t.export(batch)
+		case <-t.stop:
+			// export spans ended before shutdown
+			for {
+				select {
+				case span := <-t.queue:
+					batch = append(batch, span)
+					if len(batch) >= t.cfg.BatchSize {
+						batch = t.export(batch)
+					}
+				default:
+					t.export(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// export sends batch to exporter and returns emptied batch
+func (t *Tracer) export(batch []*SpanData) []*SpanData {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.cfg.ExportTimeout)
+	defer cancel()
+
+	if err := t.exporter.Export(ctx, batch); err != nil {
+		droppedSpansCounter.Add(float64(len(batch)))
+		log.Error(errors.Wrapf(err, "failed to export %d spans", len(batch)))
+	}
+
+	return batch[:0]
+}
+
+// Shutdown exports queued spans and stops the tracer
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	close(t.stop)
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "failed to export spans before shutdown")
+	}
+}
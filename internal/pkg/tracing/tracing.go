@@ -0,0 +1,195 @@
+// Package tracing records spans of W3C trace context and exports them to stdout or OpenTelemetry collector.
+// It is kept in tree since go.opentelemetry.io/otel does not support Go 1.11 the service is built with. Span kinds,
+// attribute names and OTLP export follow OpenTelemetry, so the package can be replaced with OpenTelemetry SDK
+// once the toolchain is upgraded.
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Kind describes relationship of the span to its parent and children
+type Kind int
+
+// Span kinds, values match OTLP
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+	KindProducer Kind = 4
+	KindConsumer Kind = 5
+)
+
+// SpanData holds ended span handed to the exporter
+type SpanData struct {
+	Name         string
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	Kind         Kind
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]interface{}
+	Links        []SpanContext
+	// Error is the message of error span ended with, empty when span succeeded
+	Error string
+}
+
+// Span is the single operation within the trace. Span is recorded when tracer is set and the trace is sampled,
+// otherwise it only carries span context, so trace context is propagated even when tracing is disabled.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+type spanContextKey struct{}
+
+var (
+	globalMu     sync.RWMutex
+	globalTracer *Tracer
+)
+
+// SetTracer sets tracer recording spans of the process, nil disables recording
+func SetTracer(tracer *Tracer) {
+	globalMu.Lock()
+	globalTracer = tracer
+	globalMu.Unlock()
+}
+
+func getTracer() *Tracer {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return globalTracer
+}
+
+// StartSpan starts span as child of span in the context, or as root of new trace when context has none.
+// Returned context holds the new span.
+func StartSpan(ctx context.Context, name string, kind Kind, links ...SpanContext) (context.Context, *Span) {
+	tracer := getTracer()
+
+	sc := SpanContext{SpanID: newSpanID(), Sampled: tracer != nil}
+	var parentSpanID SpanID
+	if parent, ok := ctx.Value(spanContextKey{}).(*Span); ok {
+		parentContext := parent.SpanContext()
+		sc.TraceID = parentContext.TraceID
+		sc.Sampled = parentContext.Sampled
+		parentSpanID = parentContext.SpanID
+	} else {
+		sc.TraceID = newTraceID()
+	}
+
+	span := &Span{
+		data: SpanData{
+			Name:         name,
+			SpanContext:  sc,
+			ParentSpanID: parentSpanID,
+			Kind:         kind,
+			StartTime:    time.Now(),
+			Links:        links,
+		},
+	}
+	if sc.Sampled {
+		span.tracer = tracer
+	}
+
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// ContextWithRemoteParent returns copy of the context with span context received from another process or stored
+// with the message, spans started with returned context become its children
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, &Span{data: SpanData{SpanContext: sc}})
+}
+
+// SpanContextFromContext returns context of the span in the context
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if span, ok := ctx.Value(spanContextKey{}).(*Span); ok {
+		return span.SpanContext(), true
+	}
+	return SpanContext{}, false
+}
+
+// Traceparent returns W3C traceparent of the span in the context, empty string when context has none
+func Traceparent(ctx context.Context) string {
+	if sc, ok := SpanContextFromContext(ctx); ok {
+		return sc.Traceparent()
+	}
+	return ""
+}
+
+// SpanContext returns context of the span
+func (s *Span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+// SetAttribute sets attribute of the span, value can be string, bool or integer
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s.tracer == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = map[string]interface{}{}
+	}
+	s.data.Attributes[key] = value
+}
+
+// AddLink links span to span of another trace, i.e. batch of messages to requests messages were sent with
+func (s *Span) AddLink(sc SpanContext) {
+	if s.tracer == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Links = append(s.data.Links, sc)
+}
+
+// SetError marks span as failed with given error, nil error is ignored
+func (s *Span) SetError(err error) {
+	if s.tracer == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End ends the span and hands it to the exporter, calls after the first one are ignored
+func (s *Span) End() {
+	if s.tracer == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.record(&data)
+}
+
+// Finish marks span as failed when err is not nil and ends it
+func (s *Span) Finish(err error) {
+	s.SetError(err)
+	s.End()
+}
+
+// Discard ends the span without exporting it, i.e. when polling found nothing to do
+func (s *Span) Discard() {
+	s.mu.Lock()
+	s.ended = true
+	s.mu.Unlock()
+}
@@ -0,0 +1,125 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*tracing.SpanData
+}
+
+func (e *recordingExporter) Export(ctx context.Context, spans []*tracing.SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, span := range spans {
+		copied := *span
+		e.spans = append(e.spans, &copied)
+	}
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{name: "Sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ok: true, sampled: true},
+		{name: "Not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", ok: true},
+		{name: "Future version with extra fields", value: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what", ok: true, sampled: true},
+		{name: "Empty", value: ""},
+		{name: "Forbidden version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "Version 00 with extra fields", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what"},
+		{name: "Short trace id", value: "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01"},
+		{name: "Not hex", value: "00-4bf92f3577b34da6a3ce929d0e0e4zzz-00f067aa0ba902b7-01"},
+		{name: "Zero trace id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "Zero span id", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := tracing.ParseTraceparent(tt.value)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+				assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+				assert.Equal(t, tt.sampled, sc.Sampled)
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := tracing.ParseTraceparent(value)
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+	assert.Equal(t, value, sc.Traceparent())
+}
+
+func TestStartSpan(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := tracing.NewTracer(exporter, tracing.Config{Interval: time.Hour})
+	tracing.SetTracer(tracer)
+	defer tracing.SetTracer(nil)
+
+	remote, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	link, _ := tracing.ParseTraceparent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	ctx, server := tracing.StartSpan(tracing.ContextWithRemoteParent(context.Background(), remote), "server", tracing.KindServer)
+	server.SetAttribute("http.status_code", 200)
+	_, child := tracing.StartSpan(ctx, "child", tracing.KindInternal, link)
+	child.Finish(errors.New("failed"))
+	server.End()
+	server.End()
+
+	_, discarded := tracing.StartSpan(context.Background(), "poll", tracing.KindInternal)
+	discarded.Discard()
+	discarded.End()
+
+	if !assert.NoError(t, tracer.Shutdown(context.Background())) {
+		t.FailNow()
+	}
+	if !assert.Len(t, exporter.spans, 2) {
+		t.FailNow()
+	}
+
+	childData, serverData := exporter.spans[0], exporter.spans[1]
+	assert.Equal(t, "server", serverData.Name)
+	assert.Equal(t, remote.TraceID, serverData.SpanContext.TraceID)
+	assert.Equal(t, remote.SpanID, serverData.ParentSpanID)
+	assert.Equal(t, 200, serverData.Attributes["http.status_code"])
+	assert.Empty(t, serverData.Error)
+
+	assert.Equal(t, "child", childData.Name)
+	assert.Equal(t, remote.TraceID, childData.SpanContext.TraceID)
+	assert.Equal(t, serverData.SpanContext.SpanID, childData.ParentSpanID)
+	assert.Equal(t, []tracing.SpanContext{link}, childData.Links)
+	assert.Equal(t, "failed", childData.Error)
+
+	assert.Equal(t, server.SpanContext().Traceparent(), tracing.Traceparent(ctx))
+}
+
+func TestStartSpanWithoutTracer(t *testing.T) {
+	ctx, span := tracing.StartSpan(context.Background(), "request", tracing.KindServer)
+	span.SetAttribute("key", "value")
+	span.End()
+
+	// trace context is propagated, but not sampled as nothing is recorded
+	sc, ok := tracing.SpanContextFromContext(ctx)
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+	assert.True(t, sc.IsValid())
+	assert.False(t, sc.Sampled)
+	assert.Empty(t, tracing.Traceparent(context.Background()))
+}
@@ -0,0 +1,37 @@
+package utils_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	client, err := utils.NewHTTPClient(utils.HTTPClientConfig{
+		Timeout:             10 * time.Second,
+		MaxIdleConnsPerHost: 10,
+		ProxyURL:            "http://proxy.local:3128",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != 10*time.Second {
+		t.Errorf("NewHTTPClient() timeout = %v, want %v", client.Timeout, 10*time.Second)
+	}
+
+	transport := client.Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != 10 {
+		t.Errorf("NewHTTPClient() max idle connections per host = %v, want %v", transport.MaxIdleConnsPerHost, 10)
+	}
+
+	proxyURL, err := transport.Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "api.twilio.com"}})
+	if err != nil || proxyURL == nil || proxyURL.Host != "proxy.local:3128" {
+		t.Errorf("NewHTTPClient() proxy = %v, %v, want proxy.local:3128", proxyURL, err)
+	}
+
+	if _, err := utils.NewHTTPClient(utils.HTTPClientConfig{ProxyURL: "://invalid"}); err == nil {
+		t.Error("NewHTTPClient() expected error for invalid proxy url")
+	}
+}
@@ -1,27 +1,192 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"net"
 	"net/http"
+	"strings"
 )
 
-// GetRequestIPAddress is helper function to read users IP from the request
+type clientIPContextKey struct{}
+
+// ContextWithClientIP returns copy of the context holding client IP resolved for the request
+func ContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, ip)
+}
+
+// GetRequestIPAddress is helper function to read users IP from the request, it returns client IP resolved
+// with TrustedProxies when there is one in request context and address of the peer otherwise
 func GetRequestIPAddress(request *http.Request) string {
-	address := request.Header.Get("X-Forwarded-For")
-	if len(address) == 0 {
-		address = request.Header.Get("X-Real-IP")
+	if ip, ok := request.Context().Value(clientIPContextKey{}).(string); ok {
+		return ip
+	}
+
+	return remoteHost(request)
+}
+
+// remoteHost returns host of the peer request came from
+func remoteHost(request *http.Request) string {
+	address, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		log.WithField("error", fmt.Sprintf("%+v", err)).
+			WithField("addr", request.RemoteAddr).
+			Error("failed to split remote address")
+		return ""
+	}
+	return address
+}
+
+// Forwarding headers trusted proxy can report client IP with
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderForwarded     = "Forwarded"
+	HeaderXRealIP       = "X-Real-Ip"
+)
+
+// TrustedProxies holds networks of proxies allowed to report client IP with forwarding header
+type TrustedProxies struct {
+	networks []*net.IPNet
+	header   string
+}
+
+// ParseTrustedProxies parses comma separated list of CIDRs or single IPs of trusted proxies, i.e. "10.0.0.0/8,192.168.1.10",
+// and the forwarding header they write: Forwarded, X-Forwarded-For or X-Real-IP. X-Forwarded-For is used when header is empty.
+// Only that header is read, since proxy passes other forwarding headers sent by the client as is.
+func ParseTrustedProxies(spec, header string) (*TrustedProxies, error) {
+	networks, err := ParseCIDRs(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid trusted proxies")
+	}
+
+	header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+	switch header {
+	case "":
+		header = HeaderXForwardedFor
+	case HeaderXForwardedFor, HeaderForwarded, HeaderXRealIP:
+	default:
+		return nil, fmt.Errorf("unsupported forwarding header %s", header)
 	}
-	if len(address) == 0 {
-		var err error
-		address, _, err = net.SplitHostPort(request.RemoteAddr)
+
+	return &TrustedProxies{networks: networks, header: header}, nil
+}
+
+// ParseCIDRs parses comma separated list of CIDRs, single IP is treated as network of one address
+func ParseCIDRs(spec string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(spec, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if len(cidr) == 0 {
+			continue
+		}
+
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %s", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
 		if err != nil {
-			log.WithField("error", fmt.Sprintf("%+v", err)).
-				WithField("addr", request.RemoteAddr).
-				Error("failed to split remote address")
-			return ""
+			return nil, fmt.Errorf("invalid CIDR %s", cidr)
 		}
+		networks = append(networks, network)
 	}
-	return address
+
+	return networks, nil
+}
+
+// Trusted tells whether address belongs to trusted proxy
+func (tp *TrustedProxies) Trusted(ip net.IP) bool {
+	if tp == nil {
+		return false
+	}
+	for _, network := range tp.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns IP of the client which sent the request. Forwarding header is only read when request
+// comes from trusted proxy, addresses of Forwarded (RFC 7239) or X-Forwarded-For header are walked from right
+// to left and the first address which is not trusted proxy is the client.
+func (tp *TrustedProxies) ClientIP(request *http.Request) string {
+	peer := remoteHost(request)
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || !tp.Trusted(peerIP) {
+		return peer
+	}
+
+	if tp.header == HeaderXRealIP {
+		if realIP := net.ParseIP(strings.TrimSpace(request.Header.Get(HeaderXRealIP))); realIP != nil {
+			return realIP.String()
+		}
+		return peer
+	}
+
+	chain := forwardedFor(request.Header, tp.header)
+	if len(chain) == 0 {
+		return peer
+	}
+
+	client := peerIP
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseForwardedIP(chain[i])
+		if ip == nil {
+			// trusted proxy forwarded address it could not identify, nearest known hop is used
+			break
+		}
+
+		client = ip
+		if !tp.Trusted(ip) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+// forwardedFor returns addresses of the forwarding chain from Forwarded or X-Forwarded-For header
+func forwardedFor(header http.Header, name string) []string {
+	var chain []string
+	if name == HeaderForwarded {
+		for _, element := range strings.Split(strings.Join(header[HeaderForwarded], ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(parts) == 2 && strings.EqualFold(parts[0], "for") {
+					chain = append(chain, parts[1])
+				}
+			}
+		}
+		return chain
+	}
+
+	for _, address := range strings.Split(strings.Join(header[HeaderXForwardedFor], ","), ",") {
+		if address = strings.TrimSpace(address); len(address) > 0 {
+			chain = append(chain, address)
+		}
+	}
+	return chain
+}
+
+// parseForwardedIP parses address of forwarding header, which can be quoted and can have port, i.e. "[2001:db8::1]:4711"
+func parseForwardedIP(address string) net.IP {
+	address = strings.Trim(strings.TrimSpace(address), `"`)
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+
+	return net.ParseIP(address)
 }
@@ -16,15 +16,16 @@ func TestGetRequestIPAddress(t *testing.T) {
 		want string
 	}{
 		{
-			"X-Forwarded-For",
+			"X-Forwarded-For is not trusted",
 			args{
 				&http.Request{
+					RemoteAddr: "10.0.0.1:8080",
 					Header: map[string][]string{
 						"X-Forwarded-For": {"123.123.123.123"},
 					},
 				},
 			},
-			"123.123.123.123",
+			"10.0.0.1",
 		},
 		{
 			"RemoteAddr",
@@ -35,6 +36,15 @@ func TestGetRequestIPAddress(t *testing.T) {
 			},
 			"localhost",
 		},
+		{
+			"Resolved client IP",
+			args{
+				(&http.Request{
+					RemoteAddr: "10.0.0.1:8080",
+				}).WithContext(utils.ContextWithClientIP((&http.Request{}).Context(), "123.123.123.123")),
+			},
+			"123.123.123.123",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -44,3 +54,163 @@ func TestGetRequestIPAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		header  string
+		wantErr bool
+	}{
+		{"Empty", "", "", false},
+		{"CIDRs and IPs", "10.0.0.0/8, 192.168.1.10,2001:db8::/32,::1", "", false},
+		{"Forwarded header", "10.0.0.0/8", "forwarded", false},
+		{"X-Real-IP header", "10.0.0.0/8", "X-Real-IP", false},
+		{"Invalid CIDR", "10.0.0.0/33", "", true},
+		{"Invalid IP", "proxy.local", "", true},
+		{"Unsupported header", "10.0.0.0/8", "X-Client-IP", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := utils.ParseTrustedProxies(tt.spec, tt.header); (err != nil) != tt.wantErr {
+				t.Errorf("ParseTrustedProxies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		forwarded  http.Header
+		want       string
+	}{
+		{
+			"Direct client",
+			"",
+			"203.0.113.7:51000",
+			nil,
+			"203.0.113.7",
+		},
+		{
+			"Spoofed X-Forwarded-For from untrusted peer",
+			"",
+			"203.0.113.7:51000",
+			http.Header{"X-Forwarded-For": {"1.1.1.1"}},
+			"203.0.113.7",
+		},
+		{
+			"Spoofed X-Real-IP from untrusted peer",
+			"X-Real-IP",
+			"203.0.113.7:51000",
+			http.Header{"X-Real-Ip": {"1.1.1.1"}},
+			"203.0.113.7",
+		},
+		{
+			"Spoofed Forwarded from untrusted peer",
+			"Forwarded",
+			"203.0.113.7:51000",
+			http.Header{"Forwarded": {"for=1.1.1.1"}},
+			"203.0.113.7",
+		},
+		{
+			"Trusted proxy",
+			"",
+			"10.0.0.1:8080",
+			http.Header{"X-Forwarded-For": {"203.0.113.7"}},
+			"203.0.113.7",
+		},
+		{
+			"Spoofed address prepended by client",
+			"",
+			"10.0.0.1:8080",
+			http.Header{"X-Forwarded-For": {"1.1.1.1, 203.0.113.7"}},
+			"203.0.113.7",
+		},
+		{
+			"Multiple trusted hops",
+			"",
+			"10.0.0.1:8080",
+			http.Header{"X-Forwarded-For": {"1.1.1.1, 203.0.113.7", "192.168.1.10, 10.0.0.2"}},
+			"203.0.113.7",
+		},
+		{
+			"All hops trusted",
+			"",
+			"10.0.0.1:8080",
+			http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			"10.0.0.3",
+		},
+		{
+			"Garbage forwarded by trusted proxy",
+			"",
+			"10.0.0.1:8080",
+			http.Header{"X-Forwarded-For": {"203.0.113.7, garbage, 10.0.0.2"}},
+			"10.0.0.2",
+		},
+		{
+			"X-Real-IP",
+			"X-Real-IP",
+			"10.0.0.1:8080",
+			http.Header{"X-Real-Ip": {"203.0.113.7"}},
+			"203.0.113.7",
+		},
+		{
+			"Forwarded",
+			"Forwarded",
+			"10.0.0.1:8080",
+			http.Header{"Forwarded": {`for=1.1.1.1, for=203.0.113.7;proto=https;by=10.0.0.2`, `For="10.0.0.2:4711"`}},
+			"203.0.113.7",
+		},
+		{
+			"Forwarded IPv6",
+			"Forwarded",
+			"[2001:db8::1]:8080",
+			http.Header{"Forwarded": {`for="[2001:db8:cafe::17]:4711"`}},
+			"2001:db8:cafe::17",
+		},
+		{
+			"Forwarded sent by client is ignored",
+			"",
+			"10.0.0.1:8080",
+			http.Header{"Forwarded": {"for=1.1.1.1"}, "X-Forwarded-For": {"203.0.113.7"}},
+			"203.0.113.7",
+		},
+		{
+			"X-Forwarded-For sent by client is ignored",
+			"Forwarded",
+			"10.0.0.1:8080",
+			http.Header{"Forwarded": {"for=203.0.113.7"}, "X-Forwarded-For": {"1.1.1.1"}},
+			"203.0.113.7",
+		},
+		{
+			"X-Real-IP sent by client is ignored",
+			"",
+			"10.0.0.1:8080",
+			http.Header{"X-Real-Ip": {"1.1.1.1"}},
+			"10.0.0.1",
+		},
+		{
+			"Obfuscated Forwarded",
+			"Forwarded",
+			"10.0.0.1:8080",
+			http.Header{"Forwarded": {"for=_hidden"}},
+			"10.0.0.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies, err := utils.ParseTrustedProxies("10.0.0.0/8,192.168.1.10,2001:db8::/32", tt.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			request := &http.Request{RemoteAddr: tt.remoteAddr, Header: tt.forwarded}
+			if got := proxies.ClientIP(request); got != tt.want {
+				t.Errorf("ClientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
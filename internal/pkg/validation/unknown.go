@@ -0,0 +1,83 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnknownFields returns paths of every object key of JSON data value has no field for, sorted.
+// Keys are matched to json names case-insensitively, the way encoding/json decodes them.
+// Nothing is returned for data which is not valid JSON.
+func UnknownFields(data []byte, value interface{}) []string {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+
+	var unknown []string
+	walkUnknown(raw, reflect.TypeOf(value), "", &unknown)
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+func walkUnknown(raw interface{}, t reflect.Type, path string, unknown *[]string) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key, value := range object {
+			field, ok := fieldByJSONName(t, key)
+			if !ok {
+				*unknown = append(*unknown, join(path, key))
+				continue
+			}
+			walkUnknown(value, field.Type, join(path, key), unknown)
+		}
+	case reflect.Slice, reflect.Array:
+		array, ok := raw.([]interface{})
+		if !ok {
+			return
+		}
+		for i, value := range array {
+			walkUnknown(value, t.Elem(), fmt.Sprintf("%s[%d]", path, i), unknown)
+		}
+	case reflect.Map:
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key, value := range object {
+			walkUnknown(value, t.Elem(), join(path, key), unknown)
+		}
+	}
+}
+
+func fieldByJSONName(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if name, ok := jsonName(field); ok && strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func join(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
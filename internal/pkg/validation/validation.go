@@ -0,0 +1,238 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Violation describes invalid field of the validated value
+type Violation struct {
+	// Field is json name of the field, nested fields are joined with dots, i.e. "messages[2].recipient"
+	Field   string
+	Code    string
+	Message string
+}
+
+// Violation codes
+const (
+	CodeRequired = "required"
+	CodeTooLong  = "too_long"
+	CodeTooMany  = "too_many"
+	CodeConflict = "conflict"
+	CodeInvalid  = "invalid"
+	CodeUnknown  = "unknown"
+)
+
+// Validate checks struct value against rules of its `validate` field tags and returns every violation found.
+// Rules are separated with commas:
+//
+//	required                 - field cant have zero value
+//	required_without=<field> - field or the other field cant have zero value
+//	excluded_with=<field>    - field and the other field cant be set together
+//	max=<n>                  - maximum length of string or number of elements of slice or map
+//	min=<n>                  - minimum value of number
+//	oneof=<a> <b>            - allowed values of string, empty string is allowed too
+//	dive                     - validate nested struct or every struct of the slice
+//
+// Other fields are referred to with their json names. Malformed rules are programming errors and cause panic.
+func Validate(value interface{}) []*Violation {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation: %s is not a struct", v.Type()))
+	}
+
+	return validateStruct(v, "")
+}
+
+func validateStruct(v reflect.Value, prefix string) []*Violation {
+	var (
+		t          = v.Type()
+		fields     = map[string]reflect.Value{}
+		violations []*Violation
+	)
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := jsonName(t.Field(i)); ok {
+			fields[name] = v.Field(i)
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonName(field)
+		tag := field.Tag.Get("validate")
+		if !ok || len(tag) == 0 {
+			continue
+		}
+		fv := v.Field(i)
+		path := prefix + name
+
+		for _, rule := range strings.Split(tag, ",") {
+			ruleName, param := rule, ""
+			if idx := strings.Index(rule, "="); idx >= 0 {
+				ruleName, param = rule[:idx], rule[idx+1:]
+			}
+
+			violation := check(ruleName, param, fv, path, fields, t)
+			if violation != nil {
+				violations = append(violations, violation)
+				// later rules of the field would only repeat the problem
+				break
+			}
+			if ruleName == "dive" {
+				violations = append(violations, dive(fv, path)...)
+			}
+		}
+	}
+
+	return violations
+}
+
+// check applies single rule to the field value, returns nil when value satisfies the rule
+func check(rule, param string, fv reflect.Value, path string, fields map[string]reflect.Value, t reflect.Type) *Violation {
+	switch rule {
+	case "required":
+		if isZero(fv) {
+			return &Violation{Field: path, Code: CodeRequired, Message: fmt.Sprintf("%s is required", path)}
+		}
+	case "required_without":
+		other := sibling(fields, param, t)
+		if isZero(fv) && isZero(other) {
+			return &Violation{Field: path, Code: CodeRequired, Message: fmt.Sprintf("%s or %s is required", path, param)}
+		}
+	case "excluded_with":
+		other := sibling(fields, param, t)
+		if !isZero(fv) && !isZero(other) {
+			return &Violation{Field: path, Code: CodeConflict, Message: fmt.Sprintf("%s cant be used together with %s", path, param)}
+		}
+	case "max":
+		max := intParam(rule, param, t)
+		switch fv.Kind() {
+		case reflect.String:
+			if fv.Len() > max {
+				return &Violation{Field: path, Code: CodeTooLong, Message: fmt.Sprintf("%s must be at most %d characters long", path, max)}
+			}
+		case reflect.Slice, reflect.Map:
+			if fv.Len() > max {
+				return &Violation{Field: path, Code: CodeTooMany, Message: fmt.Sprintf("%s must have at most %d elements", path, max)}
+			}
+		default:
+			panic(fmt.Sprintf("validation: max rule cant be applied to %s of %s", fv.Kind(), t))
+		}
+	case "min":
+		min := intParam(rule, param, t)
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if fv.Int() < int64(min) {
+				return &Violation{Field: path, Code: CodeInvalid, Message: fmt.Sprintf("%s must be at least %d", path, min)}
+			}
+		default:
+			panic(fmt.Sprintf("validation: min rule cant be applied to %s of %s", fv.Kind(), t))
+		}
+	case "oneof":
+		if fv.Kind() != reflect.String {
+			panic(fmt.Sprintf("validation: oneof rule cant be applied to %s of %s", fv.Kind(), t))
+		}
+		allowed := strings.Fields(param)
+		if fv.Len() == 0 {
+			return nil
+		}
+		for _, a := range allowed {
+			if fv.String() == a {
+				return nil
+			}
+		}
+		return &Violation{Field: path, Code: CodeInvalid, Message: fmt.Sprintf("%s must be one of %s", path, strings.Join(allowed, ", "))}
+	case "dive":
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %s of %s", rule, t))
+	}
+
+	return nil
+}
+
+// dive validates nested struct, or every struct of the slice
+func dive(fv reflect.Value, path string) []*Violation {
+	switch fv.Kind() {
+	case reflect.Ptr:
+		if fv.IsNil() {
+			return nil
+		}
+		return dive(fv.Elem(), path)
+	case reflect.Struct:
+		return validateStruct(fv, path+".")
+	case reflect.Slice:
+		var violations []*Violation
+		for i := 0; i < fv.Len(); i++ {
+			elem := fv.Index(i)
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			if elem.Kind() == reflect.Ptr && elem.IsNil() {
+				violations = append(violations, &Violation{Field: elemPath, Code: CodeRequired, Message: fmt.Sprintf("%s is required", elemPath)})
+				continue
+			}
+			violations = append(violations, dive(elem, elemPath)...)
+		}
+		return violations
+	}
+	return nil
+}
+
+func sibling(fields map[string]reflect.Value, name string, t reflect.Type) reflect.Value {
+	other, ok := fields[name]
+	if !ok {
+		panic(fmt.Sprintf("validation: unknown field %s of %s", name, t))
+	}
+	return other
+}
+
+func intParam(rule, param string, t reflect.Type) int {
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		panic(fmt.Sprintf("validation: invalid %s rule parameter %s of %s", rule, param, t))
+	}
+	return n
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// jsonName returns name field is encoded with, false is returned for fields json ignores
+func jsonName(field reflect.StructField) (string, bool) {
+	if len(field.PkgPath) > 0 {
+		// unexported
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if idx := strings.Index(tag, ","); idx >= 0 {
+		tag = tag[:idx]
+	}
+	if len(tag) == 0 {
+		return field.Name, true
+	}
+	return tag, true
+}
@@ -0,0 +1,113 @@
+package validation_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/validation"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type item struct {
+	Name string `json:"name" validate:"required,max=4"`
+}
+
+type request struct {
+	ID       string            `json:"id" validate:"required"`
+	Text     string            `json:"text,omitempty" validate:"max=5,required_without=template"`
+	Template string            `json:"template,omitempty" validate:"excluded_with=text"`
+	Kind     string            `json:"kind" validate:"oneof=a b"`
+	Count    int               `json:"count" validate:"min=1"`
+	Items    []*item           `json:"items" validate:"max=2,dive"`
+	Item     *item             `json:"item,omitempty" validate:"dive"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	ignored  string
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name               string
+		value              interface{}
+		expectedViolations []*validation.Violation
+	}{
+		{
+			"Valid",
+			&request{ID: "1", Text: "text", Kind: "a", Count: 1, Items: []*item{{Name: "one"}}},
+			nil,
+		},
+		{
+			"Every violation is returned",
+			&request{Text: "text", Template: "welcome", Kind: "c"},
+			[]*validation.Violation{
+				{Field: "id", Code: validation.CodeRequired, Message: "id is required"},
+				{Field: "template", Code: validation.CodeConflict, Message: "template cant be used together with text"},
+				{Field: "kind", Code: validation.CodeInvalid, Message: "kind must be one of a, b"},
+				{Field: "count", Code: validation.CodeInvalid, Message: "count must be at least 1"},
+			},
+		},
+		{
+			"Required without",
+			request{ID: "1", Count: 1},
+			[]*validation.Violation{
+				{Field: "text", Code: validation.CodeRequired, Message: "text or template is required"},
+			},
+		},
+		{
+			"Too long",
+			&request{ID: "1", Text: "long text", Count: 1},
+			[]*validation.Violation{
+				{Field: "text", Code: validation.CodeTooLong, Message: "text must be at most 5 characters long"},
+			},
+		},
+		{
+			"Nested values",
+			&request{ID: "1", Template: "welcome", Count: 1, Items: []*item{{Name: "one"}, nil}, Item: &item{Name: "seven"}},
+			[]*validation.Violation{
+				{Field: "items[1]", Code: validation.CodeRequired, Message: "items[1] is required"},
+				{Field: "item.name", Code: validation.CodeTooLong, Message: "item.name must be at most 4 characters long"},
+			},
+		},
+		{
+			"Too many",
+			&request{ID: "1", Template: "welcome", Count: 1, Items: []*item{{Name: "one"}, {Name: "two"}, {}}},
+			[]*validation.Violation{
+				{Field: "items", Code: validation.CodeTooMany, Message: "items must have at most 2 elements"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedViolations, validation.Validate(tt.value))
+		})
+	}
+}
+
+func TestValidate_InvalidRule(t *testing.T) {
+	assert.Panics(t, func() {
+		validation.Validate(&struct {
+			Name string `json:"name" validate:"required_without=other"`
+		}{})
+	})
+	assert.Panics(t, func() {
+		validation.Validate(&struct {
+			Name string `json:"name" validate:"unique"`
+		}{})
+	})
+}
+
+func TestUnknownFields(t *testing.T) {
+	tests := []struct {
+		name            string
+		data            string
+		expectedUnknown []string
+	}{
+		{"No unknown fields", `{"ID": "1", "items": [{"name": "one"}], "labels": {"any": "label"}}`, nil},
+		{"Unknown fields", `{"idd": "1", "text": "text", "sender": "me"}`, []string{"idd", "sender"}},
+		{"Nested unknown fields", `{"id": "1", "items": [{"name": "one"}, {"nmae": "two"}], "item": {"title": "three"}}`, []string{"item.title", "items[1].nmae"}},
+		{"Unexported fields are unknown", `{"id": "1", "ignored": "value"}`, []string{"ignored"}},
+		{"Invalid json", `{"idd": `, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedUnknown, validation.UnknownFields([]byte(tt.data), &request{}))
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package verifications
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// PostgresStore implements Store interface for Postgres
+type PostgresStore struct {
+	*sqlx.DB
+}
+
+// NewPostgresStore creates new instance of PostgresStore
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{
+		DB: db,
+	}
+}
+
+// SaveVerification stores new pending verification
+func (ps *PostgresStore) SaveVerification(ctx context.Context, verification *Verification) error {
+	if verification == nil {
+		return errors.New("verification cant be nil")
+	}
+
+	_, err := ps.NamedExecContext(ctx, "INSERT INTO verifications (verification_id, phone_number, code_hash, expires_at) VALUES(:verification_id, :phone_number, :code_hash, :expires_at)", verification)
+	if err != nil {
+		return errors.Wrap(err, "failed to save verification")
+	}
+
+	return nil
+}
+
+// GetVerification returns verification by its ID
+func (ps *PostgresStore) GetVerification(ctx context.Context, verificationID string) (*Verification, error) {
+	var (
+		verification = &Verification{}
+	)
+
+	err := ps.GetContext(ctx, verification, "SELECT verification_id, phone_number, code_hash, status, attempts, expires_at, locked_until FROM verifications WHERE verification_id=$1", verificationID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrVerificationNotFound
+		}
+
+		return nil, errors.Wrapf(err, "failed to get verification %s", verificationID)
+	}
+
+	return verification, nil
+}
+
+// IncrementAttempts increments number of check attempts of pending verification and returns updated value
+func (ps *PostgresStore) IncrementAttempts(ctx context.Context, verificationID string) (int, error) {
+	var attempts int
+
+	err := ps.GetContext(ctx, &attempts, "UPDATE verifications SET attempts=attempts+1 WHERE verification_id=$1 AND status='pending' RETURNING attempts", verificationID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrVerificationNotFound
+		}
+
+		return 0, errors.Wrapf(err, "failed to increment attempts of verification %s", verificationID)
+	}
+
+	return attempts, nil
+}
+
+// UpdateStatus moves pending verification into given status
+func (ps *PostgresStore) UpdateStatus(ctx context.Context, verificationID, status string) error {
+	res, err := ps.ExecContext(ctx, "UPDATE verifications SET status=$2 WHERE verification_id=$1 AND status='pending'", verificationID, status)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update status of verification %s", verificationID)
+	}
+
+	return checkAffected(res)
+}
+
+// Lock moves pending verification into locked status till given time
+func (ps *PostgresStore) Lock(ctx context.Context, verificationID string, until time.Time) error {
+	res, err := ps.ExecContext(ctx, "UPDATE verifications SET status='locked', locked_until=$2 WHERE verification_id=$1 AND status='pending'", verificationID, until)
+	if err != nil {
+		return errors.Wrapf(err, "failed to lock verification %s", verificationID)
+	}
+
+	return checkAffected(res)
+}
+
+// IsPhoneNumberLocked checks if phone number has verifications locked at the moment
+func (ps *PostgresStore) IsPhoneNumberLocked(ctx context.Context, phoneNumber string) (bool, error) {
+	var locked bool
+
+	err := ps.GetContext(ctx, &locked, "SELECT EXISTS(SELECT 1 FROM verifications WHERE phone_number=$1 AND status='locked' AND locked_until > now())", phoneNumber)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to check lockout of %s", phoneNumber)
+	}
+
+	return locked, nil
+}
+
+func checkAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get number of affected rows")
+	}
+	if affected == 0 {
+		return ErrVerificationNotFound
+	}
+
+	return nil
+}
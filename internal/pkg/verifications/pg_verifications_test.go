@@ -0,0 +1,125 @@
+package verifications_test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+
+	"github.com/arkadyb/demo_messenger/internal/pkg/verifications"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestPostgresStore_IncrementAttempts(t *testing.T) {
+	type fields struct {
+		DB func() (*sqlx.DB, sqlmock.Sqlmock)
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    int
+		wantErr error
+	}{
+		{
+			"Success",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^UPDATE verifications SET attempts=attempts\+1 WHERE verification_id=\$1 AND status='pending' RETURNING attempts$`).WithArgs("id").
+						WillReturnRows(sqlmock.NewRows([]string{"attempts"}).AddRow(2))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			2,
+			nil,
+		},
+		{
+			"Not pending",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectQuery(`^UPDATE verifications SET attempts=attempts\+1.*`).WillReturnError(sql.ErrNoRows)
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			0,
+			verifications.ErrVerificationNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.fields.DB()
+			ps := verifications.NewPostgresStore(db)
+			defer ps.Close()
+
+			got, err := ps.IncrementAttempts(context.Background(), "id")
+			if err != tt.wantErr {
+				t.Errorf("PostgresStore.IncrementAttempts() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("PostgresStore.IncrementAttempts() = %v, want %v", got, tt.want)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
+
+func TestPostgresStore_Lock(t *testing.T) {
+	until := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	type fields struct {
+		DB func() (*sqlx.DB, sqlmock.Sqlmock)
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr error
+	}{
+		{
+			"Success",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectExec(`^UPDATE verifications SET status='locked', locked_until=\$2 WHERE verification_id=\$1 AND status='pending'$`).WithArgs("id", until).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			nil,
+		},
+		{
+			"Not pending",
+			fields{
+				func() (*sqlx.DB, sqlmock.Sqlmock) {
+					db, mock, _ := sqlmock.New()
+					mock.ExpectExec(`^UPDATE verifications SET status='locked'.*`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+					return sqlx.NewDb(db, "sqlmock"), mock
+				},
+			},
+			verifications.ErrVerificationNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := tt.fields.DB()
+			ps := verifications.NewPostgresStore(db)
+			defer ps.Close()
+
+			if err := ps.Lock(context.Background(), "id", until); errors.Cause(err) != tt.wantErr {
+				t.Errorf("PostgresStore.Lock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if mock.ExpectationsWereMet() != nil {
+				t.Error("Not all expectations were met")
+			}
+		})
+	}
+}
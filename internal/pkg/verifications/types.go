@@ -0,0 +1,21 @@
+package verifications
+
+import "time"
+
+// Verification statuses
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusExpired  = "expired"
+	StatusLocked   = "locked"
+)
+
+type Verification struct {
+	VerificationID string     `db:"verification_id"`
+	PhoneNumber    string     `db:"phone_number"`
+	CodeHash       string     `db:"code_hash"`
+	Status         string     `db:"status"`
+	Attempts       int        `db:"attempts"`
+	ExpiresAt      time.Time  `db:"expires_at"`
+	LockedUntil    *time.Time `db:"locked_until"`
+}
@@ -0,0 +1,26 @@
+package verifications
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// ErrVerificationNotFound returned when verification with given ID does not exist
+var ErrVerificationNotFound = errors.New("verification not found")
+
+// Store describes behaviour of verifications store
+type Store interface {
+	// SaveVerification stores new pending verification
+	SaveVerification(context.Context, *Verification) error
+	// GetVerification returns verification by its ID
+	GetVerification(ctx context.Context, verificationID string) (*Verification, error)
+	// IncrementAttempts increments number of check attempts of pending verification and returns updated value
+	IncrementAttempts(ctx context.Context, verificationID string) (int, error)
+	// UpdateStatus moves pending verification into given status
+	UpdateStatus(ctx context.Context, verificationID, status string) error
+	// Lock moves pending verification into locked status till given time
+	Lock(ctx context.Context, verificationID string, until time.Time) error
+	// IsPhoneNumberLocked checks if phone number has verifications locked at the moment
+	IsPhoneNumberLocked(ctx context.Context, phoneNumber string) (bool, error)
+}
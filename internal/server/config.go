@@ -15,18 +15,83 @@ type Configuration struct {
 	CircuitBreakerSleepWindowSeconds    int
 	CircuitBreakerErrorPercentThreshold int
 
+	ProviderBreakerFailureThreshold int
+	ProviderBreakerOpenSeconds      int
+
+	SendMaxAttempts         int
+	SendRetryBackoffSeconds int
+	SendConcurrency         int
+	SendTimeoutSeconds      int
+	SendBatchTimeoutSeconds int
+
+	PacerLimits         string
+	PacerMaxWaitSeconds int
+
+	HTTPClientTimeoutSeconds               int
+	HTTPClientDialTimeoutSeconds           int
+	HTTPClientTLSHandshakeTimeoutSeconds   int
+	HTTPClientResponseHeaderTimeoutSeconds int
+	HTTPClientIdleConnTimeoutSeconds       int
+	HTTPClientMaxIdleConns                 int
+	HTTPClientMaxIdleConnsPerHost          int
+	HTTPClientMaxConnsPerHost              int
+	HTTPClientProxyURL                     string
+
 	RateLimitMaxRequests      int
+	RateLimitBulkMaxRequests  int
 	RateLimitPerPeriodSeconds int
+	RateLimitTiers            string
+	RateLimitFailurePolicy    string
+	RateLimitRetrySeconds     int
+
+	TrustedProxies    string
+	ForwardingHeader  string
+	IPFilterRulesFile string
+
+	AuthRequired           bool
+	APIKeys                string
+	TenantsStore           string
+	TenantsCacheTTLSeconds int
+	AdminAPIKeys           string
+
+	BulkMaxMessages           int
+	IdempotencyKeyTTLSeconds  int
+	IdempotencyCleanupSeconds int
+	MaxRequestBodyBytes       int64
+	OpenAPIValidation         bool
 
 	RedisHost               string
 	RedisPwd                string
 	RedisMaxIdle            int
 	RedisMaxActive          int
 	RedisIdleTimeoutSeconds int
+	RedisTimeoutSeconds     int
 
 	BufferDBConnectionString string
 	BufferDBMaxConnections   int
 
+	QueueStarvationTimeoutSeconds int
+
+	SMSMaxSegments int
+	SMSAllowUCS2   bool
+
+	TemplateLocaleFallback string
+
+	QuietHours                 string
+	QuietHoursBypassCategories string
+	QuietHoursDefaultTimeZone  string
+
+	VerifyCodeLength     int
+	VerifyCodeTTLSeconds int
+	VerifyMaxAttempts    int
+	VerifyLockoutSeconds int
+	VerifySecret         string
+	VerifyMessage        string
+
+	TracingExporter     string
+	TracingOTLPEndpoint string
+	TracingServiceName  string
+
 	LogFormat string
 }
 
@@ -44,17 +109,82 @@ func InitConfig() Configuration {
 	flag.IntVar(&cfg.CircuitBreakerSleepWindowSeconds, "circuit_breaker_sleep_window", 10, "Circuit breaker sleep period when opened")
 	flag.IntVar(&cfg.CircuitBreakerErrorPercentThreshold, "circuit_breaker_error_percent_threshold", 10, "Errors threshold in %")
 
-	flag.IntVar(&cfg.RateLimitMaxRequests, "rate_limit_max_requests", 100, "Maximum number of incoming requests per IP")
+	flag.IntVar(&cfg.ProviderBreakerFailureThreshold, "provider_breaker_failure_threshold", 5, "Number of consecutive failed provider calls opening the provider circuit breaker")
+	flag.IntVar(&cfg.ProviderBreakerOpenSeconds, "provider_breaker_open_period", 30, "Period (seconds) sending is paused for when provider circuit breaker opens")
+
+	flag.IntVar(&cfg.SendMaxAttempts, "send_max_attempts", 5, "Maximum number of delivery attempts to recipient failing with transient errors")
+	flag.IntVar(&cfg.SendConcurrency, "send_concurrency", 10, "Maximum number of parallel provider calls while delivering the batch")
+	flag.IntVar(&cfg.SendTimeoutSeconds, "send_timeout", 10, "Period (seconds) single provider call can take")
+	flag.IntVar(&cfg.SendBatchTimeoutSeconds, "send_batch_timeout", 300, "Period (seconds) delivery of the batch can take, recipients not sent in time are requeued")
+	flag.StringVar(&cfg.PacerLimits, "pacer_limits", "originator=1,account=10", "Comma separated list of key=rate[:burst] outbound limits (messages per second) for 'originator', 'account' or specific 'originator:<name>' and 'account:twilio:<sid>' keys")
+	flag.IntVar(&cfg.PacerMaxWaitSeconds, "pacer_max_wait", 1, "Period (seconds) batch delivery waits for pacer, recipients waiting longer go back to the queue")
+	flag.IntVar(&cfg.SendRetryBackoffSeconds, "send_retry_backoff", 30, "Period (seconds) before first retry of transient delivery failure, doubles with every attempt")
+
+	flag.IntVar(&cfg.RateLimitMaxRequests, "rate_limit_max_requests", 100, "Maximum number of incoming requests per IP of anonymous client or per tenant of unknown tier")
+	flag.IntVar(&cfg.RateLimitBulkMaxRequests, "rate_limit_bulk_max_requests", 10, "Maximum number of messages sent with bulk requests per IP of anonymous client or per tenant of unknown tier")
 	flag.IntVar(&cfg.RateLimitPerPeriodSeconds, "rate_limit_per_period", 1, "Period (seconds) to calculate limits for")
+	flag.StringVar(&cfg.RateLimitFailurePolicy, "rate_limit_failure_policy", "local", "Rate limiting while redis is unavailable: 'local' in-memory limits of the instance, 'open' allows or 'closed' rejects all requests")
+	flag.IntVar(&cfg.RateLimitRetrySeconds, "rate_limit_retry_period", 5, "Period (seconds) rate limiter waits before trying unavailable redis again")
+	flag.StringVar(&cfg.RateLimitTiers, "rate_limit_tiers", "", "Comma separated list of name=max_requests:bulk_max_requests rate limit tiers, used with 'config' tenants store")
+
+	flag.StringVar(&cfg.TrustedProxies, "trusted_proxies", "", "Comma separated list of CIDRs of proxies allowed to report client IP with forwarding header")
+	flag.StringVar(&cfg.ForwardingHeader, "forwarding_header", "X-Forwarded-For", "Header trusted proxies report client IP with: Forwarded, X-Forwarded-For or X-Real-IP")
+
+	flag.StringVar(&cfg.IPFilterRulesFile, "ip_filter_rules_file", "", "JSON file with per-route CIDR allow and deny lists, reloaded on SIGHUP")
+
+	flag.BoolVar(&cfg.AuthRequired, "auth_required", false, "Reject requests without API key, otherwise they are rate limited by IP")
+	flag.StringVar(&cfg.APIKeys, "api_keys", "", "Comma separated list of api_key=tenant_id:tier API keys, used with 'config' tenants store")
+	flag.StringVar(&cfg.TenantsStore, "tenants_store", "config", "Store of API keys and rate limit tiers: can be 'config' or 'postgres'")
+	flag.StringVar(&cfg.AdminAPIKeys, "admin_api_keys", "", "Comma separated list of api_key=operator admin API keys, admin routes are disabled when empty")
+	flag.IntVar(&cfg.TenantsCacheTTLSeconds, "tenants_cache_ttl", 60, "Period (seconds) API keys and tiers loaded from postgres are cached for")
+
+	flag.IntVar(&cfg.BulkMaxMessages, "bulk_max_messages", 1000, "Maximum number of messages in single bulk request")
+	flag.IntVar(&cfg.IdempotencyKeyTTLSeconds, "idempotency_key_ttl", 86400, "Period (seconds) response of send request is replayed for requests with the same Idempotency-Key")
+	flag.IntVar(&cfg.IdempotencyCleanupSeconds, "idempotency_cleanup_period", 3600, "Period (seconds) between deletions of expired idempotency keys")
+	flag.Int64Var(&cfg.MaxRequestBodyBytes, "max_request_body_bytes", 1<<20, "Maximum size (bytes) of request body, larger requests are rejected")
+	flag.BoolVar(&cfg.OpenAPIValidation, "openapi_validation", false, "Validate requests against OpenAPI document served at /openapi.json before they reach the handlers")
 
 	flag.IntVar(&cfg.BufferDBMaxConnections, "buffer_db_max_conns", 5, "Postgres DB maximum number of connections")
 	flag.StringVar(&cfg.BufferDBConnectionString, "buffer_db_connection_string", "postgres://postgres@localhost:5432/postgres?sslmode=disable", "Postgres DB connection string")
 
+	flag.IntVar(&cfg.QueueStarvationTimeoutSeconds, "queue_starvation_timeout", 60, "Period (seconds) after which waiting message is delivered regardless of its priority")
+
+	flag.IntVar(&cfg.SMSMaxSegments, "sms_max_segments", 1, "Maximum number of segments rendered template message can take")
+	flag.BoolVar(&cfg.SMSAllowUCS2, "sms_allow_ucs2", true, "Allow rendered template messages with characters outside of GSM-7 alphabet")
+
+	flag.StringVar(&cfg.TemplateLocaleFallback, "template_locale_fallback", "en", "Comma separated list of locales to fall back to when template has no variant for recipient's locale")
+
+	flag.StringVar(&cfg.QuietHours, "quiet_hours", "marketing=21:00-08:00", "Comma separated list of category=HH:MM-HH:MM and tenant:ID=HH:MM-HH:MM quiet hours in recipient's local time, 'default' applies to other categories, tenant window takes precedence over category")
+	flag.StringVar(&cfg.QuietHoursBypassCategories, "quiet_hours_bypass_categories", "transactional", "Comma separated list of categories delivered regardless of quiet hours")
+	flag.StringVar(&cfg.QuietHoursDefaultTimeZone, "quiet_hours_default_timezone", "UTC", "Time zone of recipients whose country cant be detected from the phone number")
+
+	flag.IntVar(&cfg.VerifyCodeLength, "verify_code_length", 6, "Number of digits in one-time password")
+	flag.IntVar(&cfg.VerifyCodeTTLSeconds, "verify_code_ttl", 300, "Period (seconds) one-time password stays valid")
+	flag.IntVar(&cfg.VerifyMaxAttempts, "verify_max_attempts", 5, "Number of checks allowed before verification gets locked")
+	flag.IntVar(&cfg.VerifyLockoutSeconds, "verify_lockout_period", 900, "Period (seconds) recipient cant start new verifications after verification got locked")
+	flag.StringVar(&cfg.VerifySecret, "verify_secret", "", "Secret used to hash one-time passwords, one-time password verification is disabled when empty")
+	flag.StringVar(&cfg.VerifyMessage, "verify_message", "Your verification code is {{code}}", "Default verification message, must contain {{code}} placeholder")
+
+	flag.IntVar(&cfg.HTTPClientTimeoutSeconds, "http_client_timeout", 30, "Period (seconds) of whole provider call including reading response body, 0 means no limit")
+	flag.IntVar(&cfg.HTTPClientDialTimeoutSeconds, "http_client_dial_timeout", 5, "Period (seconds) to establish connection to provider")
+	flag.IntVar(&cfg.HTTPClientTLSHandshakeTimeoutSeconds, "http_client_tls_handshake_timeout", 5, "Period (seconds) of TLS handshake with provider")
+	flag.IntVar(&cfg.HTTPClientResponseHeaderTimeoutSeconds, "http_client_response_header_timeout", 10, "Period (seconds) to wait for provider response headers")
+	flag.IntVar(&cfg.HTTPClientIdleConnTimeoutSeconds, "http_client_idle_conn_timeout", 90, "Period (seconds) idle connection to provider is kept open")
+	flag.IntVar(&cfg.HTTPClientMaxIdleConns, "http_client_max_idle_conns", 100, "Maximum number of idle connections to providers")
+	flag.IntVar(&cfg.HTTPClientMaxIdleConnsPerHost, "http_client_max_idle_conns_per_host", 10, "Maximum number of idle connections per provider host")
+	flag.IntVar(&cfg.HTTPClientMaxConnsPerHost, "http_client_max_conns_per_host", 0, "Maximum number of connections per provider host, 0 means no limit")
+	flag.StringVar(&cfg.HTTPClientProxyURL, "http_client_proxy_url", "", "Proxy for provider calls, HTTPS_PROXY environment variable is used when empty")
+
 	flag.StringVar(&cfg.RedisHost, "redis_host", ":6379", "Redis hostname with port")
 	flag.StringVar(&cfg.RedisPwd, "redis_pwd", "123456", "Redis password")
 	flag.IntVar(&cfg.RedisMaxIdle, "redis_max_idle", 20, "Redis maximum number of idle connections in the pool")
 	flag.IntVar(&cfg.RedisMaxActive, "redis_max_active", 20, "Redis maximum number of connections allocated by the pool at a given time")
 	flag.IntVar(&cfg.RedisIdleTimeoutSeconds, "redis_max_idle_timeout", 240, "Redis closes connections after remaining idle for this duration")
+	flag.IntVar(&cfg.RedisTimeoutSeconds, "redis_timeout", 1, "Period (seconds) to connect to redis and to wait for its replies")
+
+	flag.StringVar(&cfg.TracingExporter, "tracing_exporter", "none", "Exporter of request traces: can be 'none', 'stdout' or 'otlp'")
+	flag.StringVar(&cfg.TracingOTLPEndpoint, "tracing_otlp_endpoint", "http://localhost:4318/v1/traces", "OTLP/HTTP traces endpoint, used with 'otlp' exporter")
+	flag.StringVar(&cfg.TracingServiceName, "tracing_service_name", "demo_messenger", "Service name reported with exported traces")
 
 	flag.Parse()
 
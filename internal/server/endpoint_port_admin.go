@@ -0,0 +1,384 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/audit"
+	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/suppressions"
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// adminPathPrefix is prefix of admin routes
+const adminPathPrefix = "/v1/admin/"
+
+// Limits of messages listed by admin API
+const (
+	defaultAdminListLimit = 100
+	maxAdminListLimit     = 1000
+)
+
+// Audited admin actions, read-only requests are not audited
+const (
+	auditActionCancel   = "messages.cancel"
+	auditActionRequeue  = "messages.requeue"
+	auditActionPurge    = "messages.purge"
+	auditActionPause    = "sending.pause"
+	auditActionResume   = "sending.resume"
+	auditActionSuppress = "recipients.suppress"
+)
+
+// Admin holds dependencies of admin routes, admin routes are served when at least one admin API key is configured
+type Admin struct {
+	Keys         AdminKeys
+	Queue        buffer.Admin
+	Suppressions suppressions.Store
+	Audit        audit.Log
+}
+
+// ListQueueMessagesHandler, implements http.Handler for GET /v1/admin/messages route, listing is read-only, so it is not audited
+func ListQueueMessagesHandler(queue buffer.Admin) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		filter, fieldErrors := messageFilterFromQuery(req)
+		if len(fieldErrors) > 0 {
+			writeValidationProblem(writer, req, fieldErrors)
+			return
+		}
+
+		writeQueueMessages(writer, req, queue, filter)
+	})
+}
+
+// writeQueueMessages writes page of messages matching filter
+func writeQueueMessages(writer http.ResponseWriter, req *http.Request, queue buffer.Admin, filter *buffer.MessageFilter) {
+	messages, err := queue.ListMessages(req.Context(), filter)
+	if err != nil {
+		writeInternalError(writer, req, errors.Wrap(err, "failed to list messages"))
+		return
+	}
+
+	result := &types.QueueMessages{Messages: make([]*types.QueueMessage, 0, len(messages))}
+	for _, message := range messages {
+		result.Messages = append(result.Messages, queueMessage(message))
+	}
+	// full page means there may be more messages
+	if len(messages) == filter.Limit {
+		result.NextAfterID = messages[len(messages)-1].MessageID
+	}
+
+	writeJSON(writer, http.StatusOK, result)
+}
+
+// CancelMessageHandler, implements http.Handler for POST /v1/admin/messages/{message_id}/cancel route
+func CancelMessageHandler(queue buffer.Admin, auditLog audit.Log) http.Handler {
+	return messageActionHandler("cancel", auditActionCancel, "Message not found in the queue", queue.CancelMessage, auditLog)
+}
+
+// RequeueMessageHandler, implements http.Handler for POST /v1/admin/messages/{message_id}/requeue route
+func RequeueMessageHandler(queue buffer.Admin, auditLog audit.Log) http.Handler {
+	return messageActionHandler("requeue", auditActionRequeue, "Processed message not found", queue.RequeueMessage, auditLog)
+}
+
+// messageActionHandler applies action to message of message_id route variable
+func messageActionHandler(name, auditAction, notFound string, action func(ctx context.Context, messageID int64) (int, error), auditLog audit.Log) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		target := mux.Vars(req)["message_id"]
+		messageID, err := strconv.ParseInt(target, 10, 64)
+		if err != nil || messageID <= 0 {
+			recordAudit(req, auditLog, auditAction, target, nil, audit.OutcomeRejected)
+			writeValidationProblem(writer, req, []*types.FieldError{{Field: "message_id", Code: types.FieldErrorCodeInvalid, Message: "message_id must be positive integer"}})
+			return
+		}
+
+		recipients, err := action(req.Context(), messageID)
+		if err != nil {
+			if errors.Cause(err) == buffer.ErrMessageNotFound {
+				recordAudit(req, auditLog, auditAction, target, nil, audit.OutcomeRejected)
+				writeProblem(writer, req, http.StatusNotFound, types.ErrorCodeNotFound, notFound)
+				return
+			}
+
+			recordAudit(req, auditLog, auditAction, target, nil, audit.OutcomeFailed)
+			writeInternalError(writer, req, errors.Wrapf(err, "failed to %s message %d", name, messageID))
+			return
+		}
+
+		result := &types.AdminActionResult{Action: name, Recipients: recipients}
+		recordAudit(req, auditLog, auditAction, target, result, audit.OutcomeSucceeded)
+		writeJSON(writer, http.StatusOK, result)
+	})
+}
+
+// PurgeOriginatorHandler, implements http.Handler for POST /v1/admin/messages/purge route
+func PurgeOriginatorHandler(queue buffer.Admin, auditLog audit.Log) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		purgeReq := &types.PurgeRequest{}
+
+		fieldErrors, ok := decodeRequest(writer, req, purgeReq)
+		if !ok {
+			recordAudit(req, auditLog, auditActionPurge, "", nil, audit.OutcomeRejected)
+			return
+		}
+		if len(fieldErrors) > 0 {
+			recordAudit(req, auditLog, auditActionPurge, purgeReq.Originator, nil, audit.OutcomeRejected)
+			writeValidationProblem(writer, req, fieldErrors)
+			return
+		}
+
+		recipients, err := queue.PurgeOriginator(req.Context(), purgeReq.Originator)
+		if err != nil {
+			recordAudit(req, auditLog, auditActionPurge, purgeReq.Originator, nil, audit.OutcomeFailed)
+			writeInternalError(writer, req, errors.Wrap(err, "failed to purge messages"))
+			return
+		}
+
+		result := &types.AdminActionResult{Action: "purge", Recipients: recipients}
+		recordAudit(req, auditLog, auditActionPurge, purgeReq.Originator, result, audit.OutcomeSucceeded)
+		writeJSON(writer, http.StatusOK, result)
+	})
+}
+
+// ListPausesHandler, implements http.Handler for GET /v1/admin/pauses route, listing is read-only, so it is not audited
+func ListPausesHandler(queue buffer.Admin) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		pauses, err := queue.ListPauses(req.Context())
+		if err != nil {
+			writeInternalError(writer, req, errors.Wrap(err, "failed to list pauses"))
+			return
+		}
+
+		result := &types.Pauses{Pauses: make([]*types.Pause, 0, len(pauses))}
+		for _, pause := range pauses {
+			result.Pauses = append(result.Pauses, &types.Pause{
+				Scope:     pause.Scope,
+				Value:     pause.Value,
+				Reason:    pause.Reason,
+				PausedBy:  pause.PausedBy,
+				CreatedAt: pause.CreatedAt,
+			})
+		}
+
+		writeJSON(writer, http.StatusOK, result)
+	})
+}
+
+// PauseSendingHandler, implements http.Handler for POST /v1/admin/pauses route
+func PauseSendingHandler(queue buffer.Admin, auditLog audit.Log) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		pauseReq := &types.PauseRequest{}
+
+		fieldErrors, ok := decodeRequest(writer, req, pauseReq)
+		if !ok {
+			recordAudit(req, auditLog, auditActionPause, "", nil, audit.OutcomeRejected)
+			return
+		}
+		target := pauseTarget(pauseReq.Scope, pauseReq.Value)
+		fieldErrors = append(fieldErrors, pauseValueErrors(pauseReq.Scope, pauseReq.Value)...)
+		if len(fieldErrors) > 0 {
+			recordAudit(req, auditLog, auditActionPause, target, nil, audit.OutcomeRejected)
+			writeValidationProblem(writer, req, fieldErrors)
+			return
+		}
+
+		admin, _ := AdminFromContext(req.Context())
+		pause := &buffer.Pause{Scope: pauseReq.Scope, Value: pauseReq.Value, Reason: pauseReq.Reason, PausedBy: admin}
+		if err := queue.PauseSending(req.Context(), pause); err != nil {
+			recordAudit(req, auditLog, auditActionPause, target, pauseReq, audit.OutcomeFailed)
+			writeInternalError(writer, req, errors.Wrap(err, "failed to pause sending"))
+			return
+		}
+		recordAudit(req, auditLog, auditActionPause, target, pauseReq, audit.OutcomeSucceeded)
+		logging.FromContext(req.Context()).WithField("reason", pauseReq.Reason).Warnf("sending paused for %s", target)
+
+		writeJSON(writer, http.StatusOK, &types.Pause{
+			Scope:     pause.Scope,
+			Value:     pause.Value,
+			Reason:    pause.Reason,
+			PausedBy:  pause.PausedBy,
+			CreatedAt: pause.CreatedAt,
+		})
+	})
+}
+
+// ResumeSendingHandler, implements http.Handler for POST /v1/admin/pauses/resume route
+func ResumeSendingHandler(queue buffer.Admin, auditLog audit.Log) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		resumeReq := &types.ResumeRequest{}
+
+		fieldErrors, ok := decodeRequest(writer, req, resumeReq)
+		if !ok {
+			recordAudit(req, auditLog, auditActionResume, "", nil, audit.OutcomeRejected)
+			return
+		}
+		target := pauseTarget(resumeReq.Scope, resumeReq.Value)
+		fieldErrors = append(fieldErrors, pauseValueErrors(resumeReq.Scope, resumeReq.Value)...)
+		if len(fieldErrors) > 0 {
+			recordAudit(req, auditLog, auditActionResume, target, nil, audit.OutcomeRejected)
+			writeValidationProblem(writer, req, fieldErrors)
+			return
+		}
+
+		if err := queue.ResumeSending(req.Context(), resumeReq.Scope, resumeReq.Value); err != nil {
+			if errors.Cause(err) == buffer.ErrPauseNotFound {
+				recordAudit(req, auditLog, auditActionResume, target, nil, audit.OutcomeRejected)
+				writeProblem(writer, req, http.StatusNotFound, types.ErrorCodeNotFound, fmt.Sprintf("Sending is not paused for %s", target))
+				return
+			}
+
+			recordAudit(req, auditLog, auditActionResume, target, nil, audit.OutcomeFailed)
+			writeInternalError(writer, req, errors.Wrap(err, "failed to resume sending"))
+			return
+		}
+		recordAudit(req, auditLog, auditActionResume, target, nil, audit.OutcomeSucceeded)
+		logging.FromContext(req.Context()).Warnf("sending resumed for %s", target)
+
+		writer.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// SuppressRecipientHandler, implements http.Handler for POST /v1/admin/suppressions route
+func SuppressRecipientHandler(store suppressions.Store, auditLog audit.Log) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		suppressReq := &types.SuppressRequest{}
+
+		fieldErrors, ok := decodeRequest(writer, req, suppressReq)
+		if !ok {
+			recordAudit(req, auditLog, auditActionSuppress, "", nil, audit.OutcomeRejected)
+			return
+		}
+		if len(fieldErrors) > 0 {
+			recordAudit(req, auditLog, auditActionSuppress, suppressReq.PhoneNumber, nil, audit.OutcomeRejected)
+			writeValidationProblem(writer, req, fieldErrors)
+			return
+		}
+
+		// suppressed by admin, so there is no provider error code
+		if err := store.Suppress(req.Context(), suppressReq.PhoneNumber, 0); err != nil {
+			recordAudit(req, auditLog, auditActionSuppress, suppressReq.PhoneNumber, nil, audit.OutcomeFailed)
+			writeInternalError(writer, req, errors.Wrap(err, "failed to suppress recipient"))
+			return
+		}
+		recordAudit(req, auditLog, auditActionSuppress, suppressReq.PhoneNumber, nil, audit.OutcomeSucceeded)
+
+		writer.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// pauseValueErrors checks value of the pause scope, originator and tenant pauses name what they pause and global one does not
+func pauseValueErrors(scope, value string) []*types.FieldError {
+	switch {
+	case scope == buffer.PauseGlobal && len(value) > 0:
+		return []*types.FieldError{{Field: "value", Code: types.FieldErrorCodeConflict, Message: "value cant be used together with global scope"}}
+	case (scope == buffer.PauseOriginator || scope == buffer.PauseTenant) && len(value) == 0:
+		return []*types.FieldError{{Field: "value", Code: types.FieldErrorCodeRequired, Message: fmt.Sprintf("value is required for %s scope", scope)}}
+	}
+	return nil
+}
+
+// pauseTarget names paused scope in audit log and messages, i.e. "originator:acme"
+func pauseTarget(scope, value string) string {
+	if len(value) == 0 {
+		return scope
+	}
+	return scope + ":" + value
+}
+
+// messageFilterFromQuery reads filter of listed messages from query parameters
+func messageFilterFromQuery(req *http.Request) (*buffer.MessageFilter, []*types.FieldError) {
+	var (
+		query       = req.URL.Query()
+		fieldErrors []*types.FieldError
+		filter      = &buffer.MessageFilter{
+			State:       query.Get("state"),
+			Originator:  query.Get("originator"),
+			TenantID:    query.Get("tenant_id"),
+			PhoneNumber: query.Get("recipient"),
+			Limit:       defaultAdminListLimit,
+		}
+	)
+
+	if len(filter.State) > 0 {
+		known := false
+		for _, state := range buffer.States {
+			known = known || filter.State == state
+		}
+		if !known {
+			fieldErrors = append(fieldErrors, &types.FieldError{Field: "state", Code: types.FieldErrorCodeInvalid, Message: fmt.Sprintf("state must be one of %s", strings.Join(buffer.States, ", "))})
+		}
+	}
+
+	if v := query.Get("after_id"); len(v) > 0 {
+		afterID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || afterID < 0 {
+			fieldErrors = append(fieldErrors, &types.FieldError{Field: "after_id", Code: types.FieldErrorCodeInvalid, Message: "after_id must be non-negative integer"})
+		}
+		filter.AfterID = afterID
+	}
+
+	if v := query.Get("limit"); len(v) > 0 {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAdminListLimit {
+			fieldErrors = append(fieldErrors, &types.FieldError{Field: "limit", Code: types.FieldErrorCodeInvalid, Message: fmt.Sprintf("limit must be between 1 and %d", maxAdminListLimit)})
+		}
+		filter.Limit = limit
+	}
+
+	return filter, fieldErrors
+}
+
+// queueMessage converts message stored in the queue into its json representation
+func queueMessage(message *buffer.MessageDetails) *types.QueueMessage {
+	result := &types.QueueMessage{
+		MessageID:  message.MessageID,
+		Originator: message.Originator,
+		Text:       message.Text,
+		Processed:  message.Processed,
+		Priority:   buffer.PriorityName(message.Priority),
+		TenantID:   message.TenantID,
+		CreatedAt:  message.CreatedAt,
+		SendAfter:  message.SendAfter,
+		Recipients: make([]*types.QueueRecipient, 0, len(message.Recipients)),
+	}
+	for _, recipient := range message.Recipients {
+		result.Recipients = append(result.Recipients, &types.QueueRecipient{
+			PhoneNumber: recipient.PhoneNumber,
+			Status:      recipient.Status,
+			ErrorCode:   recipient.ErrorCode,
+			Attempts:    recipient.Attempts,
+		})
+	}
+
+	return result
+}
+
+// recordAudit appends admin action to the audit log, failure to record is logged and does not fail the request
+func recordAudit(req *http.Request, auditLog audit.Log, action, target string, details interface{}, outcome string) {
+	admin, _ := AdminFromContext(req.Context())
+	entry := &audit.Entry{
+		Actor:     admin,
+		Action:    action,
+		Target:    target,
+		Outcome:   outcome,
+		RequestID: RequestIDFromContext(req.Context()),
+		ClientIP:  utils.GetRequestIPAddress(req),
+	}
+	if details != nil {
+		data, err := json.Marshal(details)
+		if err != nil {
+			logging.FromContext(req.Context()).Error(errors.Wrapf(err, "failed to encode details of %s", action))
+		}
+		entry.Details = string(data)
+	}
+
+	if err := auditLog.Record(req.Context(), entry); err != nil {
+		logging.FromContext(req.Context()).WithField("action", action).WithField("target", target).Error(errors.Wrap(err, "failed to record admin action"))
+	}
+}
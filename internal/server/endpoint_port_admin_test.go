@@ -0,0 +1,588 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/arkadyb/demo_messenger/internal/pkg/audit"
+	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockedAdminQueue struct {
+	mock.Mock
+}
+
+func (m *MockedAdminQueue) ListMessages(ctx context.Context, filter *buffer.MessageFilter) (messages []*buffer.MessageDetails, err error) {
+	args := m.Called(ctx, filter)
+	if args.Get(0) != nil {
+		messages = args.Get(0).([]*buffer.MessageDetails)
+	}
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	return
+}
+
+func (m *MockedAdminQueue) CancelMessage(ctx context.Context, messageID int64) (int, error) {
+	args := m.Called(ctx, messageID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockedAdminQueue) RequeueMessage(ctx context.Context, messageID int64) (int, error) {
+	args := m.Called(ctx, messageID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockedAdminQueue) PurgeOriginator(ctx context.Context, originator string) (int, error) {
+	args := m.Called(ctx, originator)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockedAdminQueue) PauseSending(ctx context.Context, pause *buffer.Pause) error {
+	args := m.Called(ctx, pause)
+	return args.Error(0)
+}
+
+func (m *MockedAdminQueue) ResumeSending(ctx context.Context, scope, value string) error {
+	args := m.Called(ctx, scope, value)
+	return args.Error(0)
+}
+
+func (m *MockedAdminQueue) ListPauses(ctx context.Context) (pauses []*buffer.Pause, err error) {
+	args := m.Called(ctx)
+	if args.Get(0) != nil {
+		pauses = args.Get(0).([]*buffer.Pause)
+	}
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	return
+}
+
+type MockedSuppressions struct {
+	mock.Mock
+}
+
+func (m *MockedSuppressions) Suppress(ctx context.Context, phoneNumber string, errorCode int) error {
+	args := m.Called(ctx, phoneNumber, errorCode)
+	return args.Error(0)
+}
+
+func (m *MockedSuppressions) IsSuppressed(ctx context.Context, phoneNumber string) (bool, error) {
+	args := m.Called(ctx, phoneNumber)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockedAuditLog struct {
+	mock.Mock
+}
+
+func (m *MockedAuditLog) Record(ctx context.Context, entry *audit.Entry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+// auditEntry matches audit entry by its action, target and outcome
+func auditEntry(action, target, outcome string) interface{} {
+	return mock.MatchedBy(func(entry *audit.Entry) bool {
+		return entry.Actor == "ops" && entry.Action == action && entry.Target == target && entry.Outcome == outcome
+	})
+}
+
+// newAdminRouter returns router serving admin routes for operator "ops" authenticated with "admin-secret" key
+func newAdminRouter(t *testing.T, queue *MockedAdminQueue, suppressions *MockedSuppressions, auditLog *MockedAuditLog) *mux.Router {
+	keys, err := server.ParseAdminKeys("admin-secret=ops")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	router := mux.NewRouter()
+	router.Use(server.AdminAuthenticationMiddleware(keys))
+	router.Handle("/v1/admin/messages", server.ListQueueMessagesHandler(queue)).Methods("GET")
+	router.Handle("/v1/admin/messages/purge", server.PurgeOriginatorHandler(queue, auditLog)).Methods("POST")
+	router.Handle("/v1/admin/messages/{message_id}/cancel", server.CancelMessageHandler(queue, auditLog)).Methods("POST")
+	router.Handle("/v1/admin/messages/{message_id}/requeue", server.RequeueMessageHandler(queue, auditLog)).Methods("POST")
+	router.Handle("/v1/admin/pauses", server.ListPausesHandler(queue)).Methods("GET")
+	router.Handle("/v1/admin/pauses", server.PauseSendingHandler(queue, auditLog)).Methods("POST")
+	router.Handle("/v1/admin/pauses/resume", server.ResumeSendingHandler(queue, auditLog)).Methods("POST")
+	router.Handle("/v1/admin/suppressions", server.SuppressRecipientHandler(suppressions, auditLog)).Methods("POST")
+	return router
+}
+
+func TestListQueueMessagesHandler(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	messages := []*buffer.MessageDetails{
+		{
+			Message:    buffer.Message{MessageID: 11, Originator: "originator", Text: "text", Processed: true, Priority: buffer.PriorityHigh, CreatedAt: createdAt},
+			Recipients: []*buffer.Recipient{{MessageID: 11, PhoneNumber: "1", Status: buffer.RecipientDeadLettered, ErrorCode: 20429, Attempts: 5}},
+		},
+		{
+			Message:    buffer.Message{MessageID: 12, Originator: "originator", Text: "text", Processed: true, Priority: buffer.PriorityNormal, CreatedAt: createdAt},
+			Recipients: []*buffer.Recipient{{MessageID: 12, PhoneNumber: "2", Status: buffer.RecipientDeadLettered, Attempts: 5}},
+		},
+	}
+
+	tests := []struct {
+		name               string
+		url                string
+		queue              func() *MockedAdminQueue
+		expectedStatusCode int
+		expected           *types.QueueMessages
+	}{
+		{
+			"Full page",
+			"/v1/admin/messages?state=dead_lettered&originator=originator&after_id=10&limit=2",
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("ListMessages", mock.Anything, &buffer.MessageFilter{State: buffer.StateDeadLettered, Originator: "originator", AfterID: 10, Limit: 2}).Return(messages, nil)
+				return queue
+			},
+			http.StatusOK,
+			&types.QueueMessages{
+				Messages: []*types.QueueMessage{
+					{MessageID: 11, Originator: "originator", Text: "text", Processed: true, Priority: "high", CreatedAt: createdAt, Recipients: []*types.QueueRecipient{{PhoneNumber: "1", Status: buffer.RecipientDeadLettered, ErrorCode: 20429, Attempts: 5}}},
+					{MessageID: 12, Originator: "originator", Text: "text", Processed: true, Priority: "normal", CreatedAt: createdAt, Recipients: []*types.QueueRecipient{{PhoneNumber: "2", Status: buffer.RecipientDeadLettered, Attempts: 5}}},
+				},
+				NextAfterID: 12,
+			},
+		},
+		{
+			"Last page",
+			"/v1/admin/messages?recipient=1",
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("ListMessages", mock.Anything, &buffer.MessageFilter{PhoneNumber: "1", Limit: 100}).Return([]*buffer.MessageDetails{}, nil)
+				return queue
+			},
+			http.StatusOK,
+			&types.QueueMessages{Messages: []*types.QueueMessage{}},
+		},
+		{
+			"Invalid filter",
+			"/v1/admin/messages?state=sent&limit=0",
+			func() *MockedAdminQueue {
+				return &MockedAdminQueue{}
+			},
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"Queue error",
+			"/v1/admin/messages",
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("ListMessages", mock.Anything, mock.Anything).Return(nil, errors.New("error"))
+				return queue
+			},
+			http.StatusInternalServerError,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := tt.queue()
+			// listing is read-only, so it is not audited
+			auditLog := &MockedAuditLog{}
+
+			req := httptest.NewRequest("GET", "http://fake-url"+tt.url, nil)
+			req.Header.Set("X-API-Key", "admin-secret")
+			w := httptest.NewRecorder()
+
+			newAdminRouter(t, queue, &MockedSuppressions{}, auditLog).ServeHTTP(w, req)
+
+			if !assert.Equal(t, tt.expectedStatusCode, w.Code, w.Body.String()) {
+				t.FailNow()
+			}
+			if tt.expected != nil {
+				result := &types.QueueMessages{}
+				if !assert.NoError(t, json.NewDecoder(w.Body).Decode(result)) {
+					t.FailNow()
+				}
+				assert.Equal(t, tt.expected, result)
+			}
+			queue.AssertExpectations(t)
+			auditLog.AssertExpectations(t)
+		})
+	}
+}
+
+func TestMessageActionHandlers(t *testing.T) {
+	tests := []struct {
+		name               string
+		url                string
+		reqBody            string
+		queue              func() *MockedAdminQueue
+		auditAction        string
+		auditTarget        string
+		auditOutcome       string
+		expectedStatusCode int
+		expected           *types.AdminActionResult
+	}{
+		{
+			"Cancel",
+			"/v1/admin/messages/42/cancel",
+			"",
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("CancelMessage", mock.Anything, int64(42)).Return(2, nil)
+				return queue
+			},
+			"messages.cancel", "42", audit.OutcomeSucceeded,
+			http.StatusOK,
+			&types.AdminActionResult{Action: "cancel", Recipients: 2},
+		},
+		{
+			"Cancel message not in the queue",
+			"/v1/admin/messages/42/cancel",
+			"",
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("CancelMessage", mock.Anything, int64(42)).Return(0, buffer.ErrMessageNotFound)
+				return queue
+			},
+			"messages.cancel", "42", audit.OutcomeRejected,
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"Cancel invalid message ID",
+			"/v1/admin/messages/abc/cancel",
+			"",
+			func() *MockedAdminQueue {
+				return &MockedAdminQueue{}
+			},
+			"messages.cancel", "abc", audit.OutcomeRejected,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"Requeue",
+			"/v1/admin/messages/42/requeue",
+			"",
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("RequeueMessage", mock.Anything, int64(42)).Return(3, nil)
+				return queue
+			},
+			"messages.requeue", "42", audit.OutcomeSucceeded,
+			http.StatusOK,
+			&types.AdminActionResult{Action: "requeue", Recipients: 3},
+		},
+		{
+			"Requeue error",
+			"/v1/admin/messages/42/requeue",
+			"",
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("RequeueMessage", mock.Anything, int64(42)).Return(0, errors.New("error"))
+				return queue
+			},
+			"messages.requeue", "42", audit.OutcomeFailed,
+			http.StatusInternalServerError,
+			nil,
+		},
+		{
+			"Purge",
+			"/v1/admin/messages/purge",
+			`{"originator": "spammer"}`,
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("PurgeOriginator", mock.Anything, "spammer").Return(5, nil)
+				return queue
+			},
+			"messages.purge", "spammer", audit.OutcomeSucceeded,
+			http.StatusOK,
+			&types.AdminActionResult{Action: "purge", Recipients: 5},
+		},
+		{
+			"Purge without originator",
+			"/v1/admin/messages/purge",
+			`{}`,
+			func() *MockedAdminQueue {
+				return &MockedAdminQueue{}
+			},
+			"messages.purge", "", audit.OutcomeRejected,
+			http.StatusBadRequest,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := tt.queue()
+			auditLog := &MockedAuditLog{}
+			auditLog.On("Record", mock.Anything, auditEntry(tt.auditAction, tt.auditTarget, tt.auditOutcome)).Return(nil).Once()
+
+			req := httptest.NewRequest("POST", "http://fake-url"+tt.url, strings.NewReader(tt.reqBody))
+			req.Header.Set("Authorization", "Bearer admin-secret")
+			w := httptest.NewRecorder()
+
+			newAdminRouter(t, queue, &MockedSuppressions{}, auditLog).ServeHTTP(w, req)
+
+			if !assert.Equal(t, tt.expectedStatusCode, w.Code, w.Body.String()) {
+				t.FailNow()
+			}
+			if tt.expected != nil {
+				result := &types.AdminActionResult{}
+				if !assert.NoError(t, json.NewDecoder(w.Body).Decode(result)) {
+					t.FailNow()
+				}
+				assert.Equal(t, tt.expected, result)
+			}
+			queue.AssertExpectations(t)
+			auditLog.AssertExpectations(t)
+		})
+	}
+}
+
+func TestMessageActionHandlers_AuditFailure(t *testing.T) {
+	queue := &MockedAdminQueue{}
+	queue.On("CancelMessage", mock.Anything, int64(42)).Return(1, nil)
+	auditLog := &MockedAuditLog{}
+	auditLog.On("Record", mock.Anything, auditEntry("messages.cancel", "42", audit.OutcomeSucceeded)).Return(errors.New("error"))
+
+	req := httptest.NewRequest("POST", "http://fake-url/v1/admin/messages/42/cancel", nil)
+	req.Header.Set("X-API-Key", "admin-secret")
+	w := httptest.NewRecorder()
+
+	newAdminRouter(t, queue, &MockedSuppressions{}, auditLog).ServeHTTP(w, req)
+
+	// action already took place, so failure to record it is only logged
+	assert.Equal(t, http.StatusOK, w.Code)
+	auditLog.AssertExpectations(t)
+}
+
+func TestPauseHandlers(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	setCreatedAt := func(args mock.Arguments) {
+		args.Get(1).(*buffer.Pause).CreatedAt = createdAt
+	}
+
+	tests := []struct {
+		name               string
+		url                string
+		reqBody            string
+		queue              func() *MockedAdminQueue
+		auditAction        string
+		auditTarget        string
+		auditOutcome       string
+		expectedStatusCode int
+		expected           string
+	}{
+		{
+			"Pause originator",
+			"/v1/admin/pauses",
+			`{"scope": "originator", "value": "Acme", "reason": "wrong template"}`,
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("PauseSending", mock.Anything, &buffer.Pause{Scope: buffer.PauseOriginator, Value: "Acme", Reason: "wrong template", PausedBy: "ops"}).Run(setCreatedAt).Return(nil)
+				return queue
+			},
+			"sending.pause", "originator:Acme", audit.OutcomeSucceeded,
+			http.StatusOK,
+			`{"scope":"originator","value":"Acme","reason":"wrong template","paused_by":"ops","created_at":"2019-03-01T12:00:00Z"}`,
+		},
+		{
+			"Pause everything",
+			"/v1/admin/pauses",
+			`{"scope": "global"}`,
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("PauseSending", mock.Anything, &buffer.Pause{Scope: buffer.PauseGlobal, PausedBy: "ops"}).Run(setCreatedAt).Return(nil)
+				return queue
+			},
+			"sending.pause", "global", audit.OutcomeSucceeded,
+			http.StatusOK,
+			`{"scope":"global","paused_by":"ops","created_at":"2019-03-01T12:00:00Z"}`,
+		},
+		{
+			"Pause tenant without value",
+			"/v1/admin/pauses",
+			`{"scope": "tenant"}`,
+			func() *MockedAdminQueue {
+				return &MockedAdminQueue{}
+			},
+			"sending.pause", "tenant", audit.OutcomeRejected,
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"Pause global with value",
+			"/v1/admin/pauses",
+			`{"scope": "global", "value": "acme"}`,
+			func() *MockedAdminQueue {
+				return &MockedAdminQueue{}
+			},
+			"sending.pause", "global:acme", audit.OutcomeRejected,
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"Pause unknown scope",
+			"/v1/admin/pauses",
+			`{"scope": "recipient", "value": "1"}`,
+			func() *MockedAdminQueue {
+				return &MockedAdminQueue{}
+			},
+			"sending.pause", "recipient:1", audit.OutcomeRejected,
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"Pause error",
+			"/v1/admin/pauses",
+			`{"scope": "global"}`,
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("PauseSending", mock.Anything, mock.Anything).Return(errors.New("error"))
+				return queue
+			},
+			"sending.pause", "global", audit.OutcomeFailed,
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"Resume tenant",
+			"/v1/admin/pauses/resume",
+			`{"scope": "tenant", "value": "acme"}`,
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("ResumeSending", mock.Anything, buffer.PauseTenant, "acme").Return(nil)
+				return queue
+			},
+			"sending.resume", "tenant:acme", audit.OutcomeSucceeded,
+			http.StatusNoContent,
+			"",
+		},
+		{
+			"Resume not paused",
+			"/v1/admin/pauses/resume",
+			`{"scope": "global"}`,
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("ResumeSending", mock.Anything, buffer.PauseGlobal, "").Return(buffer.ErrPauseNotFound)
+				return queue
+			},
+			"sending.resume", "global", audit.OutcomeRejected,
+			http.StatusNotFound,
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := tt.queue()
+			auditLog := &MockedAuditLog{}
+			auditLog.On("Record", mock.Anything, auditEntry(tt.auditAction, tt.auditTarget, tt.auditOutcome)).Return(nil).Once()
+
+			req := httptest.NewRequest("POST", "http://fake-url"+tt.url, strings.NewReader(tt.reqBody))
+			req.Header.Set("X-API-Key", "admin-secret")
+			w := httptest.NewRecorder()
+
+			newAdminRouter(t, queue, &MockedSuppressions{}, auditLog).ServeHTTP(w, req)
+
+			if !assert.Equal(t, tt.expectedStatusCode, w.Code, w.Body.String()) {
+				t.FailNow()
+			}
+			if len(tt.expected) > 0 {
+				assert.JSONEq(t, tt.expected, w.Body.String())
+			}
+			queue.AssertExpectations(t)
+			auditLog.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListPausesHandler(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	queue := &MockedAdminQueue{}
+	queue.On("ListPauses", mock.Anything).Return([]*buffer.Pause{
+		{Scope: buffer.PauseTenant, Value: "acme", Reason: "compromised key", PausedBy: "ops", CreatedAt: createdAt},
+	}, nil)
+
+	req := httptest.NewRequest("GET", "http://fake-url/v1/admin/pauses", nil)
+	req.Header.Set("X-API-Key", "admin-secret")
+	w := httptest.NewRecorder()
+
+	// listing is read-only, so it is not audited
+	auditLog := &MockedAuditLog{}
+	newAdminRouter(t, queue, &MockedSuppressions{}, auditLog).ServeHTTP(w, req)
+
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		t.FailNow()
+	}
+	auditLog.AssertNotCalled(t, "Record", mock.Anything, mock.Anything)
+	assert.JSONEq(t, `{"pauses":[{"scope":"tenant","value":"acme","reason":"compromised key","paused_by":"ops","created_at":"2019-03-01T12:00:00Z"}]}`, w.Body.String())
+}
+
+func TestSuppressRecipientHandler(t *testing.T) {
+	tests := []struct {
+		name               string
+		reqBody            string
+		suppressions       func() *MockedSuppressions
+		auditTarget        string
+		auditOutcome       string
+		expectedStatusCode int
+	}{
+		{
+			"Suppress recipient",
+			`{"phone_number": "+3712000000"}`,
+			func() *MockedSuppressions {
+				suppressions := &MockedSuppressions{}
+				suppressions.On("Suppress", mock.Anything, "+3712000000", 0).Return(nil)
+				return suppressions
+			},
+			"+3712000000", audit.OutcomeSucceeded,
+			http.StatusNoContent,
+		},
+		{
+			"Suppress without phone number",
+			`{}`,
+			func() *MockedSuppressions {
+				return &MockedSuppressions{}
+			},
+			"", audit.OutcomeRejected,
+			http.StatusBadRequest,
+		},
+		{
+			"Suppress error",
+			`{"phone_number": "+3712000000"}`,
+			func() *MockedSuppressions {
+				suppressions := &MockedSuppressions{}
+				suppressions.On("Suppress", mock.Anything, "+3712000000", 0).Return(errors.New("error"))
+				return suppressions
+			},
+			"+3712000000", audit.OutcomeFailed,
+			http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suppressions := tt.suppressions()
+			auditLog := &MockedAuditLog{}
+			auditLog.On("Record", mock.Anything, auditEntry("recipients.suppress", tt.auditTarget, tt.auditOutcome)).Return(nil).Once()
+
+			req := httptest.NewRequest("POST", "http://fake-url/v1/admin/suppressions", strings.NewReader(tt.reqBody))
+			req.Header.Set("X-API-Key", "admin-secret")
+			w := httptest.NewRecorder()
+
+			newAdminRouter(t, &MockedAdminQueue{}, suppressions, auditLog).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatusCode, w.Code, w.Body.String())
+			suppressions.AssertExpectations(t)
+			auditLog.AssertExpectations(t)
+		})
+	}
+}
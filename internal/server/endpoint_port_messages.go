@@ -0,0 +1,29 @@
+package server
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"net/http"
+)
+
+// ListTenantMessagesHandler, implements http.Handler for GET /v1/messages route.
+// Tenant lists status of its own messages, tenant_id filter is always set to the tenant of API key.
+func ListTenantMessagesHandler(queue buffer.Admin) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		tenant, ok := TenantFromContext(req.Context())
+		if !ok {
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			writeProblem(writer, req, http.StatusUnauthorized, types.ErrorCodeUnauthorized, "API key required")
+			return
+		}
+
+		filter, fieldErrors := messageFilterFromQuery(req)
+		if len(fieldErrors) > 0 {
+			writeValidationProblem(writer, req, fieldErrors)
+			return
+		}
+		filter.TenantID = tenant.TenantID
+
+		writeQueueMessages(writer, req, queue, filter)
+	})
+}
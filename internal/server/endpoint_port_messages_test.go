@@ -0,0 +1,111 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListTenantMessagesHandler(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	acme := &tenants.Tenant{TenantID: "acme"}
+
+	tests := []struct {
+		name               string
+		url                string
+		tenant             *tenants.Tenant
+		queue              func() *MockedAdminQueue
+		expectedStatusCode int
+		expected           *types.QueueMessages
+	}{
+		{
+			"Messages of the tenant",
+			"/v1/messages?state=failed&tenant_id=other&limit=1",
+			acme,
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("ListMessages", mock.Anything, &buffer.MessageFilter{State: buffer.StateFailed, TenantID: "acme", Limit: 1}).Return([]*buffer.MessageDetails{
+					{
+						Message:    buffer.Message{MessageID: 11, Originator: "originator", Text: "text", Processed: true, Priority: buffer.PriorityNormal, CreatedAt: createdAt, TenantID: "acme"},
+						Recipients: []*buffer.Recipient{{MessageID: 11, PhoneNumber: "1", Status: buffer.RecipientFailed, ErrorCode: 21211, Attempts: 1}},
+					},
+				}, nil)
+				return queue
+			},
+			http.StatusOK,
+			&types.QueueMessages{
+				Messages: []*types.QueueMessage{
+					{MessageID: 11, Originator: "originator", Text: "text", Processed: true, Priority: "normal", TenantID: "acme", CreatedAt: createdAt, Recipients: []*types.QueueRecipient{{PhoneNumber: "1", Status: buffer.RecipientFailed, ErrorCode: 21211, Attempts: 1}}},
+				},
+				NextAfterID: 11,
+			},
+		},
+		{
+			"Anonymous request",
+			"/v1/messages",
+			nil,
+			func() *MockedAdminQueue {
+				return &MockedAdminQueue{}
+			},
+			http.StatusUnauthorized,
+			nil,
+		},
+		{
+			"Invalid filter",
+			"/v1/messages?after_id=-1",
+			acme,
+			func() *MockedAdminQueue {
+				return &MockedAdminQueue{}
+			},
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"Queue error",
+			"/v1/messages",
+			acme,
+			func() *MockedAdminQueue {
+				queue := &MockedAdminQueue{}
+				queue.On("ListMessages", mock.Anything, mock.Anything).Return(nil, errors.New("error"))
+				return queue
+			},
+			http.StatusInternalServerError,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := tt.queue()
+
+			req := httptest.NewRequest("GET", "http://fake-url"+tt.url, nil)
+			if tt.tenant != nil {
+				req = req.WithContext(tenants.NewContext(context.Background(), tt.tenant))
+			}
+			w := httptest.NewRecorder()
+
+			server.ListTenantMessagesHandler(queue).ServeHTTP(w, req)
+
+			if !assert.Equal(t, tt.expectedStatusCode, w.Code, w.Body.String()) {
+				t.FailNow()
+			}
+			if tt.expected != nil {
+				result := &types.QueueMessages{}
+				if !assert.NoError(t, json.NewDecoder(w.Body).Decode(result)) {
+					t.FailNow()
+				}
+				assert.Equal(t, tt.expected, result)
+			}
+			queue.AssertExpectations(t)
+		})
+	}
+}
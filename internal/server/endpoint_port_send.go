@@ -1,14 +1,21 @@
 package server
 
 import (
-	"encoding/json"
+	"fmt"
 	"github.com/arkadyb/demo_messenger/internal/messenger"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/validation"
 	"github.com/arkadyb/demo_messenger/internal/types"
 	"github.com/pkg/errors"
-	"github.com/prometheus/common/log"
 	"net/http"
 )
 
+// statuses of bulk messages not enqueued
+const (
+	bulkStatusRejected = "rejected"
+	bulkStatusFailed   = "failed"
+)
+
 // SendSMSHandler, implements http.Handler for /v1/send/sms route
 func SendSMSHandler(app messenger.Application) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
@@ -16,43 +23,104 @@ func SendSMSHandler(app messenger.Application) http.Handler {
 			sms = &types.SMS{}
 		)
 
-		decoder := json.NewDecoder(req.Body)
-		if err := decoder.Decode(sms); err != nil {
-			writer.WriteHeader(http.StatusBadRequest)
-			log.Error(errors.Wrap(err, "failed to decode sms from request body"))
-
+		fieldErrors, ok := decodeRequest(writer, req, sms)
+		if !ok {
 			return
 		}
-
-		if len(sms.Message) > 160 {
-			writer.WriteHeader(http.StatusBadRequest)
-			writer.Write([]byte("Message too long"))
+		if len(fieldErrors) > 0 {
+			writeValidationProblem(writer, req, fieldErrors)
 			return
 		}
 
-		if len(sms.Originator) == 0 {
-			writer.WriteHeader(http.StatusBadRequest)
-			writer.Write([]byte("Originator required"))
-			return
-		}
+		receipt, err := app.EnqueueSMS(req.Context(), sms)
+		if err != nil {
+			if invalidErr, ok := errors.Cause(err).(*messenger.InvalidSMSError); ok {
+				writeProblem(writer, req, http.StatusBadRequest, types.ErrorCodeMessageRejected, invalidErr.Reason)
+				return
+			}
 
-		if len(sms.Recipient) == 0 {
-			writer.WriteHeader(http.StatusBadRequest)
-			writer.Write([]byte("Recipient required"))
+			writeInternalError(writer, req, errors.Wrap(err, "failed to enqueue notification"))
 			return
 		}
 
-		if err := app.EnqueueSMS(req.Context(), sms); err != nil {
-			writer.WriteHeader(http.StatusInternalServerError)
-			log.Error(errors.Wrap(err, "failed to enqueue notification"))
+		writeJSON(writer, http.StatusAccepted, receipt)
+	})
+}
+
+// BulkSendSMSHandler, implements http.Handler for /v1/send/sms/bulk route.
+// Every sms is enqueued on its own, result of each of them is reported in order of the request.
+func BulkSendSMSHandler(app messenger.Application, maxMessages int) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		var (
+			bulk = &types.BulkSMSRequest{}
+		)
 
+		fieldErrors, ok := decodeRequest(writer, req, bulk)
+		if !ok {
+			return
+		}
+		if maxMessages > 0 && len(bulk.Messages) > maxMessages {
+			fieldErrors = append(fieldErrors, &types.FieldError{Field: "messages", Code: types.FieldErrorCodeTooMany, Message: fmt.Sprintf("messages must have at most %d elements", maxMessages)})
+		}
+		// unknown fields of any message reject the whole request, invalid messages are rejected one by one
+		if len(fieldErrors) > 0 {
+			writeValidationProblem(writer, req, fieldErrors)
 			return
 		}
 
-		writer.WriteHeader(http.StatusAccepted)
-		writer.Header().Set("Content-Type", "application/json")
-		if _, err := writer.Write([]byte(`{"status":"accepted"}`)); err != nil {
-			log.Error(errors.Wrap(err, "failed to write response json to output"))
+		response := &types.BulkSMSResponse{Results: make([]*types.BulkSMSResult, len(bulk.Messages))}
+		for i, sms := range bulk.Messages {
+			field := fmt.Sprintf("messages[%d]", i)
+			if sms == nil {
+				response.Results[i] = rejectedResult([]*types.FieldError{{Field: field, Code: types.FieldErrorCodeRequired, Message: field + " is required"}})
+				continue
+			}
+			if fieldErrors := fieldErrorsOf(validation.Validate(sms), field+"."); len(fieldErrors) > 0 {
+				response.Results[i] = rejectedResult(fieldErrors)
+				continue
+			}
+
+			enqueue := func() *types.BulkSMSResult {
+				return enqueueBulkMessage(req, app, sms)
+			}
+			if ir := idempotentRequestFromContext(req.Context()); ir != nil {
+				response.Results[i] = ir.enqueueBulkMessage(req.Context(), i, sms, enqueue)
+			} else {
+				response.Results[i] = enqueue()
+			}
 		}
+
+		writeJSON(writer, http.StatusMultiStatus, response)
 	})
 }
+
+// enqueueBulkMessage enqueues sms of the bulk request and returns its result
+func enqueueBulkMessage(req *http.Request, app messenger.Application, sms *types.SMS) *types.BulkSMSResult {
+	receipt, err := app.EnqueueSMS(req.Context(), sms)
+	if err != nil {
+		if invalidErr, ok := errors.Cause(err).(*messenger.InvalidSMSError); ok {
+			return &types.BulkSMSResult{Status: bulkStatusRejected, Error: invalidErr.Reason, Code: types.ErrorCodeMessageRejected}
+		}
+
+		// messages enqueued so far are kept, client retries the rest
+		logging.FromContext(req.Context()).Error(errors.Wrap(err, "failed to enqueue notification"))
+		return internalErrorResult()
+	}
+
+	return &types.BulkSMSResult{Status: receipt.Status, Receipt: receipt}
+}
+
+// internalErrorResult returns result of bulk message failed for the reason client can retry it
+func internalErrorResult() *types.BulkSMSResult {
+	return &types.BulkSMSResult{Status: bulkStatusFailed, Error: "Internal error", Code: types.ErrorCodeInternal}
+}
+
+// rejectedResult returns result of bulk message failed validation
+func rejectedResult(fieldErrors []*types.FieldError) *types.BulkSMSResult {
+	return &types.BulkSMSResult{
+		Status: bulkStatusRejected,
+		Error:  fieldErrors[0].Message,
+		Code:   types.ErrorCodeValidationFailed,
+		Errors: fieldErrors,
+	}
+}
@@ -2,6 +2,8 @@ package server_test
 
 import (
 	"context"
+	"encoding/json"
+	"github.com/arkadyb/demo_messenger/internal/messenger"
 	"github.com/arkadyb/demo_messenger/internal/server"
 	"github.com/arkadyb/demo_messenger/internal/types"
 	"github.com/pkg/errors"
@@ -17,11 +19,15 @@ type MockedApplication struct {
 	mock.Mock
 }
 
-func (ma *MockedApplication) EnqueueSMS(ctx context.Context, sms *types.SMS) (err error) {
+func (ma *MockedApplication) EnqueueSMS(ctx context.Context, sms *types.SMS) (receipt *types.SMSReceipt, err error) {
 	args := ma.Called(ctx, sms)
 
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
 	if args.Get(0) != nil {
-		err = args.Error(0)
+		receipt = args.Get(0).(*types.SMSReceipt)
 	}
 
 	return
@@ -43,7 +49,7 @@ func TestSendSMSHandler(t *testing.T) {
 			args{
 				func() *MockedApplication {
 					app := &MockedApplication{}
-					app.On("EnqueueSMS", mock.Anything, mock.Anything).Return(nil)
+					app.On("EnqueueSMS", mock.Anything, mock.Anything).Return(&types.SMSReceipt{Status: "accepted"}, nil)
 					return app
 				},
 			},
@@ -75,7 +81,7 @@ func TestSendSMSHandler(t *testing.T) {
 			args{
 				func() *MockedApplication {
 					app := &MockedApplication{}
-					app.On("EnqueueSMS", mock.Anything, mock.Anything).Return(errors.New("error"))
+					app.On("EnqueueSMS", mock.Anything, mock.Anything).Return(nil, errors.New("error"))
 					return app
 				},
 			},
@@ -112,6 +118,50 @@ func TestSendSMSHandler(t *testing.T) {
 			`{"recipient": "", "originator":"originator", "message":"message"}`,
 			http.StatusBadRequest,
 		},
+		{
+			"Template",
+			args{
+				func() *MockedApplication {
+					app := &MockedApplication{}
+					app.On("EnqueueSMS", mock.Anything, mock.Anything).Return(&types.SMSReceipt{Status: "accepted"}, nil)
+					return app
+				},
+			},
+			`{"recipient": "12345", "originator":"originator", "template_id":"welcome", "variables":{"name":"John"}}`,
+			http.StatusAccepted,
+		},
+		{
+			"No message or template",
+			args{
+				func() *MockedApplication {
+					return nil
+				},
+			},
+			`{"recipient": "12345", "originator":"originator"}`,
+			http.StatusBadRequest,
+		},
+		{
+			"Both message and template",
+			args{
+				func() *MockedApplication {
+					return nil
+				},
+			},
+			`{"recipient": "12345", "originator":"originator", "message":"message", "template_id":"welcome"}`,
+			http.StatusBadRequest,
+		},
+		{
+			"Invalid rendered template",
+			args{
+				func() *MockedApplication {
+					app := &MockedApplication{}
+					app.On("EnqueueSMS", mock.Anything, mock.Anything).Return(nil, &messenger.InvalidSMSError{Reason: "missing template variables: name"})
+					return app
+				},
+			},
+			`{"recipient": "12345", "originator":"originator", "template_id":"welcome"}`,
+			http.StatusBadRequest,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -125,3 +175,252 @@ func TestSendSMSHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestSendSMSHandler_Problem(t *testing.T) {
+	tests := []struct {
+		name            string
+		app             func() *MockedApplication
+		contentType     string
+		reqBody         string
+		expectedProblem *types.Problem
+	}{
+		{
+			"Malformed body",
+			func() *MockedApplication { return nil },
+			"",
+			`{"recipient": `,
+			&types.Problem{Type: "about:blank", Title: "Bad Request", Status: http.StatusBadRequest, Detail: "Request body is not valid JSON", Instance: "/v1/send/sms", Code: types.ErrorCodeMalformedBody},
+		},
+		{
+			"Trailing data",
+			func() *MockedApplication { return nil },
+			"application/json",
+			`{"recipient": "12345", "originator":"originator", "message":"message"} {}`,
+			&types.Problem{Type: "about:blank", Title: "Bad Request", Status: http.StatusBadRequest, Detail: "Request body is not valid JSON", Instance: "/v1/send/sms", Code: types.ErrorCodeMalformedBody},
+		},
+		{
+			"Unsupported content type",
+			func() *MockedApplication { return nil },
+			"application/x-www-form-urlencoded",
+			`recipient=12345`,
+			&types.Problem{Type: "about:blank", Title: "Unsupported Media Type", Status: http.StatusUnsupportedMediaType, Detail: "Content type application/x-www-form-urlencoded is not supported, use application/json", Instance: "/v1/send/sms", Code: types.ErrorCodeUnsupportedMedia},
+		},
+		{
+			"Unsupported charset",
+			func() *MockedApplication { return nil },
+			"application/json; charset=iso-8859-1",
+			`{"recipient": "12345", "originator":"originator", "message":"message"}`,
+			&types.Problem{Type: "about:blank", Title: "Unsupported Media Type", Status: http.StatusUnsupportedMediaType, Detail: "Charset iso-8859-1 is not supported, use utf-8", Instance: "/v1/send/sms", Code: types.ErrorCodeUnsupportedMedia},
+		},
+		{
+			"Invalid fields",
+			func() *MockedApplication { return nil },
+			"application/json; charset=UTF-8",
+			`{"message": "message", "template_id": "welcome", "priority": "urgent"}`,
+			&types.Problem{
+				Type:     "about:blank",
+				Title:    "Bad Request",
+				Status:   http.StatusBadRequest,
+				Detail:   "recipient is required; originator is required; template_id cant be used together with message; priority must be one of low, normal, high",
+				Instance: "/v1/send/sms",
+				Code:     types.ErrorCodeValidationFailed,
+				Errors: []*types.FieldError{
+					{Field: "recipient", Code: types.FieldErrorCodeRequired, Message: "recipient is required"},
+					{Field: "originator", Code: types.FieldErrorCodeRequired, Message: "originator is required"},
+					{Field: "template_id", Code: types.FieldErrorCodeConflict, Message: "template_id cant be used together with message"},
+					{Field: "priority", Code: types.FieldErrorCodeInvalid, Message: "priority must be one of low, normal, high"},
+				},
+			},
+		},
+		{
+			"Unknown fields are reported with invalid ones",
+			func() *MockedApplication { return nil },
+			"",
+			`{"recipents": "12345", "originator":"originator", "message":"message", "Variables": {"name": "Bob"}, "sender": "me"}`,
+			&types.Problem{
+				Type:     "about:blank",
+				Title:    "Bad Request",
+				Status:   http.StatusBadRequest,
+				Detail:   "recipents is not a known field; sender is not a known field; recipient is required",
+				Instance: "/v1/send/sms",
+				Code:     types.ErrorCodeValidationFailed,
+				Errors: []*types.FieldError{
+					{Field: "recipents", Code: types.FieldErrorCodeUnknown, Message: "recipents is not a known field"},
+					{Field: "sender", Code: types.FieldErrorCodeUnknown, Message: "sender is not a known field"},
+					{Field: "recipient", Code: types.FieldErrorCodeRequired, Message: "recipient is required"},
+				},
+			},
+		},
+		{
+			"Invalid field type",
+			func() *MockedApplication { return nil },
+			"",
+			`{"recipient": 12345, "originator":"originator", "message":"message"}`,
+			&types.Problem{
+				Type:     "about:blank",
+				Title:    "Bad Request",
+				Status:   http.StatusBadRequest,
+				Detail:   "recipient must be string, not number",
+				Instance: "/v1/send/sms",
+				Code:     types.ErrorCodeValidationFailed,
+				Errors: []*types.FieldError{
+					{Field: "recipient", Code: types.FieldErrorCodeInvalid, Message: "recipient must be string, not number"},
+				},
+			},
+		},
+		{
+			"Unknown fields are reported with invalid field type",
+			func() *MockedApplication { return nil },
+			"",
+			`{"recipient": 12345, "originator":"originator", "message":"message", "sender": "me"}`,
+			&types.Problem{
+				Type:     "about:blank",
+				Title:    "Bad Request",
+				Status:   http.StatusBadRequest,
+				Detail:   "sender is not a known field; recipient must be string, not number",
+				Instance: "/v1/send/sms",
+				Code:     types.ErrorCodeValidationFailed,
+				Errors: []*types.FieldError{
+					{Field: "sender", Code: types.FieldErrorCodeUnknown, Message: "sender is not a known field"},
+					{Field: "recipient", Code: types.FieldErrorCodeInvalid, Message: "recipient must be string, not number"},
+				},
+			},
+		},
+		{
+			"Rejected message",
+			func() *MockedApplication {
+				app := &MockedApplication{}
+				app.On("EnqueueSMS", mock.Anything, mock.Anything).Return(nil, &messenger.InvalidSMSError{Reason: "recipient 12345 is suppressed"})
+				return app
+			},
+			"application/json",
+			`{"recipient": "12345", "originator":"originator", "message":"message"}`,
+			&types.Problem{Type: "about:blank", Title: "Bad Request", Status: http.StatusBadRequest, Detail: "recipient 12345 is suppressed", Instance: "/v1/send/sms", Code: types.ErrorCodeMessageRejected},
+		},
+		{
+			"Internal error is not exposed",
+			func() *MockedApplication {
+				app := &MockedApplication{}
+				app.On("EnqueueSMS", mock.Anything, mock.Anything).Return(nil, errors.New("pq: connection refused"))
+				return app
+			},
+			"application/json",
+			`{"recipient": "12345", "originator":"originator", "message":"message"}`,
+			&types.Problem{Type: "about:blank", Title: "Internal Server Error", Status: http.StatusInternalServerError, Detail: "Internal server error", Instance: "/v1/send/sms", Code: types.ErrorCodeInternal},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://fake-url/v1/send/sms", strings.NewReader(tt.reqBody))
+			if len(tt.contentType) > 0 {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			server.SendSMSHandler(tt.app()).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedProblem.Status, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			problem := &types.Problem{}
+			if !assert.NoError(t, json.NewDecoder(w.Body).Decode(problem)) {
+				t.FailNow()
+			}
+			assert.Equal(t, tt.expectedProblem, problem)
+		})
+	}
+}
+
+func TestBulkSendSMSHandler(t *testing.T) {
+	tests := []struct {
+		name               string
+		app                func() *MockedApplication
+		reqBody            string
+		expectedStatusCode int
+		expectedStatuses   []string
+	}{
+		{
+			"Success",
+			func() *MockedApplication {
+				app := &MockedApplication{}
+				app.On("EnqueueSMS", mock.Anything, mock.Anything).Return(&types.SMSReceipt{Status: "accepted"}, nil)
+				return app
+			},
+			`{"messages": [{"recipient": "1", "originator":"originator", "message":"message"}, {"recipient": "2", "originator":"originator", "message":"message"}]}`,
+			http.StatusMultiStatus,
+			[]string{"accepted", "accepted"},
+		},
+		{
+			"Partial failure",
+			func() *MockedApplication {
+				app := &MockedApplication{}
+				app.On("EnqueueSMS", mock.Anything, mock.MatchedBy(func(sms *types.SMS) bool { return sms.Recipient == "1" })).Return(&types.SMSReceipt{Status: "accepted"}, nil)
+				app.On("EnqueueSMS", mock.Anything, mock.MatchedBy(func(sms *types.SMS) bool { return sms.Recipient == "2" })).Return(nil, &messenger.InvalidSMSError{Reason: "recipient 2 is suppressed"})
+				app.On("EnqueueSMS", mock.Anything, mock.MatchedBy(func(sms *types.SMS) bool { return sms.Recipient == "3" })).Return(nil, errors.New("error"))
+				return app
+			},
+			`{"messages": [{"recipient": "1", "originator":"originator", "message":"message"}, {"recipient": "2", "originator":"originator", "message":"message"}, {"recipient": "3", "originator":"originator", "message":"message"}, {"recipient": "", "originator":"originator", "message":"message"}]}`,
+			http.StatusMultiStatus,
+			[]string{"accepted", "rejected", "failed", "rejected"},
+		},
+		{
+			"Bad Input",
+			func() *MockedApplication {
+				return nil
+			},
+			`{"messages": [`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"No messages",
+			func() *MockedApplication {
+				return nil
+			},
+			`{"messages": []}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"Too many messages",
+			func() *MockedApplication {
+				return nil
+			},
+			`{"messages": [{"recipient": "1", "originator":"originator", "message":"message"}, {"recipient": "2", "originator":"originator", "message":"message"}, {"recipient": "3", "originator":"originator", "message":"message"}, {"recipient": "4", "originator":"originator", "message":"message"}, {"recipient": "5", "originator":"originator", "message":"message"}]}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"Unknown field of message",
+			func() *MockedApplication {
+				return nil
+			},
+			`{"messages": [{"recipient": "1", "originator":"originator", "message":"message"}, {"recipents": "2", "originator":"originator", "message":"message"}]}`,
+			http.StatusBadRequest,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://fake-url", strings.NewReader(tt.reqBody))
+			w := httptest.NewRecorder()
+
+			server.BulkSendSMSHandler(tt.app(), 4).ServeHTTP(w, req)
+			if !assert.Equal(t, tt.expectedStatusCode, w.Code) {
+				t.FailNow()
+			}
+
+			if tt.expectedStatuses != nil {
+				response := &types.BulkSMSResponse{}
+				if !assert.NoError(t, json.NewDecoder(w.Body).Decode(response)) {
+					t.FailNow()
+				}
+
+				var statuses []string
+				for _, result := range response.Results {
+					statuses = append(statuses, result.Status)
+				}
+				assert.Equal(t, tt.expectedStatuses, statuses)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/templates"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+// SaveTemplateHandler, implements http.Handler for POST /v1/templates/{template_id} route
+func SaveTemplateHandler(store templates.Store) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		var (
+			templateID = mux.Vars(req)["template_id"]
+			body       = struct {
+				Locale string `json:"locale"`
+				Body   string `json:"body" validate:"required"`
+			}{}
+		)
+
+		fieldErrors, ok := decodeRequest(writer, req, &body)
+		if !ok {
+			return
+		}
+
+		if len(templateID) == 0 {
+			fieldErrors = append(fieldErrors, &types.FieldError{Field: "template_id", Code: types.FieldErrorCodeRequired, Message: "template_id is required"})
+		}
+
+		// locale is checked once normalized, blank locale normalizes to empty one
+		locale := templates.NormalizeLocale(body.Locale)
+		if len(locale) == 0 {
+			fieldErrors = append(fieldErrors, &types.FieldError{Field: "locale", Code: types.FieldErrorCodeRequired, Message: "locale is required"})
+		}
+
+		if len(fieldErrors) > 0 {
+			writeValidationProblem(writer, req, fieldErrors)
+			return
+		}
+
+		tmpl, err := store.SaveTemplate(req.Context(), templateID, locale, body.Body)
+		if err != nil {
+			writeInternalError(writer, req, errors.Wrap(err, "failed to save template"))
+			return
+		}
+
+		writeJSON(writer, http.StatusCreated, tmpl)
+	})
+}
+
+// GetTemplateHandler, implements http.Handler for GET /v1/templates/{template_id} route
+func GetTemplateHandler(store templates.Store) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		var (
+			templateID = mux.Vars(req)["template_id"]
+			locale     = templates.NormalizeLocale(req.URL.Query().Get("locale"))
+			version    = 0
+			err        error
+		)
+
+		var fieldErrors []*types.FieldError
+		if len(locale) == 0 {
+			fieldErrors = append(fieldErrors, &types.FieldError{Field: "locale", Code: types.FieldErrorCodeRequired, Message: "Template locale required"})
+		}
+
+		if v := req.URL.Query().Get("version"); len(v) > 0 {
+			if version, err = strconv.Atoi(v); err != nil || version < 1 {
+				fieldErrors = append(fieldErrors, &types.FieldError{Field: "version", Code: types.FieldErrorCodeInvalid, Message: "Invalid template version"})
+			}
+		}
+
+		if len(fieldErrors) > 0 {
+			writeValidationProblem(writer, req, fieldErrors)
+			return
+		}
+
+		tmpl, err := store.GetTemplate(req.Context(), templateID, locale, version)
+		if err == templates.ErrTemplateNotFound {
+			writeProblem(writer, req, http.StatusNotFound, types.ErrorCodeNotFound, fmt.Sprintf("Template %s not found", templateID))
+			return
+		}
+		if err != nil {
+			writeInternalError(writer, req, errors.Wrap(err, "failed to get template"))
+			return
+		}
+
+		writeJSON(writer, http.StatusOK, tmpl)
+	})
+}
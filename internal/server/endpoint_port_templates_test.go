@@ -0,0 +1,207 @@
+package server_test
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/templates"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type MockedTemplates struct {
+	mock.Mock
+}
+
+func (mt *MockedTemplates) GetTemplate(ctx context.Context, templateID, locale string, version int) (tmpl *templates.Template, err error) {
+	args := mt.Called(ctx, templateID, locale, version)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	if args.Get(0) != nil {
+		tmpl = args.Get(0).(*templates.Template)
+	}
+
+	return
+}
+
+func (mt *MockedTemplates) SaveTemplate(ctx context.Context, templateID, locale, body string) (tmpl *templates.Template, err error) {
+	args := mt.Called(ctx, templateID, locale, body)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	if args.Get(0) != nil {
+		tmpl = args.Get(0).(*templates.Template)
+	}
+
+	return
+}
+
+func TestSaveTemplateHandler(t *testing.T) {
+	type args struct {
+		store func() *MockedTemplates
+	}
+	tests := []struct {
+		name               string
+		args               args
+		reqBody            string
+		expectedStatusCode int
+	}{
+		{
+			"Success",
+			args{
+				func() *MockedTemplates {
+					store := &MockedTemplates{}
+					store.On("SaveTemplate", mock.Anything, "welcome", "de-AT", "Hi {{name}}").Return(&templates.Template{TemplateID: "welcome", Version: 1, Body: "Hi {{name}}"}, nil)
+					return store
+				},
+			},
+			`{"locale": "de_at", "body": "Hi {{name}}"}`,
+			http.StatusCreated,
+		},
+		{
+			"Bad Input",
+			args{
+				func() *MockedTemplates {
+					return nil
+				},
+			},
+			`{"body": "Hi`,
+			http.StatusBadRequest,
+		},
+		{
+			"No locale",
+			args{
+				func() *MockedTemplates {
+					return nil
+				},
+			},
+			`{"body": "Hi {{name}}"}`,
+			http.StatusBadRequest,
+		},
+		{
+			"Empty body",
+			args{
+				func() *MockedTemplates {
+					return nil
+				},
+			},
+			`{"locale": "de-AT", "body": ""}`,
+			http.StatusBadRequest,
+		},
+		{
+			"Failed to save template",
+			args{
+				func() *MockedTemplates {
+					store := &MockedTemplates{}
+					store.On("SaveTemplate", mock.Anything, "welcome", "de-AT", "Hi {{name}}").Return(nil, errors.New("error"))
+					return store
+				},
+			},
+			`{"locale": "de_at", "body": "Hi {{name}}"}`,
+			http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://fake-url/v1/templates/welcome", strings.NewReader(tt.reqBody))
+			req = mux.SetURLVars(req, map[string]string{"template_id": "welcome"})
+			w := httptest.NewRecorder()
+
+			server.SaveTemplateHandler(tt.args.store()).ServeHTTP(w, req)
+			if !assert.Equal(t, tt.expectedStatusCode, w.Code) {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestGetTemplateHandler(t *testing.T) {
+	type args struct {
+		store func() *MockedTemplates
+	}
+	tests := []struct {
+		name               string
+		args               args
+		query              string
+		expectedStatusCode int
+	}{
+		{
+			"Latest version",
+			args{
+				func() *MockedTemplates {
+					store := &MockedTemplates{}
+					store.On("GetTemplate", mock.Anything, "welcome", "en", 0).Return(&templates.Template{TemplateID: "welcome", Version: 2, Body: "Hi {{name}}"}, nil)
+					return store
+				},
+			},
+			"?locale=en",
+			http.StatusOK,
+		},
+		{
+			"Specific version",
+			args{
+				func() *MockedTemplates {
+					store := &MockedTemplates{}
+					store.On("GetTemplate", mock.Anything, "welcome", "en", 1).Return(&templates.Template{TemplateID: "welcome", Version: 1, Body: "Hi {{name}}"}, nil)
+					return store
+				},
+			},
+			"?locale=en&version=1",
+			http.StatusOK,
+		},
+		{
+			"Invalid version",
+			args{
+				func() *MockedTemplates {
+					return nil
+				},
+			},
+			"?locale=en&version=abc",
+			http.StatusBadRequest,
+		},
+		{
+			"Not found",
+			args{
+				func() *MockedTemplates {
+					store := &MockedTemplates{}
+					store.On("GetTemplate", mock.Anything, "welcome", "en", 0).Return(nil, templates.ErrTemplateNotFound)
+					return store
+				},
+			},
+			"?locale=en",
+			http.StatusNotFound,
+		},
+		{
+			"No locale",
+			args{
+				func() *MockedTemplates {
+					return nil
+				},
+			},
+			"",
+			http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://fake-url/v1/templates/welcome"+tt.query, nil)
+			req = mux.SetURLVars(req, map[string]string{"template_id": "welcome"})
+			w := httptest.NewRecorder()
+
+			server.GetTemplateHandler(tt.args.store()).ServeHTTP(w, req)
+			if !assert.Equal(t, tt.expectedStatusCode, w.Code) {
+				t.Fail()
+			}
+		})
+	}
+}
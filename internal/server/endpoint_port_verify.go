@@ -0,0 +1,76 @@
+package server
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/messenger"
+	"github.com/arkadyb/demo_messenger/internal/pkg/verifications"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/arkadyb/demo_messenger/internal/verifier"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// StartVerificationHandler, implements http.Handler for /v1/verify route
+func StartVerificationHandler(app verifier.Application) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		var (
+			verificationReq = &types.VerificationRequest{}
+		)
+
+		fieldErrors, ok := decodeRequest(writer, req, verificationReq)
+		if !ok {
+			return
+		}
+		if len(fieldErrors) > 0 {
+			writeValidationProblem(writer, req, fieldErrors)
+			return
+		}
+
+		verification, err := app.StartVerification(req.Context(), verificationReq)
+		if err != nil {
+			if errors.Cause(err) == verifier.ErrPhoneNumberLocked {
+				writeProblem(writer, req, http.StatusTooManyRequests, types.ErrorCodeRecipientLocked, "Recipient is locked out")
+				return
+			}
+			if invalidErr, ok := errors.Cause(err).(*messenger.InvalidSMSError); ok {
+				writeProblem(writer, req, http.StatusBadRequest, types.ErrorCodeMessageRejected, invalidErr.Reason)
+				return
+			}
+
+			writeInternalError(writer, req, errors.Wrap(err, "failed to start verification"))
+			return
+		}
+
+		writeJSON(writer, http.StatusAccepted, verification)
+	})
+}
+
+// CheckVerificationHandler, implements http.Handler for /v1/verify/check route
+func CheckVerificationHandler(app verifier.Application) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		var (
+			check = &types.VerificationCheck{}
+		)
+
+		fieldErrors, ok := decodeRequest(writer, req, check)
+		if !ok {
+			return
+		}
+		if len(fieldErrors) > 0 {
+			writeValidationProblem(writer, req, fieldErrors)
+			return
+		}
+
+		result, err := app.CheckVerification(req.Context(), check)
+		if err != nil {
+			if errors.Cause(err) == verifications.ErrVerificationNotFound {
+				writeProblem(writer, req, http.StatusNotFound, types.ErrorCodeNotFound, "Verification not found")
+				return
+			}
+
+			writeInternalError(writer, req, errors.Wrap(err, "failed to check verification"))
+			return
+		}
+
+		writeJSON(writer, http.StatusOK, result)
+	})
+}
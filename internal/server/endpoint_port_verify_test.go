@@ -0,0 +1,186 @@
+package server_test
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/verifications"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/arkadyb/demo_messenger/internal/verifier"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type MockedVerifier struct {
+	mock.Mock
+}
+
+func (mv *MockedVerifier) StartVerification(ctx context.Context, req *types.VerificationRequest) (v *types.Verification, err error) {
+	args := mv.Called(ctx, req)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	if args.Get(0) != nil {
+		v = args.Get(0).(*types.Verification)
+	}
+
+	return
+}
+
+func (mv *MockedVerifier) CheckVerification(ctx context.Context, check *types.VerificationCheck) (res *types.VerificationResult, err error) {
+	args := mv.Called(ctx, check)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	if args.Get(0) != nil {
+		res = args.Get(0).(*types.VerificationResult)
+	}
+
+	return
+}
+
+func TestStartVerificationHandler(t *testing.T) {
+	type args struct {
+		app func() *MockedVerifier
+	}
+	tests := []struct {
+		name               string
+		args               args
+		reqBody            string
+		expectedStatusCode int
+	}{
+		{
+			"Success",
+			args{
+				func() *MockedVerifier {
+					app := &MockedVerifier{}
+					app.On("StartVerification", mock.Anything, mock.Anything).Return(&types.Verification{VerificationID: "id", Status: "pending"}, nil)
+					return app
+				},
+			},
+			`{"recipient": "12345", "originator":"originator"}`,
+			http.StatusAccepted,
+		},
+		{
+			"Bad Input",
+			args{
+				func() *MockedVerifier {
+					return nil
+				},
+			},
+			`{"recipient": "12345"`,
+			http.StatusBadRequest,
+		},
+		{
+			"No recipient",
+			args{
+				func() *MockedVerifier {
+					return nil
+				},
+			},
+			`{"recipient": "", "originator":"originator"}`,
+			http.StatusBadRequest,
+		},
+		{
+			"Locked out",
+			args{
+				func() *MockedVerifier {
+					app := &MockedVerifier{}
+					app.On("StartVerification", mock.Anything, mock.Anything).Return(nil, verifier.ErrPhoneNumberLocked)
+					return app
+				},
+			},
+			`{"recipient": "12345", "originator":"originator"}`,
+			http.StatusTooManyRequests,
+		},
+		{
+			"Failed to start verification",
+			args{
+				func() *MockedVerifier {
+					app := &MockedVerifier{}
+					app.On("StartVerification", mock.Anything, mock.Anything).Return(nil, errors.New("error"))
+					return app
+				},
+			},
+			`{"recipient": "12345", "originator":"originator"}`,
+			http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://fake-url", strings.NewReader(tt.reqBody))
+			w := httptest.NewRecorder()
+
+			server.StartVerificationHandler(tt.args.app()).ServeHTTP(w, req)
+			if !assert.Equal(t, tt.expectedStatusCode, w.Code) {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestCheckVerificationHandler(t *testing.T) {
+	type args struct {
+		app func() *MockedVerifier
+	}
+	tests := []struct {
+		name               string
+		args               args
+		reqBody            string
+		expectedStatusCode int
+	}{
+		{
+			"Approved",
+			args{
+				func() *MockedVerifier {
+					app := &MockedVerifier{}
+					app.On("CheckVerification", mock.Anything, &types.VerificationCheck{VerificationID: "id", Code: "123456"}).Return(&types.VerificationResult{VerificationID: "id", Status: "approved"}, nil)
+					return app
+				},
+			},
+			`{"verification_id": "id", "code":"123456"}`,
+			http.StatusOK,
+		},
+		{
+			"No code",
+			args{
+				func() *MockedVerifier {
+					return nil
+				},
+			},
+			`{"verification_id": "id"}`,
+			http.StatusBadRequest,
+		},
+		{
+			"Not found",
+			args{
+				func() *MockedVerifier {
+					app := &MockedVerifier{}
+					app.On("CheckVerification", mock.Anything, mock.Anything).Return(nil, verifications.ErrVerificationNotFound)
+					return app
+				},
+			},
+			`{"verification_id": "id", "code":"123456"}`,
+			http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://fake-url", strings.NewReader(tt.reqBody))
+			w := httptest.NewRecorder()
+
+			server.CheckVerificationHandler(tt.args.app()).ServeHTTP(w, req)
+			if !assert.Equal(t, tt.expectedStatusCode, w.Code) {
+				t.Fail()
+			}
+		})
+	}
+}
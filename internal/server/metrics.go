@@ -0,0 +1,50 @@
+package server
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/ratelimit"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+var (
+	httpRequestHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route, method and status code",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	rateLimiterDegradedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "rate_limiter_degraded",
+		Help: "Whether rate limiter store is unavailable and requests are limited with failure policy: 0 or 1",
+	})
+
+	rateLimiterDegradedRequestsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limiter_degraded_requests_total",
+		Help: "Number of requests limited with failure policy while rate limiter store is unavailable by outcome",
+	}, []string{"outcome"})
+
+	ipFilterDecisionsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ip_filter_decisions_total",
+		Help: "Number of requests allowed or denied by ip filter by reason",
+	}, []string{"decision", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(httpRequestHistogram, rateLimiterDegradedGauge, rateLimiterDegradedRequestsCounter, ipFilterDecisionsCounter)
+}
+
+// NewRateLimiterStatus creates status of rate limiters reporting degraded mode with metrics and logs
+func NewRateLimiterStatus(retryInterval time.Duration) *ratelimit.Status {
+	return ratelimit.NewStatus(retryInterval, func(degraded bool, err error) {
+		if degraded {
+			rateLimiterDegradedGauge.Set(1)
+			log.Error(errors.Wrap(err, "rate limiter store is unavailable, limiting requests with failure policy"))
+			return
+		}
+
+		rateLimiterDegradedGauge.Set(0)
+		log.Info("rate limiter store is available again")
+	})
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// AdminKeys maps hashed admin API keys to names of operators they belong to
+type AdminKeys map[string]string
+
+// ParseAdminKeys parses comma separated list of api_key=operator admin API keys, i.e. "secret=alice,other=bob"
+func ParseAdminKeys(spec string) (AdminKeys, error) {
+	keys := AdminKeys{}
+	for i, rule := range strings.Split(spec, ",") {
+		if rule = strings.TrimSpace(rule); len(rule) == 0 {
+			continue
+		}
+
+		// rule holds the key itself, so it is never included into errors
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 || len(strings.TrimSpace(parts[1])) == 0 {
+			return nil, fmt.Errorf("invalid admin api key #%d", i+1)
+		}
+		keys[tenants.HashAPIKey(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+	}
+
+	return keys, nil
+}
+
+type adminContextKey struct{}
+
+// AdminFromContext returns name of the operator authenticated for admin request
+func AdminFromContext(ctx context.Context) (string, bool) {
+	admin, ok := ctx.Value(adminContextKey{}).(string)
+	return admin, ok
+}
+
+// middleware handler authenticating admin requests with admin API keys, tenant API keys are not accepted.
+// Name of authenticated operator is placed into request context.
+func AdminAuthenticationMiddleware(keys AdminKeys) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			apiKey := apiKeyFromRequest(req)
+			if len(apiKey) == 0 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeProblem(w, req, http.StatusUnauthorized, types.ErrorCodeUnauthorized, "Admin API key required")
+				return
+			}
+
+			admin, ok := keys[tenants.HashAPIKey(apiKey)]
+			if !ok {
+				logging.FromContext(req.Context()).Warn("request with invalid admin API key")
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeProblem(w, req, http.StatusUnauthorized, types.ErrorCodeUnauthorized, "Invalid admin API key")
+				return
+			}
+
+			ctx := logging.WithFields(context.WithValue(req.Context(), adminContextKey{}, admin), log.Fields{"admin": admin})
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package server_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAdminKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    int
+		wantErr bool
+	}{
+		{"Empty", "", 0, false},
+		{"Keys", "secret=alice, other=bob", 2, false},
+		{"Missing operator", "secret=", 0, true},
+		{"Missing key", "=alice", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := server.ParseAdminKeys(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			assert.Len(t, keys, tt.want)
+		})
+	}
+}
+
+func TestAdminAuthenticationMiddleware(t *testing.T) {
+	keys, err := server.ParseAdminKeys("admin-secret=ops")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedStatus int
+		expectedAdmin  string
+	}{
+		{"API key header", map[string]string{"X-API-Key": "admin-secret"}, http.StatusOK, "ops"},
+		{"Bearer token", map[string]string{"Authorization": "Bearer admin-secret"}, http.StatusOK, "ops"},
+		{"Tenant API key", map[string]string{"X-API-Key": "secret"}, http.StatusUnauthorized, ""},
+		{"Anonymous", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://fake-url/v1/admin/messages", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+
+			var admin string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				admin, _ = server.AdminFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			server.AdminAuthenticationMiddleware(keys)(handler).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedAdmin, admin)
+		})
+	}
+}
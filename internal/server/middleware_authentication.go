@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// TenantFromContext returns tenant authenticated for the request
+func TenantFromContext(ctx context.Context) (*tenants.Tenant, bool) {
+	return tenants.FromContext(ctx)
+}
+
+// apiKeyFromRequest reads API key from X-API-Key header or from bearer token of Authorization header
+func apiKeyFromRequest(req *http.Request) string {
+	if apiKey := req.Header.Get("X-API-Key"); len(apiKey) > 0 {
+		return apiKey
+	}
+
+	authorization := req.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+
+	return ""
+}
+
+// middleware handler authenticating requests with API keys, authenticated tenant is placed into request context.
+// Requests without API key are served anonymously unless authentication is required.
+// Admin routes are authenticated with admin API keys by AdminAuthenticationMiddleware instead.
+func AuthenticationMiddleware(store tenants.Store, required bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			for _, skipPath := range []string{"/health", "/ready", "/metrics", "/openapi.json"} {
+				if req.URL.Path == skipPath {
+					next.ServeHTTP(w, req)
+					return
+				}
+			}
+			if strings.HasPrefix(req.URL.Path, adminPathPrefix) {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			apiKey := apiKeyFromRequest(req)
+			if len(apiKey) == 0 {
+				if required {
+					w.Header().Set("WWW-Authenticate", "Bearer")
+					writeProblem(w, req, http.StatusUnauthorized, types.ErrorCodeUnauthorized, "API key required")
+					return
+				}
+
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			tenant, err := store.GetTenantByAPIKey(req.Context(), apiKey)
+			if err == tenants.ErrTenantNotFound {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeProblem(w, req, http.StatusUnauthorized, types.ErrorCodeUnauthorized, "Invalid API key")
+				return
+			}
+			if err != nil {
+				writeInternalError(w, req, errors.Wrap(err, "failed to authenticate request"))
+				return
+			}
+
+			ctx := logging.WithFields(tenants.NewContext(req.Context(), tenant), log.Fields{"tenantID": tenant.TenantID})
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package server_test
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type MockedTenantsStore struct {
+	mock.Mock
+}
+
+func (m *MockedTenantsStore) GetTenantByAPIKey(ctx context.Context, apiKey string) (tenant *tenants.Tenant, err error) {
+	args := m.Called(ctx, apiKey)
+	if args.Get(0) != nil {
+		tenant = args.Get(0).(*tenants.Tenant)
+	}
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	return
+}
+
+func (m *MockedTenantsStore) GetTier(ctx context.Context, name string) (tier *tenants.Tier, err error) {
+	args := m.Called(ctx, name)
+	if args.Get(0) != nil {
+		tier = args.Get(0).(*tenants.Tier)
+	}
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	return
+}
+
+func TestAuthenticationMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		store          func() *MockedTenantsStore
+		required       bool
+		path           string
+		headers        map[string]string
+		expectedStatus int
+		expectedTenant string
+	}{
+		{
+			"API key header",
+			func() *MockedTenantsStore {
+				store := &MockedTenantsStore{}
+				store.On("GetTenantByAPIKey", mock.Anything, "secret").Return(&tenants.Tenant{TenantID: "acme", Tier: "gold"}, nil)
+				return store
+			},
+			true,
+			"/v1/send/sms",
+			map[string]string{"X-API-Key": "secret"},
+			http.StatusOK,
+			"acme",
+		},
+		{
+			"Bearer token",
+			func() *MockedTenantsStore {
+				store := &MockedTenantsStore{}
+				store.On("GetTenantByAPIKey", mock.Anything, "secret").Return(&tenants.Tenant{TenantID: "acme", Tier: "gold"}, nil)
+				return store
+			},
+			true,
+			"/v1/send/sms",
+			map[string]string{"Authorization": "Bearer secret"},
+			http.StatusOK,
+			"acme",
+		},
+		{
+			"Unknown API key",
+			func() *MockedTenantsStore {
+				store := &MockedTenantsStore{}
+				store.On("GetTenantByAPIKey", mock.Anything, "wrong").Return(nil, tenants.ErrTenantNotFound)
+				return store
+			},
+			false,
+			"/v1/send/sms",
+			map[string]string{"X-API-Key": "wrong"},
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"Store error",
+			func() *MockedTenantsStore {
+				store := &MockedTenantsStore{}
+				store.On("GetTenantByAPIKey", mock.Anything, "secret").Return(nil, errors.New("error"))
+				return store
+			},
+			false,
+			"/v1/send/sms",
+			map[string]string{"X-API-Key": "secret"},
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"Anonymous",
+			func() *MockedTenantsStore {
+				return &MockedTenantsStore{}
+			},
+			false,
+			"/v1/send/sms",
+			nil,
+			http.StatusOK,
+			"",
+		},
+		{
+			"Anonymous when required",
+			func() *MockedTenantsStore {
+				return &MockedTenantsStore{}
+			},
+			true,
+			"/v1/send/sms",
+			nil,
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"Health",
+			func() *MockedTenantsStore {
+				return &MockedTenantsStore{}
+			},
+			true,
+			"/health",
+			nil,
+			http.StatusOK,
+			"",
+		},
+		{
+			"Admin route",
+			func() *MockedTenantsStore {
+				return &MockedTenantsStore{}
+			},
+			true,
+			"/v1/admin/messages",
+			map[string]string{"X-API-Key": "admin-secret"},
+			http.StatusOK,
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://fake-url"+tt.path, nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+
+			var tenantID string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tenant, ok := server.TenantFromContext(r.Context()); ok {
+					tenantID = tenant.TenantID
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+
+			store := tt.store()
+			server.AuthenticationMiddleware(store, tt.required)(handler).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedTenant, tenantID)
+			store.AssertExpectations(t)
+		})
+	}
+}
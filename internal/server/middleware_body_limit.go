@@ -0,0 +1,48 @@
+package server
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+)
+
+// errBodyTooLarge is returned reading request body past the limit
+var errBodyTooLarge = errors.New("request body too large")
+
+// BodyLimitMiddleware returns middleware handler limiting size of request body to maxBytes.
+// Request declaring larger Content-Length is rejected before it is read, reading body past the limit
+// fails and handler responds with 413 then. Limit is not applied when maxBytes is not positive.
+func BodyLimitMiddleware(maxBytes int64) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		if maxBytes <= 0 {
+			return handler
+		}
+
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.ContentLength > maxBytes {
+				writeProblem(writer, request, http.StatusRequestEntityTooLarge, types.ErrorCodeBodyTooLarge, "Request body is too large")
+				return
+			}
+
+			request.Body = &limitedBody{ReadCloser: http.MaxBytesReader(writer, request.Body, maxBytes), limit: maxBytes}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// limitedBody replaces error of http.MaxBytesReader reading past the limit with errBodyTooLarge
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
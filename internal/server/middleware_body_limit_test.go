@@ -0,0 +1,66 @@
+package server_test
+
+import (
+	"encoding/json"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name               string
+		maxBytes           int64
+		reqBody            string
+		chunked            bool
+		expectedStatusCode int
+	}{
+		{"Body within limit", 16, `{"a":"b"}`, false, http.StatusOK},
+		{"Content length over limit", 4, `{"a":"b"}`, false, http.StatusRequestEntityTooLarge},
+		{"Chunked body over limit", 4, `{"a":"b"}`, true, http.StatusRequestEntityTooLarge},
+		{"Chunked body at limit", 9, `{"a":"b"}`, true, http.StatusOK},
+		{"No limit", 0, `{"a":"b"}`, false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+				if _, err := ioutil.ReadAll(req.Body); err != nil {
+					writer.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				writer.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("POST", "http://fake-url/v1/send/sms", strings.NewReader(tt.reqBody))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+
+			server.BodyLimitMiddleware(tt.maxBytes)(handler).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatusCode, w.Code)
+		})
+	}
+}
+
+func TestBodyLimitMiddleware_Handler(t *testing.T) {
+	req := httptest.NewRequest("POST", "http://fake-url/v1/send/sms", strings.NewReader(`{"recipient": "12345", "originator":"originator", "message":"message"}`))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+
+	server.BodyLimitMiddleware(32)(server.SendSMSHandler(nil)).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	problem := &types.Problem{}
+	if !assert.NoError(t, json.NewDecoder(w.Body).Decode(problem)) {
+		t.FailNow()
+	}
+	assert.Equal(t, types.ErrorCodeBodyTooLarge, problem.Code)
+}
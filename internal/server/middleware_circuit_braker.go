@@ -1,28 +1,142 @@
 package server
 
 import (
+	"bytes"
 	"fmt"
 	hrx "github.com/afex/hystrix-go/hystrix"
-	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/types"
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 	"net/http"
+	"sync"
 )
 
-// middleware handler for Hystrix implementing basic circuit breaker pattern
+// middleware handler for Hystrix implementing basic circuit breaker pattern.
+// Handler writes response into buffer, which is sent once handler returns, so handler outliving the timeout cant write to the connection.
+// Idempotency key of timed out request stays reserved until the handler returns and completes it with its response.
 func CircuitBreakerMiddleware(commandName string, config hrx.CommandConfig, next http.Handler) http.Handler {
 	hrx.ConfigureCommand(commandName, config)
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tw := &timeoutWriter{header: http.Header{}}
 		if err := hrx.Do(commandName, func() (err error) {
-			lrw := utils.NewStatusCodeRecorder(w)
-			next.ServeHTTP(lrw, req)
-			if lrw.StatusCode >= http.StatusInternalServerError {
+			next.ServeHTTP(tw, req)
+			timedOut, statusCode := tw.finish()
+			if timedOut {
+				if ir := idempotentRequestFromContext(req.Context()); ir != nil {
+					ir.finish(req.Context(), statusCode, tw.header.Get("Content-Type"), tw.body.Bytes())
+				}
+				return nil
+			}
+			if statusCode >= http.StatusInternalServerError {
 				return fmt.Errorf("internal server error with command %s", req.URL.Path)
 			}
 			return nil
 		}, nil); err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			log.Error(errors.Wrap(err, "circuit breaker error"))
+			logging.FromContext(req.Context()).Error(errors.Wrap(err, "circuit breaker error"))
+
+			switch {
+			case err == hrx.ErrTimeout:
+				if tw.timeout() {
+					if ir := idempotentRequestFromContext(req.Context()); ir != nil {
+						ir.handedOff = true
+					}
+					writeProblem(w, req, http.StatusServiceUnavailable, types.ErrorCodeTimeout, "Request timed out")
+					return
+				}
+				// handler has returned in the meantime
+			case tw.returned():
+				// handler has responded already
+			case err == hrx.ErrCircuitOpen:
+				writeProblem(w, req, http.StatusServiceUnavailable, types.ErrorCodeCircuitOpen, "Service is temporarily unavailable, retry later")
+				return
+			default:
+				writeProblem(w, req, http.StatusServiceUnavailable, types.ErrorCodeServiceUnavailable, "Too many concurrent requests, retry later")
+				return
+			}
 		}
+
+		tw.writeTo(w, req)
 	})
 }
+
+// timeoutWriter buffers response of the handler run by circuit breaker, response of handler which timed out is not sent
+type timeoutWriter struct {
+	header http.Header
+
+	mu         sync.Mutex
+	statusCode int
+	body       bytes.Buffer
+	finished   bool
+	timedOut   bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.statusCode != 0 {
+		return
+	}
+	tw.statusCode = statusCode
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.statusCode == 0 {
+		tw.statusCode = http.StatusOK
+	}
+	return tw.body.Write(data)
+}
+
+// finish is called when handler returns, it tells if handler timed out and returns status code of its response
+func (tw *timeoutWriter) finish() (bool, int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.finished = true
+	if tw.statusCode == 0 {
+		// handler returned without writing response
+		return tw.timedOut, http.StatusOK
+	}
+	return tw.timedOut, tw.statusCode
+}
+
+// timeout marks handler still running as timed out, its response is not sent. False is returned when handler has returned in the meantime
+func (tw *timeoutWriter) timeout() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.finished {
+		return false
+	}
+	tw.timedOut = true
+	return true
+}
+
+// returned tells if handler has returned
+func (tw *timeoutWriter) returned() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	return tw.finished
+}
+
+// writeTo sends buffered response of returned handler
+func (tw *timeoutWriter) writeTo(w http.ResponseWriter, req *http.Request) {
+	for name, values := range tw.header {
+		w.Header()[name] = values
+	}
+	if tw.statusCode == 0 {
+		return
+	}
+	w.WriteHeader(tw.statusCode)
+	if _, err := w.Write(tw.body.Bytes()); err != nil {
+		logging.FromContext(req.Context()).Error(errors.Wrap(err, "failed to write response"))
+	}
+}
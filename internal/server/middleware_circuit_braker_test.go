@@ -47,6 +47,19 @@ func Test_circuitBreakerMiddleware(t *testing.T) {
 			2,
 			http.StatusInternalServerError,
 		},
+		{
+			"Timeout",
+			hystrix.CommandConfig{
+				Timeout: 100,
+			},
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(300 * time.Millisecond)
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("accepted"))
+			}),
+			1,
+			http.StatusServiceUnavailable,
+		},
 	}
 
 	for _, tt := range tests {
@@ -65,6 +78,8 @@ func Test_circuitBreakerMiddleware(t *testing.T) {
 			if !assert.Equal(t, tt.expectedStatusCode, w.Code) {
 				t.FailNow()
 			}
+			// response of handler outliving the timeout is discarded
+			assert.NotContains(t, w.Body.String(), "accepted")
 		})
 	}
 }
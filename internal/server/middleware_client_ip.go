@@ -0,0 +1,18 @@
+package server
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// middleware handler resolving client IP of the request, forwarding headers are only trusted when
+// request comes from trusted proxy. Resolved IP is read with utils.GetRequestIPAddress.
+func ClientIPMiddleware(proxies *utils.TrustedProxies) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := utils.ContextWithClientIP(req.Context(), proxies.ClientIP(req))
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/idempotency"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	// idempotencyKeyHeader carries client's key of the request
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader is set on responses replayed for repeated requests
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyMiddleware returns middleware handler replaying response of completed request for repeated requests with the same
+// Idempotency-Key header, so clients can retry sending without enqueueing messages twice. Keys are scoped by tenant, or by client IP
+// of anonymous requests. Server errors, rate limited responses and bulk responses with failed messages are not stored,
+// request failed with them is executed again when retried. Request timed out in circuit breaker keeps the key until its handler returns.
+// Requests without the key, and every request when store is nil, go to the handler as they are.
+func IdempotencyMiddleware(store idempotency.Store) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		if store == nil {
+			return handler
+		}
+
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			key := request.Header.Get(idempotencyKeyHeader)
+			if len(key) == 0 {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				writeValidationProblem(writer, request, []*types.FieldError{{Field: idempotencyKeyHeader, Code: types.FieldErrorCodeTooLong, Message: fmt.Sprintf("%s cant be longer than %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength)}})
+				return
+			}
+
+			body, err := ioutil.ReadAll(request.Body)
+			if err != nil {
+				if errors.Cause(err) == errBodyTooLarge {
+					writeProblem(writer, request, http.StatusRequestEntityTooLarge, types.ErrorCodeBodyTooLarge, "Request body is too large")
+					return
+				}
+				logging.FromContext(request.Context()).Error(errors.Wrap(err, "failed to read request body"))
+				writeProblem(writer, request, http.StatusBadRequest, types.ErrorCodeMalformedBody, "Request body cant be read")
+				return
+			}
+			request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			scope := "ip:" + utils.GetRequestIPAddress(request)
+			if tenant, ok := TenantFromContext(request.Context()); ok {
+				scope = "tenant:" + tenant.TenantID
+			}
+			fingerprint := sha256.Sum256(append([]byte(request.Method+" "+request.URL.Path+"\n"), body...))
+
+			stored, err := store.Begin(request.Context(), scope, key, hex.EncodeToString(fingerprint[:]))
+			switch errors.Cause(err) {
+			case nil:
+			case idempotency.ErrRequestInProgress:
+				writer.Header().Set("Retry-After", "1")
+				writeProblem(writer, request, http.StatusConflict, types.ErrorCodeIdempotencyConflict, fmt.Sprintf("Request with the same %s is in progress", idempotencyKeyHeader))
+				return
+			case idempotency.ErrKeyReused:
+				writeProblem(writer, request, http.StatusUnprocessableEntity, types.ErrorCodeIdempotencyKeyReused, fmt.Sprintf("%s was used with different request", idempotencyKeyHeader))
+				return
+			default:
+				writeInternalError(writer, request, errors.Wrap(err, "failed to check idempotency key"))
+				return
+			}
+
+			if stored != nil {
+				if len(stored.ContentType) > 0 {
+					writer.Header().Set("Content-Type", stored.ContentType)
+				}
+				writer.Header().Set(idempotentReplayedHeader, "true")
+				writer.WriteHeader(stored.StatusCode)
+				if _, err := writer.Write(stored.Body); err != nil {
+					logging.FromContext(request.Context()).Error(errors.Wrap(err, "failed to write replayed response"))
+				}
+				return
+			}
+
+			ir := &idempotentRequest{store: store, scope: scope, key: key}
+			recorder := &bodyRecorder{StatusCodeRecorder: utils.NewStatusCodeRecorder(writer)}
+			handler.ServeHTTP(recorder, request.WithContext(context.WithValue(request.Context(), idempotentRequestKey{}, ir)))
+			if ir.handedOff {
+				// handler is still running, it completes the key once it returns
+				return
+			}
+
+			statusCode := recorder.StatusCode
+			if statusCode == 0 {
+				// handler wrote body without calling WriteHeader
+				statusCode = http.StatusOK
+			}
+			ir.finish(request.Context(), statusCode, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		})
+	}
+}
+
+type idempotentRequestKey struct{}
+
+// idempotentRequest is the request holding idempotency key
+type idempotentRequest struct {
+	store idempotency.Store
+	scope string
+	key   string
+	// retryable is set by handler when response reports failures client retries, such response is not stored
+	retryable bool
+	// handedOff is set by circuit breaker when handler outlives the request, handler completes the key on its own
+	handedOff bool
+}
+
+// finish stores response of the request, or releases the key when request can be retried.
+// Outcome is stored even when client went away, retry of enqueued message must not enqueue it again.
+func (ir *idempotentRequest) finish(ctx context.Context, statusCode int, contentType string, body []byte) {
+	if statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests || ir.retryable {
+		if err := ir.store.Release(context.Background(), ir.scope, ir.key); err != nil {
+			logging.FromContext(ctx).Error(errors.Wrap(err, "failed to release idempotency key"))
+		}
+		return
+	}
+
+	err := ir.store.Complete(context.Background(), ir.scope, ir.key, &idempotency.Response{
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		Body:        body,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error(errors.Wrap(err, "failed to store response of idempotent request"))
+	}
+}
+
+// enqueueBulkMessage runs enqueue of the bulk message with given index once per key of the request. Result of the message stored
+// by earlier attempt of the request is returned as it is, so retry of partially failed request enqueues only messages failed before.
+func (ir *idempotentRequest) enqueueBulkMessage(ctx context.Context, index int, sms *types.SMS, enqueue func() *types.BulkSMSResult) *types.BulkSMSResult {
+	data, err := json.Marshal(sms)
+	if err != nil {
+		return ir.failedBulkMessage(ctx, errors.Wrap(err, "failed to encode bulk message"))
+	}
+	fingerprint := sha256.Sum256(data)
+	scope, key := ir.scope+"/messages", fmt.Sprintf("%s/%d", ir.key, index)
+
+	stored, err := ir.store.Begin(ctx, scope, key, hex.EncodeToString(fingerprint[:]))
+	if err != nil {
+		return ir.failedBulkMessage(ctx, errors.Wrapf(err, "failed to check idempotency key of message %d", index))
+	}
+	if stored != nil {
+		result := &types.BulkSMSResult{}
+		if err := json.Unmarshal(stored.Body, result); err != nil {
+			return ir.failedBulkMessage(ctx, errors.Wrapf(err, "failed to decode stored result of message %d", index))
+		}
+		return result
+	}
+
+	result := enqueue()
+	if result.Status == bulkStatusFailed {
+		ir.retryable = true
+		if err := ir.store.Release(context.Background(), scope, key); err != nil {
+			logging.FromContext(ctx).Error(errors.Wrap(err, "failed to release idempotency key of bulk message"))
+		}
+		return result
+	}
+
+	statusCode := http.StatusAccepted
+	if result.Receipt == nil {
+		statusCode = http.StatusBadRequest
+	}
+	if data, err = json.Marshal(result); err == nil {
+		err = ir.store.Complete(context.Background(), scope, key, &idempotency.Response{StatusCode: statusCode, ContentType: "application/json", Body: data})
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error(errors.Wrap(err, "failed to store result of bulk message"))
+	}
+	return result
+}
+
+func (ir *idempotentRequest) failedBulkMessage(ctx context.Context, err error) *types.BulkSMSResult {
+	logging.FromContext(ctx).Error(err)
+	ir.retryable = true
+	return internalErrorResult()
+}
+
+// idempotentRequestFromContext returns idempotent request of the context, nil is returned for request without idempotency key
+func idempotentRequestFromContext(ctx context.Context) *idempotentRequest {
+	ir, _ := ctx.Value(idempotentRequestKey{}).(*idempotentRequest)
+	return ir
+}
+
+// bodyRecorder records status code and body of the response written through it
+type bodyRecorder struct {
+	*utils.StatusCodeRecorder
+	body bytes.Buffer
+}
+
+func (rec *bodyRecorder) Write(data []byte) (int, error) {
+	rec.body.Write(data)
+	return rec.StatusCodeRecorder.Write(data)
+}
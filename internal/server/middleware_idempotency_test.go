@@ -0,0 +1,312 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/arkadyb/demo_messenger/internal/pkg/idempotency"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockedIdempotencyStore struct {
+	mock.Mock
+}
+
+func (m *MockedIdempotencyStore) Begin(ctx context.Context, scope, key, fingerprint string) (response *idempotency.Response, err error) {
+	args := m.Called(ctx, scope, key, fingerprint)
+	if args.Get(0) != nil {
+		response = args.Get(0).(*idempotency.Response)
+	}
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	return
+}
+
+func (m *MockedIdempotencyStore) Complete(ctx context.Context, scope, key string, response *idempotency.Response) error {
+	args := m.Called(ctx, scope, key, response)
+	return args.Error(0)
+}
+
+func (m *MockedIdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	args := m.Called(ctx, scope, key)
+	return args.Error(0)
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	accepted := &idempotency.Response{StatusCode: http.StatusAccepted, ContentType: "application/json", Body: []byte(`{"status":"accepted"}` + "\n")}
+
+	tests := []struct {
+		name               string
+		key                string
+		handlerStatusCode  int
+		store              func() *MockedIdempotencyStore
+		expectedStatusCode int
+		expectedCalls      int
+		expectedReplayed   string
+	}{
+		{
+			"Without key",
+			"",
+			http.StatusAccepted,
+			func() *MockedIdempotencyStore {
+				return &MockedIdempotencyStore{}
+			},
+			http.StatusAccepted, 1, "",
+		},
+		{
+			"Too long key",
+			strings.Repeat("k", 256),
+			http.StatusAccepted,
+			func() *MockedIdempotencyStore {
+				return &MockedIdempotencyStore{}
+			},
+			http.StatusBadRequest, 0, "",
+		},
+		{
+			"New key",
+			"key",
+			http.StatusAccepted,
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(nil, nil)
+				store.On("Complete", mock.Anything, "ip:192.0.2.1", "key", accepted).Return(nil)
+				return store
+			},
+			http.StatusAccepted, 1, "",
+		},
+		{
+			"Completed request",
+			"key",
+			http.StatusAccepted,
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(accepted, nil)
+				return store
+			},
+			http.StatusAccepted, 0, "true",
+		},
+		{
+			"Request in progress",
+			"key",
+			http.StatusAccepted,
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(nil, idempotency.ErrRequestInProgress)
+				return store
+			},
+			http.StatusConflict, 0, "",
+		},
+		{
+			"Key used with different request",
+			"key",
+			http.StatusAccepted,
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(nil, idempotency.ErrKeyReused)
+				return store
+			},
+			http.StatusUnprocessableEntity, 0, "",
+		},
+		{
+			"Failed request releases key",
+			"key",
+			http.StatusInternalServerError,
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(nil, nil)
+				store.On("Release", mock.Anything, "ip:192.0.2.1", "key").Return(nil)
+				return store
+			},
+			http.StatusInternalServerError, 1, "",
+		},
+		{
+			"Store error",
+			"key",
+			http.StatusAccepted,
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(nil, errors.New("error"))
+				return store
+			},
+			http.StatusInternalServerError, 0, "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+				calls++
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(tt.handlerStatusCode)
+				writer.Write([]byte(`{"status":"accepted"}` + "\n"))
+			})
+			store := tt.store()
+
+			req := httptest.NewRequest("POST", "http://fake-url/v1/send/sms", strings.NewReader(`{"recipient": "1"}`))
+			req.RemoteAddr = "192.0.2.1:1234"
+			if len(tt.key) > 0 {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+
+			server.IdempotencyMiddleware(store)(handler).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatusCode, w.Code)
+			assert.Equal(t, tt.expectedCalls, calls)
+			assert.Equal(t, tt.expectedReplayed, w.Header().Get("Idempotent-Replayed"))
+			store.AssertExpectations(t)
+		})
+	}
+}
+
+func TestIdempotencyMiddleware_Fingerprint(t *testing.T) {
+	var fingerprints []string
+	store := &MockedIdempotencyStore{}
+	store.On("Begin", mock.Anything, "ip:192.0.2.1", "key", mock.MatchedBy(func(fingerprint string) bool {
+		fingerprints = append(fingerprints, fingerprint)
+		return true
+	})).Return(nil, nil)
+	store.On("Complete", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(nil)
+
+	for _, body := range []string{`{"recipient": "1"}`, `{"recipient": "1"}`, `{"recipient": "2"}`} {
+		req := httptest.NewRequest("POST", "http://fake-url/v1/send/sms", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("Idempotency-Key", "key")
+
+		server.IdempotencyMiddleware(store)(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			writer.WriteHeader(http.StatusAccepted)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if !assert.Len(t, fingerprints, 3) {
+		t.FailNow()
+	}
+	assert.Equal(t, fingerprints[0], fingerprints[1])
+	assert.NotEqual(t, fingerprints[0], fingerprints[2])
+}
+
+func TestIdempotencyMiddleware_BulkSendSMS(t *testing.T) {
+	body := `{"messages": [{"recipient": "1", "originator": "originator", "message": "message"}, {"recipient": "2", "originator": "originator", "message": "message"}]}`
+	stored := &idempotency.Response{StatusCode: http.StatusAccepted, ContentType: "application/json", Body: []byte(`{"status":"accepted","receipt":{"status":"accepted"}}`)}
+
+	tests := []struct {
+		name            string
+		app             func() *MockedApplication
+		store           func() *MockedIdempotencyStore
+		expectedResults []string
+	}{
+		{
+			"Failed message releases the key",
+			func() *MockedApplication {
+				app := &MockedApplication{}
+				app.On("EnqueueSMS", mock.Anything, mock.MatchedBy(func(sms *types.SMS) bool { return sms.Recipient == "1" })).Return(&types.SMSReceipt{Status: "accepted"}, nil)
+				app.On("EnqueueSMS", mock.Anything, mock.MatchedBy(func(sms *types.SMS) bool { return sms.Recipient == "2" })).Return(nil, errors.New("pq: connection refused"))
+				return app
+			},
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(nil, nil)
+				store.On("Begin", mock.Anything, "ip:192.0.2.1/messages", "key/0", mock.Anything).Return(nil, nil)
+				store.On("Complete", mock.Anything, "ip:192.0.2.1/messages", "key/0", mock.Anything).Return(nil)
+				store.On("Begin", mock.Anything, "ip:192.0.2.1/messages", "key/1", mock.Anything).Return(nil, nil)
+				store.On("Release", mock.Anything, "ip:192.0.2.1/messages", "key/1").Return(nil)
+				store.On("Release", mock.Anything, "ip:192.0.2.1", "key").Return(nil)
+				return store
+			},
+			[]string{"accepted", "failed"},
+		},
+		{
+			"Retry enqueues only failed messages",
+			func() *MockedApplication {
+				app := &MockedApplication{}
+				app.On("EnqueueSMS", mock.Anything, mock.MatchedBy(func(sms *types.SMS) bool { return sms.Recipient == "2" })).Return(&types.SMSReceipt{Status: "scheduled"}, nil)
+				return app
+			},
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(nil, nil)
+				store.On("Begin", mock.Anything, "ip:192.0.2.1/messages", "key/0", mock.Anything).Return(stored, nil)
+				store.On("Begin", mock.Anything, "ip:192.0.2.1/messages", "key/1", mock.Anything).Return(nil, nil)
+				store.On("Complete", mock.Anything, "ip:192.0.2.1/messages", "key/1", mock.Anything).Return(nil)
+				store.On("Complete", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(nil)
+				return store
+			},
+			[]string{"accepted", "scheduled"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := tt.app()
+			store := tt.store()
+
+			req := httptest.NewRequest("POST", "http://fake-url/v1/send/sms/bulk", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", "key")
+			req.RemoteAddr = "192.0.2.1:1234"
+			w := httptest.NewRecorder()
+
+			server.IdempotencyMiddleware(store)(server.BulkSendSMSHandler(app, 10)).ServeHTTP(w, req)
+
+			if !assert.Equal(t, http.StatusMultiStatus, w.Code) {
+				t.FailNow()
+			}
+			response := &types.BulkSMSResponse{}
+			if !assert.NoError(t, json.NewDecoder(w.Body).Decode(response)) {
+				t.FailNow()
+			}
+			var results []string
+			for _, result := range response.Results {
+				results = append(results, result.Status)
+			}
+			assert.Equal(t, tt.expectedResults, results)
+			app.AssertExpectations(t)
+			store.AssertExpectations(t)
+		})
+	}
+}
+
+func TestIdempotencyMiddleware_Timeout(t *testing.T) {
+	completed := make(chan *idempotency.Response, 1)
+	store := &MockedIdempotencyStore{}
+	store.On("Begin", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(nil, nil)
+	store.On("Complete", mock.Anything, "ip:192.0.2.1", "key", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		completed <- args.Get(3).(*idempotency.Response)
+	})
+
+	handler := server.CircuitBreakerMiddleware("idempotent_timeout", hystrix.CommandConfig{Timeout: 100}, http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusAccepted)
+		writer.Write([]byte(`{"status":"accepted"}`))
+	}))
+
+	req := httptest.NewRequest("POST", "http://fake-url/v1/send/sms", strings.NewReader(`{"recipient": "1"}`))
+	req.Header.Set("Idempotency-Key", "key")
+	req.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+
+	server.IdempotencyMiddleware(store)(handler).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// key stays reserved until the handler returns, then it is completed with the late response
+	select {
+	case response := <-completed:
+		assert.Equal(t, http.StatusAccepted, response.StatusCode)
+		assert.Equal(t, `{"status":"accepted"}`, string(response.Body))
+	case <-time.After(3 * time.Second):
+		t.Error("idempotency key was not completed")
+	}
+	store.AssertExpectations(t)
+}
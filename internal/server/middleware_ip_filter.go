@@ -0,0 +1,43 @@
+package server
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/ipfilter"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// IPFilter decides whether client address is allowed to call the route
+type IPFilter interface {
+	Check(path string, ip string) ipfilter.Decision
+}
+
+// middleware handler rejecting requests from addresses denied for the route, every decision is logged and counted
+func IPFilterMiddleware(filter IPFilter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			clientIP := utils.GetRequestIPAddress(req)
+			decision := filter.Check(req.URL.Path, clientIP)
+
+			fields := log.Fields{
+				"requestIP":   clientIP,
+				"requestPath": req.URL.Path,
+				"reason":      decision.Reason,
+				"rule":        decision.Rule,
+			}
+			if !decision.Allowed {
+				ipFilterDecisionsCounter.WithLabelValues("denied", decision.Reason).Inc()
+				logging.FromContext(req.Context()).WithFields(fields).Warn("request denied by ip filter")
+				writeProblem(w, req, http.StatusForbidden, types.ErrorCodeForbidden, "Client address is not allowed to call the route")
+				return
+			}
+
+			ipFilterDecisionsCounter.WithLabelValues("allowed", decision.Reason).Inc()
+			logging.FromContext(req.Context()).WithFields(fields).Debug("request allowed by ip filter")
+			next.ServeHTTP(w, req)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package server_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/ipfilter"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFilterMiddleware(t *testing.T) {
+	filter, err := ipfilter.New([]ipfilter.Rule{{Path: "/v1/templates", Allow: []string{"10.0.0.0/8"}}})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		remoteAddr     string
+		expectedStatus int
+	}{
+		{"Allowed", "/v1/templates/welcome", "10.0.0.1:1234", http.StatusOK},
+		{"Denied", "/v1/templates/welcome", "198.51.100.1:1234", http.StatusForbidden},
+		{"Other route", "/v1/send/sms", "198.51.100.1:1234", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://fake-url"+tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			w := httptest.NewRecorder()
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			server.IPFilterMiddleware(filter)(handler).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
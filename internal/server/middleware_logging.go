@@ -1,6 +1,7 @@
 package server
 
 import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
 	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
 	log "github.com/sirupsen/logrus"
 	"net/http"
@@ -19,7 +20,7 @@ func LoggingMiddleware(handler http.Handler) http.Handler {
 		startTime := time.Now()
 		recorder := utils.NewStatusCodeRecorder(writer)
 		handler.ServeHTTP(recorder, request)
-		log.WithFields(log.Fields{
+		logging.FromContext(request.Context()).WithFields(log.Fields{
 			"elapsedTime": time.Since(startTime),
 			"requestIP":   utils.GetRequestIPAddress(request),
 			"requestPath": request.URL.Path,
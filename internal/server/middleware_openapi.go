@@ -0,0 +1,44 @@
+package server
+
+import (
+	"bytes"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/openapi"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+)
+
+// OpenAPIValidationMiddleware returns middleware handler validating requests against OpenAPI document, request
+// failing validation is rejected with every violation listed. Requests the document cant validate, i.e. of
+// undocumented route or with malformed body, are passed on to the handler to be rejected the usual way.
+func OpenAPIValidationMiddleware(doc *openapi.Document) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			body, err := ioutil.ReadAll(request.Body)
+			if err != nil {
+				if errors.Cause(err) == errBodyTooLarge {
+					writeProblem(writer, request, http.StatusRequestEntityTooLarge, types.ErrorCodeBodyTooLarge, "Request body is too large")
+					return
+				}
+				writeInternalError(writer, request, errors.Wrap(err, "failed to read request body"))
+				return
+			}
+			request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			violations, err := doc.ValidateRequest(request, body)
+			if err != nil {
+				logging.FromContext(request.Context()).Debug(errors.Wrap(err, "request was not validated against openapi document"))
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			if len(violations) > 0 {
+				writeValidationProblem(writer, request, fieldErrorsOf(violations, ""))
+				return
+			}
+
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
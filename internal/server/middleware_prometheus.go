@@ -1,12 +1,39 @@
 package server
 
 import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-// middleware handler for Prometheus
+// middleware handler for Prometheus, observes latency of requests by route template, method and status code
 func PrometheusMiddleware(handler http.Handler) http.Handler {
-	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handler)
+	instrumented := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handler)
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		startTime := time.Now()
+		recorder := utils.NewStatusCodeRecorder(writer)
+		instrumented.ServeHTTP(recorder, request)
+
+		statusCode := recorder.StatusCode
+		if statusCode == 0 {
+			// handler wrote body without calling WriteHeader
+			statusCode = http.StatusOK
+		}
+		httpRequestHistogram.WithLabelValues(routeTemplate(request), request.Method, strconv.Itoa(statusCode)).Observe(time.Since(startTime).Seconds())
+	})
+}
+
+// routeTemplate returns path template of the route request matched, so paths with variables share the label
+func routeTemplate(request *http.Request) string {
+	if route := mux.CurrentRoute(request); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
 }
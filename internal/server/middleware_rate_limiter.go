@@ -1,41 +1,143 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/ratelimit"
 	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/arkadyb/demo_messenger/internal/types"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+// RateLimiter counts requests of the key and returns its quota
 type RateLimiter interface {
-	Exceeded(string) (bool, error)
+	Take(key string, count int) (*ratelimit.Quota, error)
+	Limit() int
 }
 
-// middleware handler for rate limiter
-func RateLimitingMiddleware(rl RateLimiter) mux.MiddlewareFunc {
+// RateLimiters resolves rate limiter of the tier, bulk endpoints have limiters separate from regular ones
+type RateLimiters interface {
+	RateLimiter(ctx context.Context, tier string, bulk bool) (RateLimiter, error)
+}
+
+// middleware handler for rate limiter, authenticated requests are limited by tenant and its tier,
+// anonymous requests are limited by IP with default tier. Bulk limit is charged once per message of the request.
+// Quota of the client is reported with X-RateLimit-* headers,
+// limit of the tier is reported even when request fails before it is counted.
+func RateLimitingMiddleware(limiters RateLimiters, bulk bool) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			userIP := utils.GetRequestIPAddress(req)
-			if len(userIP) == 0 {
-				w.WriteHeader(http.StatusInternalServerError)
+			tenant, authenticated := TenantFromContext(req.Context())
+
+			var tier string
+			if authenticated {
+				tier = tenant.Tier
+			}
+			rl, err := limiters.RateLimiter(req.Context(), tier, bulk)
+			if err != nil {
+				writeInternalError(w, req, errors.Wrapf(err, "failed to get rate limiter of tier %q", tier))
 				return
 			}
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rl.Limit()))
+
+			var key string
+			if authenticated {
+				key = "tenant:" + tenant.TenantID
+			} else {
+				userIP := utils.GetRequestIPAddress(req)
+				if len(userIP) == 0 {
+					writeInternalError(w, req, errors.New("failed to resolve client IP"))
+					return
+				}
+				key = "ip:" + userIP
+			}
+			count, unit := 1, "requests"
+			if bulk {
+				key = "bulk:" + key
+				unit = "messages"
+
+				var ok bool
+				if count, ok = countBulkMessages(w, req, rl.Limit()); !ok {
+					return
+				}
+			}
 
-			exceeded, err := rl.Exceeded(userIP)
+			quota, err := rl.Take(key, count)
+			if err == ratelimit.ErrUnavailable {
+				// fail-closed policy, request cant be counted
+				rateLimiterDegradedRequestsCounter.WithLabelValues("rejected").Inc()
+				writeProblem(w, req, http.StatusServiceUnavailable, types.ErrorCodeServiceUnavailable, "Rate limiter is unavailable")
+				return
+			}
 			if err != nil {
-				logrus.Error(errors.Wrapf(err, "failed to get rate limits for user IP %s", userIP))
-				w.WriteHeader(http.StatusInternalServerError)
+				writeInternalError(w, req, errors.Wrapf(err, "failed to get rate limits for %s", key))
 				return
 			}
+			if quota.Degraded {
+				outcome := "allowed"
+				if quota.Exceeded {
+					outcome = "rejected"
+				}
+				rateLimiterDegradedRequestsCounter.WithLabelValues(outcome).Inc()
+			}
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(quota.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(quota.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(quota.Reset.Unix(), 10))
+
+			if quota.Exceeded {
+				logging.FromContext(req.Context()).Error(fmt.Errorf("%s limit exceeded for %s", unit, key))
 
-			if exceeded {
-				logrus.Error(fmt.Errorf("requests limit exceeded for ip %s", userIP))
-				w.WriteHeader(http.StatusTooManyRequests)
+				retryAfter := int(math.Ceil(time.Until(quota.Reset).Seconds()))
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				writeProblem(w, req, http.StatusTooManyRequests, types.ErrorCodeRateLimitExceeded, fmt.Sprintf("Rate limit of %d %s exceeded, retry in %d seconds", quota.Limit, unit, retryAfter))
 			} else {
 				next.ServeHTTP(w, req)
 			}
 		})
 	}
 }
+
+// countBulkMessages returns number of messages in body of the bulk request, body is kept for the handler.
+// Request which is not valid bulk request is counted as one message, handler rejects it then.
+// Problem details are written and false is returned when body cant be read or request has more messages
+// than the limit allows per period, such request is never allowed, so it is not counted.
+func countBulkMessages(w http.ResponseWriter, req *http.Request, limit int) (int, bool) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		if errors.Cause(err) == errBodyTooLarge {
+			writeProblem(w, req, http.StatusRequestEntityTooLarge, types.ErrorCodeBodyTooLarge, "Request body is too large")
+			return 0, false
+		}
+		logging.FromContext(req.Context()).Error(errors.Wrap(err, "failed to read request body"))
+		writeProblem(w, req, http.StatusBadRequest, types.ErrorCodeMalformedBody, "Request body cant be read")
+		return 0, false
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var bulk struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &bulk); err != nil || len(bulk.Messages) == 0 {
+		return 1, true
+	}
+
+	if len(bulk.Messages) > limit {
+		writeProblem(w, req, http.StatusRequestEntityTooLarge, types.ErrorCodeBodyTooLarge, fmt.Sprintf("Request has %d messages, rate limit allows at most %d messages per period", len(bulk.Messages), limit))
+		return 0, false
+	}
+
+	return len(bulk.Messages), true
+}
@@ -1,12 +1,18 @@
 package server_test
 
 import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/ratelimit"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
 	"github.com/arkadyb/demo_messenger/internal/server"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -15,10 +21,31 @@ type MockedRateLimiter struct {
 	mock.Mock
 }
 
-func (m *MockedRateLimiter) Exceeded(commandName string) (res bool, err error) {
-	args := m.Called(commandName)
+func (m *MockedRateLimiter) Take(key string, count int) (quota *ratelimit.Quota, err error) {
+	args := m.Called(key, count)
 	if args.Get(0) != nil {
-		res = args.Get(0).(bool)
+		quota = args.Get(0).(*ratelimit.Quota)
+	}
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	return
+}
+
+func (m *MockedRateLimiter) Limit() int {
+	return m.Called().Int(0)
+}
+
+type MockedRateLimiters struct {
+	mock.Mock
+}
+
+func (m *MockedRateLimiters) RateLimiter(ctx context.Context, tier string, bulk bool) (rl server.RateLimiter, err error) {
+	args := m.Called(ctx, tier, bulk)
+	if args.Get(0) != nil {
+		rl = args.Get(0).(server.RateLimiter)
 	}
 
 	if args.Get(1) != nil {
@@ -29,66 +56,273 @@ func (m *MockedRateLimiter) Exceeded(commandName string) (res bool, err error) {
 }
 
 func Test_rateLimitingMiddleware(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second)
+
 	type args struct {
 		rateLimiter func() *MockedRateLimiter
 	}
 	tests := []struct {
 		name           string
 		args           args
+		apiKey         string
+		remoteAddr     string
+		bulk           bool
 		handler        http.HandlerFunc
 		expectedStatus int
+		limit          int
 	}{
 		{
 			"Has capacity",
 			args{
 				func() *MockedRateLimiter {
 					rl := &MockedRateLimiter{}
-					rl.On("Exceeded", mock.Anything).Return(false, nil)
+					rl.On("Take", mock.Anything, 1).Return(&ratelimit.Quota{Limit: 10, Remaining: 9, Reset: reset}, nil)
 					return rl
 				},
 			},
+			"",
+			"192.0.2.1:1234",
+			false,
 			func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
 			},
 			http.StatusOK,
+			10,
 		},
 		{
 			"No capacity",
 			args{
 				func() *MockedRateLimiter {
 					rl := &MockedRateLimiter{}
-					rl.On("Exceeded", mock.Anything).Return(true, nil)
+					rl.On("Take", mock.Anything, 1).Return(&ratelimit.Quota{Limit: 10, Remaining: 0, Reset: reset, Exceeded: true}, nil)
 					return rl
 				},
 			},
+			"",
+			"192.0.2.1:1234",
+			false,
 			nil,
 			http.StatusTooManyRequests,
+			10,
 		},
 		{
 			"Error",
 			args{
 				func() *MockedRateLimiter {
 					rl := &MockedRateLimiter{}
-					rl.On("Exceeded", mock.Anything).Return(false, errors.New("error"))
+					rl.On("Take", mock.Anything, 1).Return(nil, errors.New("error"))
 					return rl
 				},
 			},
+			"",
+			"192.0.2.1:1234",
+			false,
 			nil,
 			http.StatusInternalServerError,
+			10,
+		},
+		{
+			"Unavailable",
+			args{
+				func() *MockedRateLimiter {
+					rl := &MockedRateLimiter{}
+					rl.On("Take", mock.Anything, 1).Return(nil, ratelimit.ErrUnavailable)
+					return rl
+				},
+			},
+			"",
+			"192.0.2.1:1234",
+			false,
+			nil,
+			http.StatusServiceUnavailable,
+			10,
+		},
+		{
+			"Tenant",
+			args{
+				func() *MockedRateLimiter {
+					rl := &MockedRateLimiter{}
+					rl.On("Take", "tenant:acme", 1).Return(&ratelimit.Quota{Limit: 10, Remaining: 9, Reset: reset}, nil)
+					return rl
+				},
+			},
+			"secret",
+			"192.0.2.1:1234",
+			false,
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			},
+			http.StatusOK,
+			10,
+		},
+		{
+			"Bulk tenant",
+			args{
+				func() *MockedRateLimiter {
+					rl := &MockedRateLimiter{}
+					rl.On("Take", "bulk:tenant:acme", 3).Return(&ratelimit.Quota{Limit: 10, Remaining: 0, Reset: reset, Exceeded: true}, nil)
+					return rl
+				},
+			},
+			"secret",
+			"192.0.2.1:1234",
+			true,
+			nil,
+			http.StatusTooManyRequests,
+			10,
+		},
+		{
+			"Bulk messages",
+			args{
+				func() *MockedRateLimiter {
+					rl := &MockedRateLimiter{}
+					rl.On("Take", "bulk:tenant:acme", 3).Return(&ratelimit.Quota{Limit: 10, Remaining: 7, Reset: reset}, nil)
+					return rl
+				},
+			},
+			"secret",
+			"192.0.2.1:1234",
+			true,
+			func(w http.ResponseWriter, r *http.Request) {
+				// body counted by rate limiter is kept for the handler
+				body, err := ioutil.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t, `{"messages": [{}, {}, {}]}`, string(body))
+				w.WriteHeader(http.StatusOK)
+			},
+			http.StatusOK,
+			10,
+		},
+		{
+			"Bulk over the limit",
+			args{
+				func() *MockedRateLimiter {
+					return &MockedRateLimiter{}
+				},
+			},
+			"secret",
+			"192.0.2.1:1234",
+			true,
+			nil,
+			http.StatusRequestEntityTooLarge,
+			2,
+		},
+		{
+			"Unknown client IP",
+			args{
+				func() *MockedRateLimiter {
+					return &MockedRateLimiter{}
+				},
+			},
+			"",
+			"",
+			false,
+			nil,
+			http.StatusInternalServerError,
+			10,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest("GET", "http://fake-url", nil)
+			req := httptest.NewRequest("POST", "http://fake-url", strings.NewReader(`{"messages": [{}, {}, {}]}`))
+			req.RemoteAddr = tt.remoteAddr
+			if len(tt.apiKey) > 0 {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
 			w := httptest.NewRecorder()
 
-			got := server.RateLimitingMiddleware(tt.args.rateLimiter())
-			got(http.HandlerFunc(tt.handler)).ServeHTTP(w, req)
+			tier := ""
+			if len(tt.apiKey) > 0 {
+				tier = "gold"
+			}
+			rl := tt.args.rateLimiter()
+			rl.On("Limit").Return(tt.limit)
+			limiters := &MockedRateLimiters{}
+			limiters.On("RateLimiter", mock.Anything, tier, tt.bulk).Return(rl, nil)
+
+			store, err := tenants.NewStaticStore("secret=acme:gold", "gold=10:1")
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+
+			got := server.AuthenticationMiddleware(store, false)(server.RateLimitingMiddleware(limiters, tt.bulk)(http.HandlerFunc(tt.handler)))
+			got.ServeHTTP(w, req)
 
 			time.Sleep(1 * time.Second)
 			if !assert.Equal(t, w.Code, tt.expectedStatus) {
 				t.FailNow()
 			}
+
+			// limit of the tier is known even when request is not counted
+			assert.Equal(t, strconv.Itoa(tt.limit), w.Header().Get("X-RateLimit-Limit"))
+			if tt.expectedStatus == http.StatusOK || tt.expectedStatus == http.StatusTooManyRequests {
+				assert.Equal(t, strconv.FormatInt(reset.Unix(), 10), w.Header().Get("X-RateLimit-Reset"))
+			}
+			if tt.expectedStatus == http.StatusTooManyRequests {
+				assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+				retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+				assert.NoError(t, err)
+				assert.True(t, retryAfter > 0 && retryAfter <= 30)
+				assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+				assert.Contains(t, w.Body.String(), `"code":"rate_limit_exceeded"`)
+			}
+			if tt.expectedStatus == http.StatusRequestEntityTooLarge {
+				// request which is never allowed is not counted and is not worth retrying
+				assert.Empty(t, w.Header().Get("Retry-After"))
+				assert.Contains(t, w.Body.String(), "at most 2 messages per period")
+				rl.AssertNotCalled(t, "Take", mock.Anything, mock.Anything)
+			}
+			rl.AssertExpectations(t)
+		})
+	}
+}
+
+type countingRateLimiter struct {
+	maxRequests int
+}
+
+func (crl *countingRateLimiter) Take(string, int) (*ratelimit.Quota, error) {
+	return &ratelimit.Quota{Limit: crl.maxRequests, Remaining: crl.maxRequests}, nil
+}
+
+func (crl *countingRateLimiter) Limit() int {
+	return crl.maxRequests
+}
+
+func TestTierRateLimiters(t *testing.T) {
+	store, err := tenants.NewStaticStore("", "gold=1000:100")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	var created []int
+	limiters := server.NewTierRateLimiters(store, tenants.Tier{MaxRequests: 10, BulkMaxRequests: 1}, func(maxRequests int) (server.RateLimiter, error) {
+		created = append(created, maxRequests)
+		return &countingRateLimiter{maxRequests: maxRequests}, nil
+	})
+
+	tests := []struct {
+		name        string
+		tier        string
+		bulk        bool
+		maxRequests int
+	}{
+		{"Anonymous", "", false, 10},
+		{"Anonymous bulk", "", true, 1},
+		{"Tier", "gold", false, 1000},
+		{"Tier bulk", "gold", true, 100},
+		{"Unknown tier", "silver", false, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl, err := limiters.RateLimiter(context.Background(), tt.tier, tt.bulk)
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			assert.Equal(t, tt.maxRequests, rl.(*countingRateLimiter).maxRequests)
 		})
 	}
+
+	// limiters are shared by tiers with same limits
+	assert.Equal(t, []int{10, 1, 1000, 100}, created)
 }
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"net/http"
+	"runtime/debug"
+)
+
+// middleware handler recovering from panics of the handlers, panic is logged with its stack trace
+// and client gets problem details of internal server error
+func RecoveryMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				// handler aborted the response on purpose, let the server drop the connection
+				panic(rec)
+			}
+
+			logging.FromContext(request.Context()).WithField("stack", string(debug.Stack())).Errorf("panic while serving request: %v", rec)
+			writeProblem(writer, request, http.StatusInternalServerError, types.ErrorCodeInternal, "Internal server error")
+		}()
+
+		handler.ServeHTTP(writer, request)
+	})
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// RequestIDHeader carries identifier of the request, it is propagated from the client or generated
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits length of request ID accepted from the client
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns ID of the request, empty string when context has none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// middleware handler assigning ID to the request, ID sent by the client is kept when it is valid.
+// ID is echoed with X-Request-ID response header and added to the logger of request context.
+func RequestIDMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = logging.NewID()
+		}
+		writer.Header().Set(RequestIDHeader, id)
+
+		fields := log.Fields{"requestID": id}
+		if sc, ok := tracing.SpanContextFromContext(request.Context()); ok {
+			fields["traceID"] = sc.TraceID.String()
+		}
+		ctx := context.WithValue(request.Context(), requestIDKey{}, id)
+		ctx = logging.WithFields(ctx, fields)
+
+		handler.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+// validRequestID checks request ID is not empty, not too long and holds only printable ASCII characters,
+// so it can be safely written to logs and response headers
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
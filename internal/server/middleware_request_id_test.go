@@ -0,0 +1,52 @@
+package server_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		requestID  string
+		expectedID string
+	}{
+		{"Propagated", "client-request-42", "client-request-42"},
+		{"Generated when missing", "", ""},
+		{"Replaced when too long", strings.Repeat("a", 129), ""},
+		{"Replaced when not printable", "id\twith\ttabs", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://fake-url/v1/templates/welcome", nil)
+			if len(tt.requestID) > 0 {
+				req.Header.Set("X-Request-ID", tt.requestID)
+			}
+			w := httptest.NewRecorder()
+
+			var (
+				contextID string
+				loggedID  interface{}
+			)
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID = server.RequestIDFromContext(r.Context())
+				loggedID = logging.FromContext(r.Context()).Data["requestID"]
+			})
+			server.RequestIDMiddleware(handler).ServeHTTP(w, req)
+
+			responseID := w.Header().Get("X-Request-ID")
+			if len(tt.expectedID) > 0 {
+				assert.Equal(t, tt.expectedID, responseID)
+			} else {
+				assert.Len(t, responseID, 32)
+			}
+			assert.Equal(t, responseID, contextID)
+			assert.Equal(t, responseID, loggedID)
+		})
+	}
+}
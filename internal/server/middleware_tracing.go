@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"net/http"
+)
+
+// middleware handler tracing incoming requests. Request continues the trace of W3C traceparent header when it is
+// present, trace context of the request is returned with traceparent response header.
+func TracingMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		for _, skipPath := range []string{"/health", "/ready", "/metrics"} {
+			if request.URL.Path == skipPath {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+		}
+
+		ctx := request.Context()
+		if sc, ok := tracing.ParseTraceparent(request.Header.Get(tracing.TraceparentHeader)); ok {
+			ctx = tracing.ContextWithRemoteParent(ctx, sc)
+		}
+		ctx, span := tracing.StartSpan(ctx, fmt.Sprintf("%s %s", request.Method, routeTemplate(request)), tracing.KindServer)
+		span.SetAttribute("http.method", request.Method)
+		span.SetAttribute("http.route", routeTemplate(request))
+		span.SetAttribute("http.client_ip", utils.GetRequestIPAddress(request))
+
+		writer.Header().Set(tracing.TraceparentHeader, span.SpanContext().Traceparent())
+		recorder := utils.NewStatusCodeRecorder(writer)
+		handler.ServeHTTP(recorder, request.WithContext(ctx))
+
+		statusCode := recorder.StatusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		span.SetAttribute("http.status_code", statusCode)
+		if statusCode >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%d %s", statusCode, http.StatusText(statusCode)))
+		}
+		span.End()
+	})
+}
@@ -0,0 +1,58 @@
+package server_test
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/tracing"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	tests := []struct {
+		name            string
+		path            string
+		traceparent     string
+		expectedTraceID string
+		expectedHeader  bool
+	}{
+		{"Continues incoming trace", "/v1/send/sms", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"Starts new trace", "/v1/send/sms", "", "", true},
+		{"Ignores malformed traceparent", "/v1/send/sms", "00-not-a-trace-01", "", true},
+		{"Skips health check", "/health", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://fake-url"+tt.path, nil)
+			if len(tt.traceparent) > 0 {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			w := httptest.NewRecorder()
+
+			var handlerTraceparent string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerTraceparent = tracing.Traceparent(r.Context())
+				w.WriteHeader(http.StatusAccepted)
+			})
+			server.TracingMiddleware(handler).ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusAccepted, w.Code)
+			if !tt.expectedHeader {
+				assert.Empty(t, w.Header().Get("traceparent"))
+				assert.Empty(t, handlerTraceparent)
+				return
+			}
+
+			sc, ok := tracing.ParseTraceparent(w.Header().Get("traceparent"))
+			if !assert.True(t, ok) {
+				t.FailNow()
+			}
+			assert.Equal(t, sc.Traceparent(), handlerTraceparent)
+			if len(tt.expectedTraceID) > 0 {
+				assert.Equal(t, tt.expectedTraceID, sc.TraceID.String())
+				assert.NotEqual(t, "00f067aa0ba902b7", sc.SpanID.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,1818 @@
+package server
+
+import (
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/openapi"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// apiDocument is OpenAPI 3 document of every route served by the server, it has to be updated along with the routes.
+// Contract tests check routes and responses of the handlers against it.
+var apiDocument = mustLoadAPIDocument()
+
+// APIDocument returns OpenAPI document of the server
+func APIDocument() *openapi.Document {
+	return apiDocument
+}
+
+// openAPIHandler serves OpenAPI document of the server
+func openAPIHandler(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	if _, err := writer.Write(apiDocument.Bytes()); err != nil {
+		logging.FromContext(req.Context()).Error(errors.Wrap(err, "failed to write openapi document to output"))
+	}
+}
+
+func mustLoadAPIDocument() *openapi.Document {
+	doc, err := openapi.Load([]byte(apiDocumentJSON))
+	if err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+const apiDocumentJSON = `{
+	"openapi": "3.0.3",
+	"info": {
+		"title": "demo_messenger",
+		"version": "1.0.0",
+		"description": "SMS delivery service. Every error response is RFC 7807 problem details with application/problem+json content type."
+	},
+	"security": [
+		{
+			"ApiKey": []
+		},
+		{
+			"BearerAuth": []
+		},
+		{}
+	],
+	"paths": {
+		"/health": {
+			"get": {
+				"operationId": "health",
+				"summary": "Health check",
+				"tags": [
+					"system"
+				],
+				"security": [],
+				"responses": {
+					"200": {
+						"description": "Service is up",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/Health"
+								}
+							}
+						}
+					}
+				}
+			}
+		},
+		"/ready": {
+			"get": {
+				"operationId": "ready",
+				"summary": "Readiness check",
+				"tags": [
+					"system"
+				],
+				"security": [],
+				"responses": {
+					"200": {
+						"description": "Service is ready",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/Readiness"
+								}
+							}
+						}
+					},
+					"503": {
+						"description": "Service is not ready",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/Readiness"
+								}
+							}
+						}
+					}
+				}
+			}
+		},
+		"/metrics": {
+			"get": {
+				"operationId": "metrics",
+				"summary": "Prometheus metrics",
+				"tags": [
+					"system"
+				],
+				"security": [],
+				"responses": {
+					"200": {
+						"description": "Metrics in Prometheus text format",
+						"content": {
+							"text/plain": {
+								"schema": {
+									"type": "string"
+								}
+							}
+						}
+					}
+				}
+			}
+		},
+		"/openapi.json": {
+			"get": {
+				"operationId": "openapi",
+				"summary": "This document",
+				"tags": [
+					"system"
+				],
+				"security": [],
+				"responses": {
+					"200": {
+						"description": "OpenAPI document",
+						"content": {
+							"application/json": {
+								"schema": {
+									"type": "object"
+								}
+							}
+						}
+					}
+				}
+			}
+		},
+		"/v1/send/sms": {
+			"post": {
+				"operationId": "sendSMS",
+				"summary": "Enqueue sms",
+				"tags": [
+					"sms"
+				],
+				"parameters": [
+					{
+						"name": "Idempotency-Key",
+						"in": "header",
+						"required": false,
+						"schema": {
+							"type": "string",
+							"maxLength": 255
+						},
+						"description": "Retried request with the same key gets response of the first one instead of enqueueing messages again"
+					}
+				],
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {
+							"schema": {
+								"$ref": "#/components/schemas/SMS"
+							}
+						}
+					}
+				},
+				"responses": {
+					"202": {
+						"description": "Message is enqueued",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/SMSReceipt"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				}
+			}
+		},
+		"/v1/send/sms/bulk": {
+			"post": {
+				"operationId": "sendBulkSMS",
+				"summary": "Enqueue multiple sms, every message is validated and enqueued on its own",
+				"tags": [
+					"sms"
+				],
+				"parameters": [
+					{
+						"name": "Idempotency-Key",
+						"in": "header",
+						"required": false,
+						"schema": {
+							"type": "string",
+							"maxLength": 255
+						},
+						"description": "Retried request with the same key gets response of the first one instead of enqueueing messages again"
+					}
+				],
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {
+							"schema": {
+								"$ref": "#/components/schemas/BulkSMSRequest"
+							}
+						}
+					}
+				},
+				"responses": {
+					"207": {
+						"description": "Result of every message in order of the request",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/BulkSMSResponse"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				}
+			}
+		},
+		"/v1/templates/{template_id}": {
+			"post": {
+				"operationId": "saveTemplate",
+				"summary": "Store new version of the template locale variant",
+				"tags": [
+					"templates"
+				],
+				"parameters": [
+					{
+						"name": "template_id",
+						"in": "path",
+						"required": true,
+						"schema": {
+							"type": "string",
+							"minLength": 1
+						}
+					}
+				],
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {
+							"schema": {
+								"$ref": "#/components/schemas/TemplateRequest"
+							}
+						}
+					}
+				},
+				"responses": {
+					"201": {
+						"description": "Template version is stored",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/Template"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				}
+			},
+			"get": {
+				"operationId": "getTemplate",
+				"summary": "Get latest or given version of the template locale variant",
+				"tags": [
+					"templates"
+				],
+				"parameters": [
+					{
+						"name": "template_id",
+						"in": "path",
+						"required": true,
+						"schema": {
+							"type": "string",
+							"minLength": 1
+						}
+					},
+					{
+						"name": "locale",
+						"in": "query",
+						"required": true,
+						"schema": {
+							"type": "string",
+							"minLength": 1
+						}
+					},
+					{
+						"name": "version",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "integer",
+							"minimum": 1
+						}
+					}
+				],
+				"responses": {
+					"200": {
+						"description": "Template version",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/Template"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				}
+			}
+		},
+		"/v1/verify": {
+			"post": {
+				"operationId": "startVerification",
+				"summary": "Send one-time password to the recipient",
+				"tags": [
+					"verify"
+				],
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {
+							"schema": {
+								"$ref": "#/components/schemas/VerificationRequest"
+							}
+						}
+					}
+				},
+				"responses": {
+					"202": {
+						"description": "One-time password is sent",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/Verification"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				}
+			}
+		},
+		"/v1/verify/check": {
+			"post": {
+				"operationId": "checkVerification",
+				"summary": "Check one-time password received by the recipient",
+				"tags": [
+					"verify"
+				],
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {
+							"schema": {
+								"$ref": "#/components/schemas/VerificationCheck"
+							}
+						}
+					}
+				},
+				"responses": {
+					"200": {
+						"description": "Outcome of the check",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/VerificationResult"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				}
+			}
+		},
+		"/v1/messages": {
+			"get": {
+				"operationId": "listMessages",
+				"summary": "List messages of the tenant having recipients in given state, ordered by message ID",
+				"tags": [
+					"sms"
+				],
+				"parameters": [
+					{
+						"name": "state",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "string",
+							"enum": [
+								"pending",
+								"scheduled",
+								"failed",
+								"dead_lettered",
+								"cancelled"
+							]
+						}
+					},
+					{
+						"name": "originator",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "string"
+						}
+					},
+					{
+						"name": "recipient",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "string"
+						}
+					},
+					{
+						"name": "after_id",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "integer",
+							"minimum": 0
+						},
+						"description": "next_after_id of the previous page"
+					},
+					{
+						"name": "limit",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "integer",
+							"minimum": 1,
+							"maximum": 1000
+						}
+					}
+				],
+				"responses": {
+					"200": {
+						"description": "Page of messages",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/QueueMessages"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				},
+				"security": [
+					{
+						"ApiKey": []
+					},
+					{
+						"BearerAuth": []
+					}
+				],
+				"description": "Requires tenant API key, only messages sent with API keys of the tenant are listed."
+			}
+		},
+		"/v1/admin/messages": {
+			"get": {
+				"operationId": "listQueueMessages",
+				"summary": "List messages having recipients in given state, ordered by message ID",
+				"tags": [
+					"admin"
+				],
+				"parameters": [
+					{
+						"name": "state",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "string",
+							"enum": [
+								"pending",
+								"scheduled",
+								"failed",
+								"dead_lettered",
+								"cancelled"
+							]
+						}
+					},
+					{
+						"name": "originator",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "string"
+						}
+					},
+					{
+						"name": "tenant_id",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "string"
+						}
+					},
+					{
+						"name": "recipient",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "string"
+						}
+					},
+					{
+						"name": "after_id",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "integer",
+							"minimum": 0
+						},
+						"description": "next_after_id of the previous page"
+					},
+					{
+						"name": "limit",
+						"in": "query",
+						"required": false,
+						"schema": {
+							"type": "integer",
+							"minimum": 1,
+							"maximum": 1000
+						}
+					}
+				],
+				"responses": {
+					"200": {
+						"description": "Page of messages",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/QueueMessages"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				},
+				"security": [
+					{
+						"ApiKey": []
+					},
+					{
+						"BearerAuth": []
+					}
+				],
+				"description": "Requires admin API key, tenant API keys are not accepted. Read-only, calls are not recorded in the audit log."
+			}
+		},
+		"/v1/admin/messages/purge": {
+			"post": {
+				"operationId": "purgeOriginator",
+				"summary": "Cancel every message of the originator waiting in the queue",
+				"tags": [
+					"admin"
+				],
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {
+							"schema": {
+								"$ref": "#/components/schemas/PurgeRequest"
+							}
+						}
+					}
+				},
+				"responses": {
+					"200": {
+						"description": "Number of recipients cancelled",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/AdminActionResult"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				},
+				"security": [
+					{
+						"ApiKey": []
+					},
+					{
+						"BearerAuth": []
+					}
+				],
+				"description": "Requires admin API key, tenant API keys are not accepted. Every call is recorded in the audit log."
+			}
+		},
+		"/v1/admin/messages/{message_id}/cancel": {
+			"post": {
+				"operationId": "cancelMessage",
+				"summary": "Cancel message waiting in the queue",
+				"tags": [
+					"admin"
+				],
+				"parameters": [
+					{
+						"name": "message_id",
+						"in": "path",
+						"required": true,
+						"schema": {
+							"type": "integer",
+							"minimum": 1
+						}
+					}
+				],
+				"responses": {
+					"200": {
+						"description": "Number of recipients cancelled",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/AdminActionResult"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				},
+				"security": [
+					{
+						"ApiKey": []
+					},
+					{
+						"BearerAuth": []
+					}
+				],
+				"description": "Requires admin API key, tenant API keys are not accepted. Every call is recorded in the audit log."
+			}
+		},
+		"/v1/admin/messages/{message_id}/requeue": {
+			"post": {
+				"operationId": "requeueMessage",
+				"summary": "Move failed, dead-lettered, cancelled and still pending recipients of processed message back to the queue",
+				"tags": [
+					"admin"
+				],
+				"parameters": [
+					{
+						"name": "message_id",
+						"in": "path",
+						"required": true,
+						"schema": {
+							"type": "integer",
+							"minimum": 1
+						}
+					}
+				],
+				"responses": {
+					"200": {
+						"description": "Number of recipients requeued",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/AdminActionResult"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				},
+				"security": [
+					{
+						"ApiKey": []
+					},
+					{
+						"BearerAuth": []
+					}
+				],
+				"description": "Requires admin API key, tenant API keys are not accepted. Every call is recorded in the audit log."
+			}
+		},
+		"/v1/admin/pauses": {
+			"get": {
+				"operationId": "listPauses",
+				"summary": "List pauses of sending in effect",
+				"tags": [
+					"admin"
+				],
+				"responses": {
+					"200": {
+						"description": "Pauses in effect",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/Pauses"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				},
+				"security": [
+					{
+						"ApiKey": []
+					},
+					{
+						"BearerAuth": []
+					}
+				],
+				"description": "Requires admin API key, tenant API keys are not accepted. Read-only, calls are not recorded in the audit log."
+			},
+			"post": {
+				"operationId": "pauseSending",
+				"summary": "Pause sending of messages globally, of the originator or of the tenant, messages are still accepted into the queue",
+				"tags": [
+					"admin"
+				],
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {
+							"schema": {
+								"$ref": "#/components/schemas/PauseRequest"
+							}
+						}
+					}
+				},
+				"responses": {
+					"200": {
+						"description": "Pause in effect",
+						"content": {
+							"application/json": {
+								"schema": {
+									"$ref": "#/components/schemas/Pause"
+								}
+							}
+						}
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				},
+				"security": [
+					{
+						"ApiKey": []
+					},
+					{
+						"BearerAuth": []
+					}
+				],
+				"description": "Requires admin API key, tenant API keys are not accepted. Every call is recorded in the audit log."
+			}
+		},
+		"/v1/admin/pauses/resume": {
+			"post": {
+				"operationId": "resumeSending",
+				"summary": "Resume paused sending",
+				"tags": [
+					"admin"
+				],
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {
+							"schema": {
+								"$ref": "#/components/schemas/ResumeRequest"
+							}
+						}
+					}
+				},
+				"responses": {
+					"204": {
+						"description": "Sending is resumed"
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				},
+				"security": [
+					{
+						"ApiKey": []
+					},
+					{
+						"BearerAuth": []
+					}
+				],
+				"description": "Requires admin API key, tenant API keys are not accepted. Every call is recorded in the audit log."
+			}
+		},
+		"/v1/admin/suppressions": {
+			"post": {
+				"operationId": "suppressRecipient",
+				"summary": "Add recipient to suppression list, messages to suppressed recipients are rejected",
+				"tags": [
+					"admin"
+				],
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {
+							"schema": {
+								"$ref": "#/components/schemas/SuppressRequest"
+							}
+						}
+					}
+				},
+				"responses": {
+					"204": {
+						"description": "Recipient is suppressed"
+					},
+					"4XX": {
+						"description": "Client error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					},
+					"5XX": {
+						"description": "Server error, see code of the problem",
+						"content": {
+							"application/problem+json": {
+								"schema": {
+									"$ref": "#/components/schemas/Problem"
+								}
+							}
+						}
+					}
+				},
+				"security": [
+					{
+						"ApiKey": []
+					},
+					{
+						"BearerAuth": []
+					}
+				],
+				"description": "Requires admin API key, tenant API keys are not accepted. Every call is recorded in the audit log."
+			}
+		}
+	},
+	"components": {
+		"securitySchemes": {
+			"ApiKey": {
+				"type": "apiKey",
+				"in": "header",
+				"name": "X-API-Key"
+			},
+			"BearerAuth": {
+				"type": "http",
+				"scheme": "bearer"
+			}
+		},
+		"schemas": {
+			"Health": {
+				"type": "object",
+				"required": [
+					"ok"
+				],
+				"properties": {
+					"ok": {
+						"type": "boolean"
+					}
+				}
+			},
+			"Readiness": {
+				"type": "object",
+				"required": [
+					"ready",
+					"degraded"
+				],
+				"properties": {
+					"ready": {
+						"type": "boolean"
+					},
+					"degraded": {
+						"type": "array",
+						"items": {
+							"type": "string"
+						},
+						"description": "Components working in degraded mode"
+					}
+				}
+			},
+			"SMS": {
+				"type": "object",
+				"description": "Either message or template_id is required, but not both",
+				"required": [
+					"recipient",
+					"originator"
+				],
+				"additionalProperties": false,
+				"properties": {
+					"recipient": {
+						"type": "string",
+						"minLength": 1
+					},
+					"originator": {
+						"type": "string",
+						"minLength": 1
+					},
+					"message": {
+						"type": "string",
+						"maxLength": 160
+					},
+					"template_id": {
+						"type": "string"
+					},
+					"template_version": {
+						"type": "integer",
+						"minimum": 0,
+						"description": "Latest version is used when omitted"
+					},
+					"variables": {
+						"type": "object",
+						"additionalProperties": {
+							"type": "string"
+						}
+					},
+					"locale": {
+						"type": "string",
+						"description": "Inferred from recipient's country code when omitted"
+					},
+					"priority": {
+						"type": "string",
+						"enum": [
+							"low",
+							"normal",
+							"high"
+						]
+					},
+					"category": {
+						"type": "string",
+						"description": "Quiet hours are applied per category, transactional messages bypass them"
+					},
+					"timezone": {
+						"type": "string",
+						"description": "IANA time zone of the recipient, inferred from recipient's country code when omitted"
+					}
+				}
+			},
+			"SMSReceipt": {
+				"type": "object",
+				"required": [
+					"status"
+				],
+				"properties": {
+					"status": {
+						"type": "string",
+						"enum": [
+							"accepted",
+							"scheduled"
+						]
+					},
+					"scheduled_at": {
+						"type": "string",
+						"format": "date-time"
+					},
+					"template_id": {
+						"type": "string"
+					},
+					"template_version": {
+						"type": "integer"
+					},
+					"template_locale": {
+						"type": "string"
+					}
+				}
+			},
+			"BulkSMSRequest": {
+				"type": "object",
+				"required": [
+					"messages"
+				],
+				"additionalProperties": false,
+				"properties": {
+					"messages": {
+						"type": "array",
+						"minItems": 1,
+						"items": {
+							"$ref": "#/components/schemas/BulkSMS"
+						}
+					}
+				}
+			},
+			"BulkSMS": {
+				"type": "object",
+				"description": "Message of the bulk request, it is validated as SMS on its own and rejected in results of the response when invalid",
+				"additionalProperties": false,
+				"properties": {
+					"recipient": {
+						"type": "string"
+					},
+					"originator": {
+						"type": "string"
+					},
+					"message": {
+						"type": "string"
+					},
+					"template_id": {
+						"type": "string"
+					},
+					"template_version": {
+						"type": "integer",
+						"description": "Latest version is used when omitted"
+					},
+					"variables": {
+						"type": "object",
+						"additionalProperties": {
+							"type": "string"
+						}
+					},
+					"locale": {
+						"type": "string",
+						"description": "Inferred from recipient's country code when omitted"
+					},
+					"priority": {
+						"type": "string"
+					},
+					"category": {
+						"type": "string",
+						"description": "Quiet hours are applied per category, transactional messages bypass them"
+					},
+					"timezone": {
+						"type": "string",
+						"description": "IANA time zone of the recipient, inferred from recipient's country code when omitted"
+					}
+				}
+			},
+			"BulkSMSResponse": {
+				"type": "object",
+				"required": [
+					"results"
+				],
+				"properties": {
+					"results": {
+						"type": "array",
+						"items": {
+							"$ref": "#/components/schemas/BulkSMSResult"
+						}
+					}
+				}
+			},
+			"BulkSMSResult": {
+				"type": "object",
+				"required": [
+					"status"
+				],
+				"properties": {
+					"status": {
+						"type": "string",
+						"enum": [
+							"accepted",
+							"scheduled",
+							"rejected",
+							"failed"
+						]
+					},
+					"error": {
+						"type": "string"
+					},
+					"code": {
+						"type": "string"
+					},
+					"errors": {
+						"type": "array",
+						"items": {
+							"$ref": "#/components/schemas/FieldError"
+						}
+					},
+					"receipt": {
+						"$ref": "#/components/schemas/SMSReceipt"
+					}
+				}
+			},
+			"TemplateRequest": {
+				"type": "object",
+				"required": [
+					"locale",
+					"body"
+				],
+				"additionalProperties": false,
+				"properties": {
+					"locale": {
+						"type": "string",
+						"minLength": 1
+					},
+					"body": {
+						"type": "string",
+						"minLength": 1
+					}
+				}
+			},
+			"Template": {
+				"type": "object",
+				"required": [
+					"template_id",
+					"locale",
+					"version",
+					"body",
+					"created_at"
+				],
+				"properties": {
+					"template_id": {
+						"type": "string"
+					},
+					"locale": {
+						"type": "string"
+					},
+					"version": {
+						"type": "integer"
+					},
+					"body": {
+						"type": "string"
+					},
+					"created_at": {
+						"type": "string",
+						"format": "date-time"
+					}
+				}
+			},
+			"VerificationRequest": {
+				"type": "object",
+				"required": [
+					"recipient",
+					"originator"
+				],
+				"additionalProperties": false,
+				"properties": {
+					"recipient": {
+						"type": "string",
+						"minLength": 1
+					},
+					"originator": {
+						"type": "string",
+						"minLength": 1
+					},
+					"template_id": {
+						"type": "string",
+						"description": "Template with {{code}} placeholder, default message is used when omitted"
+					},
+					"locale": {
+						"type": "string"
+					}
+				}
+			},
+			"Verification": {
+				"type": "object",
+				"required": [
+					"verification_id",
+					"status",
+					"expires_at"
+				],
+				"properties": {
+					"verification_id": {
+						"type": "string"
+					},
+					"status": {
+						"type": "string",
+						"enum": [
+							"pending",
+							"approved",
+							"expired",
+							"locked"
+						]
+					},
+					"expires_at": {
+						"type": "string",
+						"format": "date-time"
+					}
+				}
+			},
+			"VerificationCheck": {
+				"type": "object",
+				"required": [
+					"verification_id",
+					"code"
+				],
+				"additionalProperties": false,
+				"properties": {
+					"verification_id": {
+						"type": "string",
+						"minLength": 1
+					},
+					"code": {
+						"type": "string",
+						"minLength": 1
+					}
+				}
+			},
+			"VerificationResult": {
+				"type": "object",
+				"required": [
+					"verification_id",
+					"status",
+					"attempts_left"
+				],
+				"properties": {
+					"verification_id": {
+						"type": "string"
+					},
+					"status": {
+						"type": "string",
+						"enum": [
+							"pending",
+							"approved",
+							"expired",
+							"locked"
+						]
+					},
+					"attempts_left": {
+						"type": "integer"
+					}
+				}
+			},
+			"QueueMessages": {
+				"type": "object",
+				"required": [
+					"messages"
+				],
+				"properties": {
+					"messages": {
+						"type": "array",
+						"items": {
+							"$ref": "#/components/schemas/QueueMessage"
+						}
+					},
+					"next_after_id": {
+						"type": "integer",
+						"description": "Passed as after_id to get the next page, omitted on the last page"
+					}
+				}
+			},
+			"QueueMessage": {
+				"type": "object",
+				"required": [
+					"message_id",
+					"originator",
+					"text",
+					"processed",
+					"priority",
+					"created_at",
+					"recipients"
+				],
+				"properties": {
+					"message_id": {
+						"type": "integer"
+					},
+					"originator": {
+						"type": "string"
+					},
+					"text": {
+						"type": "string"
+					},
+					"processed": {
+						"type": "boolean",
+						"description": "Message was taken from the queue by messenger or cancelled"
+					},
+					"priority": {
+						"type": "string",
+						"enum": [
+							"low",
+							"normal",
+							"high"
+						]
+					},
+					"created_at": {
+						"type": "string",
+						"format": "date-time"
+					},
+					"send_after": {
+						"type": "string",
+						"format": "date-time"
+					},
+					"tenant_id": {
+						"type": "string"
+					},
+					"recipients": {
+						"type": "array",
+						"items": {
+							"$ref": "#/components/schemas/QueueRecipient"
+						}
+					}
+				}
+			},
+			"QueueRecipient": {
+				"type": "object",
+				"required": [
+					"phone_number",
+					"status",
+					"attempts"
+				],
+				"properties": {
+					"phone_number": {
+						"type": "string"
+					},
+					"status": {
+						"type": "string",
+						"enum": [
+							"pending",
+							"sent",
+							"failed",
+							"dead_lettered",
+							"cancelled"
+						]
+					},
+					"error_code": {
+						"type": "integer"
+					},
+					"attempts": {
+						"type": "integer"
+					}
+				}
+			},
+			"PurgeRequest": {
+				"type": "object",
+				"required": [
+					"originator"
+				],
+				"additionalProperties": false,
+				"properties": {
+					"originator": {
+						"type": "string",
+						"minLength": 1
+					}
+				}
+			},
+			"PauseRequest": {
+				"type": "object",
+				"required": [
+					"scope"
+				],
+				"additionalProperties": false,
+				"properties": {
+					"scope": {
+						"type": "string",
+						"enum": [
+							"global",
+							"originator",
+							"tenant"
+						]
+					},
+					"value": {
+						"type": "string",
+						"description": "Originator or tenant ID paused, not set for global pause"
+					},
+					"reason": {
+						"type": "string",
+						"maxLength": 256
+					}
+				}
+			},
+			"ResumeRequest": {
+				"type": "object",
+				"required": [
+					"scope"
+				],
+				"additionalProperties": false,
+				"properties": {
+					"scope": {
+						"type": "string",
+						"enum": [
+							"global",
+							"originator",
+							"tenant"
+						]
+					},
+					"value": {
+						"type": "string"
+					}
+				}
+			},
+			"Pause": {
+				"type": "object",
+				"required": [
+					"scope",
+					"paused_by",
+					"created_at"
+				],
+				"properties": {
+					"scope": {
+						"type": "string",
+						"enum": [
+							"global",
+							"originator",
+							"tenant"
+						]
+					},
+					"value": {
+						"type": "string"
+					},
+					"reason": {
+						"type": "string"
+					},
+					"paused_by": {
+						"type": "string",
+						"description": "Operator of the admin API key"
+					},
+					"created_at": {
+						"type": "string",
+						"format": "date-time"
+					}
+				}
+			},
+			"Pauses": {
+				"type": "object",
+				"required": [
+					"pauses"
+				],
+				"properties": {
+					"pauses": {
+						"type": "array",
+						"items": {
+							"$ref": "#/components/schemas/Pause"
+						}
+					}
+				}
+			},
+			"SuppressRequest": {
+				"type": "object",
+				"required": [
+					"phone_number"
+				],
+				"additionalProperties": false,
+				"properties": {
+					"phone_number": {
+						"type": "string",
+						"minLength": 1
+					}
+				}
+			},
+			"AdminActionResult": {
+				"type": "object",
+				"required": [
+					"action",
+					"recipients"
+				],
+				"properties": {
+					"action": {
+						"type": "string",
+						"enum": [
+							"cancel",
+							"requeue",
+							"purge"
+						]
+					},
+					"recipients": {
+						"type": "integer",
+						"description": "Number of recipients action was applied to"
+					}
+				}
+			},
+			"Problem": {
+				"type": "object",
+				"required": [
+					"type",
+					"title",
+					"status",
+					"code"
+				],
+				"properties": {
+					"type": {
+						"type": "string"
+					},
+					"title": {
+						"type": "string"
+					},
+					"status": {
+						"type": "integer"
+					},
+					"detail": {
+						"type": "string"
+					},
+					"instance": {
+						"type": "string"
+					},
+					"code": {
+						"type": "string",
+						"enum": [
+							"malformed_body",
+							"body_too_large",
+							"unsupported_media_type",
+							"validation_failed",
+							"message_rejected",
+							"not_found",
+							"method_not_allowed",
+							"unauthorized",
+							"forbidden",
+							"rate_limit_exceeded",
+							"recipient_locked",
+							"idempotency_conflict",
+							"idempotency_key_reused",
+							"service_unavailable",
+							"circuit_open",
+							"timeout",
+							"internal_error"
+						]
+					},
+					"request_id": {
+						"type": "string"
+					},
+					"errors": {
+						"type": "array",
+						"items": {
+							"$ref": "#/components/schemas/FieldError"
+						}
+					}
+				}
+			},
+			"FieldError": {
+				"type": "object",
+				"required": [
+					"field",
+					"code",
+					"message"
+				],
+				"properties": {
+					"field": {
+						"type": "string"
+					},
+					"code": {
+						"type": "string",
+						"enum": [
+							"required",
+							"too_long",
+							"too_many",
+							"conflict",
+							"invalid",
+							"unknown"
+						]
+					},
+					"message": {
+						"type": "string"
+					}
+				}
+			}
+		}
+	}
+}
+`
@@ -0,0 +1,245 @@
+package server_test
+
+import (
+	"encoding/json"
+	"github.com/arkadyb/demo_messenger/internal/messenger"
+	"github.com/arkadyb/demo_messenger/internal/pkg/buffer"
+	"github.com/arkadyb/demo_messenger/internal/pkg/ipfilter"
+	"github.com/arkadyb/demo_messenger/internal/pkg/ratelimit"
+	"github.com/arkadyb/demo_messenger/internal/pkg/templates"
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/arkadyb/demo_messenger/internal/pkg/verifications"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/arkadyb/demo_messenger/internal/verifier"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newContractServer returns server with mocked dependencies answering requests of the contract tests
+func newContractServer(t *testing.T, openAPIValidation bool) *server.Server {
+	app := &MockedApplication{}
+	app.On("EnqueueSMS", mock.Anything, mock.MatchedBy(func(sms *types.SMS) bool { return sms.Recipient == "1" })).Return(&types.SMSReceipt{Status: "accepted"}, nil)
+	app.On("EnqueueSMS", mock.Anything, mock.MatchedBy(func(sms *types.SMS) bool { return sms.Recipient == "2" })).Return(nil, &messenger.InvalidSMSError{Reason: "recipient 2 is suppressed"})
+	app.On("EnqueueSMS", mock.Anything, mock.MatchedBy(func(sms *types.SMS) bool { return sms.Recipient == "3" })).Return(nil, errors.New("pq: connection refused"))
+
+	tmpl := &templates.Template{TemplateID: "welcome", Locale: "en", Version: 1, Body: "Hi {{name}}", CreatedAt: time.Now()}
+	store := &MockedTemplates{}
+	store.On("SaveTemplate", mock.Anything, "welcome", "en", "Hi {{name}}").Return(tmpl, nil)
+	store.On("GetTemplate", mock.Anything, "welcome", "en", 0).Return(tmpl, nil)
+	store.On("GetTemplate", mock.Anything, "missing", "en", 0).Return(nil, templates.ErrTemplateNotFound)
+
+	verify := &MockedVerifier{}
+	verify.On("StartVerification", mock.Anything, mock.MatchedBy(func(req *types.VerificationRequest) bool { return req.Recipient == "1" })).Return(&types.Verification{VerificationID: "v1", Status: "pending", ExpiresAt: time.Now()}, nil)
+	verify.On("StartVerification", mock.Anything, mock.MatchedBy(func(req *types.VerificationRequest) bool { return req.Recipient == "2" })).Return(nil, verifier.ErrPhoneNumberLocked)
+	verify.On("CheckVerification", mock.Anything, &types.VerificationCheck{VerificationID: "v1", Code: "123456"}).Return(&types.VerificationResult{VerificationID: "v1", Status: "approved"}, nil)
+	verify.On("CheckVerification", mock.Anything, &types.VerificationCheck{VerificationID: "v2", Code: "123456"}).Return(nil, verifications.ErrVerificationNotFound)
+
+	rl := &MockedRateLimiter{}
+	rl.On("Take", mock.Anything, mock.Anything).Return(&ratelimit.Quota{Limit: 100, Remaining: 99, Reset: time.Now().Add(time.Minute)}, nil)
+	rl.On("Limit").Return(100)
+	limiters := &MockedRateLimiters{}
+	limiters.On("RateLimiter", mock.Anything, mock.Anything, mock.Anything).Return(rl, nil)
+
+	proxies, err := utils.ParseTrustedProxies("", "")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	filter, err := ipfilter.New(nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	cfg := server.Configuration{
+		CircuitBreakerTimeoutSeconds:        10,
+		CircuitBreakerSleepWindowSeconds:    10,
+		CircuitBreakerErrorPercentThreshold: 100,
+		BulkMaxMessages:                     3,
+		MaxRequestBodyBytes:                 1 << 20,
+		OpenAPIValidation:                   openAPIValidation,
+	}
+
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	queue := &MockedAdminQueue{}
+	queue.On("ListMessages", mock.Anything, mock.Anything).Return([]*buffer.MessageDetails{
+		{
+			Message:    buffer.Message{MessageID: 1, Originator: "originator", Text: "message", Processed: true, Priority: buffer.PriorityNormal, CreatedAt: createdAt},
+			Recipients: []*buffer.Recipient{{MessageID: 1, PhoneNumber: "1", Status: buffer.RecipientDeadLettered, ErrorCode: 20429, Attempts: 5}},
+		},
+	}, nil)
+	queue.On("CancelMessage", mock.Anything, int64(1)).Return(2, nil)
+	queue.On("CancelMessage", mock.Anything, int64(2)).Return(0, buffer.ErrMessageNotFound)
+	queue.On("RequeueMessage", mock.Anything, int64(1)).Return(1, nil)
+	queue.On("PurgeOriginator", mock.Anything, "originator").Return(3, nil)
+	queue.On("ListPauses", mock.Anything).Return([]*buffer.Pause{{Scope: buffer.PauseOriginator, Value: "originator", Reason: "wrong template", PausedBy: "ops", CreatedAt: createdAt}}, nil)
+	queue.On("PauseSending", mock.Anything, mock.Anything).Return(nil)
+	queue.On("ResumeSending", mock.Anything, buffer.PauseTenant, "acme").Return(nil)
+	queue.On("ResumeSending", mock.Anything, buffer.PauseGlobal, "").Return(buffer.ErrPauseNotFound)
+	suppressions := &MockedSuppressions{}
+	suppressions.On("Suppress", mock.Anything, "1", 0).Return(nil)
+	auditLog := &MockedAuditLog{}
+	auditLog.On("Record", mock.Anything, mock.Anything).Return(nil)
+	adminKeys, err := server.ParseAdminKeys("admin-secret=ops")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return server.NewServer(cfg, app, store, verify, &MockedTenantsStore{}, limiters, ratelimit.NewStatus(time.Minute, nil), proxies, filter, nil, &server.Admin{Keys: adminKeys, Queue: queue, Suppressions: suppressions, Audit: auditLog})
+}
+
+func TestAPIDocument_Routes(t *testing.T) {
+	srv := newContractServer(t, false)
+
+	var routes []string
+	err := srv.Handler.(*mux.Router).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// path prefix of subrouter
+			return nil
+		}
+		for _, method := range methods {
+			routes = append(routes, method+" "+path)
+		}
+		return nil
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	sort.Strings(routes)
+
+	assert.Equal(t, server.APIDocument().Operations(), routes)
+}
+
+func TestAPIDocument_Contract(t *testing.T) {
+	tests := []struct {
+		name               string
+		method             string
+		url                string
+		reqBody            string
+		expectedStatusCode int
+		apiKey             string
+	}{
+		{"Health", "GET", "/health", "", http.StatusOK, ""},
+		{"Ready", "GET", "/ready", "", http.StatusOK, ""},
+		{"OpenAPI document", "GET", "/openapi.json", "", http.StatusOK, ""},
+		{"Send sms", "POST", "/v1/send/sms", `{"recipient": "1", "originator": "originator", "message": "message"}`, http.StatusAccepted, ""},
+		{"Send invalid sms", "POST", "/v1/send/sms", `{"recipents": "1", "message": "message"}`, http.StatusBadRequest, ""},
+		{"Send rejected sms", "POST", "/v1/send/sms", `{"recipient": "2", "originator": "originator", "message": "message"}`, http.StatusBadRequest, ""},
+		{"Send sms failure", "POST", "/v1/send/sms", `{"recipient": "3", "originator": "originator", "message": "message"}`, http.StatusInternalServerError, ""},
+		{"Send malformed sms", "POST", "/v1/send/sms", `{"recipient": `, http.StatusBadRequest, ""},
+		{"Send bulk sms", "POST", "/v1/send/sms/bulk", `{"messages": [{"recipient": "1", "originator": "originator", "message": "message"}, {"recipient": "2", "originator": "originator", "message": "message"}, {"originator": "originator"}]}`, http.StatusMultiStatus, ""},
+		{"Send too many sms", "POST", "/v1/send/sms/bulk", `{"messages": [{}, {}, {}, {}]}`, http.StatusBadRequest, ""},
+		{"Save template", "POST", "/v1/templates/welcome", `{"locale": "en", "body": "Hi {{name}}"}`, http.StatusCreated, ""},
+		{"Save invalid template", "POST", "/v1/templates/welcome", `{"locale": "en"}`, http.StatusBadRequest, ""},
+		{"Get template", "GET", "/v1/templates/welcome?locale=en", "", http.StatusOK, ""},
+		{"Get missing template", "GET", "/v1/templates/missing?locale=en", "", http.StatusNotFound, ""},
+		{"Get template without locale", "GET", "/v1/templates/welcome", "", http.StatusBadRequest, ""},
+		{"Start verification", "POST", "/v1/verify", `{"recipient": "1", "originator": "originator"}`, http.StatusAccepted, ""},
+		{"Start locked verification", "POST", "/v1/verify", `{"recipient": "2", "originator": "originator"}`, http.StatusTooManyRequests, ""},
+		{"Check verification", "POST", "/v1/verify/check", `{"verification_id": "v1", "code": "123456"}`, http.StatusOK, ""},
+		{"Check missing verification", "POST", "/v1/verify/check", `{"verification_id": "v2", "code": "123456"}`, http.StatusNotFound, ""},
+		{"List queue messages", "GET", "/v1/admin/messages?state=dead_lettered&limit=10", "", http.StatusOK, "admin-secret"},
+		{"List queue messages of unknown state", "GET", "/v1/admin/messages?state=sent", "", http.StatusBadRequest, "admin-secret"},
+		{"List queue messages anonymously", "GET", "/v1/admin/messages", "", http.StatusUnauthorized, ""},
+		{"Cancel message", "POST", "/v1/admin/messages/1/cancel", "", http.StatusOK, "admin-secret"},
+		{"Cancel missing message", "POST", "/v1/admin/messages/2/cancel", "", http.StatusNotFound, "admin-secret"},
+		{"Requeue message", "POST", "/v1/admin/messages/1/requeue", "", http.StatusOK, "admin-secret"},
+		{"Purge originator", "POST", "/v1/admin/messages/purge", `{"originator": "originator"}`, http.StatusOK, "admin-secret"},
+		{"Purge without originator", "POST", "/v1/admin/messages/purge", `{}`, http.StatusBadRequest, "admin-secret"},
+		{"List pauses", "GET", "/v1/admin/pauses", "", http.StatusOK, "admin-secret"},
+		{"Pause originator", "POST", "/v1/admin/pauses", `{"scope": "originator", "value": "originator", "reason": "wrong template"}`, http.StatusOK, "admin-secret"},
+		{"Pause unknown scope", "POST", "/v1/admin/pauses", `{"scope": "recipient", "value": "1"}`, http.StatusBadRequest, "admin-secret"},
+		{"Resume tenant", "POST", "/v1/admin/pauses/resume", `{"scope": "tenant", "value": "acme"}`, http.StatusNoContent, "admin-secret"},
+		{"Resume not paused", "POST", "/v1/admin/pauses/resume", `{"scope": "global"}`, http.StatusNotFound, "admin-secret"},
+		{"Suppress recipient", "POST", "/v1/admin/suppressions", `{"phone_number": "1"}`, http.StatusNoContent, "admin-secret"},
+		{"Suppress without phone number", "POST", "/v1/admin/suppressions", `{}`, http.StatusBadRequest, "admin-secret"},
+	}
+	for _, validate := range []bool{false, true} {
+		srv := newContractServer(t, validate)
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(tt.method, "http://fake-url"+tt.url, strings.NewReader(tt.reqBody))
+				if len(tt.apiKey) > 0 {
+					req.Header.Set("X-API-Key", tt.apiKey)
+				}
+				w := httptest.NewRecorder()
+
+				srv.Handler.ServeHTTP(w, req)
+
+				if !assert.Equal(t, tt.expectedStatusCode, w.Code, w.Body.String()) {
+					t.FailNow()
+				}
+				violations, err := server.APIDocument().ValidateResponse(tt.method, req.URL.Path, w.Code, w.Header(), w.Body.Bytes())
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				assert.Empty(t, violations)
+			})
+		}
+	}
+}
+
+func TestOpenAPIValidationMiddleware(t *testing.T) {
+	tests := []struct {
+		name               string
+		method             string
+		url                string
+		reqBody            string
+		expectedStatusCode int
+		expectedFields     []string
+	}{
+		{"Valid request", "POST", "/v1/send/sms", `{"recipient": "1", "originator": "originator", "message": "message"}`, http.StatusOK, nil},
+		{"Invalid body", "POST", "/v1/send/sms", `{"recipient": "", "message": "message", "priority": "urgent", "sender": "me"}`, http.StatusBadRequest, []string{"originator", "priority", "recipient", "sender"}},
+		{"Invalid query", "GET", "/v1/templates/welcome?version=0", "", http.StatusBadRequest, []string{"locale", "version"}},
+		{"Malformed body is left to the handler", "POST", "/v1/send/sms", `{"recipient": `, http.StatusOK, nil},
+		{"Undocumented route is left to the handler", "POST", "/v2/send/sms", `{}`, http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body string
+			handler := http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+				data, _ := ioutil.ReadAll(req.Body)
+				body = string(data)
+				writer.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tt.method, "http://fake-url"+tt.url, strings.NewReader(tt.reqBody))
+			w := httptest.NewRecorder()
+
+			server.OpenAPIValidationMiddleware(server.APIDocument())(handler).ServeHTTP(w, req)
+
+			if !assert.Equal(t, tt.expectedStatusCode, w.Code) {
+				t.FailNow()
+			}
+			if tt.expectedFields == nil {
+				// handler reads the body middleware has read already
+				assert.Equal(t, tt.reqBody, body)
+				return
+			}
+
+			problem := &types.Problem{}
+			if !assert.NoError(t, json.NewDecoder(w.Body).Decode(problem)) {
+				t.FailNow()
+			}
+			var fields []string
+			for _, fieldErr := range problem.Errors {
+				fields = append(fields, fieldErr.Field)
+			}
+			assert.Equal(t, types.ErrorCodeValidationFailed, problem.Code)
+			assert.Equal(t, tt.expectedFields, fields)
+		})
+	}
+}
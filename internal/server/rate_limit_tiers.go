@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
+	"sync"
+)
+
+// NewRateLimiterFunc creates rate limiter allowing maxRequests per rate limiting period
+type NewRateLimiterFunc func(maxRequests int) (RateLimiter, error)
+
+// TierRateLimiters implements RateLimiters with limits of tiers from tenants store.
+// Anonymous requests and tiers missing in the store use default limits.
+type TierRateLimiters struct {
+	tiers       tenants.Store
+	defaultTier tenants.Tier
+	newLimiter  NewRateLimiterFunc
+
+	mu       sync.Mutex
+	limiters map[string]RateLimiter
+}
+
+// NewTierRateLimiters creates new instance of TierRateLimiters
+func NewTierRateLimiters(tiers tenants.Store, defaultTier tenants.Tier, newLimiter NewRateLimiterFunc) *TierRateLimiters {
+	return &TierRateLimiters{
+		tiers:       tiers,
+		defaultTier: defaultTier,
+		newLimiter:  newLimiter,
+		limiters:    map[string]RateLimiter{},
+	}
+}
+
+// RateLimiter returns rate limiter of the tier
+func (trl *TierRateLimiters) RateLimiter(ctx context.Context, tierName string, bulk bool) (RateLimiter, error) {
+	tier := &trl.defaultTier
+	if len(tierName) > 0 {
+		var err error
+		if tier, err = trl.tiers.GetTier(ctx, tierName); err == tenants.ErrTierNotFound {
+			tier = &trl.defaultTier
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	maxRequests := tier.MaxRequests
+	if bulk {
+		maxRequests = tier.BulkMaxRequests
+	}
+
+	// limiters are created per limit, so changed limits of the tier take effect without restart
+	key := fmt.Sprintf("%t:%d", bulk, maxRequests)
+
+	trl.mu.Lock()
+	defer trl.mu.Unlock()
+
+	rl, ok := trl.limiters[key]
+	if !ok {
+		var err error
+		if rl, err = trl.newLimiter(maxRequests); err != nil {
+			return nil, err
+		}
+		trl.limiters[key] = rl
+	}
+
+	return rl, nil
+}
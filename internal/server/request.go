@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/validation"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// decodeRequest reads json body of the request into value and validates it.
+// Unknown and invalid fields are returned all at once, so handler can add its own checks before reporting them.
+// Problem details are written and false is returned when body has wrong content type, is too large or is not valid json.
+func decodeRequest(writer http.ResponseWriter, req *http.Request, value interface{}) ([]*types.FieldError, bool) {
+	if detail := checkContentType(req.Header.Get("Content-Type")); len(detail) > 0 {
+		writeProblem(writer, req, http.StatusUnsupportedMediaType, types.ErrorCodeUnsupportedMedia, detail)
+		return nil, false
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		if errors.Cause(err) == errBodyTooLarge {
+			writeProblem(writer, req, http.StatusRequestEntityTooLarge, types.ErrorCodeBodyTooLarge, "Request body is too large")
+			return nil, false
+		}
+		logging.FromContext(req.Context()).Error(errors.Wrap(err, "failed to read request body"))
+		writeProblem(writer, req, http.StatusBadRequest, types.ErrorCodeMalformedBody, "Request body cant be read")
+		return nil, false
+	}
+
+	var fieldErrors []*types.FieldError
+	// decoder ignores unknown fields, keys of the whole body are matched to json names of value instead to report all of them at once
+	for _, field := range validation.UnknownFields(data, value) {
+		fieldErrors = append(fieldErrors, &types.FieldError{Field: field, Code: types.FieldErrorCodeUnknown, Message: fmt.Sprintf("%s is not a known field", field)})
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	err = decoder.Decode(value)
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok && len(typeErr.Field) > 0 {
+		fieldErrors = append(fieldErrors, &types.FieldError{Field: typeErr.Field, Code: types.FieldErrorCodeInvalid, Message: fmt.Sprintf("%s must be %s, not %s", typeErr.Field, typeErr.Type, typeErr.Value)})
+		return fieldErrors, true
+	}
+	if err == nil {
+		if _, tokenErr := decoder.Token(); tokenErr != io.EOF {
+			err = errors.New("unexpected data after json value")
+		}
+	}
+	if err != nil {
+		logging.FromContext(req.Context()).Debug(errors.Wrap(err, "failed to decode request body"))
+		writeProblem(writer, req, http.StatusBadRequest, types.ErrorCodeMalformedBody, "Request body is not valid JSON")
+		return nil, false
+	}
+
+	return append(fieldErrors, fieldErrorsOf(validation.Validate(value), "")...), true
+}
+
+// checkContentType returns problem detail of request content type other than json in utf-8.
+// Request without content type is assumed to be json.
+func checkContentType(contentType string) string {
+	if len(contentType) == 0 {
+		return ""
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Sprintf("Content type %s is not valid", contentType)
+	}
+	if mediaType != "application/json" {
+		return fmt.Sprintf("Content type %s is not supported, use application/json", mediaType)
+	}
+	if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") {
+		return fmt.Sprintf("Charset %s is not supported, use utf-8", charset)
+	}
+
+	return ""
+}
+
+// fieldErrorsOf converts validation violations to field errors of problem details, field names are prefixed with prefix
+func fieldErrorsOf(violations []*validation.Violation, prefix string) []*types.FieldError {
+	fieldErrors := make([]*types.FieldError, len(violations))
+	for i, violation := range violations {
+		fieldErrors[i] = &types.FieldError{
+			Field:   prefix + violation.Field,
+			Code:    violation.Code,
+			Message: prefix + violation.Message,
+		}
+	}
+	return fieldErrors
+}
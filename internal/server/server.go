@@ -2,23 +2,32 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	hrx "github.com/afex/hystrix-go/hystrix"
-	"github.com/arkadyb/caply"
 	"github.com/arkadyb/demo_messenger/internal/messenger"
-	"github.com/gorilla/handlers"
+	"github.com/arkadyb/demo_messenger/internal/pkg/idempotency"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/ratelimit"
+	"github.com/arkadyb/demo_messenger/internal/pkg/templates"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/arkadyb/demo_messenger/internal/verifier"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	stdlog "log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // NewServer returns new server instance
-func NewServer(cfg Configuration, messenger messenger.Application, caply *caply.Caply) *Server {
+func NewServer(cfg Configuration, messenger messenger.Application, templates templates.Store, verifier verifier.Application, tenants tenants.Store, limiters RateLimiters, limitersStatus *ratelimit.Status, proxies *utils.TrustedProxies, ipFilter IPFilter, idempotencyKeys idempotency.Store, admin *Admin) *Server {
 	var (
 		addr             = fmt.Sprintf(":%s", strconv.Itoa(cfg.Port))
 		hrxDefaultConfig = hrx.CommandConfig{
@@ -29,19 +38,62 @@ func NewServer(cfg Configuration, messenger messenger.Application, caply *caply.
 	)
 
 	router := mux.NewRouter()
-	router.Use(LoggingMiddleware, RateLimitingMiddleware(caply), PrometheusMiddleware, handlers.RecoveryHandler(handlers.PrintRecoveryStack(true)))
+	// requests rejected by ip filter, authentication and rate limiter are measured as well
+	router.Use(ClientIPMiddleware(proxies), TracingMiddleware, RequestIDMiddleware, PrometheusMiddleware, LoggingMiddleware, IPFilterMiddleware(ipFilter), AuthenticationMiddleware(tenants, cfg.AuthRequired), RateLimitingMiddleware(limiters, false), BodyLimitMiddleware(cfg.MaxRequestBodyBytes))
+	if cfg.OpenAPIValidation {
+		router.Use(OpenAPIValidationMiddleware(apiDocument))
+	}
+	router.Use(RecoveryMiddleware)
 
 	router.NotFoundHandler = http.HandlerFunc(notFound404Handler)
+	router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowed405Handler)
 	router.Handle("/health", http.HandlerFunc(healthHandler)).Methods("GET")
+	router.Handle("/ready", ReadinessHandler(limitersStatus, cfg.RateLimitFailurePolicy)).Methods("GET")
 	router.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{})).Methods("GET")
+	router.Handle("/openapi.json", http.HandlerFunc(openAPIHandler)).Methods("GET")
 
+	// retried send requests with the same Idempotency-Key get response of the first one
 	v1 := router.PathPrefix("/v1/send").Subrouter()
-	v1.Handle("/sms", CircuitBreakerMiddleware("ping_request", hrxDefaultConfig, SendSMSHandler(messenger))).Methods("POST")
+	v1.Use(IdempotencyMiddleware(idempotencyKeys))
+	v1.Handle("/sms", CircuitBreakerMiddleware("send_sms_request", hrxDefaultConfig, SendSMSHandler(messenger))).Methods("POST")
+	// bulk requests are counted once against regular limit of the tier and once per message against its bulk limit
+	v1.Handle("/sms/bulk", RateLimitingMiddleware(limiters, true)(CircuitBreakerMiddleware("send_sms_bulk_request", hrxDefaultConfig, BulkSendSMSHandler(messenger, cfg.BulkMaxMessages)))).Methods("POST")
+
+	v1Templates := router.PathPrefix("/v1/templates").Subrouter()
+	v1Templates.Handle("/{template_id}", SaveTemplateHandler(templates)).Methods("POST")
+	v1Templates.Handle("/{template_id}", GetTemplateHandler(templates)).Methods("GET")
+
+	// one-time password verification is optional
+	if verifier != nil {
+		v1Verify := router.PathPrefix("/v1/verify").Subrouter()
+		v1Verify.Handle("", StartVerificationHandler(verifier)).Methods("POST")
+		v1Verify.Handle("/check", CheckVerificationHandler(verifier)).Methods("POST")
+	}
+
+	// tenants list status of their own messages
+	if admin != nil && admin.Queue != nil {
+		router.Handle("/v1/messages", ListTenantMessagesHandler(admin.Queue)).Methods("GET")
+	}
+
+	if admin != nil && len(admin.Keys) > 0 {
+		v1Admin := router.PathPrefix("/v1/admin").Subrouter()
+		v1Admin.Use(AdminAuthenticationMiddleware(admin.Keys))
+		v1Admin.Handle("/messages", ListQueueMessagesHandler(admin.Queue)).Methods("GET")
+		v1Admin.Handle("/messages/purge", PurgeOriginatorHandler(admin.Queue, admin.Audit)).Methods("POST")
+		v1Admin.Handle("/messages/{message_id}/cancel", CancelMessageHandler(admin.Queue, admin.Audit)).Methods("POST")
+		v1Admin.Handle("/messages/{message_id}/requeue", RequeueMessageHandler(admin.Queue, admin.Audit)).Methods("POST")
+		v1Admin.Handle("/pauses", ListPausesHandler(admin.Queue)).Methods("GET")
+		v1Admin.Handle("/pauses", PauseSendingHandler(admin.Queue, admin.Audit)).Methods("POST")
+		v1Admin.Handle("/pauses/resume", ResumeSendingHandler(admin.Queue, admin.Audit)).Methods("POST")
+		v1Admin.Handle("/suppressions", SuppressRecipientHandler(admin.Suppressions, admin.Audit)).Methods("POST")
+	}
 
 	return &Server{
 		Server: &http.Server{
 			Addr:    addr,
 			Handler: router,
+			// errors of connections and handlers go through the process logger
+			ErrorLog: stdlog.New(log.StandardLogger().WriterLevel(log.ErrorLevel), "", 0),
 		},
 	}
 }
@@ -53,18 +105,18 @@ type Server struct {
 
 // Stop gracefully stops server
 func (s *Server) Stop() {
-	log.Println("gracefully stopping server...")
+	log.Info("gracefully stopping server...")
 
 	err := s.Shutdown(context.Background())
 	if err != nil {
 		log.Error(errors.Wrap(err, "failed to gracefully stop server"))
 	}
-	log.Println("server has been stopped")
+	log.Info("server has been stopped")
 }
 
 // Start's sever waiting for incoming requests
 func (s *Server) Start() {
-	log.Printf("starting server on %s", s.Addr)
+	log.Infof("starting server on %s", s.Addr)
 	go func() {
 		if err := s.ListenAndServe(); err != nil {
 			log.Fatal("unable to start server: ", err)
@@ -73,11 +125,59 @@ func (s *Server) Start() {
 	}()
 }
 
+// problemContentType is media type of problem details responses
+const problemContentType = "application/problem+json"
+
 // NotFound404Handler provides a 404/not found route
 func notFound404Handler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotFound)
-	if _, err := w.Write([]byte(`{"statusCode": 404,"error": "Not Found","message": "Not Found"}`)); err != nil {
+	writeProblem(w, r, http.StatusNotFound, types.ErrorCodeNotFound, "Route not found")
+}
+
+// methodNotAllowed405Handler responds to requests of existing route with method route does not serve
+func methodNotAllowed405Handler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusMethodNotAllowed, types.ErrorCodeMethodNotAllowed, fmt.Sprintf("Method %s is not allowed", r.Method))
+}
+
+// writeProblem writes RFC 7807 problem details response, field errors are listed with validation failures
+func writeProblem(writer http.ResponseWriter, req *http.Request, statusCode int, code, detail string, fieldErrors ...*types.FieldError) {
+	problem := &types.Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(statusCode),
+		Status:    statusCode,
+		Detail:    detail,
+		Instance:  req.URL.Path,
+		Code:      code,
+		RequestID: RequestIDFromContext(req.Context()),
+		Errors:    fieldErrors,
+	}
+
+	writer.Header().Set("Content-Type", problemContentType)
+	writer.WriteHeader(statusCode)
+	if err := json.NewEncoder(writer).Encode(problem); err != nil {
+		logging.FromContext(req.Context()).Error(errors.Wrap(err, "failed to write problem json to output"))
+	}
+}
+
+// writeInternalError logs the error and writes problem details of internal server error, error itself is not exposed
+func writeInternalError(writer http.ResponseWriter, req *http.Request, err error) {
+	logging.FromContext(req.Context()).Error(err)
+	writeProblem(writer, req, http.StatusInternalServerError, types.ErrorCodeInternal, "Internal server error")
+}
+
+// writeValidationProblem writes problem details of request failed validation
+func writeValidationProblem(writer http.ResponseWriter, req *http.Request, fieldErrors []*types.FieldError) {
+	messages := make([]string, len(fieldErrors))
+	for i, fieldErr := range fieldErrors {
+		messages[i] = fieldErr.Message
+	}
+	writeProblem(writer, req, http.StatusBadRequest, types.ErrorCodeValidationFailed, strings.Join(messages, "; "), fieldErrors...)
+}
+
+// writeJSON writes value as json response with given status code
+func writeJSON(writer http.ResponseWriter, statusCode int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
 		log.Error(errors.Wrap(err, "failed to write response json to output"))
 	}
 }
@@ -90,3 +190,30 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 		log.Error(errors.Wrap(err, "failed to write response json to output"))
 	}
 }
+
+// readiness is json body of readiness endpoint
+type readiness struct {
+	Ready bool `json:"ready"`
+	// Degraded lists components working in degraded mode
+	Degraded []string `json:"degraded"`
+}
+
+// ReadinessHandler provides a readiness check route, instance is not ready while
+// rate limiter store is unavailable and requests are rejected with fail-closed policy
+func ReadinessHandler(limitersStatus *ratelimit.Status, failurePolicy string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := &readiness{Ready: true, Degraded: []string{}}
+		if limitersStatus != nil && limitersStatus.Degraded() {
+			status.Degraded = append(status.Degraded, "rate_limiter")
+			if ratelimit.Policy(failurePolicy) == ratelimit.PolicyClosed {
+				status.Ready = false
+			}
+		}
+
+		if !status.Ready {
+			writeJSON(w, http.StatusServiceUnavailable, status)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	})
+}
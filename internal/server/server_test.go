@@ -0,0 +1,119 @@
+package server_test
+
+import (
+	"encoding/json"
+	"github.com/arkadyb/demo_messenger/internal/pkg/ipfilter"
+	"github.com/arkadyb/demo_messenger/internal/pkg/ratelimit"
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/arkadyb/demo_messenger/internal/verifier"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		degraded       bool
+		policy         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Ready", false, "closed", http.StatusOK, `{"ready":true,"degraded":[]}`},
+		{"Degraded", true, "local", http.StatusOK, `{"ready":true,"degraded":["rate_limiter"]}`},
+		{"Degraded fail-closed", true, "closed", http.StatusServiceUnavailable, `{"ready":false,"degraded":["rate_limiter"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := ratelimit.NewStatus(time.Minute, nil)
+			if tt.degraded {
+				primary := &MockedRateLimiter{}
+				primary.On("Take", mock.Anything, 1).Return(nil, errors.New("connection refused"))
+				fl, err := ratelimit.NewFallbackLimiter(primary, 1, time.Minute, ratelimit.PolicyOpen, status)
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				fl.Take("key", 1)
+			}
+
+			req := httptest.NewRequest("GET", "http://fake-url/ready", nil)
+			w := httptest.NewRecorder()
+			server.ReadinessHandler(status, tt.policy).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://fake-url/v1/templates/welcome", nil)
+	w := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map")
+	})
+	server.RequestIDMiddleware(server.RecoveryMiddleware(handler)).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	problem := &types.Problem{}
+	if !assert.NoError(t, json.NewDecoder(w.Body).Decode(problem)) {
+		t.FailNow()
+	}
+	assert.Equal(t, types.ErrorCodeInternal, problem.Code)
+	assert.Equal(t, "/v1/templates/welcome", problem.Instance)
+	assert.Equal(t, w.Header().Get("X-Request-ID"), problem.RequestID)
+	assert.NotContains(t, w.Body.String(), "nil map")
+}
+
+func TestNewServer_Verification(t *testing.T) {
+	tests := []struct {
+		name       string
+		verifier   verifier.Application
+		registered bool
+	}{
+		{"Enabled", &MockedVerifier{}, true},
+		{"Disabled", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies, err := utils.ParseTrustedProxies("", "")
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			filter, err := ipfilter.New(nil)
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+
+			srv := server.NewServer(server.Configuration{}, &MockedApplication{}, nil, tt.verifier, &MockedTenantsStore{}, &MockedRateLimiters{}, ratelimit.NewStatus(time.Minute, nil), proxies, filter, nil, nil)
+
+			var routes []string
+			err = srv.Handler.(*mux.Router).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+				if path, err := route.GetPathTemplate(); err == nil {
+					routes = append(routes, path)
+				}
+				return nil
+			})
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+
+			for _, path := range []string{"/v1/verify", "/v1/verify/check"} {
+				if tt.registered {
+					assert.Contains(t, routes, path)
+				} else {
+					assert.NotContains(t, routes, path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package types
+
+import "time"
+
+// QueueMessages is page of messages listed by admin API
+type QueueMessages struct {
+	Messages []*QueueMessage `json:"messages"`
+	// NextAfterID is passed as after_id to get the next page, 0 when there are no more messages
+	NextAfterID int64 `json:"next_after_id,omitempty"`
+}
+
+// QueueMessage is message stored in the queue along with its recipients
+type QueueMessage struct {
+	MessageID  int64  `json:"message_id"`
+	Originator string `json:"originator"`
+	Text       string `json:"text"`
+	// Processed is true once message was taken from the queue by messenger or cancelled
+	Processed bool   `json:"processed"`
+	Priority  string `json:"priority"`
+	// TenantID is tenant message was enqueued by, omitted for anonymous clients
+	TenantID   string            `json:"tenant_id,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	SendAfter  *time.Time        `json:"send_after,omitempty"`
+	Recipients []*QueueRecipient `json:"recipients"`
+}
+
+// QueueRecipient is delivery state of message recipient
+type QueueRecipient struct {
+	PhoneNumber string `json:"phone_number"`
+	// Status is "pending", "sent", "failed", "dead_lettered" or "cancelled"
+	Status    string `json:"status"`
+	ErrorCode int    `json:"error_code,omitempty"`
+	Attempts  int    `json:"attempts"`
+}
+
+// PurgeRequest removes every message of the originator waiting in the queue
+type PurgeRequest struct {
+	Originator string `json:"originator" validate:"required"`
+}
+
+// AdminActionResult is the outcome of admin action on the queue
+type AdminActionResult struct {
+	// Action is "cancel", "requeue" or "purge"
+	Action string `json:"action"`
+	// Recipients is number of recipients action was applied to
+	Recipients int `json:"recipients"`
+}
+
+// PauseRequest pauses sending of messages in the scope, messages are still accepted into the queue
+type PauseRequest struct {
+	// Scope is "global", "originator" or "tenant"
+	Scope string `json:"scope" validate:"required,oneof=global originator tenant"`
+	// Value is originator or tenant ID paused, it is not set for global pause
+	Value  string `json:"value,omitempty"`
+	Reason string `json:"reason,omitempty" validate:"max=256"`
+}
+
+// ResumeRequest resumes sending of messages in paused scope
+type ResumeRequest struct {
+	Scope string `json:"scope" validate:"required,oneof=global originator tenant"`
+	Value string `json:"value,omitempty"`
+}
+
+// Pause is pause of sending in effect
+type Pause struct {
+	Scope     string    `json:"scope"`
+	Value     string    `json:"value,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	PausedBy  string    `json:"paused_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Pauses lists pauses in effect
+type Pauses struct {
+	Pauses []*Pause `json:"pauses"`
+}
+
+// SuppressRequest adds recipient to suppression list, messages to suppressed recipients are rejected
+type SuppressRequest struct {
+	PhoneNumber string `json:"phone_number" validate:"required"`
+}
@@ -0,0 +1,61 @@
+package types
+
+// Problem is RFC 7807 problem details body of every error response, served with application/problem+json content type
+// https://tools.ietf.org/html/rfc7807
+type Problem struct {
+	// Type is "about:blank", so Title is the HTTP status text and Code tells problems apart
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Code is machine-readable error code, one of ErrorCode* constants
+	Code string `json:"code"`
+	// RequestID is X-Request-ID of the failed request
+	RequestID string `json:"request_id,omitempty"`
+	// Errors lists invalid fields of the request
+	Errors []*FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes invalid field of the request
+type FieldError struct {
+	// Field is json name of the field, nested fields are joined with dots, i.e. "messages[2].recipient"
+	Field string `json:"field"`
+	// Code is one of FieldErrorCode* constants
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error codes of problem details
+const (
+	ErrorCodeMalformedBody     = "malformed_body"
+	ErrorCodeBodyTooLarge      = "body_too_large"
+	ErrorCodeUnsupportedMedia  = "unsupported_media_type"
+	ErrorCodeValidationFailed  = "validation_failed"
+	ErrorCodeMessageRejected   = "message_rejected"
+	ErrorCodeNotFound          = "not_found"
+	ErrorCodeMethodNotAllowed  = "method_not_allowed"
+	ErrorCodeUnauthorized      = "unauthorized"
+	ErrorCodeForbidden         = "forbidden"
+	ErrorCodeRateLimitExceeded = "rate_limit_exceeded"
+	ErrorCodeRecipientLocked   = "recipient_locked"
+	// ErrorCodeIdempotencyConflict is returned while request with the same Idempotency-Key is in progress
+	ErrorCodeIdempotencyConflict = "idempotency_conflict"
+	// ErrorCodeIdempotencyKeyReused is returned when Idempotency-Key was used with different request
+	ErrorCodeIdempotencyKeyReused = "idempotency_key_reused"
+	ErrorCodeServiceUnavailable   = "service_unavailable"
+	ErrorCodeCircuitOpen          = "circuit_open"
+	ErrorCodeTimeout              = "timeout"
+	ErrorCodeInternal             = "internal_error"
+)
+
+// Error codes of invalid fields
+const (
+	FieldErrorCodeRequired = "required"
+	FieldErrorCodeTooLong  = "too_long"
+	FieldErrorCodeTooMany  = "too_many"
+	FieldErrorCodeConflict = "conflict"
+	FieldErrorCodeInvalid  = "invalid"
+	FieldErrorCodeUnknown  = "unknown"
+)
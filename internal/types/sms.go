@@ -1,7 +1,59 @@
 package types
 
+import "time"
+
+// SMS is the message enqueued for sending, fields are validated according to their validate tags
 type SMS struct {
-	Recipient  string `json:"recipient"`
-	Originator string `json:"originator"`
-	Message    string `json:"message"`
+	Recipient  string `json:"recipient" validate:"required"`
+	Originator string `json:"originator" validate:"required"`
+	Message    string `json:"message" validate:"max=160,required_without=template_id"`
+
+	// TemplateID and Variables are used to render message text from stored template instead of Message
+	TemplateID      string            `json:"template_id,omitempty" validate:"excluded_with=message"`
+	TemplateVersion int               `json:"template_version,omitempty" validate:"min=0"`
+	Variables       map[string]string `json:"variables,omitempty"`
+	// Locale of the template variant, inferred from recipient's country code when empty
+	Locale string `json:"locale,omitempty"`
+
+	// Priority of delivery, can be "low", "normal" (default) or "high"
+	Priority string `json:"priority,omitempty" validate:"oneof=low normal high"`
+
+	// Category of the message, quiet hours are applied per category and transactional messages bypass them
+	Category string `json:"category,omitempty"`
+	// TimeZone is IANA name of recipient's time zone, inferred from recipient's country code when empty
+	TimeZone string `json:"timezone,omitempty"`
+}
+
+// SMSReceipt holds details of enqueued sms
+type SMSReceipt struct {
+	// Status is "accepted", or "scheduled" when message is held until the end of recipient's quiet hours
+	Status      string     `json:"status"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+
+	// Template variant used to render message text
+	TemplateID      string `json:"template_id,omitempty"`
+	TemplateVersion int    `json:"template_version,omitempty"`
+	TemplateLocale  string `json:"template_locale,omitempty"`
+}
+
+// BulkSMSRequest holds messages enqueued with single request
+type BulkSMSRequest struct {
+	Messages []*SMS `json:"messages" validate:"required"`
+}
+
+// BulkSMSResponse holds result of every message of the bulk request, in order of the request
+type BulkSMSResponse struct {
+	Results []*BulkSMSResult `json:"results"`
+}
+
+// BulkSMSResult is the outcome of single message of the bulk request
+type BulkSMSResult struct {
+	// Status is receipt status for enqueued message, "rejected" for invalid message or "failed" when it can be retried
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Code is machine-readable error code of rejected or failed message, one of ErrorCode* constants
+	Code string `json:"code,omitempty"`
+	// Errors lists invalid fields of rejected message
+	Errors  []*FieldError `json:"errors,omitempty"`
+	Receipt *SMSReceipt   `json:"receipt,omitempty"`
 }
@@ -0,0 +1,32 @@
+package types
+
+import "time"
+
+// VerificationRequest asks to send one-time password to the recipient
+type VerificationRequest struct {
+	Recipient  string `json:"recipient" validate:"required"`
+	Originator string `json:"originator" validate:"required"`
+	// TemplateID of the message template with {{code}} placeholder, default message is used when empty
+	TemplateID string `json:"template_id,omitempty"`
+	Locale     string `json:"locale,omitempty"`
+}
+
+// Verification holds details of started verification
+type Verification struct {
+	VerificationID string    `json:"verification_id"`
+	Status         string    `json:"status"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// VerificationCheck asks to validate one-time password received by the recipient
+type VerificationCheck struct {
+	VerificationID string `json:"verification_id" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+// VerificationResult holds outcome of verification check
+type VerificationResult struct {
+	VerificationID string `json:"verification_id"`
+	Status         string `json:"status"`
+	AttemptsLeft   int    `json:"attempts_left"`
+}
@@ -0,0 +1,19 @@
+package verifier
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	verificationsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "verify_requests_total",
+		Help: "Number of verification requests by outcome",
+	}, []string{"outcome"})
+
+	checksCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "verify_checks_total",
+		Help: "Number of verification checks by outcome",
+	}, []string{"outcome"})
+)
+
+func init() {
+	prometheus.MustRegister(verificationsCounter, checksCounter)
+}
@@ -0,0 +1,238 @@
+package verifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/arkadyb/demo_messenger/internal/messenger"
+	"github.com/arkadyb/demo_messenger/internal/pkg/logging"
+	"github.com/arkadyb/demo_messenger/internal/pkg/templates"
+	"github.com/arkadyb/demo_messenger/internal/pkg/verifications"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/pkg/errors"
+	"math/big"
+	"time"
+)
+
+// ErrPhoneNumberLocked returned when phone number is locked out after too many failed checks
+var ErrPhoneNumberLocked = errors.New("phone number is locked out")
+
+// Application interface describes behaviour of one-time password verification service
+type Application interface {
+	// StartVerification generates one-time password and sends it to the recipient
+	StartVerification(context.Context, *types.VerificationRequest) (*types.Verification, error)
+	// CheckVerification validates one-time password received by the recipient
+	CheckVerification(context.Context, *types.VerificationCheck) (*types.VerificationResult, error)
+}
+
+// Config holds verifier settings
+type Config struct {
+	// CodeLength is number of digits in one-time password
+	CodeLength int
+	// CodeTTL defines how long one-time password stays valid
+	CodeTTL time.Duration
+	// MaxAttempts is number of checks allowed before verification gets locked
+	MaxAttempts int
+	// LockoutPeriod defines how long phone number cant start new verifications after verification got locked
+	LockoutPeriod time.Duration
+	// Secret is used to hash one-time passwords
+	Secret string
+	// Message is default message template with {{code}} placeholder
+	Message string
+}
+
+// NewVerifier creates new Verifier instance
+func NewVerifier(app messenger.Application, store verifications.Store, cfg Config) *Verifier {
+	return &Verifier{
+		app:   app,
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Verifier implements Application interface
+type Verifier struct {
+	app   messenger.Application
+	store verifications.Store
+	cfg   Config
+}
+
+// StartVerification generates one-time password, stores its hash and enqueues sms with it.
+// Verification is expired when sms cant be enqueued, so code which was never sent cant be checked.
+func (v *Verifier) StartVerification(ctx context.Context, req *types.VerificationRequest) (*types.Verification, error) {
+	if req == nil {
+		return nil, errors.New("verification request cant be nil")
+	}
+
+	locked, err := v.store.IsPhoneNumberLocked(ctx, req.Recipient)
+	if err != nil {
+		verificationsCounter.WithLabelValues("failed").Inc()
+		return nil, errors.Wrap(err, "failed to check phone number lockout")
+	}
+	if locked {
+		verificationsCounter.WithLabelValues("locked_out").Inc()
+		return nil, ErrPhoneNumberLocked
+	}
+
+	verificationID, err := randomID()
+	if err != nil {
+		verificationsCounter.WithLabelValues("failed").Inc()
+		return nil, errors.Wrap(err, "failed to generate verification id")
+	}
+	code, err := randomCode(v.cfg.CodeLength)
+	if err != nil {
+		verificationsCounter.WithLabelValues("failed").Inc()
+		return nil, errors.Wrap(err, "failed to generate code")
+	}
+
+	verification := &verifications.Verification{
+		VerificationID: verificationID,
+		PhoneNumber:    req.Recipient,
+		CodeHash:       v.hash(verificationID, code),
+		Status:         verifications.StatusPending,
+		ExpiresAt:      time.Now().Add(v.cfg.CodeTTL),
+	}
+	if err := v.store.SaveVerification(ctx, verification); err != nil {
+		verificationsCounter.WithLabelValues("failed").Inc()
+		return nil, errors.Wrap(err, "failed to save verification")
+	}
+
+	sms := &types.SMS{
+		Recipient:  req.Recipient,
+		Originator: req.Originator,
+		TemplateID: req.TemplateID,
+		Variables:  map[string]string{"code": code},
+		Locale:     req.Locale,
+		Priority:   "high",
+		Category:   "transactional",
+	}
+	if len(sms.TemplateID) == 0 {
+		if sms.Message, err = templates.Render(v.cfg.Message, sms.Variables); err != nil {
+			verificationsCounter.WithLabelValues("failed").Inc()
+			return nil, errors.Wrap(err, "failed to render verification message")
+		}
+		sms.Variables = nil
+	}
+
+	if _, err := v.app.EnqueueSMS(ctx, sms); err != nil {
+		verificationsCounter.WithLabelValues("failed").Inc()
+		if expireErr := v.store.UpdateStatus(context.Background(), verification.VerificationID, verifications.StatusExpired); expireErr != nil {
+			logging.FromContext(ctx).Error(errors.Wrapf(expireErr, "failed to expire verification %s", verification.VerificationID))
+		}
+		return nil, errors.Wrap(err, "failed to enqueue verification sms")
+	}
+
+	verificationsCounter.WithLabelValues("sent").Inc()
+	return &types.Verification{
+		VerificationID: verification.VerificationID,
+		Status:         verification.Status,
+		ExpiresAt:      verification.ExpiresAt,
+	}, nil
+}
+
+// CheckVerification validates one-time password, verification gets locked when attempts limit is reached
+func (v *Verifier) CheckVerification(ctx context.Context, check *types.VerificationCheck) (*types.VerificationResult, error) {
+	if check == nil {
+		return nil, errors.New("verification check cant be nil")
+	}
+
+	verification, err := v.store.GetVerification(ctx, check.VerificationID)
+	if err == verifications.ErrVerificationNotFound {
+		checksCounter.WithLabelValues("not_found").Inc()
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get verification")
+	}
+
+	result := &types.VerificationResult{
+		VerificationID: verification.VerificationID,
+	}
+
+	switch verification.Status {
+	case verifications.StatusPending:
+	case verifications.StatusApproved:
+		// approved code cant be used twice
+		return v.result(result, verifications.StatusExpired, 0), nil
+	default:
+		return v.result(result, verification.Status, 0), nil
+	}
+
+	if time.Now().After(verification.ExpiresAt) {
+		if err := v.store.UpdateStatus(ctx, verification.VerificationID, verifications.StatusExpired); err != nil && err != verifications.ErrVerificationNotFound {
+			return nil, errors.Wrap(err, "failed to expire verification")
+		}
+		return v.result(result, verifications.StatusExpired, 0), nil
+	}
+
+	attempts, err := v.store.IncrementAttempts(ctx, verification.VerificationID)
+	if err == verifications.ErrVerificationNotFound {
+		// verification has been concurrently approved or locked
+		return v.result(result, verifications.StatusExpired, 0), nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to increment verification attempts")
+	}
+	if attempts > v.cfg.MaxAttempts {
+		return v.lock(ctx, result)
+	}
+
+	if hmac.Equal([]byte(v.hash(verification.VerificationID, check.Code)), []byte(verification.CodeHash)) {
+		if err := v.store.UpdateStatus(ctx, verification.VerificationID, verifications.StatusApproved); err != nil {
+			if err == verifications.ErrVerificationNotFound {
+				return v.result(result, verifications.StatusExpired, 0), nil
+			}
+			return nil, errors.Wrap(err, "failed to approve verification")
+		}
+		return v.result(result, verifications.StatusApproved, 0), nil
+	}
+
+	if attempts == v.cfg.MaxAttempts {
+		return v.lock(ctx, result)
+	}
+
+	return v.result(result, "rejected", v.cfg.MaxAttempts-attempts), nil
+}
+
+func (v *Verifier) lock(ctx context.Context, result *types.VerificationResult) (*types.VerificationResult, error) {
+	if err := v.store.Lock(ctx, result.VerificationID, time.Now().Add(v.cfg.LockoutPeriod)); err != nil && err != verifications.ErrVerificationNotFound {
+		return nil, errors.Wrap(err, "failed to lock verification")
+	}
+	return v.result(result, verifications.StatusLocked, 0), nil
+}
+
+func (v *Verifier) result(result *types.VerificationResult, status string, attemptsLeft int) *types.VerificationResult {
+	checksCounter.WithLabelValues(status).Inc()
+	result.Status = status
+	result.AttemptsLeft = attemptsLeft
+	return result
+}
+
+// hash returns HMAC of the code bound to verification ID, so same codes produce different hashes
+func (v *Verifier) hash(verificationID, code string) string {
+	mac := hmac.New(sha256.New, []byte(v.cfg.Secret))
+	mac.Write([]byte(verificationID + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func randomCode(length int) (string, error) {
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code), nil
+}
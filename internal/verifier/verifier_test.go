@@ -0,0 +1,320 @@
+package verifier_test
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/verifications"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/arkadyb/demo_messenger/internal/verifier"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type MockedApplication struct {
+	mock.Mock
+}
+
+func (ma *MockedApplication) EnqueueSMS(ctx context.Context, sms *types.SMS) (receipt *types.SMSReceipt, err error) {
+	args := ma.Called(ctx, sms)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	if args.Get(0) != nil {
+		receipt = args.Get(0).(*types.SMSReceipt)
+	}
+
+	return
+}
+
+type MockedStore struct {
+	mock.Mock
+}
+
+func (ms *MockedStore) SaveVerification(ctx context.Context, v *verifications.Verification) (err error) {
+	args := ms.Called(ctx, v)
+
+	if args.Get(0) != nil {
+		err = args.Error(0)
+	}
+
+	return
+}
+
+func (ms *MockedStore) GetVerification(ctx context.Context, id string) (v *verifications.Verification, err error) {
+	args := ms.Called(ctx, id)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	if args.Get(0) != nil {
+		v = args.Get(0).(*verifications.Verification)
+	}
+
+	return
+}
+
+func (ms *MockedStore) IncrementAttempts(ctx context.Context, id string) (attempts int, err error) {
+	args := ms.Called(ctx, id)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	return args.Int(0), err
+}
+
+func (ms *MockedStore) UpdateStatus(ctx context.Context, id, status string) (err error) {
+	args := ms.Called(ctx, id, status)
+
+	if args.Get(0) != nil {
+		err = args.Error(0)
+	}
+
+	return
+}
+
+func (ms *MockedStore) Lock(ctx context.Context, id string, until time.Time) (err error) {
+	args := ms.Called(ctx, id, until)
+
+	if args.Get(0) != nil {
+		err = args.Error(0)
+	}
+
+	return
+}
+
+func (ms *MockedStore) IsPhoneNumberLocked(ctx context.Context, phoneNumber string) (locked bool, err error) {
+	args := ms.Called(ctx, phoneNumber)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	return args.Bool(0), err
+}
+
+var cfg = verifier.Config{
+	CodeLength:    6,
+	CodeTTL:       time.Minute,
+	MaxAttempts:   3,
+	LockoutPeriod: time.Hour,
+	Secret:        "secret",
+	Message:       "Your code is {{code}}",
+}
+
+// startVerification runs verification and returns stored verification together with the code sent
+func startVerification(t *testing.T) (*verifications.Verification, string) {
+	var (
+		saved *verifications.Verification
+		code  string
+	)
+
+	store := &MockedStore{}
+	store.On("IsPhoneNumberLocked", mock.Anything, "+4412345").Return(false, nil)
+	store.On("SaveVerification", mock.Anything, mock.MatchedBy(func(v *verifications.Verification) bool {
+		saved = v
+		return true
+	})).Return(nil)
+
+	app := &MockedApplication{}
+	app.On("EnqueueSMS", mock.Anything, mock.MatchedBy(func(sms *types.SMS) bool {
+		if match := regexp.MustCompile(`^Your code is (\d{6})$`).FindStringSubmatch(sms.Message); match != nil {
+			code = match[1]
+		}
+		return true
+	})).Return(&types.SMSReceipt{Status: "accepted"}, nil)
+
+	got, err := verifier.NewVerifier(app, store, cfg).StartVerification(context.Background(), &types.VerificationRequest{
+		Recipient:  "+4412345",
+		Originator: "originator",
+	})
+	if !assert.NoError(t, err) || !assert.NotNil(t, saved) || !assert.Len(t, code, 6) {
+		t.FailNow()
+	}
+	assert.Equal(t, saved.VerificationID, got.VerificationID)
+	assert.Equal(t, verifications.StatusPending, got.Status)
+	assert.NotEqual(t, code, saved.CodeHash)
+
+	return saved, code
+}
+
+func TestVerifier_StartVerification(t *testing.T) {
+	startVerification(t)
+
+	t.Run("Locked out", func(t *testing.T) {
+		store := &MockedStore{}
+		store.On("IsPhoneNumberLocked", mock.Anything, "+4412345").Return(true, nil)
+
+		_, err := verifier.NewVerifier(nil, store, cfg).StartVerification(context.Background(), &types.VerificationRequest{
+			Recipient:  "+4412345",
+			Originator: "originator",
+		})
+		assert.Equal(t, verifier.ErrPhoneNumberLocked, err)
+	})
+
+	t.Run("Template", func(t *testing.T) {
+		store := &MockedStore{}
+		store.On("IsPhoneNumberLocked", mock.Anything, "+4412345").Return(false, nil)
+		store.On("SaveVerification", mock.Anything, mock.Anything).Return(nil)
+
+		app := &MockedApplication{}
+		app.On("EnqueueSMS", mock.Anything, mock.MatchedBy(func(sms *types.SMS) bool {
+			return sms.TemplateID == "otp" && sms.Locale == "de" && len(sms.Variables["code"]) == 6 && len(sms.Message) == 0
+		})).Return(&types.SMSReceipt{Status: "accepted"}, nil)
+
+		_, err := verifier.NewVerifier(app, store, cfg).StartVerification(context.Background(), &types.VerificationRequest{
+			Recipient:  "+4412345",
+			Originator: "originator",
+			TemplateID: "otp",
+			Locale:     "de",
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Enqueue error", func(t *testing.T) {
+		var saved *verifications.Verification
+
+		store := &MockedStore{}
+		store.On("IsPhoneNumberLocked", mock.Anything, "+4412345").Return(false, nil)
+		store.On("SaveVerification", mock.Anything, mock.MatchedBy(func(v *verifications.Verification) bool {
+			saved = v
+			return true
+		})).Return(nil)
+		store.On("UpdateStatus", mock.Anything, mock.Anything, verifications.StatusExpired).Return(nil)
+
+		app := &MockedApplication{}
+		app.On("EnqueueSMS", mock.Anything, mock.Anything).Return(nil, errors.New("error"))
+
+		_, err := verifier.NewVerifier(app, store, cfg).StartVerification(context.Background(), &types.VerificationRequest{
+			Recipient:  "+4412345",
+			Originator: "originator",
+		})
+		if !assert.Error(t, err) || !assert.NotNil(t, saved) {
+			t.FailNow()
+		}
+		store.AssertCalled(t, "UpdateStatus", mock.Anything, saved.VerificationID, verifications.StatusExpired)
+	})
+}
+
+func TestVerifier_CheckVerification(t *testing.T) {
+	saved, code := startVerification(t)
+
+	pending := func(attempts int) *verifications.Verification {
+		v := *saved
+		v.Attempts = attempts
+		return &v
+	}
+
+	tests := []struct {
+		name         string
+		code         string
+		store        func() *MockedStore
+		wantStatus   string
+		attemptsLeft int
+		wantErr      error
+	}{
+		{
+			"Approved",
+			code,
+			func() *MockedStore {
+				store := &MockedStore{}
+				store.On("GetVerification", mock.Anything, saved.VerificationID).Return(pending(0), nil)
+				store.On("IncrementAttempts", mock.Anything, saved.VerificationID).Return(1, nil)
+				store.On("UpdateStatus", mock.Anything, saved.VerificationID, verifications.StatusApproved).Return(nil)
+				return store
+			},
+			verifications.StatusApproved,
+			0,
+			nil,
+		},
+		{
+			"Rejected",
+			"000000x",
+			func() *MockedStore {
+				store := &MockedStore{}
+				store.On("GetVerification", mock.Anything, saved.VerificationID).Return(pending(0), nil)
+				store.On("IncrementAttempts", mock.Anything, saved.VerificationID).Return(1, nil)
+				return store
+			},
+			"rejected",
+			2,
+			nil,
+		},
+		{
+			"Locked on last failed attempt",
+			"000000x",
+			func() *MockedStore {
+				store := &MockedStore{}
+				store.On("GetVerification", mock.Anything, saved.VerificationID).Return(pending(2), nil)
+				store.On("IncrementAttempts", mock.Anything, saved.VerificationID).Return(3, nil)
+				store.On("Lock", mock.Anything, saved.VerificationID, mock.Anything).Return(nil)
+				return store
+			},
+			verifications.StatusLocked,
+			0,
+			nil,
+		},
+		{
+			"Expired",
+			code,
+			func() *MockedStore {
+				v := pending(0)
+				v.ExpiresAt = time.Now().Add(-time.Second)
+
+				store := &MockedStore{}
+				store.On("GetVerification", mock.Anything, saved.VerificationID).Return(v, nil)
+				store.On("UpdateStatus", mock.Anything, saved.VerificationID, verifications.StatusExpired).Return(nil)
+				return store
+			},
+			verifications.StatusExpired,
+			0,
+			nil,
+		},
+		{
+			"Already approved",
+			code,
+			func() *MockedStore {
+				v := pending(1)
+				v.Status = verifications.StatusApproved
+
+				store := &MockedStore{}
+				store.On("GetVerification", mock.Anything, saved.VerificationID).Return(v, nil)
+				return store
+			},
+			verifications.StatusExpired,
+			0,
+			nil,
+		},
+		{
+			"Not found",
+			code,
+			func() *MockedStore {
+				store := &MockedStore{}
+				store.On("GetVerification", mock.Anything, saved.VerificationID).Return(nil, verifications.ErrVerificationNotFound)
+				return store
+			},
+			"",
+			0,
+			verifications.ErrVerificationNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifier.NewVerifier(nil, tt.store(), cfg).CheckVerification(context.Background(), &types.VerificationCheck{
+				VerificationID: saved.VerificationID,
+				Code:           tt.code,
+			})
+			if !assert.Equal(t, tt.wantErr, err) || err != nil {
+				return
+			}
+			assert.Equal(t, tt.wantStatus, got.Status)
+			assert.Equal(t, tt.attemptsLeft, got.AttemptsLeft)
+		})
+	}
+}
@@ -0,0 +1,12 @@
+CREATE TABLE audit_log (
+    audit_id bigserial PRIMARY KEY,
+    actor text NOT NULL,
+    action text NOT NULL,
+    target text NOT NULL,
+    details jsonb,
+    outcome text NOT NULL,
+    request_id text,
+    client_ip text,
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX audit_log_created_at_idx ON audit_log(created_at);
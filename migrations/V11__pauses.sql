@@ -0,0 +1,10 @@
+ALTER TABLE messages ADD COLUMN tenant_id text;
+
+CREATE TABLE pauses (
+    scope text NOT NULL,
+    value text NOT NULL DEFAULT '',
+    reason text,
+    paused_by text NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (scope, value)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_keys (
+    scope text NOT NULL,
+    idempotency_key text NOT NULL,
+    fingerprint text NOT NULL,
+    status_code integer,
+    content_type text,
+    body bytea,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (scope, idempotency_key)
+);
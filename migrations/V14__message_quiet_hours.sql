@@ -0,0 +1,2 @@
+ALTER TABLE messages ADD COLUMN category text;
+ALTER TABLE messages ADD COLUMN time_zone text;
@@ -0,0 +1,7 @@
+CREATE TABLE templates (
+    template_id text NOT NULL,
+    version integer NOT NULL,
+    body text NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (template_id, version)
+);
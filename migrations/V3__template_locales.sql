@@ -0,0 +1,4 @@
+ALTER TABLE templates ADD COLUMN locale text NOT NULL DEFAULT 'en';
+ALTER TABLE templates DROP CONSTRAINT templates_pkey;
+ALTER TABLE templates ADD PRIMARY KEY (template_id, locale, version);
+ALTER TABLE templates ALTER COLUMN locale DROP DEFAULT;
@@ -0,0 +1,11 @@
+CREATE TABLE verifications (
+    verification_id text NOT NULL PRIMARY KEY,
+    phone_number text NOT NULL,
+    code_hash text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    expires_at timestamp with time zone NOT NULL,
+    locked_until timestamp with time zone,
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX verifications_phone_number_idx ON verifications(phone_number, status);
@@ -0,0 +1,3 @@
+ALTER TABLE messages ADD COLUMN priority smallint NOT NULL DEFAULT 1;
+ALTER TABLE messages ADD COLUMN created_at timestamp with time zone NOT NULL DEFAULT now();
+CREATE INDEX messages_unprocessed_idx ON messages(priority DESC, message_id) WHERE processed = FALSE;
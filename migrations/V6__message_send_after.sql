@@ -0,0 +1,4 @@
+ALTER TABLE messages ADD COLUMN send_after timestamp with time zone;
+DROP INDEX messages_unprocessed_idx;
+CREATE INDEX messages_unprocessed_idx ON messages(priority DESC, message_id) WHERE processed = FALSE AND send_after IS NULL;
+CREATE INDEX messages_scheduled_idx ON messages(send_after) WHERE processed = FALSE AND send_after IS NOT NULL;
@@ -0,0 +1,9 @@
+ALTER TABLE recipients ADD COLUMN status text NOT NULL DEFAULT 'pending';
+ALTER TABLE recipients ADD COLUMN error_code integer;
+ALTER TABLE recipients ADD COLUMN attempts integer NOT NULL DEFAULT 0;
+
+CREATE TABLE suppressions (
+    phone_number text NOT NULL PRIMARY KEY,
+    error_code integer,
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
@@ -0,0 +1,14 @@
+CREATE TABLE rate_limit_tiers (
+    name text NOT NULL PRIMARY KEY,
+    max_requests integer NOT NULL,
+    bulk_max_requests integer NOT NULL
+);
+
+CREATE TABLE api_keys (
+    api_key_hash text NOT NULL PRIMARY KEY,
+    tenant_id text NOT NULL,
+    tier text NOT NULL REFERENCES rate_limit_tiers(name),
+    revoked boolean NOT NULL DEFAULT FALSE,
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX api_keys_tenant_idx ON api_keys(tenant_id);
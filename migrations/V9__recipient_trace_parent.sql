@@ -0,0 +1 @@
+ALTER TABLE recipients ADD COLUMN trace_parent text;
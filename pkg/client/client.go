@@ -0,0 +1,257 @@
+// Package client is Go client of demo_messenger HTTP API. Sending is retried on network errors, rate limits and server errors
+// with the same Idempotency-Key, so every message is enqueued once.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request and response bodies of the API
+type (
+	// SMS is the message enqueued for sending
+	SMS = types.SMS
+	// SMSReceipt holds details of enqueued sms
+	SMSReceipt = types.SMSReceipt
+	// BulkSMSResponse holds result of every message of the bulk request, in order of the request
+	BulkSMSResponse = types.BulkSMSResponse
+	// BulkSMSResult is the outcome of single message of the bulk request
+	BulkSMSResult = types.BulkSMSResult
+	// Problem is RFC 7807 problem details of error response
+	Problem = types.Problem
+	// FieldError describes invalid field of the request
+	FieldError = types.FieldError
+)
+
+// Defaults of the Config
+const (
+	DefaultRetryBackoff = time.Second
+	DefaultMaxRetryWait = time.Minute
+)
+
+// Config holds client settings
+type Config struct {
+	// APIKey of the tenant is sent with every request, requests are anonymous when it is empty
+	APIKey string
+	// HTTPClient sends requests, http.DefaultClient is used when nil
+	HTTPClient *http.Client
+	// MaxRetries is number of times request failed with network error, rate limit, server error
+	// or conflict with request in progress is retried, 0 disables retries
+	MaxRetries int
+	// RetryBackoff is the wait before first retry when response has no Retry-After header, doubles with every retry.
+	// DefaultRetryBackoff is used when it is not set
+	RetryBackoff time.Duration
+	// MaxRetryWait limits the wait before retry, request server asks to retry later than that fails.
+	// DefaultMaxRetryWait is used when it is not set
+	MaxRetryWait time.Duration
+}
+
+// Client sends messages through the API, it is safe for concurrent use
+type Client struct {
+	baseURL string
+	cfg     Config
+}
+
+// NewClient returns client of the API served at baseURL, i.e. "http://localhost:8085"
+func NewClient(baseURL string, cfg Config) *Client {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	if cfg.MaxRetryWait <= 0 {
+		cfg.MaxRetryWait = DefaultMaxRetryWait
+	}
+
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		cfg:     cfg,
+	}
+}
+
+// Error is returned for error response of the API
+type Error struct {
+	StatusCode int
+	// Problem is problem details of the response, nil when response has no problem details body
+	Problem *Problem
+	// RetryAfter is the wait server asked for before the request is retried
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Problem == nil {
+		return fmt.Sprintf("messenger responded with %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	msg := fmt.Sprintf("messenger responded with %d %s (%s)", e.StatusCode, e.Problem.Title, e.Problem.Code)
+	if len(e.Problem.Detail) > 0 {
+		msg += ": " + e.Problem.Detail
+	}
+	for _, fieldError := range e.Problem.Errors {
+		msg += fmt.Sprintf("; %s: %s", fieldError.Field, fieldError.Message)
+	}
+	return msg
+}
+
+// Code returns machine-readable code of the problem, i.e. "validation_failed"
+func (e *Error) Code() string {
+	if e.Problem == nil {
+		return ""
+	}
+	return e.Problem.Code
+}
+
+// temporary tells if the request can succeed when retried
+func (e *Error) temporary() bool {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode >= http.StatusInternalServerError:
+		return true
+	case e.StatusCode == http.StatusConflict:
+		return e.Code() == types.ErrorCodeIdempotencyConflict
+	}
+	return false
+}
+
+// SendSMS enqueues sms. Error response is returned as *Error, so its problem details are inspected with type assertion.
+// Request is retried with the same idempotencyKey, random key is generated when it is empty.
+// Key identifying the message in caller's domain, i.e. ID of the order message notifies about, makes repeated calls safe too.
+func (c *Client) SendSMS(ctx context.Context, sms *SMS, idempotencyKey string) (*SMSReceipt, error) {
+	receipt := &SMSReceipt{}
+	if err := c.post(ctx, "/v1/send/sms", sms, idempotencyKey, receipt); err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// SendBulkSMS enqueues messages with single request. Every message is validated and enqueued on its own,
+// so outcome of each of them is checked in results of the response.
+// Request is retried with the same idempotencyKey, random key is generated when it is empty.
+func (c *Client) SendBulkSMS(ctx context.Context, messages []*SMS, idempotencyKey string) (*BulkSMSResponse, error) {
+	response := &BulkSMSResponse{}
+	if err := c.post(ctx, "/v1/send/sms/bulk", &types.BulkSMSRequest{Messages: messages}, idempotencyKey, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// post sends body to the path and decodes response into result, retrying temporary failures
+func (c *Client) post(ctx context.Context, path string, body interface{}, idempotencyKey string, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode request")
+	}
+	if len(idempotencyKey) == 0 {
+		if idempotencyKey, err = newIdempotencyKey(); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.do(ctx, path, data, idempotencyKey, result)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		wait := c.cfg.RetryBackoff << uint(attempt)
+		switch e := err.(type) {
+		case *Error:
+			if !e.temporary() {
+				return err
+			}
+			if e.RetryAfter > 0 {
+				wait = e.RetryAfter
+			}
+		case *url.Error:
+			// response was not received
+		default:
+			return err
+		}
+		if attempt >= c.cfg.MaxRetries || wait > c.cfg.MaxRetryWait {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// do sends single request, error response is returned as *Error and network error as *url.Error
+func (c *Client) do(ctx context.Context, path string, data []byte, idempotencyKey string, result interface{}) error {
+	req, err := http.NewRequest("POST", c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	if len(c.cfg.APIKey) > 0 {
+		req.Header.Set("X-API-Key", c.cfg.APIKey)
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &Error{StatusCode: resp.StatusCode, RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+		problem := &Problem{}
+		if err := json.NewDecoder(resp.Body).Decode(problem); err == nil && len(problem.Code) > 0 {
+			apiErr.Problem = problem
+		}
+		return apiErr
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.Wrapf(err, "failed to decode response of %s", path)
+	}
+
+	return nil
+}
+
+// retryAfter parses Retry-After header given either in seconds or as HTTP date, 0 is returned when it is not set
+func retryAfter(value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(time.Now()) {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// newIdempotencyKey generates random key of the request
+func newIdempotencyKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", errors.Wrap(err, "failed to generate idempotency key")
+	}
+	return hex.EncodeToString(key), nil
+}
@@ -0,0 +1,407 @@
+package client_test
+
+import (
+	"context"
+	"github.com/arkadyb/demo_messenger/internal/pkg/idempotency"
+	"github.com/arkadyb/demo_messenger/internal/pkg/ipfilter"
+	"github.com/arkadyb/demo_messenger/internal/pkg/ratelimit"
+	"github.com/arkadyb/demo_messenger/internal/pkg/tenants"
+	"github.com/arkadyb/demo_messenger/internal/pkg/utils"
+	"github.com/arkadyb/demo_messenger/internal/server"
+	"github.com/arkadyb/demo_messenger/internal/types"
+	"github.com/arkadyb/demo_messenger/pkg/client"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type MockedApplication struct {
+	mock.Mock
+}
+
+func (ma *MockedApplication) EnqueueSMS(ctx context.Context, sms *types.SMS) (receipt *types.SMSReceipt, err error) {
+	args := ma.Called(ctx, sms)
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	if args.Get(0) != nil {
+		receipt = args.Get(0).(*types.SMSReceipt)
+	}
+
+	return
+}
+
+type MockedIdempotencyStore struct {
+	mock.Mock
+}
+
+func (m *MockedIdempotencyStore) Begin(ctx context.Context, scope, key, fingerprint string) (response *idempotency.Response, err error) {
+	args := m.Called(ctx, scope, key, fingerprint)
+	if args.Get(0) != nil {
+		response = args.Get(0).(*idempotency.Response)
+	}
+
+	if args.Get(1) != nil {
+		err = args.Error(1)
+	}
+
+	return
+}
+
+func (m *MockedIdempotencyStore) Complete(ctx context.Context, scope, key string, response *idempotency.Response) error {
+	args := m.Called(ctx, scope, key, response)
+	return args.Error(0)
+}
+
+func (m *MockedIdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	args := m.Called(ctx, scope, key)
+	return args.Error(0)
+}
+
+// testServer serves the API with given application and idempotency store and records Idempotency-Key of every request
+type testServer struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	keys []string
+}
+
+func (ts *testServer) requestKeys() []string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]string(nil), ts.keys...)
+}
+
+// newTestServer starts the API for tenant "acme" of API key "secret", its tier allows maxRequests per second
+func newTestServer(t *testing.T, app *MockedApplication, store *MockedIdempotencyStore, maxRequests int) *testServer {
+	tenantsStore, err := tenants.NewStaticStore("secret=acme:test", "test="+strconv.Itoa(maxRequests)+":"+strconv.Itoa(maxRequests))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	limiters := server.NewTierRateLimiters(tenantsStore, tenants.Tier{MaxRequests: 1, BulkMaxRequests: 1}, func(maxRequests int) (server.RateLimiter, error) {
+		return ratelimit.NewMemoryLimiter(maxRequests, time.Second)
+	})
+	proxies, err := utils.ParseTrustedProxies("", "")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	filter, err := ipfilter.New(nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	cfg := server.Configuration{
+		CircuitBreakerTimeoutSeconds:        10,
+		CircuitBreakerSleepWindowSeconds:    10,
+		CircuitBreakerErrorPercentThreshold: 100,
+		BulkMaxMessages:                     3,
+		MaxRequestBodyBytes:                 1 << 20,
+		AuthRequired:                        true,
+	}
+	srv := server.NewServer(cfg, app, nil, nil, tenantsStore, limiters, ratelimit.NewStatus(time.Minute, nil), proxies, filter, store, nil)
+
+	ts := &testServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ts.mu.Lock()
+		ts.keys = append(ts.keys, req.Header.Get("Idempotency-Key"))
+		ts.mu.Unlock()
+
+		srv.Handler.ServeHTTP(w, req)
+	}))
+	return ts
+}
+
+func TestClient_SendSMS(t *testing.T) {
+	sms := &client.SMS{Recipient: "12345", Originator: "originator", Message: "message"}
+	accepted := &types.SMSReceipt{Status: "accepted"}
+
+	tests := []struct {
+		name             string
+		sms              *client.SMS
+		key              string
+		maxRetries       int
+		app              func() *MockedApplication
+		store            func() *MockedIdempotencyStore
+		expectedReceipt  *client.SMSReceipt
+		expectedStatus   int
+		expectedCode     string
+		expectedRequests int
+	}{
+		{
+			"Success",
+			sms,
+			"order-1",
+			3,
+			func() *MockedApplication {
+				app := &MockedApplication{}
+				app.On("EnqueueSMS", mock.Anything, sms).Return(accepted, nil)
+				return app
+			},
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "tenant:acme", "order-1", mock.Anything).Return(nil, nil)
+				store.On("Complete", mock.Anything, "tenant:acme", "order-1", mock.Anything).Return(nil)
+				return store
+			},
+			accepted,
+			0,
+			"",
+			1,
+		},
+		{
+			"Validation error is not retried",
+			&client.SMS{Originator: "originator", Message: "message"},
+			"order-1",
+			3,
+			func() *MockedApplication {
+				return &MockedApplication{}
+			},
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "tenant:acme", "order-1", mock.Anything).Return(nil, nil)
+				store.On("Complete", mock.Anything, "tenant:acme", "order-1", mock.Anything).Return(nil)
+				return store
+			},
+			nil,
+			http.StatusBadRequest,
+			types.ErrorCodeValidationFailed,
+			1,
+		},
+		{
+			"Server error is retried",
+			sms,
+			"order-1",
+			3,
+			func() *MockedApplication {
+				app := &MockedApplication{}
+				app.On("EnqueueSMS", mock.Anything, sms).Return(nil, errors.New("pq: connection refused")).Once()
+				app.On("EnqueueSMS", mock.Anything, sms).Return(accepted, nil)
+				return app
+			},
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "tenant:acme", "order-1", mock.Anything).Return(nil, nil)
+				store.On("Release", mock.Anything, "tenant:acme", "order-1").Return(nil)
+				store.On("Complete", mock.Anything, "tenant:acme", "order-1", mock.Anything).Return(nil)
+				return store
+			},
+			accepted,
+			0,
+			"",
+			2,
+		},
+		{
+			"Retries exhausted",
+			sms,
+			"order-1",
+			1,
+			func() *MockedApplication {
+				app := &MockedApplication{}
+				app.On("EnqueueSMS", mock.Anything, sms).Return(nil, errors.New("pq: connection refused"))
+				return app
+			},
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "tenant:acme", "order-1", mock.Anything).Return(nil, nil)
+				store.On("Release", mock.Anything, "tenant:acme", "order-1").Return(nil)
+				return store
+			},
+			nil,
+			http.StatusInternalServerError,
+			types.ErrorCodeInternal,
+			2,
+		},
+		{
+			"Request in progress is retried",
+			sms,
+			"order-1",
+			3,
+			func() *MockedApplication {
+				return &MockedApplication{}
+			},
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "tenant:acme", "order-1", mock.Anything).Return(nil, idempotency.ErrRequestInProgress).Once()
+				store.On("Begin", mock.Anything, "tenant:acme", "order-1", mock.Anything).Return(&idempotency.Response{StatusCode: http.StatusAccepted, ContentType: "application/json", Body: []byte(`{"status":"accepted"}`)}, nil)
+				return store
+			},
+			accepted,
+			0,
+			"",
+			2,
+		},
+		{
+			"Reused key is not retried",
+			sms,
+			"order-1",
+			3,
+			func() *MockedApplication {
+				return &MockedApplication{}
+			},
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "tenant:acme", "order-1", mock.Anything).Return(nil, idempotency.ErrKeyReused)
+				return store
+			},
+			nil,
+			http.StatusUnprocessableEntity,
+			types.ErrorCodeIdempotencyKeyReused,
+			1,
+		},
+		{
+			"Key is generated",
+			sms,
+			"",
+			3,
+			func() *MockedApplication {
+				app := &MockedApplication{}
+				app.On("EnqueueSMS", mock.Anything, sms).Return(nil, errors.New("pq: connection refused")).Once()
+				app.On("EnqueueSMS", mock.Anything, sms).Return(accepted, nil)
+				return app
+			},
+			func() *MockedIdempotencyStore {
+				store := &MockedIdempotencyStore{}
+				store.On("Begin", mock.Anything, "tenant:acme", mock.Anything, mock.Anything).Return(nil, nil)
+				store.On("Release", mock.Anything, "tenant:acme", mock.Anything).Return(nil)
+				store.On("Complete", mock.Anything, "tenant:acme", mock.Anything, mock.Anything).Return(nil)
+				return store
+			},
+			accepted,
+			0,
+			"",
+			2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, tt.app(), tt.store(), 100)
+			defer ts.Close()
+
+			c := client.NewClient(ts.URL, client.Config{APIKey: "secret", MaxRetries: tt.maxRetries, RetryBackoff: 10 * time.Millisecond})
+			receipt, err := c.SendSMS(context.Background(), tt.sms, tt.key)
+			if tt.expectedStatus == 0 {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				assert.Equal(t, tt.expectedReceipt, receipt)
+			} else {
+				apiErr, ok := err.(*client.Error)
+				if !assert.True(t, ok, "error %v is not *client.Error", err) {
+					t.FailNow()
+				}
+				assert.Equal(t, tt.expectedStatus, apiErr.StatusCode)
+				assert.Equal(t, tt.expectedCode, apiErr.Code())
+			}
+
+			keys := ts.requestKeys()
+			if !assert.Len(t, keys, tt.expectedRequests) {
+				t.FailNow()
+			}
+			for _, key := range keys {
+				assert.NotEmpty(t, key)
+				assert.Equal(t, keys[0], key)
+				if len(tt.key) > 0 {
+					assert.Equal(t, tt.key, key)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_SendSMS_RateLimited(t *testing.T) {
+	sms := &client.SMS{Recipient: "12345", Originator: "originator", Message: "message"}
+
+	app := &MockedApplication{}
+	app.On("EnqueueSMS", mock.Anything, sms).Return(&types.SMSReceipt{Status: "accepted"}, nil)
+	store := &MockedIdempotencyStore{}
+	store.On("Begin", mock.Anything, "tenant:acme", mock.Anything, mock.Anything).Return(nil, nil)
+	store.On("Complete", mock.Anything, "tenant:acme", mock.Anything, mock.Anything).Return(nil)
+	ts := newTestServer(t, app, store, 1)
+	defer ts.Close()
+
+	withoutRetries := client.NewClient(ts.URL, client.Config{APIKey: "secret"})
+	_, err := withoutRetries.SendSMS(context.Background(), sms, "order-1")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = withoutRetries.SendSMS(context.Background(), sms, "order-2")
+	apiErr, ok := err.(*client.Error)
+	if !assert.True(t, ok, "error %v is not *client.Error", err) {
+		t.FailNow()
+	}
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(t, types.ErrorCodeRateLimitExceeded, apiErr.Code())
+	assert.Equal(t, time.Second, apiErr.RetryAfter)
+
+	// wait server asks for is longer than allowed
+	impatient := client.NewClient(ts.URL, client.Config{APIKey: "secret", MaxRetries: 3, MaxRetryWait: 100 * time.Millisecond})
+	_, err = impatient.SendSMS(context.Background(), sms, "order-2")
+	apiErr, ok = err.(*client.Error)
+	if !assert.True(t, ok, "error %v is not *client.Error", err) {
+		t.FailNow()
+	}
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+
+	// cancelled while waiting to retry
+	withRetries := client.NewClient(ts.URL, client.Config{APIKey: "secret", MaxRetries: 3})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = withRetries.SendSMS(ctx, sms, "order-2")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// retried after the wait
+	start := time.Now()
+	receipt, err := withRetries.SendSMS(context.Background(), sms, "order-2")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "accepted", receipt.Status)
+	assert.True(t, time.Since(start) >= 500*time.Millisecond, "request was retried without waiting")
+}
+
+func TestClient_SendBulkSMS(t *testing.T) {
+	messages := []*client.SMS{
+		{Recipient: "1", Originator: "originator", Message: "message"},
+		{Originator: "originator", Message: "message"},
+	}
+
+	app := &MockedApplication{}
+	app.On("EnqueueSMS", mock.Anything, messages[0]).Return(&types.SMSReceipt{Status: "accepted"}, nil)
+	store := &MockedIdempotencyStore{}
+	store.On("Begin", mock.Anything, "tenant:acme", "batch-1", mock.Anything).Return(nil, nil)
+	store.On("Complete", mock.Anything, "tenant:acme", "batch-1", mock.Anything).Return(nil)
+	store.On("Begin", mock.Anything, "tenant:acme/messages", "batch-1/0", mock.Anything).Return(nil, nil)
+	store.On("Complete", mock.Anything, "tenant:acme/messages", "batch-1/0", mock.Anything).Return(nil)
+	ts := newTestServer(t, app, store, 100)
+	defer ts.Close()
+
+	c := client.NewClient(ts.URL+"/", client.Config{APIKey: "secret"})
+	response, err := c.SendBulkSMS(context.Background(), messages, "batch-1")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.Len(t, response.Results, 2) {
+		t.FailNow()
+	}
+	assert.Equal(t, "accepted", response.Results[0].Status)
+	assert.Equal(t, "rejected", response.Results[1].Status)
+	assert.Nil(t, response.Results[1].Receipt)
+
+	// unauthenticated request
+	anonymous := client.NewClient(ts.URL, client.Config{MaxRetries: 3})
+	_, err = anonymous.SendBulkSMS(context.Background(), messages, "batch-1")
+	apiErr, ok := err.(*client.Error)
+	if !assert.True(t, ok, "error %v is not *client.Error", err) {
+		t.FailNow()
+	}
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, types.ErrorCodeUnauthorized, apiErr.Code())
+}